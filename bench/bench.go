@@ -0,0 +1,420 @@
+// Package bench publishes synthetic events to NATS to measure the throughput of the
+// consumer.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/pkg/ethereum"
+	"github.com/chainbound/valtrack/types"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prysmaticlabs/go-bitfield"
+	"github.com/rs/zerolog"
+)
+
+// streamName is the stream the sentry publishes to.
+const streamName = "EVENTS"
+
+// tickInterval is how often the pacer releases a batch of events.
+const tickInterval = 10 * time.Millisecond
+
+// progressInterval is how often the progress is logged.
+const progressInterval = 5 * time.Second
+
+// DefaultMix is the event mix when none is configured, about the ratio of a mainnet sentry.
+var DefaultMix = map[string]int{
+	types.EventPeerDiscovered:   10,
+	types.EventMetadataReceived: 3,
+	types.EventHandshakeFailed:  1,
+}
+
+// Config configures a benchmark run.
+type Config struct {
+	NatsURL string
+	Nats    config.NatsConfig
+	// Rate is the target number of events published per second.
+	Rate int
+	// Duration is how long events are published for.
+	Duration time.Duration
+	// Mix is the relative weight of every event type.
+	Mix map[string]int
+	// Concurrency is the number of events published at the same time.
+	Concurrency int
+	// Consumer is the durable consumer whose lag is reported. Empty doesn't report it.
+	Consumer string
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *Config) Validate() error {
+	if c.Rate <= 0 {
+		return fmt.Errorf("invalid rate %d: must be positive", c.Rate)
+	}
+
+	if c.Duration <= 0 {
+		return fmt.Errorf("invalid duration %s: must be positive", c.Duration)
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("invalid concurrency %d: must be positive", c.Concurrency)
+	}
+
+	if len(c.Mix) == 0 {
+		return fmt.Errorf("empty event mix")
+	}
+
+	return nil
+}
+
+// ParseMix parses an event mix of `type=weight` entries, e.g. `peer_discovered=10`.
+func ParseMix(specs []string) (map[string]int, error) {
+	mix := make(map[string]int, len(specs))
+
+	for _, spec := range specs {
+		eventType, weightStr, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mix entry %q: must be type=weight", spec)
+		}
+
+		eventType = strings.TrimSpace(eventType)
+		if _, ok := generators[eventType]; !ok {
+			return nil, fmt.Errorf("invalid mix entry %q: unsupported event type %q (%s)", spec, eventType, strings.Join(EventTypes(), ", "))
+		}
+
+		weight, err := strconv.Atoi(strings.TrimSpace(weightStr))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix entry %q: weight must be a non-negative integer", spec)
+		}
+
+		if weight > 0 {
+			mix[eventType] = weight
+		}
+	}
+
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("the event mix has no event type with a positive weight")
+	}
+
+	return mix, nil
+}
+
+// EventTypes returns the event types that can be synthesized.
+func EventTypes() []string {
+	eventTypes := make([]string, 0, len(generators))
+	for eventType := range generators {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	return eventTypes
+}
+
+// ConsumerLag is the state of the durable consumer at the end of a run.
+type ConsumerLag struct {
+	// Pending is the number of messages not delivered to the consumer yet.
+	Pending uint64 `json:"pending"`
+	// AckPending is the number of messages delivered but not acknowledged yet.
+	AckPending int `json:"ack_pending"`
+	// Acked is the number of messages the consumer acknowledged during the run.
+	Acked uint64 `json:"acked"`
+	// AckRate is the number of messages the consumer acknowledged per second during the run.
+	AckRate float64 `json:"ack_rate"`
+}
+
+// Report summarizes a benchmark run.
+type Report struct {
+	DurationSeconds float64           `json:"duration_seconds"`
+	TargetRate      int               `json:"target_rate"`
+	Published       uint64            `json:"published"`
+	Failed          uint64            `json:"failed"`
+	Rate            float64           `json:"rate"`
+	ByType          map[string]uint64 `json:"by_type"`
+	Consumer        *ConsumerLag      `json:"consumer,omitempty"`
+}
+
+// generator returns the event number n of a run, with the subject to publish it on.
+type generator func(runID string, n uint64, rng *rand.Rand) (string, interface{ MsgID() string })
+
+var generators = map[string]generator{
+	types.EventPeerDiscovered:   peerDiscovered,
+	types.EventMetadataReceived: metadataReceived,
+	types.EventHandshakeFailed:  handshakeFailed,
+}
+
+// peerID returns a unique peer ID per event, so no event is dropped as a duplicate.
+func peerID(runID string, n uint64) string {
+	return fmt.Sprintf("bench-%s-%d", runID, n)
+}
+
+func randomIP(rng *rand.Rand) string {
+	return fmt.Sprintf("%d.%d.%d.%d", 1+rng.Intn(223), rng.Intn(256), rng.Intn(256), 1+rng.Intn(254))
+}
+
+func peerDiscovered(runID string, n uint64, rng *rand.Rand) (string, interface{ MsgID() string }) {
+	return types.SubjectPeerDiscovered, &types.PeerDiscoveredEvent{
+		ENR:           "enr:-bench",
+		ID:            peerID(runID, n),
+		IP:            randomIP(rng),
+		Port:          9000,
+		IPVersion:     4,
+		Source:        types.SourceDiscv5,
+		EnrSeq:        int64(1 + rng.Intn(100)),
+		Distance:      254 + rng.Intn(3),
+		CrawlerID:     "bench-" + runID,
+		CrawlerLoc:    "bench",
+		Timestamp:     time.Now().UnixMilli(),
+		SchemaVersion: ethereum.EventSchemaVersion,
+		ObservedAt:    time.Now().UnixMilli(),
+	}
+}
+
+func metadataReceived(runID string, n uint64, rng *rand.Rand) (string, interface{ MsgID() string }) {
+	attnets := bitfield.NewBitvector64()
+	for i := 0; i < 2; i++ {
+		attnets.SetBitAt(uint64(rng.Intn(64)), true)
+	}
+
+	ip := randomIP(rng)
+
+	return types.SubjectMetadataReceived, &types.MetadataReceivedEvent{
+		ENR:        "enr:-bench",
+		ID:         peerID(runID, n),
+		Multiaddr:  "/ip4/" + ip + "/tcp/9000",
+		Multiaddrs: []string{"/ip4/" + ip + "/tcp/9000"},
+		RemoteAddr: "/ip4/" + ip + "/tcp/9000",
+		Direction:  types.DirectionOutbound,
+		Epoch:      -1,
+		MetaData: &types.SimpleMetaData{
+			SeqNumber: int64(1 + rng.Intn(100)),
+			Attnets:   attnets,
+			Syncnets:  bitfield.NewBitvector4(),
+		},
+		SubscribedSubnets: []int64{int64(rng.Intn(64)), int64(rng.Intn(64))},
+		ClientVersion:     "bench/v0.0.0",
+		PingLatencyMs:     int64(rng.Intn(300)),
+		CrawlerID:         "bench-" + runID,
+		CrawlerLoc:        "bench",
+		Timestamp:         time.Now().UnixMilli(),
+		SchemaVersion:     ethereum.EventSchemaVersion,
+		ObservedAt:        time.Now().UnixMilli(),
+	}
+}
+
+func handshakeFailed(runID string, n uint64, rng *rand.Rand) (string, interface{ MsgID() string }) {
+	return types.SubjectHandshakeFailed, &types.HandshakeFailedEvent{
+		ID:             peerID(runID, n),
+		Multiaddr:      "/ip4/" + randomIP(rng) + "/tcp/9000",
+		Reason:         "status",
+		Error:          "synthetic failure",
+		BackoffCounter: 1,
+		CrawlerID:      "bench-" + runID,
+		CrawlerLoc:     "bench",
+		Timestamp:      time.Now().UnixMilli(),
+		SchemaVersion:  ethereum.EventSchemaVersion,
+	}
+}
+
+// picker picks event types at random according to the weights of a mix.
+type picker struct {
+	types   []string
+	cumSums []int
+	total   int
+}
+
+func newPicker(mix map[string]int) *picker {
+	p := &picker{}
+
+	// Sorted, so a seed gives the same sequence of events
+	for _, eventType := range EventTypes() {
+		if weight := mix[eventType]; weight > 0 {
+			p.total += weight
+			p.types = append(p.types, eventType)
+			p.cumSums = append(p.cumSums, p.total)
+		}
+	}
+
+	return p
+}
+
+func (p *picker) pick(rng *rand.Rand) string {
+	r := rng.Intn(p.total)
+	return p.types[sort.SearchInts(p.cumSums, r+1)]
+}
+
+// Run publishes synthetic events at the configured rate until the duration elapsed or the
+// context is cancelled, and returns the achieved throughput. The EVENTS stream must
+// exist, i.e. a sentry must have run against the NATS server before.
+func Run(ctx context.Context, cfg *Config, log zerolog.Logger) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts, err := cfg.Nats.Options()
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS configuration: %w", err)
+	}
+
+	nc, err := nats.Connect(cfg.NatsURL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NATS at %s: %w", cfg.NatsURL, err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("error creating JetStream context: %w", err)
+	}
+
+	if _, err := js.Stream(ctx, streamName); err != nil {
+		return nil, fmt.Errorf("stream %s not found, run a sentry against this NATS server first: %w", streamName, err)
+	}
+
+	var consumer jetstream.Consumer
+	var startAckFloor uint64
+	if cfg.Consumer != "" {
+		if consumer, err = js.Consumer(ctx, streamName, cfg.Consumer); err != nil {
+			return nil, fmt.Errorf("failed to look up consumer %s: %w", cfg.Consumer, err)
+		}
+
+		info, err := consumer.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up consumer %s: %w", cfg.Consumer, err)
+		}
+		startAckFloor = info.AckFloor.Stream
+	}
+
+	runID := uuid.NewString()[:8]
+	log.Info().Str("run_id", runID).Int("rate", cfg.Rate).Dur("duration", cfg.Duration).Any("mix", cfg.Mix).Msg("Starting benchmark")
+
+	var published, failed atomic.Uint64
+	byType := make(map[string]*atomic.Uint64, len(cfg.Mix))
+	for eventType := range cfg.Mix {
+		byType[eventType] = new(atomic.Uint64)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	// The pacer hands out event numbers, the workers generate and publish them
+	jobs := make(chan uint64, cfg.Concurrency)
+	mix := newPicker(cfg.Mix)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewSource(seed))
+			for n := range jobs {
+				eventType := mix.pick(rng)
+				subject, event := generators[eventType](runID, n, rng)
+
+				publishCtx, publishCancel := context.WithTimeout(context.Background(), 3*time.Second)
+				_, err := ethereum.PublishEvent(publishCtx, js, subject, &cfg.Nats, event)
+				publishCancel()
+
+				if err != nil {
+					failed.Add(1)
+					log.Debug().Err(err).Str("subject", subject).Msg("Failed to publish event")
+					continue
+				}
+
+				published.Add(1)
+				byType[eventType].Add(1)
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+
+	start := time.Now()
+	pace(runCtx, cfg.Rate, jobs, func() {
+		elapsed := time.Since(start).Seconds()
+		logger := log.Info().Uint64("published", published.Load()).Uint64("failed", failed.Load()).Float64("rate", float64(published.Load())/elapsed)
+
+		if consumer != nil {
+			if info, err := consumer.Info(ctx); err == nil {
+				logger = logger.Uint64("consumer_pending", info.NumPending).Int("consumer_ack_pending", info.NumAckPending)
+			}
+		}
+
+		logger.Msg("Benchmark progress")
+	})
+
+	close(jobs)
+	wg.Wait()
+
+	elapsed := time.Since(start)
+
+	report := &Report{
+		DurationSeconds: elapsed.Seconds(),
+		TargetRate:      cfg.Rate,
+		Published:       published.Load(),
+		Failed:          failed.Load(),
+		Rate:            float64(published.Load()) / elapsed.Seconds(),
+		ByType:          make(map[string]uint64, len(byType)),
+	}
+
+	for eventType, count := range byType {
+		report.ByType[eventType] = count.Load()
+	}
+
+	if consumer != nil {
+		info, err := consumer.Info(context.Background())
+		if err != nil {
+			return report, fmt.Errorf("failed to look up consumer %s: %w", cfg.Consumer, err)
+		}
+
+		acked := info.AckFloor.Stream - startAckFloor
+		report.Consumer = &ConsumerLag{
+			Pending:    info.NumPending,
+			AckPending: info.NumAckPending,
+			Acked:      acked,
+			AckRate:    float64(acked) / elapsed.Seconds(),
+		}
+	}
+
+	return report, nil
+}
+
+// pace sends event numbers to jobs at `rate` per second until the context is done, and
+// calls progress every progressInterval. If the workers can't keep up, the pacer blocks,
+// so the achieved rate falls below the target instead of queueing events.
+func pace(ctx context.Context, rate int, jobs chan<- uint64, progress func()) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	progressTicker := time.NewTicker(progressInterval)
+	defer progressTicker.Stop()
+
+	start := time.Now()
+
+	var n uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-progressTicker.C:
+			progress()
+		case <-ticker.C:
+			// Release the events due by now, which spreads fractional rates over the ticks
+			due := uint64(time.Since(start).Seconds() * float64(rate))
+			for ; n < due; n++ {
+				select {
+				case jobs <- n:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
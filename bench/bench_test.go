@@ -0,0 +1,49 @@
+package bench
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/chainbound/valtrack/types"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix([]string{"peer_discovered=10", " metadata_received = 3", "handshake_failed=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mix) != 2 || mix[types.EventPeerDiscovered] != 10 || mix[types.EventMetadataReceived] != 3 {
+		t.Fatalf("unexpected mix %v", mix)
+	}
+
+	for _, specs := range [][]string{
+		{"peer_discovered"},
+		{"peer_discovered=-1"},
+		{"heartbeat=1"},
+		{"peer_discovered=0"},
+	} {
+		if _, err := ParseMix(specs); err == nil {
+			t.Errorf("%v: expected an error", specs)
+		}
+	}
+}
+
+func TestPickerFollowsWeights(t *testing.T) {
+	p := newPicker(map[string]int{types.EventPeerDiscovered: 3, types.EventMetadataReceived: 1})
+	rng := rand.New(rand.NewSource(1))
+
+	counts := make(map[string]int)
+	for i := 0; i < 10_000; i++ {
+		counts[p.pick(rng)]++
+	}
+
+	if len(counts) != 2 {
+		t.Fatalf("expected 2 event types, got %v", counts)
+	}
+
+	// 7500 expected, with a generous margin
+	if n := counts[types.EventPeerDiscovered]; n < 7000 || n > 8000 {
+		t.Errorf("expected about 7500 peer_discovered events, got %d", n)
+	}
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/chainbound/valtrack/bench"
+	"github.com/chainbound/valtrack/log"
+	"github.com/urfave/cli/v2"
+)
+
+var BenchCommand = &cli.Command{
+	Name:   "bench",
+	Usage:  "publish synthetic events to NATS to measure the consumer's throughput",
+	Action: runBench,
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "nats-url",
+			Usage:   "NATS server URL (needs JetStream)",
+			Aliases: []string{"n"},
+			Value:   "nats://localhost:4222",
+		},
+		&cli.IntFlag{
+			Name:  "rate",
+			Usage: "Events published per second",
+			Value: 1000,
+		},
+		&cli.DurationFlag{
+			Name:  "duration",
+			Usage: "How long to publish events for",
+			Value: time.Minute,
+		},
+		&cli.StringSliceFlag{
+			Name:  "mix",
+			Usage: "Relative weight of every event type as type=weight, e.g. peer_discovered=10,metadata_received=3 (default peer_discovered=10,metadata_received=3,handshake_failed=1)",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Usage: "Number of events published at the same time",
+			Value: 16,
+		},
+		&cli.StringFlag{
+			Name:  "consumer",
+			Usage: "Name of the durable consumer to report the lag of (empty to only report the publish rate)",
+		},
+		&cli.BoolFlag{
+			Name:  "nats-gzip",
+			Usage: "Compress the published events with gzip",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the report as JSON",
+		},
+	}, natsFlags...),
+}
+
+func runBench(c *cli.Context) error {
+	natsCfg, err := natsConfigFromFlags(c)
+	if err != nil {
+		return err
+	}
+	natsCfg.Gzip = c.Bool("nats-gzip")
+
+	mix := bench.DefaultMix
+	if specs := c.StringSlice("mix"); len(specs) > 0 {
+		if mix, err = bench.ParseMix(specs); err != nil {
+			return err
+		}
+	}
+
+	cfg := bench.Config{
+		NatsURL:     c.String("nats-url"),
+		Nats:        natsCfg,
+		Rate:        c.Int("rate"),
+		Duration:    c.Duration("duration"),
+		Mix:         mix,
+		Concurrency: c.Int("concurrency"),
+		Consumer:    c.String("consumer"),
+	}
+
+	// A signal ends the run early, with a report of what was published so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := bench.Run(ctx, &cfg, log.NewLogger("bench"))
+	if err != nil && report == nil {
+		return err
+	}
+
+	// The report of a run whose consumer lookup failed is printed along with the error
+	if c.Bool("json") {
+		if encErr := json.NewEncoder(os.Stdout).Encode(report); encErr != nil {
+			return encErr
+		}
+		return err
+	}
+
+	fmt.Printf("published %d events in %.1fs: %.0f/s (target %d/s), %d failed\n", report.Published, report.DurationSeconds, report.Rate, report.TargetRate, report.Failed)
+
+	eventTypes := make([]string, 0, len(report.ByType))
+	for eventType := range report.ByType {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	for _, eventType := range eventTypes {
+		fmt.Printf("  %s: %d\n", eventType, report.ByType[eventType])
+	}
+
+	if report.Consumer != nil {
+		fmt.Printf("consumer %s acknowledged %d messages: %.0f/s, %d pending, %d awaiting ack\n", cfg.Consumer, report.Consumer.Acked, report.Consumer.AckRate, report.Consumer.Pending, report.Consumer.AckPending)
+	}
+
+	return err
+}
@@ -1,14 +1,21 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/chainbound/valtrack/clickhouse"
+	"github.com/chainbound/valtrack/config"
 	"github.com/chainbound/valtrack/consumer"
 	"github.com/chainbound/valtrack/discovery"
+	"github.com/chainbound/valtrack/log"
+	"github.com/chainbound/valtrack/pkg/ethereum"
 	"github.com/google/uuid"
 
 	"github.com/rs/zerolog"
@@ -19,7 +26,7 @@ var ConsumerCommand = &cli.Command{
 	Name:   "consumer",
 	Usage:  "run the consumer",
 	Action: runConsumer,
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "log-level",
 			Usage:   "Log level",
@@ -37,6 +44,10 @@ var ConsumerCommand = &cli.Command{
 			Usage: "Consumer name",
 			Value: "consumer-" + uuid.New().String(),
 		},
+		&cli.BoolFlag{
+			Name:  "ephemeral",
+			Usage: "Delete the JetStream consumer on shutdown (always the case without --name, as the random name can't be resumed)",
+		},
 		&cli.StringFlag{
 			Name:  "endpoint",
 			Usage: "Clickhouse server endpoint",
@@ -70,14 +81,138 @@ var ConsumerCommand = &cli.Command{
 			Usage: "Clickhouse max validator batch size",
 			Value: 128,
 		},
-	},
+		&cli.StringFlag{
+			Name:  "output-dir",
+			Usage: "Directory to write the Parquet output files to",
+			Value: ".",
+		},
+		&cli.StringFlag{
+			Name:  "partition-by",
+			Usage: "Partition Parquet output by event timestamp (none, day, hour)",
+			Value: string(consumer.PartitionNone),
+		},
+		&cli.StringFlag{
+			Name:  "shard-by",
+			Usage: "Split Parquet output per sentry (none, crawler_id)",
+			Value: string(consumer.ShardNone),
+		},
+		&cli.BoolFlag{
+			Name:  "manifest",
+			Usage: "Maintain a manifest.json in the output directory listing every completed Parquet file with its time range, row count and schema version",
+		},
+		&cli.IntFlag{
+			Name:  "max-open-writers",
+			Usage: "Number of Parquet files (partitions and shards) each output keeps open, the least recently written one is closed beyond it",
+			Value: consumer.DefaultMaxOpenWriters,
+		},
+		&cli.Int64Flag{
+			Name:  "row-group-size",
+			Usage: "Parquet row group size in bytes, buffered in memory per open file",
+			Value: consumer.DefaultRowGroupSize,
+		},
+		&cli.Int64Flag{
+			Name:  "page-size",
+			Usage: "Parquet page size in bytes",
+			Value: consumer.DefaultPageSize,
+		},
+		&cli.Int64Flag{
+			Name:  "writer-parallelism",
+			Usage: "Number of goroutines each Parquet writer uses to marshal rows",
+			Value: consumer.DefaultWriterParallelism,
+		},
+		&cli.BoolFlag{
+			Name:  "store-raw",
+			Usage: "Store the original payload of every event in a raw column",
+		},
+		&cli.DurationFlag{
+			Name:  "rollup-window",
+			Usage: "Write rollups of the metadata events (distinct peers, per client and per country) every window, aligned to wall-clock time, e.g. 1h (0 to disable)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "rollup-aggregations",
+			Usage: "Aggregations in the rollups (peers, clients, countries)",
+			Value: cli.NewStringSlice(consumer.AllRollupAggregations...),
+		},
+		&cli.BoolFlag{
+			Name:  "rollup-only",
+			Usage: "Only write the rollups of the metadata events, not the raw events",
+		},
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: "Convert the events in this NDJSON file (e.g. a sentry event log) to Parquet instead of consuming from NATS",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-gap",
+			Usage: "Start even if messages after the last acknowledged one were already removed from the stream",
+		},
+		&cli.BoolFlag{
+			Name:  "strict",
+			Usage: "Refuse to start if the durable consumer already exists with a different configuration, instead of updating it",
+		},
+		&cli.DurationFlag{
+			Name:  "drain-timeout",
+			Usage: "How long to keep processing the fetched messages on shutdown before aborting them (0 to abort right away)",
+			Value: 30 * time.Second,
+		},
+		&cli.DurationFlag{
+			Name:  "close-timeout",
+			Usage: "How long each sink (Parquet writer, rollups, InfluxDB) is given to flush and close on shutdown (0 to wait for all of them)",
+			Value: 30 * time.Second,
+		},
+		&cli.StringFlag{
+			Name:  "influx.url",
+			Usage: "Write the handshake, discovery and heartbeat counts to this InfluxDB server for live dashboards, e.g. http://localhost:8086 (empty to disable)",
+		},
+		&cli.StringFlag{
+			Name:  "influx.token",
+			Usage: "InfluxDB API token",
+		},
+		&cli.StringFlag{
+			Name:  "influx.org",
+			Usage: "InfluxDB organization",
+		},
+		&cli.StringFlag{
+			Name:  "influx.bucket",
+			Usage: "InfluxDB bucket",
+			Value: "valtrack",
+		},
+		&cli.IntFlag{
+			Name:  "influx.batch-size",
+			Usage: "Number of points written to InfluxDB at once",
+			Value: consumer.DefaultInfluxBatchSize,
+		},
+		&cli.DurationFlag{
+			Name:  "influx.flush-interval",
+			Usage: "Interval partial batches are written to InfluxDB at",
+			Value: consumer.DefaultInfluxFlushInterval,
+		},
+		&cli.IntFlag{
+			Name:  "backpressure.high-watermark",
+			Usage: "Pause fetching from NATS once this many validator events are queued for the IP lookup or Clickhouse (0 to disable)",
+			Value: consumer.DefaultBackpressureHighWatermark,
+		},
+		&cli.IntFlag{
+			Name:  "backpressure.low-watermark",
+			Usage: "Resume fetching once the paused validator event queues drained to this many events",
+			Value: consumer.DefaultBackpressureLowWatermark,
+		},
+		&cli.StringFlag{
+			Name:  "ack-mode",
+			Usage: "Acknowledge messages without waiting for the server (async), or wait for its confirmation (sync), which is slower but avoids duplicates from lost acks",
+			Value: string(consumer.AckAsync),
+		},
+		&cli.StringFlag{
+			Name:  "report-file",
+			Usage: "Write the shutdown report to this file as JSON (empty to only log it)",
+		},
+	}, natsFlags...),
 }
 
 var SentryCommand = &cli.Command{
 	Name:   "sentry",
 	Usage:  "run the sentry node",
 	Action: runSentry,
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "log-level",
 			Usage:   "log level",
@@ -90,16 +225,399 @@ var SentryCommand = &cli.Command{
 			Aliases: []string{"n"},
 			Value:   "", // If empty URL, run the sentry without NATS
 		},
-	},
+		&cli.DurationFlag{
+			Name:  "nats-dedup-window",
+			Usage: "How long the EVENTS stream remembers message IDs to drop duplicate publishes",
+			Value: 2 * time.Minute,
+		},
+		&cli.IntFlag{
+			Name:  "nats-publish-buffer",
+			Usage: "Number of events kept while disconnected from NATS and published once reconnected, the oldest are dropped beyond it",
+			Value: 10000,
+		},
+		&cli.IntFlag{
+			Name:  "nats-breaker-threshold",
+			Usage: "Consecutive NATS publish failures after which publishing stops for --nats-breaker-cooldown, dropping the events (0 to disable)",
+			Value: 5,
+		},
+		&cli.DurationFlag{
+			Name:  "nats-breaker-cooldown",
+			Usage: "How long publishing stops once the NATS circuit breaker opened, before trying again with a single event",
+			Value: 30 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:  "nats-gzip",
+			Usage: "Gzip the payload of published events, e.g. for bandwidth-metered NATS clusters",
+		},
+		&cli.StringSliceFlag{
+			Name:  "stream-subjects",
+			Usage: "Subjects of the EVENTS stream",
+			Value: cli.NewStringSlice(config.DefaultStreamSubjects...),
+		},
+		&cli.StringFlag{
+			Name:  "stream-retention",
+			Usage: "Retention policy of the EVENTS stream (limits, interest or workqueue)",
+			Value: "interest",
+		},
+		&cli.DurationFlag{
+			Name:  "stream-max-age",
+			Usage: "Maximum age of the messages in the EVENTS stream (0 for unlimited)",
+		},
+		&cli.Int64Flag{
+			Name:  "stream-max-bytes",
+			Usage: "Maximum size of the EVENTS stream in bytes (0 for unlimited)",
+		},
+		&cli.IntFlag{
+			Name:  "stream-replicas",
+			Usage: "Number of replicas of the EVENTS stream in a NATS cluster",
+			Value: 1,
+		},
+		&cli.StringFlag{
+			Name:  "metadata-log",
+			Usage: "File to write metadata_received events to as NDJSON when running without NATS (empty to disable)",
+			Value: config.DefaultNodeConfig.LogPath,
+		},
+		&cli.StringFlag{
+			Name:  "discovery-log",
+			Usage: "File to write peer_discovered events to as NDJSON when running without NATS (empty to disable)",
+			Value: config.DefaultNodeConfig.DiscLogPath,
+		},
+		&cli.BoolFlag{
+			Name:  "disable-file-log",
+			Usage: "Don't write events to --metadata-log and --discovery-log, e.g. for high-throughput crawls without NATS that don't need them",
+		},
+		&cli.StringFlag{
+			Name:  "event-socket",
+			Usage: "Unix socket to serve all events on as NDJSON to a sidecar, instead of the log files (can't be combined with NATS)",
+		},
+		&cli.IntFlag{
+			Name:  "max-peers",
+			Usage: "Maximum number of connected peers (0 for unlimited)",
+			Value: config.DefaultNodeConfig.MaxPeers,
+		},
+		&cli.StringFlag{
+			Name:  "eviction-policy",
+			Usage: "What to do with new connections at the peer limit: 'oldest' (evict the least recently updated peer) or 'reject'",
+			Value: config.DefaultNodeConfig.EvictionPolicy,
+		},
+		&cli.StringFlag{
+			Name:  "dial-strategy",
+			Usage: "Order in which discovered peers are dialed: 'attnets' (most attestation subnets first) or 'fifo' (discovery order)",
+			Value: config.DefaultNodeConfig.DialStrategy,
+		},
+		&cli.IntFlag{
+			Name:  "dial-addrs-per-peer",
+			Usage: "Number of addresses of a peer to try, public ones first, until a handshake succeeds",
+			Value: config.DefaultNodeConfig.DialAddrsPerPeer,
+		},
+		&cli.StringFlag{
+			Name:  "attnets",
+			Usage: "Attestation subnets advertised in the ENR and metadata: 'all', 'none' or a comma-separated list of subnets (0-63)",
+			Value: config.DefaultNodeConfig.Attnets,
+		},
+		&cli.StringFlag{
+			Name:  "syncnets",
+			Usage: "Sync committee subnets advertised in the ENR and metadata: 'all', 'none' or a comma-separated list of subnets (0-3)",
+			Value: config.DefaultNodeConfig.Syncnets,
+		},
+		&cli.DurationFlag{
+			Name:  "discovery-dedup-window",
+			Usage: "Also report a rediscovered peer again after this window since it was last reported (0 to report every peer once, and again only when its ENR changed)",
+			Value: config.DefaultNodeConfig.DiscoveryDedupWindow,
+		},
+		&cli.DurationFlag{
+			Name:  "discovery-watchdog",
+			Usage: "Restart the discv5 walk if it found no new peer within this window (0 to disable)",
+			Value: config.DefaultNodeConfig.DiscoveryWatchdog,
+		},
+		&cli.IntFlag{
+			Name:  "metadata-cache-size",
+			Usage: "Maximum number of peers to keep status and metadata for, least recently seen are evicted first (0 for unlimited)",
+			Value: config.DefaultNodeConfig.MetadataCacheSize,
+		},
+		&cli.IntFlag{
+			Name:  "backoff-cache-size",
+			Usage: "Maximum number of backed off peers to keep retrying, least recently failed are forgotten first (0 for unlimited)",
+			Value: config.DefaultNodeConfig.BackoffCacheSize,
+		},
+		&cli.StringFlag{
+			Name:  "cache-path",
+			Usage: "File to persist the peer handshake state to, so it survives restarts (empty to keep it in memory)",
+			Value: config.DefaultNodeConfig.CachePath,
+		},
+		&cli.DurationFlag{
+			Name:  "cache-ttl",
+			Usage: "How long peers are kept in the peer cache after they were last seen",
+			Value: config.DefaultNodeConfig.CacheTTL,
+		},
+		&cli.StringSliceFlag{
+			Name:  "listen-addrs",
+			Usage: "libp2p multiaddrs to listen on (default /ip4/0.0.0.0/tcp/9000)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "announce-addrs",
+			Usage: "libp2p multiaddrs to advertise to peers instead of the listen addresses, e.g. a public address behind NAT",
+		},
+		&cli.BoolFlag{
+			Name:  "enable-nat",
+			Usage: "Try to open the libp2p port on the router with UPnP / NAT-PMP",
+			Value: config.DefaultNodeConfig.EnableNAT,
+		},
+		&cli.BoolFlag{
+			Name:  "keep-connected",
+			Usage: "Stay connected to peers after a successful handshake instead of disconnecting them (bound with --max-peers)",
+			Value: config.DefaultNodeConfig.KeepConnected,
+		},
+		&cli.StringFlag{
+			Name:  "peers-file",
+			Usage: "File with ENRs or multiaddrs (one per line) to dial instead of discovering peers with discv5",
+		},
+		&cli.BoolFlag{
+			Name:  "redial-on-disconnect",
+			Usage: "Redial peers that disconnect from us after a successful handshake (use with --keep-connected)",
+		},
+		&cli.IntFlag{
+			Name:  "max-redials",
+			Usage: "Number of redials of a disconnected peer before giving up on it",
+			Value: config.DefaultNodeConfig.MaxRedials,
+		},
+		&cli.BoolFlag{
+			Name:  "accept-inbound",
+			Usage: "Handshake with peers that connect to us (set to false for an outbound-only crawler)",
+			Value: config.DefaultNodeConfig.AcceptInbound,
+		},
+		&cli.BoolFlag{
+			Name:  "dial-outbound",
+			Usage: "Dial discovered peers (set to false for inbound-only, passive monitoring)",
+			Value: config.DefaultNodeConfig.DialOutbound,
+		},
+		&cli.IntFlag{
+			Name:  "expected-peers",
+			Usage: "Expected number of peers in this run, to size a bloom filter of handshaked peers that skips redialing them (0 to disable)",
+			Value: config.DefaultNodeConfig.ExpectedPeers,
+		},
+		&cli.Float64Flag{
+			Name:  "peer-filter-fp-rate",
+			Usage: "False positive rate of the handshaked peers filter at --expected-peers (false positives are never dialed)",
+			Value: config.DefaultNodeConfig.PeerFilterFPRate,
+		},
+		&cli.IntFlag{
+			Name:  "unique-peers-precision",
+			Usage: "Estimate the distinct peers that connected with a HyperLogLog of 2^p bytes, between 4 and 18, with a standard error of 1.04/sqrt(2^p) (0 to disable)",
+		},
+		&cli.StringFlag{
+			Name:  "beacon-api",
+			Usage: "Beacon node API (e.g. http://localhost:5052) to take the head and finalized checkpoint of our status from (empty to compute the head slot from the clock)",
+		},
+		&cli.DurationFlag{
+			Name:  "status-interval",
+			Usage: "Interval the status is refreshed at from the beacon API or the clock (0 to only set it on startup)",
+			Value: config.DefaultNodeConfig.StatusInterval,
+		},
+		&cli.DurationFlag{
+			Name:  "beacon-peers-interval",
+			Usage: "Interval the peers of the --beacon-api node are polled at, to flag them in the metadata events (0 to disable)",
+			Value: config.DefaultNodeConfig.BeaconPeersInterval,
+		},
+		&cli.BoolFlag{
+			Name:  "gossip-px",
+			Usage: "Join gossipsub with peer exchange, without subscribing to any topic, and publish the peers learned from PX as peer_discovered events",
+		},
+		&cli.StringFlag{
+			Name:  "ntp-server",
+			Usage: "NTP server to measure the clock offset recorded in events against (empty to disable)",
+			Value: config.DefaultNodeConfig.NTPServer,
+		},
+		&cli.DurationFlag{
+			Name:  "diversity-interval",
+			Usage: "Interval of the client diversity snapshots of the handshaked peers, e.g. 10m (0 to disable)",
+			Value: config.DefaultNodeConfig.DiversityInterval,
+		},
+		&cli.IntFlag{
+			Name:  "handshake-retries",
+			Usage: "Number of times a handshake request (status, ping or metadata) is retried when the peer resets the stream",
+			Value: config.DefaultNodeConfig.HandshakeRetries,
+		},
+		&cli.DurationFlag{
+			Name:  "handshake-retry-delay",
+			Usage: "Delay before retrying a handshake request",
+			Value: config.DefaultNodeConfig.HandshakeRetryDelay,
+		},
+		&cli.DurationFlag{
+			Name:  "metadata-cooldown",
+			Usage: "Minimum interval between metadata requests to the same peer, reusing the previous metadata within it (0 to disable)",
+			Value: config.DefaultNodeConfig.MetadataCooldown,
+		},
+		&cli.DurationFlag{
+			Name:  "heartbeat-interval",
+			Usage: "Interval of the heartbeat events that show the sentry is up (0 to disable)",
+			Value: config.DefaultNodeConfig.HeartbeatInterval,
+		},
+		&cli.StringFlag{
+			Name:  "disc-table-file",
+			Usage: "Append a snapshot of the discv5 routing table (bucket occupancy and ENRs) to this file as NDJSON every --disc-table-interval (empty to disable)",
+		},
+		&cli.DurationFlag{
+			Name:  "disc-table-interval",
+			Usage: "Interval of the discv5 routing table snapshots",
+			Value: config.DefaultNodeConfig.DiscTableInterval,
+		},
+		&cli.StringFlag{
+			Name:  "redact-ip",
+			Usage: "Redact the IP of peer_discovered events: truncate (zero the last IPv4 octet, keep the IPv6 /48) or hmac (keyed with --redact-key-file) (empty to keep it)",
+		},
+		&cli.StringFlag{
+			Name:  "redact-enr",
+			Usage: "Redact the ENR of peer_discovered events, which includes the IP: drop (empty to keep it)",
+		},
+		&cli.StringFlag{
+			Name:  "redact-port",
+			Usage: "Redact the port of peer_discovered events: drop (empty to keep it)",
+		},
+		&cli.StringFlag{
+			Name:  "redact-key-file",
+			Usage: "File with the HMAC key of --redact-ip hmac",
+		},
+		&cli.BoolFlag{
+			Name:  "record-handshake-failures",
+			Usage: "Publish a handshake_failed event for every failed handshake with a dialed peer",
+		},
+		&cli.BoolFlag{
+			Name:  "record-fork-mismatches",
+			Usage: "Publish a handshake_failed event for every peer on another fork, dialed or inbound",
+		},
+		&cli.StringSliceFlag{
+			Name:  "accepted-fork-digests",
+			Usage: "Hex-encoded fork digests peers are also accepted on, besides the current one, e.g. around a fork transition",
+		},
+		&cli.BoolFlag{
+			Name:  "accept-next-fork-digest",
+			Usage: "Also accept peers on the fork digest of the next fork scheduled in the network config",
+			Value: config.DefaultNodeConfig.AcceptNextForkDigest,
+		},
+		&cli.BoolFlag{
+			Name:  "metadata-on-status-failure",
+			Usage: "Still request the metadata of dialed peers whose status request failed, and publish it as a partial metadata_received event",
+		},
+		&cli.IntFlag{
+			Name:  "suspicious-peer-threshold",
+			Usage: "Publish a suspicious_peer event when a public IP serves this many peer IDs within --suspicious-peer-window, some on the same port (0 to disable)",
+		},
+		&cli.DurationFlag{
+			Name:  "suspicious-peer-window",
+			Usage: "Window the peer IDs of an IP are counted over for --suspicious-peer-threshold",
+			Value: config.DefaultNodeConfig.SuspiciousPeerWindow,
+		},
+		&cli.BoolFlag{
+			Name:  "peer-churn-events",
+			Usage: "Publish a peer_churn event whenever the first connection to a peer opens or its last one closes",
+		},
+		&cli.DurationFlag{
+			Name:  "peerstore-addr-ttl",
+			Usage: "How long the libp2p peerstore keeps the addresses of a disconnected peer",
+			Value: config.DefaultNodeConfig.PeerstoreAddrTTL,
+		},
+		&cli.DurationFlag{
+			Name:  "peerstore-record-ttl",
+			Usage: "How long the libp2p peerstore keeps the other records (keys, protocols, agent version) of a disconnected peer",
+			Value: config.DefaultNodeConfig.PeerstoreRecordTTL,
+		},
+		&cli.DurationFlag{
+			Name:  "peerstore-gc-interval",
+			Usage: "Interval of the libp2p peerstore garbage collection that applies the peerstore TTLs (0 to disable)",
+			Value: config.DefaultNodeConfig.PeerstoreGCInterval,
+		},
+		&cli.IntFlag{
+			Name:  "rcmgr-max-conns",
+			Usage: "Maximum number of connections of the libp2p host (0 for the libp2p default, scaled to the machine)",
+		},
+		&cli.IntFlag{
+			Name:  "rcmgr-max-streams",
+			Usage: "Maximum number of streams of the libp2p host (0 for the libp2p default, scaled to the machine)",
+		},
+		&cli.IntFlag{
+			Name:  "rcmgr-max-memory-mb",
+			Usage: "Maximum memory in MB reserved by the libp2p host (0 for the libp2p default, scaled to the machine)",
+		},
+		&cli.StringFlag{
+			Name:  "identity-key",
+			Usage: "File with the node's private key, generated on the first run, for a stable peer ID and ENR (empty for a new key on every start)",
+		},
+		&cli.BoolFlag{
+			Name:  "disable-resource-manager",
+			Usage: "Don't limit the connections, streams and memory of the libp2p host",
+		},
+		&cli.DurationFlag{
+			Name:  "max-runtime",
+			Usage: "Shut down gracefully after running for this long, e.g. for scheduled crawls (0 to run until stopped)",
+		},
+		&cli.StringFlag{
+			Name:  "stats-addr",
+			Usage: "Address to serve a JSON summary of the crawl (/stats) and the local node (/self) on, e.g. :9091 (empty to disable)",
+		},
+		&cli.StringFlag{
+			Name:  "http-addr",
+			Usage: "Address to serve Prometheus metrics (/metrics) and the log level endpoint (/loglevel) on (empty to disable)",
+			Value: ":9090",
+		},
+		&cli.StringFlag{
+			Name:  "report-file",
+			Usage: "Write the shutdown report to this file as JSON (empty to only log it)",
+		},
+	}, natsFlags...),
 }
 
 func runConsumer(c *cli.Context) error {
+	partitionBy, err := consumer.ParsePartitionBy(c.String("partition-by"))
+	if err != nil {
+		return err
+	}
+
+	shardBy, err := consumer.ParseShardBy(c.String("shard-by"))
+	if err != nil {
+		return err
+	}
+
+	ackMode, err := consumer.ParseAckMode(c.String("ack-mode"))
+	if err != nil {
+		return err
+	}
+
+	natsCfg, err := natsConfigFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	outputDir := c.String("output-dir")
+	if err := consumer.PrepareOutputDir(outputDir); err != nil {
+		return err
+	}
+
+	var manifest *consumer.Manifest
+	if c.Bool("manifest") {
+		if manifest, err = consumer.OpenManifest(outputDir); err != nil {
+			return err
+		}
+	}
+
 	cfg := consumer.ConsumerConfig{
 		LogLevel:      c.String("log-level"),
 		NatsURL:       c.String("nats-url"),
+		NatsCfg:       natsCfg,
 		Name:          c.String("name"),
 		DuneNamespace: c.String("dune.namespace"),
 		DuneApiKey:    c.String("dune.api-key"),
+		WriterCfg: consumer.WriterConfig{
+			Dir:            outputDir,
+			Prefix:         c.String("name"),
+			PartitionBy:    partitionBy,
+			ShardBy:        shardBy,
+			MaxOpenWriters: c.Int("max-open-writers"),
+			Manifest:       manifest,
+			RowGroupSize:   c.Int64("row-group-size"),
+			PageSize:       c.Int64("page-size"),
+			Parallelism:    c.Int64("writer-parallelism"),
+		},
 		ChCfg: clickhouse.ClickhouseConfig{
 			Endpoint:              c.String("endpoint"),
 			DB:                    c.String("db"),
@@ -107,38 +625,252 @@ func runConsumer(c *cli.Context) error {
 			Password:              c.String("password"),
 			MaxValidatorBatchSize: c.Uint64("batch-size"),
 		},
+		AllowGap:     c.Bool("allow-gap"),
+		Strict:       c.Bool("strict"),
+		Input:        c.String("input"),
+		StoreRaw:     c.Bool("store-raw"),
+		DrainTimeout: c.Duration("drain-timeout"),
+		CloseTimeout: c.Duration("close-timeout"),
+		Ephemeral:    c.Bool("ephemeral") || !c.IsSet("name"),
+		AckMode:      ackMode,
+		Influx: consumer.InfluxConfig{
+			URL:           c.String("influx.url"),
+			Token:         c.String("influx.token"),
+			Org:           c.String("influx.org"),
+			Bucket:        c.String("influx.bucket"),
+			BatchSize:     c.Int("influx.batch-size"),
+			FlushInterval: c.Duration("influx.flush-interval"),
+		},
+		Backpressure: consumer.BackpressureConfig{
+			HighWatermark: c.Int("backpressure.high-watermark"),
+			LowWatermark:  c.Int("backpressure.low-watermark"),
+		},
+		Rollup: consumer.RollupConfig{
+			Window:       c.Duration("rollup-window"),
+			Aggregations: c.StringSlice("rollup-aggregations"),
+			Only:         c.Bool("rollup-only"),
+		},
+	}
+
+	if err := cfg.WriterCfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Rollup.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Influx.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Backpressure.Validate(); err != nil {
+		return err
 	}
 
 	level, _ := zerolog.ParseLevel(cfg.LogLevel)
 	zerolog.SetGlobalLevel(level)
 
-	consumer.RunConsumer(&cfg)
-	return nil
+	report, err := consumer.RunConsumer(c.Context, &cfg)
+	if report != nil && c.String("report-file") != "" {
+		if err := writeReport(c.String("report-file"), report); err != nil {
+			return err
+		}
+	}
+
+	return err
 }
 
 func runSentry(c *cli.Context) error {
 	level, _ := zerolog.ParseLevel(c.String("log-level"))
 	zerolog.SetGlobalLevel(level)
 
-	disc, err := discovery.NewDiscovery(c.String("nats-url"))
+	natsCfg, err := natsConfigFromFlags(c)
+	if err != nil {
+		return err
+	}
+	natsCfg.DedupWindow = c.Duration("nats-dedup-window")
+	natsCfg.Gzip = c.Bool("nats-gzip")
+	natsCfg.PublishBuffer = c.Int("nats-publish-buffer")
+	natsCfg.BreakerThreshold = c.Int("nats-breaker-threshold")
+	natsCfg.BreakerCooldown = c.Duration("nats-breaker-cooldown")
+	natsCfg.Stream = config.StreamConfig{
+		Subjects:  c.StringSlice("stream-subjects"),
+		Retention: c.String("stream-retention"),
+		MaxAge:    c.Duration("stream-max-age"),
+		MaxBytes:  c.Int64("stream-max-bytes"),
+		Replicas:  c.Int("stream-replicas"),
+	}
+	if err := natsCfg.Validate(); err != nil {
+		return err
+	}
+
+	nodeConfig := config.DefaultNodeConfig
+	nodeConfig.NatsURL = c.String("nats-url")
+	nodeConfig.Nats = natsCfg
+	nodeConfig.LogPath = c.String("metadata-log")
+	nodeConfig.DiscLogPath = c.String("discovery-log")
+	nodeConfig.DisableFileLog = c.Bool("disable-file-log")
+	nodeConfig.EventSocket = c.String("event-socket")
+	nodeConfig.MaxPeers = c.Int("max-peers")
+	nodeConfig.EvictionPolicy = c.String("eviction-policy")
+	nodeConfig.DialStrategy = c.String("dial-strategy")
+	nodeConfig.DiscoveryDedupWindow = c.Duration("discovery-dedup-window")
+	nodeConfig.DiscoveryWatchdog = c.Duration("discovery-watchdog")
+	nodeConfig.DialAddrsPerPeer = c.Int("dial-addrs-per-peer")
+	nodeConfig.Attnets = c.String("attnets")
+	nodeConfig.Syncnets = c.String("syncnets")
+	nodeConfig.MetadataCacheSize = c.Int("metadata-cache-size")
+	nodeConfig.BackoffCacheSize = c.Int("backoff-cache-size")
+	nodeConfig.CachePath = c.String("cache-path")
+	nodeConfig.CacheTTL = c.Duration("cache-ttl")
+	nodeConfig.KeepConnected = c.Bool("keep-connected")
+	nodeConfig.ListenAddrs = c.StringSlice("listen-addrs")
+	nodeConfig.AnnounceAddrs = c.StringSlice("announce-addrs")
+	nodeConfig.EnableNAT = c.Bool("enable-nat")
+	nodeConfig.PeersFile = c.String("peers-file")
+	nodeConfig.RedialOnDisconnect = c.Bool("redial-on-disconnect")
+	nodeConfig.MaxRedials = c.Int("max-redials")
+	nodeConfig.NTPServer = c.String("ntp-server")
+	nodeConfig.BeaconAPI = c.String("beacon-api")
+	nodeConfig.StatusInterval = c.Duration("status-interval")
+	nodeConfig.BeaconPeersInterval = c.Duration("beacon-peers-interval")
+	nodeConfig.GossipPX = c.Bool("gossip-px")
+	nodeConfig.DiversityInterval = c.Duration("diversity-interval")
+	nodeConfig.HandshakeRetries = c.Int("handshake-retries")
+	nodeConfig.HandshakeRetryDelay = c.Duration("handshake-retry-delay")
+	nodeConfig.MetadataCooldown = c.Duration("metadata-cooldown")
+	nodeConfig.HeartbeatInterval = c.Duration("heartbeat-interval")
+	nodeConfig.DiscTablePath = c.String("disc-table-file")
+	nodeConfig.DiscTableInterval = c.Duration("disc-table-interval")
+	nodeConfig.Redaction = config.RedactionConfig{
+		IP:   c.String("redact-ip"),
+		ENR:  c.String("redact-enr"),
+		Port: c.String("redact-port"),
+	}
+	nodeConfig.RecordHandshakeFailures = c.Bool("record-handshake-failures")
+	nodeConfig.RecordForkMismatches = c.Bool("record-fork-mismatches")
+	nodeConfig.AcceptNextForkDigest = c.Bool("accept-next-fork-digest")
+	nodeConfig.MetadataOnStatusFailure = c.Bool("metadata-on-status-failure")
+	nodeConfig.SuspiciousPeerThreshold = c.Int("suspicious-peer-threshold")
+	nodeConfig.SuspiciousPeerWindow = c.Duration("suspicious-peer-window")
+	nodeConfig.PeerChurnEvents = c.Bool("peer-churn-events")
+	nodeConfig.PeerstoreAddrTTL = c.Duration("peerstore-addr-ttl")
+	nodeConfig.PeerstoreRecordTTL = c.Duration("peerstore-record-ttl")
+	nodeConfig.PeerstoreGCInterval = c.Duration("peerstore-gc-interval")
+	nodeConfig.ResourceMaxConns = c.Int("rcmgr-max-conns")
+	nodeConfig.ResourceMaxStreams = c.Int("rcmgr-max-streams")
+	nodeConfig.ResourceMaxMemoryMB = c.Int("rcmgr-max-memory-mb")
+	nodeConfig.DisableResourceManager = c.Bool("disable-resource-manager")
+	nodeConfig.IdentityKeyPath = c.String("identity-key")
+	nodeConfig.AcceptInbound = c.Bool("accept-inbound")
+	nodeConfig.DialOutbound = c.Bool("dial-outbound")
+	nodeConfig.ExpectedPeers = c.Int("expected-peers")
+	nodeConfig.PeerFilterFPRate = c.Float64("peer-filter-fp-rate")
+	nodeConfig.UniquePeersPrecision = c.Int("unique-peers-precision")
+
+	if path := c.String("redact-key-file"); path != "" {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read the redaction key: %w", err)
+		}
+		nodeConfig.Redaction.Key = bytes.TrimSpace(key)
+	}
+	if err := nodeConfig.Redaction.Validate(); err != nil {
+		return err
+	}
+
+	for _, s := range c.StringSlice("accepted-fork-digests") {
+		digest, err := config.ParseForkDigest(s)
+		if err != nil {
+			return err
+		}
+		nodeConfig.AcceptedForkDigests = append(nodeConfig.AcceptedForkDigests, digest)
+	}
+
+	// Fail on invalid multiaddrs before starting anything
+	for _, addrs := range [][]string{nodeConfig.ListenAddrs, nodeConfig.AnnounceAddrs} {
+		if _, err := ethereum.ParseMaddrs(addrs); err != nil {
+			return err
+		}
+	}
+
+	if addr := c.String("http-addr"); addr != "" {
+		go serveHTTP(addr)
+	}
+
+	disc, err := discovery.NewDiscovery(&nodeConfig, nil)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create the sentry: %w", err)
+	}
+
+	if addr := c.String("stats-addr"); addr != "" {
+		go serveStats(addr, disc.StatsHandler, disc.SelfHandler, disc.DiscTableHandler)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	defer cancel()
 
+	// startErr is set before done is closed
+	var startErr error
+	done := make(chan struct{})
 	go func() {
-		if err := disc.Start(ctx); err != nil {
-			panic(err)
-		}
+		defer close(done)
+
+		startErr = disc.Start(ctx)
 	}()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-	<-quit
+	// A nil channel never fires, so without --max-runtime we only wait for a signal
+	var deadline <-chan time.Time
+	if maxRuntime := c.Duration("max-runtime"); maxRuntime > 0 {
+		timer := time.NewTimer(maxRuntime)
+		defer timer.Stop()
+
+		deadline = timer.C
+	}
+
+	logger := log.NewLogger("sentry")
+
+	var reason string
+	select {
+	case <-quit:
+		logger.Info().Msg("Received shutdown signal")
+		reason = "signal"
+	case <-deadline:
+		logger.Info().Dur("max_runtime", c.Duration("max-runtime")).Msg("Max runtime reached, shutting down")
+		reason = "max_runtime"
+	case <-done:
+		if startErr == nil {
+			return errors.New("sentry stopped unexpectedly")
+		}
+		return fmt.Errorf("sentry stopped: %w", startErr)
+	}
+
+	// Stop the node and wait for it to publish the events left to NATS and close its event
+	// logs
+	cancel()
+	<-done
+	if startErr != nil {
+		return fmt.Errorf("sentry stopped: %w", startErr)
+	}
+
+	report := sentryReport{CrawlStats: disc.Stats(), StoppedAt: time.Now(), Reason: reason}
+	logger.Info().
+		Str("reason", report.Reason).
+		Time("started_at", report.StartedAt).
+		Int64("uptime_seconds", report.UptimeSeconds).
+		Uint64("peers_discovered", report.PeersDiscovered).
+		Uint64("handshake_successes", report.HandshakeSuccesses).
+		Uint64("handshake_failures", report.HandshakeFailures).
+		Msg("Shutdown report")
+
+	if path := c.String("report-file"); path != "" {
+		return writeReport(path, report)
+	}
 
 	return nil
 }
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chainbound/valtrack/consumer"
+	"github.com/urfave/cli/v2"
+)
+
+var CompactCommand = &cli.Command{
+	Name:      "compact",
+	Usage:     "merge and deduplicate the Parquet files of a consumer output",
+	ArgsUsage: "<dir> <out.parquet>",
+	Action:    runCompact,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "type",
+			Usage:    "Output to compact (discovery_events, metadata_events, validator_metadata_events, attnets_changed_events, heartbeat_events, handshake_failed_events, suspicious_peer_events or peer_churn_events)",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "key",
+			Usage: "Columns that identify duplicate rows, of which only the first is kept",
+			Value: cli.NewStringSlice(consumer.DefaultCompactKey...),
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the report as JSON",
+		},
+	},
+}
+
+func runCompact(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("usage: valtrack compact --type <output> <dir> <out.parquet>")
+	}
+
+	dir, out := c.Args().Get(0), c.Args().Get(1)
+
+	name := c.String("type")
+	if _, ok := consumer.OutputSchemas[name]; !ok {
+		return fmt.Errorf("unknown output type %q", name)
+	}
+
+	files, err := consumer.CompactFiles(dir, name)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+
+	// Don't read a previous compaction into the new one
+	if abs, err := filepath.Abs(out); err == nil {
+		files = slices.DeleteFunc(files, func(f string) bool {
+			fAbs, err := filepath.Abs(f)
+			return err == nil && fAbs == abs
+		})
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no %s parquet files in %s", name, dir)
+	}
+
+	stats, err := consumer.Compact(name, files, out, c.StringSlice("key"))
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(stats)
+	}
+
+	fmt.Printf("compacted %d files into %s (key: %s)\n", stats.Files, out, strings.Join(c.StringSlice("key"), ", "))
+	fmt.Printf("rows in: %d, rows out: %d, duplicates: %d\n", stats.RowsIn, stats.RowsOut, stats.Duplicates)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/chainbound/valtrack/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveStats serves the crawl summary on /stats, the local node on /self and its discv5
+// routing table on /disctable on the given address.
+func serveStats(addr string, stats, self, discTable http.HandlerFunc) {
+	logger := log.NewLogger("http")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", stats)
+	mux.HandleFunc("/self", self)
+	mux.HandleFunc("/disctable", discTable)
+
+	logger.Info().Str("addr", addr).Msg("Serving stats endpoint")
+
+	if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
+		logger.Error().Err(err).Msg("Stats server stopped")
+	}
+}
+
+// serveHTTP serves the Prometheus metrics and the admin endpoints on the given address.
+func serveHTTP(addr string) {
+	logger := log.NewLogger("http")
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/loglevel", log.LevelHandler)
+
+	logger.Info().Str("addr", addr).Msg("Serving HTTP endpoints")
+
+	if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
+		logger.Error().Err(err).Msg("HTTP server stopped")
+	}
+}
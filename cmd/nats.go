@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/types"
+	"github.com/urfave/cli/v2"
+)
+
+// natsFlags are the NATS authentication and TLS flags shared by the sentry and consumer.
+var natsFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "nats-creds",
+		Usage: "NATS user credentials (JWT) file",
+	},
+	&cli.StringFlag{
+		Name:  "nats-nkey",
+		Usage: "NATS NKey seed file",
+	},
+	&cli.StringFlag{
+		Name:  "nats-token",
+		Usage: "NATS authentication token",
+	},
+	&cli.StringFlag{
+		Name:  "nats-tls-ca",
+		Usage: "CA certificate to verify the NATS server with",
+	},
+	&cli.StringFlag{
+		Name:  "nats-tls-cert",
+		Usage: "Client certificate for NATS mutual TLS",
+	},
+	&cli.StringFlag{
+		Name:  "nats-tls-key",
+		Usage: "Client key for NATS mutual TLS",
+	},
+	&cli.DurationFlag{
+		Name:  "nats-reconnect-wait",
+		Usage: "Delay before the first reconnect attempt to NATS, doubled on every further attempt",
+		Value: time.Second,
+	},
+	&cli.DurationFlag{
+		Name:  "nats-reconnect-max-wait",
+		Usage: "Maximum delay between reconnect attempts to NATS",
+		Value: 30 * time.Second,
+	},
+	&cli.IntFlag{
+		Name:  "nats-max-reconnects",
+		Usage: "Number of reconnect attempts to NATS before giving up (-1 for unlimited)",
+		Value: -1,
+	},
+	&cli.StringFlag{
+		Name:  "wire-format",
+		Usage: "Encoding of the events on NATS (json, protobuf or compact). The consumer detects it per message and uses this for messages without a format header",
+		Value: string(types.WireFormatJSON),
+	},
+}
+
+func natsConfigFromFlags(c *cli.Context) (config.NatsConfig, error) {
+	cfg := config.NatsConfig{
+		CredsFile:  c.String("nats-creds"),
+		NKeyFile:   c.String("nats-nkey"),
+		Token:      c.String("nats-token"),
+		TLSCA:      c.String("nats-tls-ca"),
+		TLSCert:    c.String("nats-tls-cert"),
+		TLSKey:     c.String("nats-tls-key"),
+		WireFormat: types.WireFormat(c.String("wire-format")),
+
+		ReconnectWait:    c.Duration("nats-reconnect-wait"),
+		ReconnectMaxWait: c.Duration("nats-reconnect-max-wait"),
+		MaxReconnects:    c.Int("nats-max-reconnects"),
+	}
+
+	return cfg, cfg.Validate()
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/discovery"
+	"github.com/chainbound/valtrack/pkg/ethereum"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+var ProbeCommand = &cli.Command{
+	Name:      "probe",
+	Usage:     "handshake a single peer and print the result",
+	ArgsUsage: "<enr-or-multiaddr>",
+	Action:    runProbe,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "log-level",
+			Usage:   "Log level",
+			Aliases: []string{"l"},
+			Value:   "warn",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "Timeout of the whole handshake, from dialing the peer to its metadata",
+			Value: config.DefaultNodeConfig.DialTimeout,
+		},
+		&cli.StringFlag{
+			Name:  "beacon-api",
+			Usage: "Beacon node API (e.g. http://localhost:5052) to take the head and finalized checkpoint of our status from (empty to compute the head slot from the clock)",
+		},
+		&cli.StringFlag{
+			Name:  "identity-key",
+			Usage: "Path to the secp256k1 identity key to probe with (empty for a random one)",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the result as JSON",
+		},
+	},
+}
+
+func runProbe(c *cli.Context) error {
+	level, _ := zerolog.ParseLevel(c.String("log-level"))
+	zerolog.SetGlobalLevel(level)
+
+	if c.NArg() != 1 {
+		return errors.New("expected a single ENR or multiaddr to probe")
+	}
+
+	sp, err := ethereum.ParseStaticPeer(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	// A node without discv5, event outputs or a fixed port
+	nodeConfig := config.DefaultNodeConfig
+	nodeConfig.NatsURL = ""
+	nodeConfig.LogPath = ""
+	nodeConfig.DiscLogPath = ""
+	nodeConfig.Port = 0
+	nodeConfig.DialTimeout = c.Duration("timeout")
+	nodeConfig.BeaconAPI = c.String("beacon-api")
+	nodeConfig.IdentityKeyPath = c.String("identity-key")
+
+	disc, err := discovery.NewDiscovery(&nodeConfig, ethereum.NewStaticDiscoverer([]*ethereum.StaticPeer{sp}, nil))
+	if err != nil {
+		return err
+	}
+
+	result := disc.Probe(c.Context, sp)
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	} else if err := printProbe(os.Stdout, result); err != nil {
+		return err
+	}
+
+	if failed := failedProbeSteps(result); len(failed) > 0 {
+		return fmt.Errorf("probe failed: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+type namedProbeStep struct {
+	name string
+	step *ethereum.ProbeStep
+}
+
+// probeSteps returns the steps of a probe in the order they are run.
+func probeSteps(r *ethereum.ProbeResult) []namedProbeStep {
+	return []namedProbeStep{
+		{"connect", &r.Connect},
+		{"identify", &r.Identify},
+		{"status", &r.Status},
+		{"ping", &r.Ping},
+		{"metadata", &r.MetaData},
+	}
+}
+
+// failedProbeSteps returns the names of the steps that failed or were skipped.
+func failedProbeSteps(r *ethereum.ProbeResult) []string {
+	var failed []string
+	for _, s := range probeSteps(r) {
+		if s.step.Error != "" || s.step.Skipped {
+			failed = append(failed, s.name)
+		}
+	}
+
+	return failed
+}
+
+func printProbe(out io.Writer, r *ethereum.ProbeResult) error {
+	fmt.Fprintf(out, "peer:       %s\n", r.PeerID)
+	if r.ENR != "" {
+		fmt.Fprintf(out, "enr:        %s\n", r.ENR)
+	}
+	fmt.Fprintf(out, "addrs:      %s\n", orDash(strings.Join(r.Addrs, ", ")))
+	fmt.Fprintf(out, "remote:     %s\n", orDash(r.RemoteAddr))
+	fmt.Fprintf(out, "agent:      %s\n", orDash(r.AgentVersion))
+	fmt.Fprintf(out, "protocols:  %d\n\n", len(r.Protocols))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tDURATION\tRESULT")
+	for _, s := range probeSteps(r) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.name, probeDuration(s.step), probeOutcome(s.step))
+	}
+
+	return w.Flush()
+}
+
+func probeDuration(step *ethereum.ProbeStep) string {
+	if step.Skipped {
+		return "-"
+	}
+
+	return fmt.Sprintf("%dms", step.DurationMs)
+}
+
+// probeOutcome summarizes the result and error of a step on a line.
+func probeOutcome(step *ethereum.ProbeStep) string {
+	var parts []string
+	switch res := step.Result.(type) {
+	case *ethereum.ProbeStatus:
+		parts = append(parts, fmt.Sprintf("fork_digest=%s head_slot=%d finalized_epoch=%d head_root=%s finalized_root=%s",
+			res.ForkDigest, res.HeadSlot, res.FinalizedEpoch, res.HeadRoot, res.FinalizedRoot))
+	case *ethereum.ProbePing:
+		parts = append(parts, fmt.Sprintf("rtt=%dms", res.RTTMs))
+	case *ethereum.ProbeMetaData:
+		parts = append(parts, fmt.Sprintf("seq_number=%d attnets=%s syncnets=%s subnets=%v",
+			res.SeqNumber, res.Attnets, res.Syncnets, res.LongLivedSubnets))
+	}
+
+	switch {
+	case step.Skipped:
+		parts = append(parts, "skipped")
+	case step.Error != "":
+		parts = append(parts, "error: "+step.Error)
+	case len(parts) == 0:
+		parts = append(parts, "ok")
+	}
+
+	return strings.Join(parts, " ")
+}
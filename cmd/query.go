@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chainbound/valtrack/consumer"
+	"github.com/urfave/cli/v2"
+)
+
+var QueryCommand = &cli.Command{
+	Name:   "query",
+	Usage:  "inspect Parquet files written by the consumer",
+	Action: runQuery,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "schema",
+			Usage: "Print the schema of this Parquet file (column names, types and converted types)",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the output as JSON",
+		},
+	},
+}
+
+func runQuery(c *cli.Context) error {
+	path := c.String("schema")
+	if path == "" {
+		return errors.New("nothing to query, use --schema <file.parquet>")
+	}
+
+	schema, err := consumer.ReadParquetSchema(path)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schema)
+	}
+
+	fmt.Printf("%s: %d rows\n\n", path, schema.NumRows)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLUMN\tTYPE\tCONVERTED TYPE\tREPETITION")
+	printColumns(w, schema.Columns)
+
+	return w.Flush()
+}
+
+// printColumns prints a row per column, indenting nested columns under their group.
+func printColumns(w io.Writer, columns []consumer.ParquetColumn) {
+	for _, col := range columns {
+		name := col.Path[strings.LastIndex(col.Path, ".")+1:]
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\n", strings.Repeat("  ", col.Depth), name, orDash(col.Type), orDash(col.ConvertedType), orDash(col.Repetition))
+		printColumns(w, col.Children)
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
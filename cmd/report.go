@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chainbound/valtrack/pkg/ethereum"
+)
+
+// sentryReport summarizes a sentry run on shutdown.
+type sentryReport struct {
+	ethereum.CrawlStats
+	StoppedAt time.Time `json:"stopped_at"`
+	// Reason is why the sentry stopped, "signal" or "max_runtime"
+	Reason string `json:"reason"`
+}
+
+// writeReport writes a shutdown report as JSON to path. It's written to a temporary file
+// first, so a reader never sees a partial report.
+func writeReport(path string, report any) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode shutdown report: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".report-*")
+	if err != nil {
+		return fmt.Errorf("failed to write shutdown report: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write shutdown report: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write shutdown report: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write shutdown report: %w", err)
+	}
+
+	return nil
+}
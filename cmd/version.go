@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chainbound/valtrack/version"
+	"github.com/urfave/cli/v2"
+)
+
+var VersionCommand = &cli.Command{
+	Name:  "version",
+	Usage: "print the version and build info",
+	Action: func(c *cli.Context) error {
+		fmt.Println(version.Info())
+		return nil
+	},
+}
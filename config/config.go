@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
@@ -38,16 +39,38 @@ type DiscConfig struct {
 	LogPath    string
 	Bootnodes  []*enode.Node
 	NatsURL    string
+	Nats       NatsConfig
+	// DialStrategy decides in which order discovered peers are dialed ("fifo" or "attnets").
+	DialStrategy string
+	// DiscoveryDedupWindow reports a rediscovered peer again once the window passed since it
+	// was last reported. 0 reports every peer once, and again only when its ENR changed.
+	DiscoveryDedupWindow time.Duration
+	// WatchdogWindow restarts the discv5 walk if it found no new peer within the window. 0
+	// disables the watchdog.
+	WatchdogWindow time.Duration
+	// Attnets and Syncnets are the subnet bitfields advertised in the ENR. Attnets defaults to
+	// all subnets, Syncnets isn't advertised when nil.
+	Attnets  []byte
+	Syncnets []byte
+	// EventWriter replaces the LogPath file when set. It's owned, and closed, by the caller.
+	EventWriter io.Writer
+	// Redaction redacts the peer_discovered events.
+	Redaction RedactionConfig
+	// AcceptedForkDigests are accepted in ENRs besides ForkDigest.
+	AcceptedForkDigests [][4]byte
 }
 
 var DefaultDiscConfig DiscConfig = DiscConfig{
-	IP:         "0.0.0.0",
-	UDP:        9000,
-	TCP:        9000,
-	DBPath:     "",
-	ForkDigest: [4]byte{0x6a, 0x95, 0xa1, 0xa9},
-	LogPath:    "discovery_events.log",
-	Bootnodes:  GetEthereumBootnodes(),
+	IP:                   "0.0.0.0",
+	UDP:                  9000,
+	TCP:                  9000,
+	DBPath:               "",
+	ForkDigest:           [4]byte{0x6a, 0x95, 0xa1, 0xa9},
+	LogPath:              "discovery_events.log",
+	Bootnodes:            GetEthereumBootnodes(),
+	DialStrategy:         "attnets",
+	DiscoveryDedupWindow: 0,
+	WatchdogWindow:       15 * time.Minute,
 }
 
 func (d *DiscConfig) Eth2EnrEntry() (enr.Entry, error) {
@@ -85,17 +108,207 @@ type NodeConfig struct {
 	IP                string
 	Port              int
 	NatsURL           string
-	LogPath           string
+	Nats              NatsConfig
+	// LogPath is the file metadata_received events are written to (as NDJSON) when running
+	// without NATS. Empty disables it.
+	LogPath string
+	// DiscLogPath is the file peer_discovered events are written to (as NDJSON) when running
+	// without NATS. Empty disables it.
+	DiscLogPath string
+	// DisableFileLog disables both LogPath and DiscLogPath, so events are only logged and
+	// published.
+	DisableFileLog bool
+	// EventSocket is a Unix socket both event logs are served on instead, to a sidecar
+	// reading them. It can't be combined with NATS.
+	EventSocket string
+	// MaxPeers is the maximum number of peers the node stays connected to. 0 means unlimited.
+	MaxPeers int
+	// EvictionPolicy decides which peer to drop when MaxPeers is reached ("oldest" or "reject").
+	EvictionPolicy string
+	// DialStrategy decides in which order discovered peers are dialed ("fifo" or "attnets").
+	DialStrategy string
+	// DiscoveryDedupWindow reports a rediscovered peer again once the window passed since it
+	// was last reported. 0 reports every peer once, and again only when its ENR changed.
+	DiscoveryDedupWindow time.Duration
+	// DiscoveryWatchdog restarts the discv5 walk if it found no new peer within the window. 0
+	// disables the watchdog.
+	DiscoveryWatchdog time.Duration
+	// Attnets are the attestation subnets the sentry advertises in its ENR and metadata:
+	// "all", "none" or a comma-separated list of subnet indices.
+	Attnets string
+	// Syncnets are the sync committee subnets the sentry advertises, like Attnets.
+	Syncnets string
+	// DialAddrsPerPeer is the number of addresses of a peer that are tried, one after the
+	// other within DialTimeout, until a handshake succeeds.
+	DialAddrsPerPeer int
+	// CachePath is the file the peer handshake state is persisted to across restarts. Empty keeps it in memory only.
+	CachePath string
+	// CacheTTL is how long a peer stays in the cache after it was last seen.
+	CacheTTL time.Duration
+	// KeepConnected keeps peers connected after a successful handshake, instead of disconnecting them.
+	KeepConnected bool
+	// ListenAddrs are the libp2p multiaddrs to listen on. If empty, the node listens on IP and Port.
+	ListenAddrs []string
+	// AnnounceAddrs replace the listen addresses advertised to peers, e.g. a public address behind NAT.
+	AnnounceAddrs []string
+	// EnableNAT tries to map the listen port on the router with UPnP / NAT-PMP.
+	EnableNAT bool
+	// MetadataCacheSize is the maximum number of peers kept in the peerstore. 0 means unlimited.
+	MetadataCacheSize int
+	// BackoffCacheSize is the maximum number of backed off peers kept in the peerstore. 0 means unlimited.
+	BackoffCacheSize int
+	// PeersFile is a file with ENRs or multiaddrs to dial instead of doing a discv5 walk.
+	PeersFile string
+	// RedialOnDisconnect redials peers that disconnect from us after a successful handshake.
+	RedialOnDisconnect bool
+	// MaxRedials is the number of redials of a disconnected peer before giving up on it.
+	MaxRedials int
+	// AcceptInbound handshakes with peers that connect to us. If false, they are disconnected
+	// right away.
+	AcceptInbound bool
+	// DialOutbound dials the discovered peers. If false, the node only handshakes with peers
+	// that connect to us, and discovery only reports the peers it finds.
+	DialOutbound bool
+	// ExpectedPeers sizes a bloom filter of the peers handshaked during this run, which are
+	// then not dialed again. 0 disables the filter.
+	ExpectedPeers int
+	// PeerFilterFPRate is the false positive rate of the filter at ExpectedPeers peers.
+	// False positives are peers that are never dialed.
+	PeerFilterFPRate float64
+	// UniquePeersPrecision estimates the number of distinct peers that connected during this
+	// run with a HyperLogLog of 2^p one-byte registers, with a standard error of
+	// 1.04/sqrt(2^p) (0.81% at 14). 0 disables it.
+	UniquePeersPrecision int
+	// NTPServer is the server the clock offset recorded in events is measured against. Empty
+	// disables clock sync.
+	NTPServer string
+	// DiversityInterval is the interval of the client diversity snapshots of the handshaked
+	// peers. 0 disables them.
+	DiversityInterval time.Duration
+	// HandshakeRetries is the number of times a handshake request (status, ping or metadata)
+	// is retried when the peer resets the stream.
+	HandshakeRetries int
+	// HandshakeRetryDelay is the delay before retrying a handshake request.
+	HandshakeRetryDelay time.Duration
+	// MetadataCooldown is the minimum interval between metadata requests to the same peer.
+	// Within it, the metadata of the peer's previous handshake is reused. 0 disables it.
+	MetadataCooldown time.Duration
+	// HeartbeatInterval is the interval of the heartbeat events that show the sentry is up.
+	// 0 disables them.
+	HeartbeatInterval time.Duration
+	// DiscTablePath is the file a snapshot of the discv5 routing table is appended to every
+	// DiscTableInterval, as NDJSON. Empty disables the snapshots.
+	DiscTablePath     string
+	DiscTableInterval time.Duration
+	// Redaction redacts the addresses of the peer_discovered events. Off by default.
+	Redaction RedactionConfig
+	// RecordHandshakeFailures publishes a handshake_failed event for every failed handshake
+	// with a dialed peer.
+	RecordHandshakeFailures bool
+	// RecordForkMismatches publishes a handshake_failed event for every peer, dialed or
+	// inbound, whose status is on another fork.
+	RecordForkMismatches bool
+	// AcceptedForkDigests are accepted in the status and ENR of peers besides ForkDigest,
+	// e.g. the digests of both sides of a fork transition.
+	AcceptedForkDigests [][4]byte
+	// AcceptNextForkDigest also accepts the fork digest of the next fork scheduled in the
+	// network config, so the peers that already switched to it aren't rejected around the
+	// fork.
+	AcceptNextForkDigest bool
+	// MetadataOnStatusFailure still requests the metadata of dialed peers whose status request
+	// failed, and publishes it as a partial metadata_received event.
+	MetadataOnStatusFailure bool
+	// SuspiciousPeerThreshold publishes a suspicious_peer event when a public IP served this
+	// many distinct peer IDs within SuspiciousPeerWindow, some on the same port. 0 disables it.
+	SuspiciousPeerThreshold int
+	SuspiciousPeerWindow    time.Duration
+	// PeerChurnEvents publishes a peer_churn event whenever the first connection to a peer
+	// opens or its last one closes. There are many, so it's off by default.
+	PeerChurnEvents bool
+	// BeaconAPI is a beacon node the head and finalized checkpoint of our status are taken
+	// from. Without it, or when it's unavailable, the head slot is computed from GenesisTime.
+	BeaconAPI string
+	// StatusInterval is how often the status is refreshed. 0 only sets it on startup.
+	StatusInterval time.Duration
+	// BeaconPeersInterval is how often the peers the beacon node at BeaconAPI is connected to
+	// are polled, to flag them in the metadata events. 0 disables it.
+	BeaconPeersInterval time.Duration
+	// GossipPX joins gossipsub with peer exchange, without subscribing to any topic, and
+	// publishes the peers learned from the PX records of PRUNE messages as peer_discovered
+	// events. It's an additional source alongside the discovery walk.
+	GossipPX bool
+	// GenesisTime is the Unix time of the genesis of the network, mainnet by default.
+	GenesisTime int64
+	// GenesisValidatorsRoot is the genesis validators root of the network the fork digests are
+	// computed with, mainnet by default.
+	GenesisValidatorsRoot [32]byte
+	// PeerstoreAddrTTL is how long the libp2p peerstore keeps the addresses of a peer after it
+	// disconnects.
+	PeerstoreAddrTTL time.Duration
+	// PeerstoreRecordTTL is how long the libp2p peerstore keeps all other records of a peer
+	// (keys, protocols, agent version) after it disconnects.
+	PeerstoreRecordTTL time.Duration
+	// PeerstoreGCInterval is the interval of the libp2p peerstore garbage collection that
+	// applies the TTLs above. 0 disables it, keeping the libp2p defaults.
+	PeerstoreGCInterval time.Duration
+	// ResourceMaxConns replaces the libp2p resource manager's system connection limit, which
+	// is otherwise scaled to the machine. 0 keeps the default.
+	ResourceMaxConns int
+	// ResourceMaxStreams replaces the resource manager's system stream limit. 0 keeps the default.
+	ResourceMaxStreams int
+	// ResourceMaxMemoryMB replaces the resource manager's system memory limit. 0 keeps the default.
+	ResourceMaxMemoryMB int
+	// IdentityKeyPath is the file the node's private key is kept in, so its peer ID and ENR
+	// are stable across restarts. It's generated on the first run. Empty generates a new key
+	// on every start.
+	IdentityKeyPath string
+	// DisableResourceManager doesn't limit the connections, streams and memory of the libp2p host.
+	DisableResourceManager bool
 }
 
 var DefaultNodeConfig NodeConfig = NodeConfig{
-	PrivateKey:        nil,
-	BeaconConfig:      nil,
-	ForkDigest:        [4]byte{0x6a, 0x95, 0xa1, 0xa9},
-	Encoder:           encoder.SszNetworkEncoder{},
-	DialTimeout:       10 * time.Second,
-	ConcurrentDialers: 64,
-	IP:                "0.0.0.0",
-	Port:              9000,
-	LogPath:           "metadata_events.log",
+	PrivateKey:           nil,
+	BeaconConfig:         nil,
+	ForkDigest:           [4]byte{0x6a, 0x95, 0xa1, 0xa9},
+	Encoder:              encoder.SszNetworkEncoder{},
+	DialTimeout:          10 * time.Second,
+	ConcurrentDialers:    64,
+	IP:                   "0.0.0.0",
+	Port:                 9000,
+	LogPath:              "metadata_events.log",
+	DiscLogPath:          "discovery_events.log",
+	MaxPeers:             0,
+	EvictionPolicy:       "oldest",
+	DialStrategy:         "attnets",
+	DiscoveryDedupWindow: 0,
+	DiscoveryWatchdog:    15 * time.Minute,
+	Attnets:              "all",
+	Syncnets:             "none",
+	DialAddrsPerPeer:     1,
+	CachePath:            "",
+	CacheTTL:             24 * time.Hour,
+	KeepConnected:        false,
+	EnableNAT:            false,
+	MetadataCacheSize:    100_000,
+	BackoffCacheSize:     50_000,
+	MaxRedials:           5,
+	AcceptInbound:        true,
+	DialOutbound:         true,
+	PeerFilterFPRate:     0.01,
+	NTPServer:            "pool.ntp.org",
+	HandshakeRetries:     1,
+	HandshakeRetryDelay:  200 * time.Millisecond,
+	HeartbeatInterval:    time.Minute,
+	DiscTableInterval:    10 * time.Minute,
+	AcceptNextForkDigest: true,
+	SuspiciousPeerWindow: time.Hour,
+	StatusInterval:       time.Minute,
+	GenesisTime:          1606824023,
+	PeerstoreAddrTTL:     10 * time.Minute,
+	PeerstoreRecordTTL:   time.Hour,
+	PeerstoreGCInterval:  time.Minute,
+	GenesisValidatorsRoot: [32]byte{
+		0x4b, 0x36, 0x3d, 0xb9, 0x4e, 0x28, 0x61, 0x20, 0xd7, 0x6e, 0xb9, 0x05, 0x34, 0x0f, 0xdd, 0x4e,
+		0x54, 0xbf, 0xe9, 0xf0, 0x6b, 0xf3, 0x3f, 0xf6, 0xcf, 0x5a, 0xd2, 0x7f, 0x51, 0x1b, 0xfe, 0x95,
+	},
 }
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ParseForkDigest parses a hex-encoded fork digest, with or without the 0x prefix.
+func ParseForkDigest(s string) ([4]byte, error) {
+	var digest [4]byte
+
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != len(digest) {
+		return digest, fmt.Errorf("invalid fork digest %q: expected 4 hex-encoded bytes", s)
+	}
+
+	copy(digest[:], b)
+	return digest, nil
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NatsConfig holds the authentication and TLS options for connecting to NATS.
+type NatsConfig struct {
+	// CredsFile is a JWT user credentials file.
+	CredsFile string
+	// NKeyFile is a file holding an NKey seed.
+	NKeyFile string
+	// Token is an authentication token.
+	Token string
+
+	// TLSCA is the CA certificate used to verify the server.
+	TLSCA string
+	// TLSCert and TLSKey are the client certificate and key, for mutual TLS.
+	TLSCert string
+	TLSKey  string
+
+	// DedupWindow is how long the EVENTS stream remembers published message IDs to
+	// drop duplicates. Only used by the sentry, which creates the stream.
+	DedupWindow time.Duration
+	// Stream configures the EVENTS stream. Only used by the sentry, which creates it.
+	Stream StreamConfig
+
+	// WireFormat is the encoding the sentry publishes events in (see types.WireFormat). The
+	// consumer detects the format of every message from its header, and assumes this one
+	// for messages without it. Empty means JSON.
+	WireFormat types.WireFormat
+	// Gzip compresses the payload of every published event. Only used by the sentry, the
+	// consumer decompresses messages based on their ContentEncodingHeader.
+	Gzip bool
+
+	// ReconnectWait is the delay before the first reconnect attempt, doubled on every
+	// further attempt up to ReconnectMaxWait. 0 keeps the NATS client's fixed delay.
+	ReconnectWait    time.Duration
+	ReconnectMaxWait time.Duration
+	// MaxReconnects is the number of reconnect attempts before giving up, -1 for unlimited.
+	// 0 keeps the NATS client's default.
+	MaxReconnects int
+	// PublishBuffer is the number of events the sentry keeps while disconnected, to publish
+	// them once reconnected. The oldest events are dropped when it's full.
+	PublishBuffer int
+	// BreakerThreshold is the number of consecutive publish failures after which the sentry
+	// stops publishing for BreakerCooldown, then tries again with a single event. 0 disables
+	// the circuit breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// DefaultStreamSubjects are the subjects of all the events the sentry publishes.
+var DefaultStreamSubjects = types.AllSubjects()
+
+// StreamConfig holds the options of the EVENTS stream the sentry creates. Zero values
+// leave the server defaults.
+type StreamConfig struct {
+	// Subjects are the subjects the stream stores. Empty means DefaultStreamSubjects.
+	Subjects []string
+	// Retention is the retention policy ("limits", "interest" or "workqueue"). Empty means
+	// interest, so messages are removed once every consumer acknowledged them.
+	Retention string
+	// MaxAge is the maximum age of the messages in the stream. 0 means unlimited.
+	MaxAge time.Duration
+	// MaxBytes is the maximum size of the stream. 0 means unlimited.
+	MaxBytes int64
+	// Replicas is the number of replicas of the stream in a cluster. 0 means 1.
+	Replicas int
+}
+
+// RetentionPolicy returns the JetStream retention policy of the stream.
+func (s *StreamConfig) RetentionPolicy() (jetstream.RetentionPolicy, error) {
+	switch s.Retention {
+	case "", "interest":
+		return jetstream.InterestPolicy, nil
+	case "limits":
+		return jetstream.LimitsPolicy, nil
+	case "workqueue":
+		return jetstream.WorkQueuePolicy, nil
+	default:
+		return 0, fmt.Errorf("unknown stream retention policy: %s", s.Retention)
+	}
+}
+
+// Validate checks that at most one authentication method is set, and that the
+// client certificate and key are provided together.
+func (c *NatsConfig) Validate() error {
+	methods := 0
+	for _, m := range []string{c.CredsFile, c.NKeyFile, c.Token} {
+		if m != "" {
+			methods++
+		}
+	}
+
+	if methods > 1 {
+		return errors.New("nats: only one of creds, nkey or token authentication can be set")
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("nats: TLS client certificate and key must be set together")
+	}
+
+	if c.DedupWindow < 0 {
+		return errors.New("nats: dedup window can't be negative")
+	}
+
+	if _, err := c.Stream.RetentionPolicy(); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+
+	if c.Stream.MaxAge < 0 || c.Stream.MaxBytes < 0 || c.Stream.Replicas < 0 {
+		return errors.New("nats: stream max age, max bytes and replicas can't be negative")
+	}
+
+	if c.ReconnectWait < 0 || c.ReconnectMaxWait < 0 || c.PublishBuffer < 0 {
+		return errors.New("nats: reconnect waits and publish buffer can't be negative")
+	}
+
+	if c.BreakerThreshold < 0 || (c.BreakerThreshold > 0 && c.BreakerCooldown <= 0) {
+		return errors.New("nats: breaker threshold can't be negative, and the breaker cooldown must be positive")
+	}
+
+	if c.WireFormat != "" {
+		if _, err := types.ParseWireFormat(string(c.WireFormat)); err != nil {
+			return fmt.Errorf("nats: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Options returns the NATS connection options for this configuration.
+func (c *NatsConfig) Options() ([]nats.Option, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	var opts []nats.Option
+
+	switch {
+	case c.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(c.CredsFile))
+	case c.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(c.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("nats: failed to load nkey seed: %w", err)
+		}
+		opts = append(opts, opt)
+	case c.Token != "":
+		opts = append(opts, nats.Token(c.Token))
+	}
+
+	if c.TLSCA != "" {
+		opts = append(opts, nats.RootCAs(c.TLSCA))
+	}
+
+	if c.TLSCert != "" {
+		opts = append(opts, nats.ClientCert(c.TLSCert, c.TLSKey))
+	}
+
+	if c.ReconnectWait > 0 {
+		opts = append(opts, nats.CustomReconnectDelay(c.ReconnectDelay))
+	}
+
+	if c.MaxReconnects != 0 {
+		opts = append(opts, nats.MaxReconnects(c.MaxReconnects))
+	}
+
+	return opts, nil
+}
+
+// ReconnectDelay returns the delay before the given reconnect attempt (starting at 1):
+// ReconnectWait, doubled on every attempt, up to ReconnectMaxWait (or ReconnectWait if unset).
+func (c *NatsConfig) ReconnectDelay(attempts int) time.Duration {
+	maxWait := max(c.ReconnectMaxWait, c.ReconnectWait)
+
+	delay := c.ReconnectWait
+	for i := 1; i < attempts && delay < maxWait; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxWait)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The redaction modes of a field.
+const (
+	// RedactTruncate zeroes the host part of an IP: the last octet of IPv4 addresses, all
+	// but the /48 prefix of IPv6 addresses.
+	RedactTruncate = "truncate"
+	// RedactHMAC replaces an IP with its HMAC-SHA256 keyed with the redaction key, so
+	// peers can still be told apart without storing their address.
+	RedactHMAC = "hmac"
+	// RedactDrop removes the field.
+	RedactDrop = "drop"
+)
+
+// RedactionConfig redacts fields of the peer_discovered events before they are logged or
+// published, for deployments that can't store the raw addresses of peers. A field with an
+// empty mode is kept as is.
+type RedactionConfig struct {
+	// IP is RedactTruncate or RedactHMAC.
+	IP string
+	// ENR is RedactDrop, it includes the IP.
+	ENR string
+	// Port is RedactDrop.
+	Port string
+	// Key is the HMAC key, required with RedactHMAC.
+	Key []byte
+}
+
+// Enabled reports whether any field is redacted.
+func (c *RedactionConfig) Enabled() bool {
+	return c.IP != "" || c.ENR != "" || c.Port != ""
+}
+
+// Validate checks the mode of every field, and that the HMAC key is set when needed.
+func (c *RedactionConfig) Validate() error {
+	switch c.IP {
+	case "", RedactTruncate:
+	case RedactHMAC:
+		if len(c.Key) == 0 {
+			return errors.New("redaction: the hmac mode needs a key")
+		}
+	default:
+		return fmt.Errorf("redaction: invalid IP mode %q (expected %s or %s)", c.IP, RedactTruncate, RedactHMAC)
+	}
+
+	for field, mode := range map[string]string{"ENR": c.ENR, "port": c.Port} {
+		if mode != "" && mode != RedactDrop {
+			return fmt.Errorf("redaction: invalid %s mode %q (expected %s)", field, mode, RedactDrop)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// AckMode is how the consumer acknowledges the messages it processed.
+type AckMode string
+
+const (
+	// AckAsync sends the ack without waiting for the server. A lost ack has the message
+	// redelivered, and written twice.
+	AckAsync AckMode = "async"
+	// AckSync waits for the server to confirm the ack, at the cost of a round trip per message.
+	AckSync AckMode = "sync"
+)
+
+// ackSyncTimeout is how long a sync ack waits for the server's confirmation.
+const ackSyncTimeout = 5 * time.Second
+
+// ParseAckMode validates an ack mode.
+func ParseAckMode(s string) (AckMode, error) {
+	switch m := AckMode(s); m {
+	case AckAsync, AckSync:
+		return m, nil
+	case "":
+		return AckAsync, nil
+	default:
+		return "", fmt.Errorf("invalid ack mode %q (expected async or sync)", s)
+	}
+}
+
+// ack acknowledges a message. Sync acks are aborted on shutdown, when ctx is cancelled.
+func (m AckMode) ack(ctx context.Context, msg jetstream.Msg) error {
+	if m != AckSync {
+		return msg.Ack()
+	}
+
+	ackCtx, cancel := context.WithTimeout(ctx, ackSyncTimeout)
+	defer cancel()
+
+	return msg.DoubleAck(ackCtx)
+}
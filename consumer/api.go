@@ -4,11 +4,12 @@ import (
 	"bufio"
 	"database/sql"
 	"encoding/json"
-	"log"
 	"math"
 	"net/http"
 	"os"
 	"strings"
+
+	"github.com/rs/zerolog"
 )
 
 type ValidatorTracker struct {
@@ -71,17 +72,22 @@ func loadAPIKeys(filePath string, apiKey string) (bool, error) {
 	return apiKeys[apiKey], scanner.Err()
 }
 
-func createGetValidatorsHandler(db *sql.DB) http.HandlerFunc {
+func createGetValidatorsHandler(db *sql.DB, log zerolog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiKey := r.Header.Get("X-API-Key")
 
-		isAdmin, _ := loadAPIKeys("api_keys.txt", apiKey)
+		// Without readable API keys, everyone gets the public view
+		isAdmin, err := loadAPIKeys("api_keys.txt", apiKey)
+		if err != nil {
+			log.Debug().Err(err).Msg("Error loading API keys")
+		}
 
 		// Map to store unique entries per peer_id
 		peerIDMap := make(map[string]ValidatorTracker)
 
 		rows, err := db.Query(selectQuery)
 		if err != nil {
+			log.Error().Err(err).Msg("Error querying validators")
 			http.Error(w, "Error querying database", http.StatusInternalServerError)
 			return
 		}
@@ -98,7 +104,9 @@ func createGetValidatorsHandler(db *sql.DB) http.HandlerFunc {
 				&vm.ASN, &vm.ASNOrganization, &vm.ASNType,
 			)
 			if err != nil {
-				log.Fatalf("Error scanning row: %v\n", err)
+				log.Error().Err(err).Msg("Error scanning validator row")
+				http.Error(w, "Error querying database", http.StatusInternalServerError)
+				return
 			}
 
 			// Dont return sensitive information if not admin
@@ -120,12 +128,19 @@ func createGetValidatorsHandler(db *sql.DB) http.HandlerFunc {
 
 		}
 
+		if err := rows.Err(); err != nil {
+			log.Error().Err(err).Msg("Error iterating validator rows")
+			http.Error(w, "Error querying database", http.StatusInternalServerError)
+			return
+		}
+
 		for _, vm := range peerIDMap {
 			validators = append(validators, vm)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(validators); err != nil {
+			log.Error().Err(err).Msg("Error encoding validators")
 			http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
 		}
 	}
@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// validatorQueueSize is the capacity of the validator event queues, to the IP metadata
+// lookup and to Clickhouse.
+const validatorQueueSize = 16384
+
+const (
+	DefaultBackpressureHighWatermark = validatorQueueSize * 3 / 4
+	DefaultBackpressureLowWatermark  = validatorQueueSize / 4
+)
+
+// backpressurePollInterval is how often the queue depth is checked while fetching is paused.
+const backpressurePollInterval = 100 * time.Millisecond
+
+// BackpressureConfig pauses fetching from JetStream while the validator event queues are
+// saturated, instead of blocking on them with a batch of unacknowledged messages.
+type BackpressureConfig struct {
+	// HighWatermark is the queue depth fetching is paused at, checked before every batch.
+	// 0 disables pausing.
+	HighWatermark int
+	// LowWatermark is the queue depth fetching resumes at once paused.
+	LowWatermark int
+}
+
+// Validate checks the watermarks, if pausing is enabled.
+func (c *BackpressureConfig) Validate() error {
+	if c.HighWatermark == 0 {
+		return nil
+	}
+
+	if c.HighWatermark < 0 || c.HighWatermark > validatorQueueSize {
+		return fmt.Errorf("invalid backpressure high watermark %d: must be between 0 and %d", c.HighWatermark, validatorQueueSize)
+	}
+
+	if c.LowWatermark < 0 || c.LowWatermark >= c.HighWatermark {
+		return fmt.Errorf("invalid backpressure low watermark %d: must be at least 0 and below the high watermark %d", c.LowWatermark, c.HighWatermark)
+	}
+
+	return nil
+}
+
+// fetchPauser pauses the fetch loop between the watermarks of the queue depth.
+type fetchPauser struct {
+	cfg   BackpressureConfig
+	depth func() int
+	log   zerolog.Logger
+}
+
+// wait returns right away if the depth is below the high watermark. Otherwise it blocks
+// until the depth drained to the low watermark, or ctx is cancelled.
+func (p *fetchPauser) wait(ctx context.Context) {
+	if p.cfg.HighWatermark == 0 {
+		return
+	}
+
+	depth := p.depth()
+	if depth < p.cfg.HighWatermark {
+		return
+	}
+
+	start := time.Now()
+	fetchPauses.Inc()
+	fetchPaused.Set(1)
+	p.log.Warn().Int("depth", depth).Int("low_watermark", p.cfg.LowWatermark).Msg("Validator queues saturated, pausing fetching")
+
+	defer func() {
+		took := time.Since(start)
+		fetchPauseDuration.Observe(took.Seconds())
+		fetchPaused.Set(0)
+		p.log.Info().Dur("paused", took).Msg("Validator queues drained, resuming fetching")
+	}()
+
+	ticker := time.NewTicker(backpressurePollInterval)
+	defer ticker.Stop()
+
+	for p.depth() > p.cfg.LowWatermark {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// queueDepth is the depth of the fullest validator event queue, which blocks the processing
+// of metadata events once full.
+func (c *Consumer) queueDepth() int {
+	depth := len(c.validatorMetadataChan)
+	if c.chClient != nil {
+		depth = max(depth, len(c.chClient.ValidatorEventChan))
+	}
+
+	return depth
+}
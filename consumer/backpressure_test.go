@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFetchPauser(t *testing.T) {
+	cfg := BackpressureConfig{HighWatermark: 10, LowWatermark: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&BackpressureConfig{HighWatermark: 10, LowWatermark: 10}).Validate(); err == nil {
+		t.Fatal("expected an error for a low watermark at the high watermark")
+	}
+
+	var depth atomic.Int64
+	p := &fetchPauser{cfg: cfg, depth: func() int { return int(depth.Load()) }, log: zerolog.Nop()}
+
+	// Below the high watermark, fetching goes on
+	depth.Store(9)
+	p.wait(context.Background())
+
+	// At the high watermark, fetching resumes once drained to the low watermark
+	depth.Store(10)
+	done := make(chan struct{})
+	go func() {
+		p.wait(context.Background())
+		close(done)
+	}()
+	time.Sleep(backpressurePollInterval)
+
+	depth.Store(5)
+	select {
+	case <-done:
+		t.Fatal("resumed above the low watermark")
+	case <-time.After(3 * backpressurePollInterval):
+	}
+
+	depth.Store(2)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("didn't resume at the low watermark")
+	}
+}
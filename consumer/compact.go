@@ -0,0 +1,211 @@
+package consumer
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// compactBatchSize is the number of rows read from an input file at a time.
+const compactBatchSize = 10_000
+
+// OutputSchemas are the row types of the Parquet files written by the consumer, by name.
+var OutputSchemas = outputSchemas()
+
+// DefaultCompactKey are the columns rows are deduplicated by when compacting.
+var DefaultCompactKey = []string{"id", "timestamp"}
+
+// CompactStats reports what a compaction did.
+type CompactStats struct {
+	Files      int   `json:"files"`
+	RowsIn     int64 `json:"rows_in"`
+	RowsOut    int64 `json:"rows_out"`
+	Duplicates int64 `json:"duplicates"`
+}
+
+// CompactFiles returns the Parquet files of the output `name` under dir: the files in a
+// `name` directory (partitioned output), or named `name_<prefix>*.parquet`.
+func CompactFiles(dir, name string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || filepath.Ext(path) != ".parquet" {
+			return nil
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(filepath.Dir(abs), string(filepath.Separator))
+		if slices.Contains(parts, name) || strings.HasPrefix(d.Name(), name+"_") {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// Compact merges the given Parquet files of the output `name` into a single file at out,
+// keeping only the first row of every distinct `key` (a list of column names). Rows are
+// streamed in batches, only a hash of the keys seen so far is kept in memory. The output
+// is written to a temporary file that replaces out once complete.
+func Compact(name string, files []string, out string, key []string) (*CompactStats, error) {
+	schema, ok := OutputSchemas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output %q", name)
+	}
+
+	rowType := reflect.TypeOf(schema).Elem()
+
+	keyFields, err := keyFieldIndexes(rowType, key)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := out + ".tmp"
+	file, err := local.NewLocalFileWriter(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+
+	pw, err := newParquetWriter(file, schema, &WriterConfig{})
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to create parquet writer for %s: %w", tmp, err)
+	}
+
+	stats := &CompactStats{Files: len(files)}
+	seen := make(map[[16]byte]struct{})
+
+	for _, path := range files {
+		err = readRows(path, schema, rowType, func(row reflect.Value) error {
+			stats.RowsIn++
+
+			h := rowKey(row, keyFields)
+			if _, ok := seen[h]; ok {
+				stats.Duplicates++
+				return nil
+			}
+			seen[h] = struct{}{}
+
+			stats.RowsOut++
+			return pw.Write(row.Interface())
+		})
+		if err != nil {
+			break
+		}
+	}
+
+	if stopErr := pw.WriteStop(); err == nil && stopErr != nil {
+		err = fmt.Errorf("failed to finalize %s: %w", tmp, stopErr)
+	}
+
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close %s: %w", tmp, closeErr)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, out); err != nil {
+		return nil, fmt.Errorf("failed to move %s to %s: %w", tmp, out, err)
+	}
+
+	return stats, nil
+}
+
+// readRows calls fn with every row of a Parquet file, reading compactBatchSize rows at a
+// time.
+func readRows(path string, schema any, rowType reflect.Type, fn func(row reflect.Value) error) error {
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetReader(file, schema, int64(DefaultWriterParallelism))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer pr.ReadStop()
+
+	for remaining := pr.GetNumRows(); remaining > 0; {
+		n := min(remaining, compactBatchSize)
+
+		batch := reflect.New(reflect.SliceOf(rowType))
+		batch.Elem().Set(reflect.MakeSlice(reflect.SliceOf(rowType), int(n), int(n)))
+
+		if err := pr.Read(batch.Interface()); err != nil {
+			return fmt.Errorf("failed to read rows of %s: %w", path, err)
+		}
+
+		for i := 0; i < int(n); i++ {
+			if err := fn(batch.Elem().Index(i)); err != nil {
+				return fmt.Errorf("failed to write row of %s: %w", path, err)
+			}
+		}
+
+		remaining -= n
+	}
+
+	return nil
+}
+
+// keyFieldIndexes returns the indexes of the struct fields with the given Parquet column
+// names.
+func keyFieldIndexes(rowType reflect.Type, columns []string) ([]int, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("empty deduplication key")
+	}
+
+	byName := make(map[string]int, rowType.NumField())
+	for i := 0; i < rowType.NumField(); i++ {
+		for _, opt := range strings.Split(rowType.Field(i).Tag.Get("parquet"), ",") {
+			if name, ok := strings.CutPrefix(strings.TrimSpace(opt), "name="); ok {
+				byName[name] = i
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(columns))
+	for _, col := range columns {
+		i, ok := byName[col]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q in deduplication key", col)
+		}
+		indexes = append(indexes, i)
+	}
+
+	return indexes, nil
+}
+
+// rowKey hashes the key fields of a row.
+func rowKey(row reflect.Value, fields []int) [16]byte {
+	h := sha256.New()
+	for _, i := range fields {
+		fmt.Fprintf(h, "%v\x00", row.Field(i).Interface())
+	}
+
+	var key [16]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
@@ -4,23 +4,26 @@ import (
 	"context"
 	"database/sql"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
 	ch "github.com/chainbound/valtrack/clickhouse"
+	"github.com/chainbound/valtrack/config"
 	"github.com/chainbound/valtrack/log"
+	"github.com/chainbound/valtrack/pkg/ethereum"
 	"github.com/chainbound/valtrack/types"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
-	"github.com/xitongsys/parquet-go-source/local"
-	"github.com/xitongsys/parquet-go/writer"
 )
 
 const BATCH_SIZE = 1024
@@ -28,30 +31,100 @@ const BATCH_SIZE = 1024
 type ConsumerConfig struct {
 	LogLevel      string
 	NatsURL       string
+	NatsCfg       config.NatsConfig
 	Name          string
 	ChCfg         ch.ClickhouseConfig
 	DuneNamespace string
 	DuneApiKey    string
+	WriterCfg     WriterConfig
+	// AllowGap lets the consumer start even if messages it hasn't acknowledged yet were
+	// already removed from the stream.
+	AllowGap bool
+	// Strict refuses to start if the durable consumer already exists with a different
+	// configuration, instead of updating it.
+	Strict bool
+	// Input is an NDJSON file with events to convert to Parquet instead of consuming from NATS.
+	Input string
+	// StoreRaw stores the original payload of every event in the `raw` column.
+	StoreRaw bool
+	// MetaDataSerializer encodes the `metadata` column of the metadata events. Defaults to
+	// SerializeMetaData.
+	MetaDataSerializer MetaDataSerializer
+	// Rollup configures the periodic rollups of the metadata events.
+	Rollup RollupConfig
+	// Influx configures the InfluxDB sink of the stream consumer.
+	Influx InfluxConfig
+	// Backpressure configures when fetching pauses for the validator event queues to drain.
+	Backpressure BackpressureConfig
+	// DrainTimeout is how long the consumer keeps processing the messages it already fetched
+	// after a shutdown signal, before aborting them. 0 aborts them right away.
+	DrainTimeout time.Duration
+	// CloseTimeout is how long each sink (Parquet writer, rollups, InfluxDB) is given to
+	// flush and close on shutdown. Sinks are closed concurrently, so a stuck one doesn't hold
+	// the others back. 0 waits for every sink.
+	CloseTimeout time.Duration
+	// Ephemeral deletes the JetStream consumer on shutdown, for runs that won't be resumed.
+	Ephemeral bool
+	// AckMode is how processed messages are acknowledged. Defaults to AckAsync.
+	AckMode AckMode
 }
 
 type Consumer struct {
-	log             zerolog.Logger
-	discoveryWriter *writer.ParquetWriter
-	metadataWriter  *writer.ParquetWriter
-	validatorWriter *writer.ParquetWriter
-	js              jetstream.JetStream
+	log zerolog.Logger
+	// writers are the Parquet writers of OutputSchemas, by output name
+	writers map[string]*PartitionedWriter
+	js      jetstream.JetStream
+	// durable is the durable consumer, set once started
+	durable jetstream.Consumer
 
 	validatorMetadataChan chan *types.MetadataReceivedEvent
 
+	// rollups is only set with a rollup window
+	rollups *rollups
+	// influx is only set with an InfluxDB URL
+	influx *influxSink
+
 	chClient *ch.ClickhouseClient
 	db       *sql.DB
 	dune     *Dune
+
+	// unknownSchemas holds the newer event schema versions we already warned about
+	unknownSchemas map[int]struct{}
+	decodeStats    *decodeStats
+	stats          *runStats
+	storeRaw       bool
+	// serializeMetaData encodes the metadata column of the metadata events
+	serializeMetaData MetaDataSerializer
+	// wireFormat is the format of messages published without a WireFormatHeader
+	wireFormat types.WireFormat
+	ackMode    AckMode
+	// pauser holds the fetch loop back while the validator event queues are saturated
+	pauser *fetchPauser
 }
 
-func RunConsumer(cfg *ConsumerConfig) {
+// metaDataSerializer returns the configured MetaDataSerializer, or SerializeMetaData.
+func (cfg *ConsumerConfig) metaDataSerializer() MetaDataSerializer {
+	if cfg.MetaDataSerializer != nil {
+		return cfg.MetaDataSerializer
+	}
+
+	return SerializeMetaData
+}
+
+// RunConsumer consumes events until a shutdown signal or ctx is cancelled, or converts the
+// input file, and returns the report of the run.
+func RunConsumer(ctx context.Context, cfg *ConsumerConfig) (*ShutdownReport, error) {
 	// Set up logging
 	log := log.NewLogger("consumer")
 
+	// Cancelled on shutdown, which aborts the processing of in-flight messages
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Input != "" {
+		return runFileConsumer(ctx, cfg, log)
+	}
+
 	// Set up the sqlite database
 	db, err := sql.Open("sqlite3", "./validator_tracker.sqlite")
 	if err != nil {
@@ -64,71 +137,95 @@ func RunConsumer(cfg *ConsumerConfig) {
 		log.Error().Err(err).Msg("Error setting up database")
 	}
 
-	err = loadIPMetadataFromCSV(db, "ip_metadata.csv")
+	err = loadIPMetadataFromCSV(db, "ip_metadata.csv", log)
 	if err != nil {
-		log.Error().Err(err).Msg("Error setting up database")
+		log.Error().Err(err).Msg("Error loading IP metadata")
 	}
 
 	log.Info().Msg("Sqlite DB setup complete")
 
 	// Set up NATS
-	nc, err := nats.Connect(cfg.NatsURL)
+	natsOpts, err := cfg.NatsCfg.Options()
 	if err != nil {
-		log.Error().Err(err).Msg("Error connecting to NATS")
+		return nil, fmt.Errorf("invalid NATS configuration: %w", err)
 	}
-	defer nc.Close()
 
-	js, err := jetstream.New(nc)
+	nc, err := nats.Connect(cfg.NatsURL, natsOpts...)
 	if err != nil {
-		log.Error().Err(err).Msg("Error creating JetStream context")
+		return nil, fmt.Errorf("error connecting to NATS at %s: %w", cfg.NatsURL, err)
 	}
+	defer nc.Close()
 
-	// Create Parquet writer files
-	w_discovery, err := local.NewLocalFileWriter("discovery_events.parquet")
+	js, err := jetstream.New(nc)
 	if err != nil {
-		log.Error().Err(err).Msg("Error creating discovery events parquet file")
+		return nil, fmt.Errorf("error creating JetStream context: %w", err)
 	}
-	defer w_discovery.Close()
 
-	w_metadata, err := local.NewLocalFileWriter("metadata_events.parquet")
-	if err != nil {
-		log.Error().Err(err).Msg("Error creating metadata events parquet file")
-	}
-	defer w_metadata.Close()
+	// Set up HTTP server
+	mux := http.NewServeMux()
+	registerAPIHandlers(mux, db, log)
 
-	w_validator, err := local.NewLocalFileWriter("validator_metadata_events.parquet")
-	if err != nil {
-		log.Error().Err(err).Msg("Error creating validator parquet file")
-	}
-	defer w_validator.Close()
+	server := &http.Server{Addr: ":8080", Handler: mux}
 
-	// Set up Parquet writers
-	discoveryWriter, err := writer.NewParquetWriter(w_discovery, new(types.PeerDiscoveredEvent), 4)
-	if err != nil {
-		log.Error().Err(err).Msg("Error creating Peer discovered Parquet writer")
-	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Error starting HTTP server")
+		}
+	}()
 	defer func() {
-		discoveryWriter.WriteStop()
-		log.Info().Msg("Stopped Discovery Parquet writer")
+		server.Shutdown(context.Background())
 	}()
 
-	metadataWriter, err := writer.NewParquetWriter(w_metadata, new(types.MetadataReceivedEvent), 4)
-	if err != nil {
-		log.Error().Err(err).Msg("Error creating Metadata Parquet writer")
+	return runStreamConsumer(ctx, cfg, js, db, log)
+}
+
+// runStreamConsumer consumes the events of the EVENTS stream on js until the context is
+// cancelled, and returns the report of the run once the in-flight messages are processed
+// and the Parquet files are closed. Without a database, the IP metadata of validators
+// isn't tracked.
+func runStreamConsumer(ctx context.Context, cfg *ConsumerConfig, js jetstream.JetStream, db *sql.DB, log zerolog.Logger) (report *ShutdownReport, err error) {
+	// Closed with the shutdown report, or on return if the consumer failed to start
+	var sinks sinks
+	defer sinks.close(cfg.CloseTimeout, log)
+
+	// Set up Parquet writers
+	writers := newWriters(&cfg.WriterCfg, log)
+	for name, w := range writers {
+		sinks.add(name, w.Close)
 	}
-	defer func() {
-		metadataWriter.WriteStop()
-		log.Info().Msg("Stopped Metadata Parquet writer")
-	}()
 
-	validatorWriter, err := writer.NewParquetWriter(w_validator, new(types.ValidatorEvent), 4)
-	if err != nil {
-		log.Error().Err(err).Msg("Error creating Validator Parquet writer")
+	idleWriters := writerList(writers)
+
+	var rollups *rollups
+	if cfg.Rollup.Window > 0 {
+		rollupWriter := NewPartitionedWriter("rollups", new(RollupRow), &cfg.WriterCfg, log)
+
+		var country func(string) string
+		if db != nil {
+			country = countryFromDB(db)
+		}
+
+		rollups = newRollups(&cfg.Rollup, rollupWriter, country, log)
+		go rollups.run(ctx)
+		idleWriters = append(idleWriters, rollupWriter)
+
+		// Write the current windows once all messages are processed, before closing the writer
+		sinks.add("rollups", func() {
+			rollups.flush(time.Now(), true)
+			rollupWriter.Close()
+		})
+	}
+
+	// Stopped before the sinks are closed, also on return if the consumer failed to start
+	stopIdleCloser := startIdleCloser(idleWriters...)
+	defer stopIdleCloser()
+
+	var influx *influxSink
+	if cfg.Influx.URL != "" {
+		influx = newInfluxSink(&cfg.Influx, log)
+		go influx.run()
+		sinks.add("influx", influx.Close)
 	}
-	defer func() {
-		validatorWriter.WriteStop()
-		log.Info().Msg("Stopped Validator Parquet writer")
-	}()
 
 	// Set up Clickhouse client
 	chCfg := ch.ClickhouseConfig{
@@ -142,6 +239,7 @@ func RunConsumer(cfg *ConsumerConfig) {
 
 	var chClient *ch.ClickhouseClient
 	if chCfg.Endpoint != "" {
+		var err error
 		chClient, err = ch.NewClickhouseClient(&chCfg)
 		if err != nil {
 			log.Error().Err(err).Msg("Error creating Clickhouse client")
@@ -160,45 +258,63 @@ func RunConsumer(cfg *ConsumerConfig) {
 	}
 
 	consumer := Consumer{
-		log:             log,
-		discoveryWriter: discoveryWriter,
-		metadataWriter:  metadataWriter,
-		validatorWriter: validatorWriter,
-		js:              js,
+		log:     log,
+		writers: writers,
+		js:      js,
 
-		validatorMetadataChan: make(chan *types.MetadataReceivedEvent, 16384),
+		validatorMetadataChan: make(chan *types.MetadataReceivedEvent, validatorQueueSize),
+		rollups:               rollups,
+		influx:                influx,
 
 		chClient: chClient,
 		db:       db,
 		dune:     dune,
-	}
 
-	// Start the consumer
-	go func() {
-		if err := consumer.Start(cfg.Name); err != nil {
-			log.Error().Err(err).Msg("Error in consumer")
-		}
-	}()
+		unknownSchemas: make(map[int]struct{}),
+		decodeStats:    newDecodeStats(),
+		stats:          newRunStats(),
+		storeRaw:       cfg.StoreRaw,
+		wireFormat:     cfg.NatsCfg.WireFormat,
+		ackMode:        cfg.AckMode,
 
-	ipInfoToken := os.Getenv("IPINFO_TOKEN")
-	if ipInfoToken == "" {
-		log.Error().Msg("IPINFO_TOKEN environment variable is required")
+		serializeMetaData: cfg.metaDataSerializer(),
 	}
 
-	go consumer.runValidatorMetadataEventHandler(ipInfoToken)
+	if db == nil {
+		consumer.validatorMetadataChan = nil
+	}
 
-	// Set up HTTP server
-	server := &http.Server{Addr: ":8080", Handler: nil}
-	http.HandleFunc("/validators", createGetValidatorsHandler(db))
+	consumer.pauser = &fetchPauser{cfg: cfg.Backpressure, depth: consumer.queueDepth, log: log}
 
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Error().Err(err).Msg("Error starting HTTP server")
+	go consumer.decodeStats.runReporter(log)
+
+	// Processing outlives ctx while draining, until it's done or the drain timeout expired
+	procCtx, forceStop := context.WithCancel(context.Background())
+	defer forceStop()
+
+	// Start the consumer
+	fetchDone, err := consumer.Start(ctx, procCtx, cfg.Name, cfg.AllowGap, cfg.Strict)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Ephemeral {
+		// After the shutdown report, which looks the consumer up
+		defer consumer.deleteConsumer(cfg.Name)
+	}
+
+	if db != nil {
+		ipInfoToken := os.Getenv("IPINFO_TOKEN")
+		if ipInfoToken == "" {
+			log.Error().Msg("IPINFO_TOKEN environment variable is required")
 		}
-	}()
-	defer func() {
-		server.Shutdown(context.Background())
-	}()
+
+		go func() {
+			if err := consumer.runValidatorMetadataEventHandler(ipInfoToken); err != nil {
+				log.Error().Err(err).Msg("Validator metadata handler stopped")
+			}
+		}()
+	}
 
 	// Start publishing to Dune periodically
 	if dune != nil {
@@ -221,13 +337,43 @@ func RunConsumer(cfg *ConsumerConfig) {
 	}
 
 	// Gracefully shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-	<-quit
+	<-ctx.Done()
+
+	if cfg.DrainTimeout > 0 {
+		log.Info().Dur("timeout", cfg.DrainTimeout).Msg("Shutting down, draining fetched messages")
+
+		select {
+		case <-fetchDone:
+		case <-time.After(cfg.DrainTimeout):
+			log.Warn().Msg("Drain timed out, aborting the remaining messages")
+			forceStop()
+		}
+	} else {
+		log.Info().Msg("Shutting down, aborting in-flight messages")
+		forceStop()
+	}
+
+	// Wait for the message being processed before closing the writers
+	<-fetchDone
+	stopIdleCloser()
+
+	consumer.stats.setSinks(sinks.close(cfg.CloseTimeout, log))
+	return consumer.stats.report(consumer.durable, log), nil
+}
+
+// registerAPIHandlers registers the consumer's HTTP endpoints.
+func registerAPIHandlers(mux *http.ServeMux, db *sql.DB, logger zerolog.Logger) {
+	mux.HandleFunc("/validators", createGetValidatorsHandler(db, logger))
+	mux.HandleFunc("/loglevel", log.LevelHandler)
+	mux.Handle("/metrics", promhttp.Handler())
 }
 
-func (c *Consumer) Start(name string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Start creates the durable consumer and starts fetching messages until ctx is cancelled.
+// Messages are processed with procCtx: the rest of the last fetched batch is still
+// processed after ctx is cancelled, until procCtx is cancelled too, and then negatively
+// acknowledged. The returned channel is closed once the fetch loop stopped.
+func (c *Consumer) Start(ctx, procCtx context.Context, name string, allowGap, strict bool) (<-chan struct{}, error) {
+	setupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Set up a consumer
@@ -239,20 +385,39 @@ func (c *Consumer) Start(name string) error {
 	}
 
 	// TODO: Change the stream name to 'valtrack'
-	stream, err := c.js.Stream(ctx, "EVENTS")
+	stream, err := c.js.Stream(setupCtx, "EVENTS")
 	if err != nil {
 		c.log.Error().Err(err).Msg("Error opening valtrack jetstream")
-		return err
+		return nil, err
 	}
 
-	consumer, err := stream.CreateOrUpdateConsumer(ctx, consumerCfg)
+	if err := c.checkConsumerConflict(setupCtx, stream, consumerCfg, strict); err != nil {
+		return nil, err
+	}
+
+	consumer, err := stream.CreateOrUpdateConsumer(setupCtx, consumerCfg)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Error creating consumer")
-		return err
+		return nil, err
+	}
+
+	if err := c.checkResumeGap(setupCtx, stream, consumer, allowGap); err != nil {
+		return nil, err
 	}
 
+	c.durable = consumer
+
+	done := make(chan struct{})
 	go func() {
-		for {
+		defer close(done)
+
+		for ctx.Err() == nil {
+			// Messages aren't fetched while they'd wait on a full queue
+			c.pauser.wait(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
 			batch, err := consumer.FetchNoWait(BATCH_SIZE)
 			if err != nil {
 				c.log.Error().Err(err).Msg("Error fetching batch of messages")
@@ -264,53 +429,291 @@ func (c *Consumer) Start(name string) error {
 			}
 
 			for msg := range batch.Messages() {
-				handleMessage(c, msg)
-			}
+				// Hand the rest of the batch back when the drain is aborted, so it's redelivered
+				// after a restart
+				if procCtx.Err() != nil {
+					c.stats.record(msg.Subject(), resultRedelivered)
+					nakMessage(c.log, msg)
+					continue
+				}
 
+				handleMessage(procCtx, c, msg)
+			}
 		}
 	}()
 
+	return done, nil
+}
+
+// deleteConsumer deletes the JetStream consumer, so ephemeral runs don't leave it behind on
+// the server.
+func (c *Consumer) deleteConsumer(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.js.DeleteConsumer(ctx, "EVENTS", name); err != nil {
+		c.log.Error().Err(err).Str("consumer", name).Msg("Failed to delete ephemeral consumer")
+		return
+	}
+
+	c.log.Info().Str("consumer", name).Msg("Deleted ephemeral consumer")
+}
+
+// checkResumeGap verifies that the messages after the consumer's ack floor are still in
+// the stream. If the stream already dropped some of them (e.g. because of its limits
+// while the consumer was down), they are lost, so we refuse to start unless allowGap is set.
+func (c *Consumer) checkResumeGap(ctx context.Context, stream jetstream.Stream, consumer jetstream.Consumer, allowGap bool) error {
+	cInfo, err := consumer.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching consumer info: %w", err)
+	}
+
+	sInfo, err := stream.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching stream info: %w", err)
+	}
+
+	var gap uint64
+	// A consumer that never acknowledged anything starts at the beginning of the stream.
+	resumeSeq := cInfo.AckFloor.Stream + 1
+	if cInfo.AckFloor.Stream > 0 && resumeSeq < sInfo.State.FirstSeq {
+		gap = sInfo.State.FirstSeq - resumeSeq
+	}
+
+	resumeGap.Set(float64(gap))
+
+	if gap == 0 {
+		return nil
+	}
+
+	c.log.Warn().
+		Uint64("resume_seq", resumeSeq).
+		Uint64("first_seq", sInfo.State.FirstSeq).
+		Uint64("gap", gap).
+		Msgf("Resume point is no longer in the stream, %d messages were lost", gap)
+
+	if !allowGap {
+		return fmt.Errorf("%d messages between sequence %d and %d are no longer in the stream (use --allow-gap to start anyway)", gap, resumeSeq, sInfo.State.FirstSeq-1)
+	}
+
+	return nil
+}
+
+// checkConsumerConflict compares the configuration of an existing durable consumer with
+// the one we're about to create. CreateOrUpdateConsumer silently updates it, which changes
+// the delivery behavior for any other instance using the same name, so conflicts are
+// logged, and refused if strict is set.
+func (c *Consumer) checkConsumerConflict(ctx context.Context, stream jetstream.Stream, desired jetstream.ConsumerConfig, strict bool) error {
+	existing, err := stream.Consumer(ctx, desired.Durable)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching consumer info: %w", err)
+	}
+
+	info := existing.CachedInfo()
+	fields := consumerConfigConflicts(info.Config, desired)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	for _, field := range fields {
+		consumerConflicts.WithLabelValues(field).Inc()
+	}
+
+	c.log.Warn().
+		Str("consumer", desired.Durable).
+		Strs("fields", fields).
+		Int("waiting_pulls", info.NumWaiting).
+		Int("ack_pending", info.NumAckPending).
+		Msg("Durable consumer already exists with a different configuration, another instance may be using it")
+
+	if strict {
+		return fmt.Errorf("durable consumer %s already exists with a different %s (remove --strict to update it)", desired.Durable, strings.Join(fields, ", "))
+	}
+
 	return nil
 }
 
-func handleMessage(c *Consumer, msg jetstream.Msg) {
-	md, _ := msg.Metadata()
+// consumerConfigConflicts returns the names of the fields of the desired consumer config
+// that differ from the existing one. Fields the server fills with a default are only
+// compared when we set them.
+func consumerConfigConflicts(existing, desired jetstream.ConsumerConfig) []string {
+	var fields []string
+
+	if existing.Description != desired.Description {
+		fields = append(fields, "description")
+	}
+	if existing.AckPolicy != desired.AckPolicy {
+		fields = append(fields, "ack_policy")
+	}
+	if existing.DeliverPolicy != desired.DeliverPolicy {
+		fields = append(fields, "deliver_policy")
+	}
+	if existing.ReplayPolicy != desired.ReplayPolicy {
+		fields = append(fields, "replay_policy")
+	}
+	if existing.FilterSubject != desired.FilterSubject || !slices.Equal(existing.FilterSubjects, desired.FilterSubjects) {
+		fields = append(fields, "filter_subjects")
+	}
+	if desired.AckWait != 0 && existing.AckWait != desired.AckWait {
+		fields = append(fields, "ack_wait")
+	}
+	if desired.MaxDeliver != 0 && existing.MaxDeliver != desired.MaxDeliver {
+		fields = append(fields, "max_deliver")
+	}
+	if desired.MaxAckPending != 0 && existing.MaxAckPending != desired.MaxAckPending {
+		fields = append(fields, "max_ack_pending")
+	}
+
+	return fields
+}
+
+func handleMessage(ctx context.Context, c *Consumer, msg jetstream.Msg) {
+	md, err := msg.Metadata()
+	if err != nil {
+		c.log.Error().Err(err).Str("subject", msg.Subject()).Msg("Error reading message metadata")
+		return
+	}
+
+	logger := c.log.With().Str("subject", msg.Subject()).Uint64("seq", md.Sequence.Stream).Logger()
 	progress := float64(md.Sequence.Stream) / (float64(md.NumPending) + float64(md.Sequence.Stream)) * 100
 
-	switch msg.Subject() {
-	case "events.peer_discovered":
-		var event types.PeerDiscoveredEvent
-		if err := json.Unmarshal(msg.Data(), &event); err != nil {
-			c.log.Err(err).Msg("Error unmarshaling PeerDiscoveredEvent")
-			msg.Term()
-			return
+	data := msg.Data()
+
+	info := messageInfo{format: c.wireFormat, ingestedAt: time.Now().UnixMilli()}
+	if h := msg.Headers(); h != nil {
+		if encoding := h.Get(types.ContentEncodingHeader); encoding != "" {
+			if data, err = decompressPayload(encoding, data); err != nil {
+				c.decodeStats.record(msg.Subject(), true)
+				c.stats.record(msg.Subject(), resultFailed)
+				logger.Error().Err(err).Msg("Error decompressing event")
+				if err := msg.Term(); err != nil {
+					logger.Error().Err(err).Msg("Error terminating message")
+				}
+				return
+			}
+		}
+
+		if format := h.Get(types.WireFormatHeader); format != "" {
+			info.format = types.WireFormat(format)
 		}
 
-		c.log.Info().Time("timestamp", md.Timestamp).Uint64("pending", md.NumPending).Str("progress", fmt.Sprintf("%.2f%%", progress)).Msg("peer_discovered")
-		c.storeDiscoveryEvent(event)
+		info.crawlerID = h.Get(types.CrawlerIDHeader)
+		info.crawlerLoc = h.Get(types.CrawlerLocationHeader)
+		info.crawlerVer = h.Get(types.CrawlerVersionHeader)
+	}
+
+	err = c.processEvent(ctx, msg.Subject(), info, data)
+	switch {
+	case errors.Is(err, errUnknownSubject):
+		c.stats.record(msg.Subject(), resultUnknown)
+		logger.Warn().Msg("Unknown event type")
+
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		// Interrupted by the shutdown, so have it redelivered after a restart
+		c.stats.record(msg.Subject(), resultRedelivered)
+		logger.Warn().Msg("Processing cancelled, message will be redelivered")
+		nakMessage(logger, msg)
+		return
+
+	case errors.Is(err, errWriteFailed):
+		// Not persisted, so have it redelivered instead of acknowledging it
+		c.stats.record(msg.Subject(), resultFailed)
+		logger.Error().Err(err).Msg("Error storing event, message will be redelivered")
+		nakMessage(logger, msg)
+		return
 
-	case "events.metadata_received":
-		var event types.MetadataReceivedEvent
-		if err := json.Unmarshal(msg.Data(), &event); err != nil {
-			c.log.Err(err).Msg("Error unmarshaling MetadataReceivedEvent")
-			msg.Term()
-			return
+	case err != nil:
+		c.stats.record(msg.Subject(), resultFailed)
+		logger.Error().Err(err).Msg("Error unmarshaling event")
+		if err := msg.Term(); err != nil {
+			logger.Error().Err(err).Msg("Error terminating message")
 		}
+		return
+
+	default:
+		c.stats.record(msg.Subject(), resultStored)
+		c.log.Info().Time("timestamp", md.Timestamp).Uint64("pending", md.NumPending).Str("progress", fmt.Sprintf("%.2f%%", progress)).Msg(types.EventType(msg.Subject()))
+	}
 
-		c.log.Info().Time("timestamp", md.Timestamp).Uint64("pending", md.NumPending).Str("progress", fmt.Sprintf("%.2f%%", progress)).Msg("metadata_received")
-		c.handleMetadataEvent(event)
-		c.storeMetadataEvent(event)
+	if err := c.ackMode.ack(ctx, msg); err != nil {
+		logger.Error().Err(err).Msg("Error acknowledging message")
+	}
+}
 
+// decompressPayload decompresses a payload published with the given content encoding.
+func decompressPayload(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case types.ContentEncodingGzip:
+		return types.Gunzip(data)
 	default:
-		c.log.Warn().Str("subject", msg.Subject()).Msg("Unknown event type")
+		return nil, fmt.Errorf("unknown content encoding: %s", encoding)
 	}
+}
 
-	if err := msg.Ack(); err != nil {
-		c.log.Err(err).Msg("Error acknowledging message")
+// nakMessage asks for a message to be redelivered.
+func nakMessage(logger zerolog.Logger, msg jetstream.Msg) {
+	if err := msg.Nak(); err != nil {
+		logger.Error().Err(err).Str("subject", msg.Subject()).Msg("Error negatively acknowledging message")
 	}
 }
 
-func (c *Consumer) handleMetadataEvent(event types.MetadataReceivedEvent) {
+var errUnknownSubject = errors.New("unknown event subject")
+
+// messageInfo is what we know about an event from its message, besides the payload.
+type messageInfo struct {
+	// format is the wire format of the payload, JSON if empty
+	format types.WireFormat
+	// The crawler fields, sent in headers with the compact format
+	crawlerID  string
+	crawlerLoc string
+	crawlerVer string
+	// ingestedAt is when the consumer received the event, in Unix milliseconds
+	ingestedAt int64
+}
+
+// processEvent decodes an event published on `subject` and stores it. It returns
+// errUnknownSubject for subjects we don't consume, the decoding error, or the context
+// error if storing was cancelled.
+func (c *Consumer) processEvent(ctx context.Context, subject string, info messageInfo, data []byte) error {
+	if info.format == "" {
+		info.format = types.WireFormatJSON
+	}
+
+	t, ok := eventTypesBySubject[subject]
+	if !ok {
+		return errUnknownSubject
+	}
+
+	return t.process(ctx, c, payload{subject: subject, info: info, data: data}, c.writers[t.output])
+}
+
+// checkSchemaVersion warns (once per version) about events produced with a newer schema
+// than this consumer knows. Fields added in that version are dropped when storing the event.
+func (c *Consumer) checkSchemaVersion(version int) {
+	if version <= ethereum.EventSchemaVersion {
+		return
+	}
+
+	if _, ok := c.unknownSchemas[version]; ok {
+		return
+	}
+
+	c.unknownSchemas[version] = struct{}{}
+	c.log.Warn().Int("schema_version", version).Int("supported_version", ethereum.EventSchemaVersion).Msg("Received event with a newer schema version, unknown fields will be dropped")
+}
+
+// handleMetadataEvent stores a validator event if the metadata indicates the peer runs
+// validators. It only returns an error if the context was cancelled before the event was
+// handed to any sink. Once it was, a redelivery would duplicate it, so the remaining sinks
+// are skipped if cancelled meanwhile and the message is acknowledged.
+func (c *Consumer) handleMetadataEvent(ctx context.Context, event types.MetadataReceivedEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Extract the long lived subnets from the metadata
 	longLived := indexesFromBitfield(event.MetaData.Attnets)
 
@@ -320,10 +723,17 @@ func (c *Consumer) handleMetadataEvent(event types.MetadataReceivedEvent) {
 		// If the subscribed subnets and the longLived subnets are the same,
 		// then there's probably no validator OR
 		// If the longLived subnets are not equal to 2
-		return
+		return nil
 	}
 
-	c.validatorMetadataChan <- &event
+	// Not set when converting a file, where IP metadata isn't looked up
+	if c.validatorMetadataChan != nil {
+		select {
+		case c.validatorMetadataChan <- &event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 
 	validatorEvent := types.ValidatorEvent{
 		ENR:               event.ENR,
@@ -342,29 +752,157 @@ func (c *Consumer) handleMetadataEvent(event types.MetadataReceivedEvent) {
 	}
 
 	if c.chClient != nil {
-		c.chClient.ValidatorEventChan <- &validatorEvent
-		c.log.Info().Any("validator_event", validatorEvent).Msg("Inserted validator event")
+		select {
+		case c.chClient.ValidatorEventChan <- &validatorEvent:
+			c.log.Info().Any("validator_event", validatorEvent).Msg("Inserted validator event")
+		case <-ctx.Done():
+			if c.validatorMetadataChan == nil {
+				return ctx.Err()
+			}
+			c.log.Warn().Str("peer", validatorEvent.ID).Msg("Processing cancelled, validator event not inserted into ClickHouse")
+		}
 	}
 
-	if err := c.validatorWriter.Write(validatorEvent); err != nil {
-		c.log.Err(err).Msg("Failed to write validator event to Parquet file")
-	} else {
-		c.log.Trace().Msg("Wrote validator event to Parquet file")
+	if err := c.writers[validatorOutput].Write(time.UnixMilli(validatorEvent.Timestamp), validatorEvent); err != nil {
+		return fmt.Errorf("failed to write validator event to Parquet file: %w", err)
 	}
+
+	c.log.Trace().Msg("Wrote validator event to Parquet file")
+	return nil
 }
 
-func (c *Consumer) storeDiscoveryEvent(event types.PeerDiscoveredEvent) {
-	if err := c.discoveryWriter.Write(event); err != nil {
-		c.log.Err(err).Msg("Failed to write discovery event to Parquet file")
-	} else {
-		c.log.Trace().Msg("Wrote discovery event to Parquet file")
+// storeDiscoveryEvent writes the event to Parquet. It returns the context error if it was
+// cancelled before the event was written, or the write error, which wraps errWriteFailed
+// if the message should be redelivered. The event is only sent to InfluxDB once written,
+// so redeliveries aren't counted twice.
+func (c *Consumer) storeDiscoveryEvent(ctx context.Context, event types.PeerDiscoveredEvent, w *PartitionedWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := w.Write(time.UnixMilli(event.Timestamp), event); err != nil {
+		return fmt.Errorf("failed to write discovery event to Parquet file: %w", err)
+	}
+
+	c.log.Trace().Msg("Wrote discovery event to Parquet file")
+
+	if c.influx != nil {
+		c.influx.addPeerDiscovered(&event)
 	}
+
+	return nil
 }
 
-func (c *Consumer) storeMetadataEvent(event types.MetadataReceivedEvent) {
-	if err := c.metadataWriter.Write(event); err != nil {
-		c.log.Err(err).Msg("Failed to write metadata event to Parquet file")
-	} else {
+// storeMetadataEvent writes the event to Parquet, see storeDiscoveryEvent.
+func (c *Consumer) storeMetadataEvent(ctx context.Context, event types.MetadataReceivedEvent, w *PartitionedWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if c.rollups == nil || !c.rollups.cfg.Only {
+		row, err := newMetadataRow(&event, c.serializeMetaData)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metadata: %w", err)
+		}
+
+		if err := w.Write(time.UnixMilli(event.Timestamp), row); err != nil {
+			return fmt.Errorf("failed to write metadata event to Parquet file: %w", err)
+		}
+
 		c.log.Trace().Msg("Wrote metadata event to Parquet file")
 	}
+
+	// Only count the event once it's written, a failed write has it redelivered
+	if c.rollups != nil {
+		c.rollups.add(&event)
+	}
+
+	if c.influx != nil {
+		c.influx.addMetadata(&event)
+	}
+
+	return nil
+}
+
+// storeAttnetsChangedEvent writes the event to Parquet, see storeDiscoveryEvent.
+func (c *Consumer) storeAttnetsChangedEvent(ctx context.Context, event types.AttnetsChangedEvent, w *PartitionedWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := w.Write(time.UnixMilli(event.Timestamp), event); err != nil {
+		return fmt.Errorf("failed to write attnets changed event to Parquet file: %w", err)
+	}
+
+	c.log.Trace().Msg("Wrote attnets changed event to Parquet file")
+	return nil
+}
+
+// storeHeartbeatEvent records the time of the sentry's last heartbeat and writes the event
+// to Parquet, see storeDiscoveryEvent.
+func (c *Consumer) storeHeartbeatEvent(ctx context.Context, event types.HeartbeatEvent, w *PartitionedWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lastHeartbeat.WithLabelValues(event.CrawlerID).Set(float64(event.Timestamp) / 1000)
+
+	if err := w.Write(time.UnixMilli(event.Timestamp), event); err != nil {
+		return fmt.Errorf("failed to write heartbeat event to Parquet file: %w", err)
+	}
+
+	c.log.Trace().Msg("Wrote heartbeat event to Parquet file")
+
+	if c.influx != nil {
+		c.influx.addHeartbeat(&event)
+	}
+
+	return nil
+}
+
+// storeHandshakeFailedEvent writes a failed handshake to Parquet, see storeDiscoveryEvent.
+func (c *Consumer) storeHandshakeFailedEvent(ctx context.Context, event types.HandshakeFailedEvent, w *PartitionedWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := w.Write(time.UnixMilli(event.Timestamp), event); err != nil {
+		return fmt.Errorf("failed to write handshake failed event to Parquet file: %w", err)
+	}
+
+	c.log.Trace().Msg("Wrote handshake failed event to Parquet file")
+
+	if c.influx != nil {
+		c.influx.addHandshakeFailed(&event)
+	}
+
+	return nil
+}
+
+// storeSuspiciousPeerEvent writes a suspicious IP to Parquet, see storeDiscoveryEvent.
+func (c *Consumer) storeSuspiciousPeerEvent(ctx context.Context, event types.SuspiciousPeerEvent, w *PartitionedWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := w.Write(time.UnixMilli(event.Timestamp), event); err != nil {
+		return fmt.Errorf("failed to write suspicious peer event to Parquet file: %w", err)
+	}
+
+	c.log.Trace().Msg("Wrote suspicious peer event to Parquet file")
+	return nil
+}
+
+// storePeerChurnEvent writes a connection transition to Parquet, see storeDiscoveryEvent.
+func (c *Consumer) storePeerChurnEvent(ctx context.Context, event types.PeerChurnEvent, w *PartitionedWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := w.Write(time.UnixMilli(event.Timestamp), event); err != nil {
+		return fmt.Errorf("failed to write peer churn event to Parquet file: %w", err)
+	}
+
+	c.log.Trace().Msg("Wrote peer churn event to Parquet file")
+	return nil
 }
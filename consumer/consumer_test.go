@@ -0,0 +1,359 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	ch "github.com/chainbound/valtrack/clickhouse"
+	"github.com/chainbound/valtrack/types"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prysmaticlabs/go-bitfield"
+	"github.com/rs/zerolog"
+)
+
+// Every subject the sentry publishes on must be handled by the consumer.
+func TestProcessEventHandlesAllSubjects(t *testing.T) {
+	c := &Consumer{log: zerolog.Nop(), decodeStats: newDecodeStats()}
+
+	for _, subject := range types.AllSubjects() {
+		// Invalid payloads fail to decode, after the subject was matched
+		err := c.processEvent(context.Background(), subject, messageInfo{}, []byte("invalid"))
+		if err == nil || errors.Is(err, errUnknownSubject) {
+			t.Errorf("%s: expected a decoding error, got %v", subject, err)
+		}
+	}
+}
+
+// The registered event types, and the validator output, make up the Parquet outputs.
+func TestOutputSchemas(t *testing.T) {
+	want := []string{"attnets_changed_events", "discovery_events", "handshake_failed_events", "heartbeat_events", "metadata_events", "peer_churn_events", "suspicious_peer_events", "validator_metadata_events"}
+
+	var got []string
+	for name := range OutputSchemas {
+		got = append(got, name)
+	}
+	slices.Sort(got)
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected outputs %v, got %v", want, got)
+	}
+}
+
+// Ephemeral consumers are deleted on shutdown, durable ones are kept.
+func TestEphemeralConsumerDeleted(t *testing.T) {
+	for _, ephemeral := range []bool{false, true} {
+		url, js := runJetStream(t)
+
+		stop := startConsumer(t, &ConsumerConfig{
+			Name:      "test",
+			NatsURL:   url,
+			Ephemeral: ephemeral,
+			WriterCfg: WriterConfig{Dir: t.TempDir(), Prefix: "test", PartitionBy: PartitionNone},
+		})
+
+		waitFor(t, "the consumer to be created", func() bool {
+			_, err := js.Consumer(context.Background(), "EVENTS", "test")
+			return err == nil
+		})
+
+		if _, err := stop(); err != nil {
+			t.Fatalf("consumer failed: %v", err)
+		}
+
+		_, err := js.Consumer(context.Background(), "EVENTS", "test")
+		if deleted := errors.Is(err, jetstream.ErrConsumerNotFound); deleted != ephemeral {
+			t.Errorf("ephemeral %v: expected deleted %v, got %v", ephemeral, ephemeral, err)
+		}
+	}
+}
+
+// Sync acks wait for the server, and are aborted on shutdown.
+func TestAckSync(t *testing.T) {
+	_, js := runJetStream(t)
+
+	for i := 0; i < 2; i++ {
+		publish(t, js, types.SubjectPeerDiscovered, types.WireFormatJSON, false, &types.PeerDiscoveredEvent{ID: fmt.Sprintf("peer-%d", i), Timestamp: time.Now().UnixMilli()})
+	}
+
+	if err := AckSync.ack(context.Background(), fetch(t, js, "test")); err != nil {
+		t.Fatalf("unexpected ack error: %v", err)
+	}
+	if info := consumerInfo(t, js, "test"); info.AckFloor.Stream != 1 {
+		t.Fatalf("expected the first message to be acked, got ack floor %d", info.AckFloor.Stream)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := AckSync.ack(ctx, fetch(t, js, "test")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the ack to be aborted, got %v", err)
+	}
+}
+
+// Events published by the sentry end up as rows in the consumer's Parquet files, once.
+func TestStreamConsumerRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	url, js := runJetStream(t)
+
+	now := time.Now().UnixMilli()
+	events := []struct {
+		subject string
+		format  types.WireFormat
+		gzip    bool
+		event   interface{ MsgID() string }
+	}{
+		{types.SubjectPeerDiscovered, types.WireFormatProtobuf, true, &types.PeerDiscoveredEvent{ID: "peer-1", IP: "1.2.3.4", Port: 9000, Timestamp: now}},
+		{types.SubjectPeerDiscovered, types.WireFormatJSON, false, &types.PeerDiscoveredEvent{ID: "peer-2", IP: "5.6.7.8", Port: 9000, Timestamp: now}},
+		// A retried publish, which the stream drops within its deduplication window
+		{types.SubjectPeerDiscovered, types.WireFormatJSON, false, &types.PeerDiscoveredEvent{ID: "peer-2", IP: "5.6.7.8", Port: 9000, Timestamp: now}},
+		{types.SubjectAttnetsChanged, types.WireFormatJSON, false, &types.AttnetsChangedEvent{ID: "peer-1", AddedSubnets: []int64{3}, Timestamp: now}},
+		{types.SubjectHeartbeat, types.WireFormatJSON, true, &types.HeartbeatEvent{CrawlerID: "crawler", ConnectedPeers: 10, Timestamp: now}},
+		{types.SubjectHandshakeFailed, types.WireFormatJSON, false, &types.HandshakeFailedEvent{ID: "peer-3", Reason: "fork_digest", Timestamp: now}},
+		{types.SubjectMetadataReceived, types.WireFormatProtobuf, false, &types.MetadataReceivedEvent{ID: "peer-1", MetaData: &types.SimpleMetaData{
+			SeqNumber: 42,
+			Attnets:   bitfield.Bitvector64{0x03, 0, 0, 0, 0, 0, 0, 0x80},
+			Syncnets:  bitfield.Bitvector4{0x01},
+		}, Timestamp: now}},
+	}
+
+	for i, e := range events {
+		if ack := publish(t, js, e.subject, e.format, e.gzip, e.event); ack.Duplicate != (i == 2) {
+			t.Fatalf("%s: expected duplicate %v, got %v", e.subject, i == 2, ack.Duplicate)
+		}
+	}
+
+	stop := startConsumer(t, &ConsumerConfig{
+		Name:      "test",
+		NatsURL:   url,
+		WriterCfg: WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionNone},
+	})
+
+	waitProcessed(t, js, "test")
+
+	report, err := stop()
+	if err != nil {
+		t.Fatalf("consumer failed: %v", err)
+	}
+
+	if got := report.Stored[types.EventType(types.SubjectPeerDiscovered)]; got != 2 {
+		t.Errorf("expected 2 discovered peers in the shutdown report, got %d", got)
+	}
+	if report.Failed != 0 || report.Unknown != 0 || report.Redelivered != 0 {
+		t.Errorf("expected no failed, unknown or redelivered messages in the shutdown report, got %+v", report)
+	}
+	if report.ResumeSeq != 7 || report.Pending != 0 {
+		t.Errorf("expected to resume after the last message, got sequence %d with %d pending", report.ResumeSeq, report.Pending)
+	}
+
+	for file, rows := range map[string]int64{
+		"discovery_events_test.parquet":        2,
+		"attnets_changed_events_test.parquet":  1,
+		"heartbeat_events_test.parquet":        1,
+		"handshake_failed_events_test.parquet": 1,
+		"metadata_events_test.parquet":         1,
+	} {
+		if got := countRows(t, filepath.Join(dir, file)); got != rows {
+			t.Errorf("%s: expected %d rows, got %d", file, rows, got)
+		}
+	}
+
+	var ids []string
+	err = readRows(filepath.Join(dir, "discovery_events_test.parquet"), new(types.PeerDiscoveredEvent), reflect.TypeOf(types.PeerDiscoveredEvent{}), func(row reflect.Value) error {
+		ids = append(ids, row.Interface().(types.PeerDiscoveredEvent).ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ids, []string{"peer-1", "peer-2"}) {
+		t.Errorf("expected the discovered peers in order, got %v", ids)
+	}
+
+	// The metadata column is JSON with hex-encoded bitfields
+	var metadata []string
+	err = readRows(filepath.Join(dir, "metadata_events_test.parquet"), new(MetadataRow), reflect.TypeOf(MetadataRow{}), func(row reflect.Value) error {
+		metadata = append(metadata, row.Interface().(MetadataRow).MetaData)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metadata) != 1 {
+		t.Fatalf("expected 1 metadata row, got %d", len(metadata))
+	}
+
+	var md map[string]any
+	if err := json.Unmarshal([]byte(metadata[0]), &md); err != nil {
+		t.Fatalf("metadata column isn't JSON: %v", err)
+	}
+
+	want := map[string]any{"seq_number": float64(42), "attnets": "0300000000000080", "syncnets": "01"}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("expected metadata %v, got %v", want, md)
+	}
+}
+
+// Messages that can't be decoded are terminated, so they aren't redelivered.
+func TestInvalidMessageTerminated(t *testing.T) {
+	dir := t.TempDir()
+	url, js := runJetStream(t)
+
+	if _, err := js.Publish(context.Background(), types.SubjectPeerDiscovered, []byte("invalid")); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, js, types.SubjectPeerDiscovered, types.WireFormatJSON, false, &types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()})
+
+	stop := startConsumer(t, &ConsumerConfig{
+		Name:      "test",
+		NatsURL:   url,
+		WriterCfg: WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionNone},
+	})
+
+	waitProcessed(t, js, "test")
+
+	report, err := stop()
+	if err != nil {
+		t.Fatalf("consumer failed: %v", err)
+	}
+
+	if info := consumerInfo(t, js, "test"); info.Delivered.Consumer != 2 {
+		t.Errorf("expected each message to be delivered once, got %d deliveries", info.Delivered.Consumer)
+	}
+	if report.Failed != 1 {
+		t.Errorf("expected 1 failed message in the shutdown report, got %d", report.Failed)
+	}
+
+	checkRows(t, dir, map[string]int64{"discovery_events_test.parquet": 1})
+}
+
+// Messages whose event couldn't be written are redelivered until it is.
+func TestFailedWriteRedelivered(t *testing.T) {
+	dir := t.TempDir()
+	url, js := runJetStream(t)
+
+	publish(t, js, types.SubjectPeerDiscovered, types.WireFormatJSON, false, &types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()})
+
+	// The output directory is a file at first, so the Parquet file can't be created
+	out := filepath.Join(dir, "out")
+	if err := os.WriteFile(out, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := startConsumer(t, &ConsumerConfig{
+		Name:      "test",
+		NatsURL:   url,
+		WriterCfg: WriterConfig{Dir: out, Prefix: "test", PartitionBy: PartitionNone},
+	})
+
+	waitFor(t, "the message to be redelivered", func() bool {
+		consumer, err := js.Consumer(context.Background(), "EVENTS", "test")
+		if err != nil {
+			return false
+		}
+
+		info, err := consumer.Info(context.Background())
+		return err == nil && info.Delivered.Consumer > 1
+	})
+
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	waitProcessed(t, js, "test")
+
+	if _, err := stop(); err != nil {
+		t.Fatalf("consumer failed: %v", err)
+	}
+
+	checkRows(t, out, map[string]int64{"discovery_events_test.parquet": 1})
+}
+
+// Messages whose processing was cancelled by the shutdown are redelivered, not acked.
+func TestCancelledMessageNaked(t *testing.T) {
+	_, js := runJetStream(t)
+
+	publish(t, js, types.SubjectPeerDiscovered, types.WireFormatJSON, false, &types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()})
+
+	c := &Consumer{log: zerolog.Nop(), decodeStats: newDecodeStats(), stats: newRunStats()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handleMessage(ctx, c, fetch(t, js, "test"))
+
+	md, err := fetch(t, js, "test").Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if md.NumDelivered != 2 {
+		t.Fatalf("expected the message to be redelivered, got %d deliveries", md.NumDelivered)
+	}
+}
+
+// A metadata event whose validator event was already handed off is acked and stored even if
+// cancelled meanwhile, so a redelivery doesn't duplicate the validator event.
+func TestCancelledValidatorEventAcked(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionNone}
+
+	_, js := runJetStream(t)
+	publish(t, js, types.SubjectMetadataReceived, types.WireFormatJSON, false, &types.MetadataReceivedEvent{
+		ID:                "peer",
+		MetaData:          &types.SimpleMetaData{Attnets: bitfield.Bitvector64{0x03, 0, 0, 0, 0, 0, 0, 0}},
+		SubscribedSubnets: []int64{0, 1, 5},
+		Timestamp:         time.Now().UnixMilli(),
+	})
+
+	c := &Consumer{
+		log:            zerolog.Nop(),
+		decodeStats:    newDecodeStats(),
+		stats:          newRunStats(),
+		unknownSchemas: make(map[int]struct{}),
+		writers: map[string]*PartitionedWriter{
+			"metadata_events": NewPartitionedWriter("metadata_events", new(MetadataRow), cfg, zerolog.Nop()),
+			validatorOutput:   NewPartitionedWriter(validatorOutput, new(types.ValidatorEvent), cfg, zerolog.Nop()),
+		},
+		validatorMetadataChan: make(chan *types.MetadataReceivedEvent),
+		// Never drained, so the shutdown interrupts the ClickHouse insert
+		chClient:          &ch.ClickhouseClient{ValidatorEventChan: make(chan *types.ValidatorEvent)},
+		serializeMetaData: SerializeMetaData,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-c.validatorMetadataChan
+		cancel()
+	}()
+
+	handleMessage(ctx, c, fetch(t, js, "test"))
+	for _, w := range c.writers {
+		w.Close()
+	}
+
+	waitProcessed(t, js, "test")
+
+	if info := consumerInfo(t, js, "test"); info.Delivered.Consumer != 1 {
+		t.Fatalf("expected the message to be acked, got %d deliveries", info.Delivered.Consumer)
+	}
+
+	for file, rows := range map[string]int64{
+		"metadata_events_test.parquet":           1,
+		"validator_metadata_events_test.parquet": 1,
+	} {
+		if got := countRows(t, filepath.Join(dir, file)); got != rows {
+			t.Errorf("%s: expected %d rows, got %d", file, rows, got)
+		}
+	}
+}
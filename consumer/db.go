@@ -13,6 +13,7 @@ import (
 	"github.com/ipinfo/go/v2/ipinfo"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 var (
@@ -95,10 +96,10 @@ type asnJSON struct {
 	Type            string `json:"type"`
 }
 
-func loadIPMetadataFromCSV(db *sql.DB, path string) error {
+func loadIPMetadataFromCSV(db *sql.DB, path string, log zerolog.Logger) error {
 	file, err := os.Open(path)
 	if err != nil {
-		errors.Wrap(err, fmt.Sprintf("Error opening csv file: %s", path))
+		return errors.Wrap(err, fmt.Sprintf("Error opening csv file: %s", path))
 	}
 
 	defer file.Close()
@@ -107,46 +108,51 @@ func loadIPMetadataFromCSV(db *sql.DB, path string) error {
 
 	ips, err := r.ReadAll()
 	if err != nil {
-		errors.Wrap(err, "Error reading csv records")
+		return errors.Wrap(err, "Error reading csv records")
 	}
 
 	var rowCountStr string
 	err = db.QueryRow("SELECT COUNT(ip) FROM ip_metadata").Scan(&rowCountStr)
 	if err != nil {
-		errors.Wrap(err, "Error querying ip_metadata database")
+		return errors.Wrap(err, "Error querying ip_metadata database")
 	}
 
 	rowCount, _ := strconv.Atoi(rowCountStr)
 	if rowCount == 0 {
 		tx, err := db.Begin()
 		if err != nil {
-			errors.Wrap(err, "Error beginning transaction")
+			return errors.Wrap(err, "Error beginning transaction")
 		}
 
 		stmt, err := tx.Prepare(insertIpMetadataQuery)
 		if err != nil {
-			errors.Wrap(err, "Error preparing insert statement")
+			tx.Rollback()
+			return errors.Wrap(err, "Error preparing insert statement")
 		}
+		defer stmt.Close()
 
 		for _, ip := range ips {
 			parts := strings.Split(ip[5], ",")
 			lat, _ := strconv.ParseFloat(parts[0], 64)
 			long, _ := strconv.ParseFloat(parts[1], 64)
 
+			// Rows without valid ASN data are still inserted, without the ASN fields
 			var asnJson asnJSON
 			if err := json.Unmarshal([]byte(ip[8]), &asnJson); err != nil {
-				errors.Wrap(err, fmt.Sprintf("Error unmarshalling ASN JSON: %s", ip[8]))
+				log.Warn().Err(err).Str("ip", ip[0]).Str("asn", ip[8]).Msg("Error unmarshalling ASN JSON, inserting the row without ASN data")
 			}
+
 			// `INSERT INTO ip_metadata (ip, hostname, city, region, country, latitude, longitude, postal_code, asn, asn_organization, asn_type) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 			_, err := stmt.Exec(ip[0], ip[1], ip[2], ip[3], ip[4], lat, long, ip[7], asnJson.Asn, asnJson.AsnOrganization, asnJson.Type)
 			if err != nil {
-				errors.Wrap(err, "Error inserting row")
+				tx.Rollback()
+				return errors.Wrap(err, fmt.Sprintf("Error inserting row for %s", ip[0]))
 			}
 		}
 
 		err = tx.Commit()
 		if err != nil {
-			errors.Wrap(err, "Error committing transaction")
+			return errors.Wrap(err, "Error committing transaction")
 		}
 
 	}
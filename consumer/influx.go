@@ -0,0 +1,267 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chainbound/valtrack/pkg/ethereum"
+	"github.com/chainbound/valtrack/types"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultInfluxBatchSize     = 5000
+	DefaultInfluxFlushInterval = time.Second
+)
+
+// InfluxConfig configures the InfluxDB sink, which writes the numeric fields of the events
+// for live dashboards. Raw events still go to Parquet.
+type InfluxConfig struct {
+	// URL is the InfluxDB server, e.g. http://localhost:8086. Empty disables the sink.
+	URL    string
+	Token  string
+	Org    string
+	Bucket string
+	// BatchSize is the number of points written at once. A partial batch is written every
+	// FlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Validate checks the sink configuration, if it's enabled.
+func (c *InfluxConfig) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+
+	if _, err := url.Parse(c.URL); err != nil {
+		return fmt.Errorf("invalid InfluxDB URL %q: %w", c.URL, err)
+	}
+
+	if c.Bucket == "" {
+		return fmt.Errorf("the InfluxDB sink needs a bucket")
+	}
+
+	if c.BatchSize < 1 {
+		return fmt.Errorf("invalid InfluxDB batch size %d: must be at least 1", c.BatchSize)
+	}
+
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("invalid InfluxDB flush interval %s: must be positive", c.FlushInterval)
+	}
+
+	return nil
+}
+
+// influxSink batches points in the InfluxDB line protocol and writes them with the v2
+// write API. Points are dropped rather than slowing down the consumer when InfluxDB falls
+// behind.
+type influxSink struct {
+	cfg      *InfluxConfig
+	writeURL string
+	client   *http.Client
+	log      zerolog.Logger
+
+	points chan string
+	done   chan struct{}
+}
+
+func newInfluxSink(cfg *InfluxConfig, log zerolog.Logger) *influxSink {
+	query := url.Values{"bucket": {cfg.Bucket}, "precision": {"ms"}}
+	if cfg.Org != "" {
+		query.Set("org", cfg.Org)
+	}
+
+	return &influxSink{
+		cfg:      cfg,
+		writeURL: strings.TrimSuffix(cfg.URL, "/") + "/api/v2/write?" + query.Encode(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		log:      log.With().Str("sink", "influx").Logger(),
+		points:   make(chan string, 4*cfg.BatchSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// run writes the batches until the sink is closed, then writes the last one.
+func (s *influxSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	count := 0
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+
+		if err := s.write(batch.Bytes()); err != nil {
+			influxPoints.WithLabelValues("failed").Add(float64(count))
+			s.log.Error().Err(err).Int("points", count).Msg("Failed to write points to InfluxDB")
+		} else {
+			influxPoints.WithLabelValues("written").Add(float64(count))
+			s.log.Trace().Int("points", count).Msg("Wrote points to InfluxDB")
+		}
+
+		batch.Reset()
+		count = 0
+	}
+
+	for {
+		select {
+		case point, ok := <-s.points:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch.WriteString(point)
+			batch.WriteByte('\n')
+			count++
+
+			if count >= s.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *influxSink) write(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.cfg.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("InfluxDB returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// add queues a point, or drops it if the queue is full.
+func (s *influxSink) add(point string) {
+	select {
+	case s.points <- point:
+	default:
+		influxPoints.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Close writes the queued points and stops the sink.
+func (s *influxSink) Close() {
+	close(s.points)
+	<-s.done
+}
+
+// addPeerDiscovered counts a discovered peer.
+func (s *influxSink) addPeerDiscovered(event *types.PeerDiscoveredEvent) {
+	s.add(influxLine("peer_discovered",
+		[][2]string{{"crawler", event.CrawlerID}, {"ip_version", ipVersionTag(event.IPVersion)}, {"source", event.Source}},
+		[][2]string{{"count", "1i"}},
+		event.Timestamp))
+}
+
+// ipVersionTag leaves out the IP version of events from before it was published.
+func ipVersionTag(version int) string {
+	if version == 0 {
+		return ""
+	}
+	return strconv.Itoa(version)
+}
+
+// addMetadata counts a handshake by client, with the ping latency of the peer and its
+// number of subscribed subnets.
+func (s *influxSink) addMetadata(event *types.MetadataReceivedEvent) {
+	s.add(influxLine("handshake",
+		[][2]string{{"client", ethereum.ClientName(event.ClientVersion)}, {"crawler", event.CrawlerID}, {"direction", event.Direction}},
+		[][2]string{
+			{"count", "1i"},
+			{"ping_latency_ms", strconv.FormatInt(event.PingLatencyMs, 10) + "i"},
+			{"subscribed_subnets", strconv.Itoa(len(event.SubscribedSubnets)) + "i"},
+		},
+		event.Timestamp))
+}
+
+// addHandshakeFailed counts a failed handshake by reason.
+func (s *influxSink) addHandshakeFailed(event *types.HandshakeFailedEvent) {
+	s.add(influxLine("handshake_failed",
+		[][2]string{{"crawler", event.CrawlerID}, {"reason", event.Reason}},
+		[][2]string{{"count", "1i"}},
+		event.Timestamp))
+}
+
+// addHeartbeat writes the number of connected peers and the uptime of a sentry.
+func (s *influxSink) addHeartbeat(event *types.HeartbeatEvent) {
+	s.add(influxLine("heartbeat",
+		[][2]string{{"crawler", event.CrawlerID}},
+		[][2]string{
+			{"connected_peers", strconv.Itoa(event.ConnectedPeers) + "i"},
+			{"uptime_seconds", strconv.FormatInt(event.UptimeSeconds, 10) + "i"},
+		},
+		event.Timestamp))
+}
+
+// influxLine formats a point in the line protocol, in the `valtrack_` measurement namespace.
+// Empty tags are left out, fields are already formatted.
+func influxLine(measurement string, tags, fields [][2]string, timestampMs int64) string {
+	var b strings.Builder
+	b.WriteString("valtrack_")
+	b.WriteString(influxEscape(measurement))
+
+	for _, tag := range tags {
+		if tag[1] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(influxEscape(tag[0]))
+		b.WriteByte('=')
+		b.WriteString(influxEscape(tag[1]))
+	}
+
+	for i, field := range fields {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(influxEscape(field[0]))
+		b.WriteByte('=')
+		b.WriteString(field[1])
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(timestampMs, 10))
+
+	return b.String()
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// influxEscape escapes a measurement, tag key, tag value or field key.
+func influxEscape(s string) string {
+	return influxEscaper.Replace(s)
+}
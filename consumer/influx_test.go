@@ -0,0 +1,59 @@
+package consumer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/rs/zerolog"
+)
+
+func TestInfluxSink(t *testing.T) {
+	bodies := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "valtrack" || r.URL.Query().Get("precision") != "ms" {
+			t.Errorf("unexpected write URL %s", r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Token secret" {
+			t.Errorf("unexpected authorization header %q", got)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := &InfluxConfig{URL: srv.URL, Token: "secret", Bucket: "valtrack", BatchSize: 2, FlushInterval: time.Hour}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := newInfluxSink(cfg, zerolog.Nop())
+	go sink.run()
+
+	sink.addMetadata(&types.MetadataReceivedEvent{ClientVersion: "Lighthouse/v5.1.3", CrawlerID: "my crawler", Direction: "outbound", PingLatencyMs: 42, Timestamp: 1000})
+	sink.addHandshakeFailed(&types.HandshakeFailedEvent{CrawlerID: "crawler", Reason: "fork_digest", Timestamp: 2000})
+	// A partial batch is written on close
+	sink.addHeartbeat(&types.HeartbeatEvent{CrawlerID: "crawler", ConnectedPeers: 10, UptimeSeconds: 60, Timestamp: 3000})
+	sink.Close()
+
+	close(bodies)
+	var lines []string
+	for body := range bodies {
+		lines = append(lines, strings.Split(strings.TrimSpace(body), "\n")...)
+	}
+
+	want := []string{
+		`valtrack_handshake,client=lighthouse,crawler=my\ crawler,direction=outbound count=1i,ping_latency_ms=42i,subscribed_subnets=0i 1000`,
+		`valtrack_handshake_failed,crawler=crawler,reason=fork_digest count=1i 2000`,
+		`valtrack_heartbeat,crawler=crawler connected_peers=10i,uptime_seconds=60i 3000`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected points:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
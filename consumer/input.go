@@ -0,0 +1,125 @@
+package consumer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/rs/zerolog"
+)
+
+// maxInputLineSize is the longest event line accepted in an input file.
+const maxInputLineSize = 4 * 1024 * 1024
+
+// fileEvent is a line of the sentry's NDJSON event log (written when running without NATS).
+// The type is the NATS subject without the `events.` prefix.
+type fileEvent struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+// runFileConsumer converts the events in the NDJSON file at cfg.Input to Parquet, through
+// the same path as events consumed from NATS, and returns the report of the run when the
+// whole file is read or the context is cancelled. The report is also returned along with
+// the error of an interrupted conversion.
+func runFileConsumer(ctx context.Context, cfg *ConsumerConfig, log zerolog.Logger) (*ShutdownReport, error) {
+	f, err := os.Open(cfg.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer f.Close()
+
+	c := &Consumer{
+		log:     log,
+		writers: newWriters(&cfg.WriterCfg, log),
+
+		unknownSchemas: make(map[int]struct{}),
+		decodeStats:    newDecodeStats(),
+		stats:          newRunStats(),
+		storeRaw:       cfg.StoreRaw,
+
+		serializeMetaData: cfg.metaDataSerializer(),
+	}
+
+	// Closed with the report, or on return if reading the file failed
+	var sinks sinks
+	defer sinks.close(cfg.CloseTimeout, log)
+
+	for name, w := range c.writers {
+		sinks.add(name, w.Close)
+	}
+
+	// The events are from the past, so every window is written at the end
+	if cfg.Rollup.Window > 0 {
+		rollupWriter := NewPartitionedWriter("rollups", new(RollupRow), &cfg.WriterCfg, log)
+
+		c.rollups = newRollups(&cfg.Rollup, rollupWriter, nil, log)
+		sinks.add("rollups", func() {
+			c.rollups.flush(time.Now(), true)
+			rollupWriter.Close()
+		})
+	}
+
+	report := func() *ShutdownReport {
+		c.stats.setSinks(sinks.close(cfg.CloseTimeout, log))
+		return c.stats.report(nil, log)
+	}
+
+	log.Info().Str("input", cfg.Input).Msg("Converting events from file")
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxInputLineSize)
+
+	var lineNum, processed, failed int
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			log.Warn().Int("line", lineNum).Msg("Interrupted, stopping conversion")
+			return report(), err
+		}
+
+		lineNum++
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		logger := log.With().Int("line", lineNum).Logger()
+
+		var line fileEvent
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Type == "" {
+			failed++
+			c.stats.record("", resultFailed)
+			logger.Error().Err(err).Msg("Skipping line without an event type")
+			continue
+		}
+
+		subject := types.Subject(line.Type)
+		err := c.processEvent(ctx, subject, messageInfo{format: types.WireFormatJSON, ingestedAt: time.Now().UnixMilli()}, line.Event)
+		switch {
+		case errors.Is(err, errUnknownSubject):
+			failed++
+			c.stats.record(subject, resultUnknown)
+			logger.Warn().Str("type", line.Type).Msg("Unknown event type")
+		case err != nil:
+			failed++
+			c.stats.record(subject, resultFailed)
+			logger.Error().Err(err).Str("type", line.Type).Msg("Error unmarshaling event")
+		default:
+			processed++
+			c.stats.record(subject, resultStored)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read input file at line %d: %w", lineNum+1, err)
+	}
+
+	log.Info().Int("processed", processed).Int("failed", failed).Msg("Finished converting events from file")
+
+	return report(), nil
+}
@@ -0,0 +1,203 @@
+package consumer
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/types"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// runJetStream starts an embedded NATS server with JetStream and the EVENTS stream the
+// sentry creates, and returns its URL with a JetStream context connected to it.
+func runJetStream(t *testing.T) (string, jetstream.JetStream) {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{JetStream: true, StoreDir: t.TempDir(), Port: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Start()
+	t.Cleanup(func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+
+	if !srv.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server didn't start")
+	}
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EVENTS", Subjects: config.DefaultStreamSubjects})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv.ClientURL(), js
+}
+
+// publish publishes an event like the sentry does, encoded in `format` and compressed with
+// `gzip`, with its deduplication ID.
+func publish(t *testing.T, js jetstream.JetStream, subject string, format types.WireFormat, gzip bool, event interface{ MsgID() string }) *jetstream.PubAck {
+	t.Helper()
+
+	data, format, err := types.Marshal(format, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(types.WireFormatHeader, string(format))
+
+	if gzip {
+		if data, err = types.Gzip(data); err != nil {
+			t.Fatal(err)
+		}
+		msg.Header.Set(types.ContentEncodingHeader, types.ContentEncodingGzip)
+	}
+
+	msg.Data = data
+
+	ack, err := js.PublishMsg(context.Background(), msg, jetstream.WithMsgID(event.MsgID()))
+	if err != nil {
+		t.Fatalf("failed to publish %s: %v", subject, err)
+	}
+
+	return ack
+}
+
+// fetch fetches the next message of the EVENTS stream with a pull consumer of its own.
+func fetch(t *testing.T, js jetstream.JetStream, name string) jetstream.Msg {
+	t.Helper()
+
+	ctx := context.Background()
+
+	consumer, err := js.CreateOrUpdateConsumer(ctx, "EVENTS", jetstream.ConsumerConfig{Durable: name, AckPolicy: jetstream.AckExplicitPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := consumer.Next(jetstream.FetchMaxWait(5 * time.Second))
+	if err != nil {
+		t.Fatalf("failed to fetch a message: %v", err)
+	}
+
+	return msg
+}
+
+// consumerInfo returns the state of a consumer of the EVENTS stream.
+func consumerInfo(t *testing.T, js jetstream.JetStream, name string) *jetstream.ConsumerInfo {
+	t.Helper()
+
+	consumer, err := js.Consumer(context.Background(), "EVENTS", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := consumer.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info
+}
+
+// waitFor polls until `done` returns true, for up to 10 seconds.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitProcessed waits until the consumer acknowledged or terminated every message of the
+// stream, so none will be redelivered.
+func waitProcessed(t *testing.T, js jetstream.JetStream, name string) {
+	t.Helper()
+
+	stream, err := js.Stream(context.Background(), "EVENTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := stream.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the messages to be processed", func() bool {
+		consumer, err := js.Consumer(context.Background(), "EVENTS", name)
+		if err != nil {
+			return false
+		}
+
+		ci, err := consumer.Info(context.Background())
+		return err == nil && ci.AckFloor.Stream == info.State.LastSeq
+	})
+}
+
+// startConsumer runs RunConsumer in a temporary working directory, where it keeps its
+// database, until the returned function is called, which returns its result.
+func startConsumer(t *testing.T, cfg *ConsumerConfig) (stop func() (*ShutdownReport, error)) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	type result struct {
+		report *ShutdownReport
+		err    error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		report, err := RunConsumer(ctx, cfg)
+		done <- result{report, err}
+	}()
+
+	// Changing back before the temporary directory is removed
+	stopped := false
+	t.Cleanup(func() {
+		if !stopped {
+			cancel()
+			<-done
+		}
+		os.Chdir(wd)
+	})
+
+	return func() (*ShutdownReport, error) {
+		stopped = true
+		cancel()
+		r := <-done
+		return r.report, r.err
+	}
+}
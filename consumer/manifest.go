@@ -0,0 +1,128 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// ManifestName is the name of the manifest file in the output directory.
+const ManifestName = "manifest.json"
+
+// ManifestFile is a completed Parquet file in the manifest.
+type ManifestFile struct {
+	// Output is the name of the output the file belongs to, e.g. metadata_events.
+	Output string `json:"output"`
+	// Path is relative to the output directory.
+	Path string `json:"path"`
+	// MinTimestamp and MaxTimestamp are the range of the event timestamps written to the
+	// file, in Unix milliseconds.
+	MinTimestamp int64 `json:"min_timestamp"`
+	MaxTimestamp int64 `json:"max_timestamp"`
+	// Rows is the number of rows in the file, read from its footer.
+	Rows  int64 `json:"rows"`
+	Bytes int64 `json:"bytes"`
+	// SchemaVersion is the highest event schema version of the rows, 0 for rows without one
+	// (e.g. rollups).
+	SchemaVersion int `json:"schema_version"`
+	// ClosedAt is when the file was completed, in Unix milliseconds.
+	ClosedAt int64 `json:"closed_at"`
+}
+
+// Manifest lists the completed Parquet files of an output directory in its manifest.json,
+// so downstream jobs can process new files without scanning the directory. The file is
+// rewritten every time a Parquet file is completed, through a temporary file that replaces
+// it, so readers never see a partial manifest.
+type Manifest struct {
+	mu    sync.Mutex
+	path  string
+	files []ManifestFile
+}
+
+// OpenManifest opens the manifest of `dir`, keeping the files listed by a previous run.
+func OpenManifest(dir string) (*Manifest, error) {
+	m := &Manifest{path: filepath.Join(dir, ManifestName)}
+
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var existing struct {
+		Files []ManifestFile `json:"files"`
+	}
+	if err := json.Unmarshal(data, &existing); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", m.path, err)
+	}
+
+	m.files = existing.Files
+	return m, nil
+}
+
+// Files returns the files listed in the manifest, in completion order.
+func (m *Manifest) Files() []ManifestFile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]ManifestFile(nil), m.files...)
+}
+
+// add lists a completed file and rewrites the manifest.
+func (m *Manifest) add(file ManifestFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files = append(m.files, file)
+
+	data, err := json.MarshalIndent(struct {
+		Files []ManifestFile `json:"files"`
+	}{m.files}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), ".manifest-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary manifest: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary manifest: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary manifest: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), m.path)
+}
+
+// schemaVersion returns the SchemaVersion field of a row, or 0 if it has none.
+func schemaVersion(row interface{}) int {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+
+	field := v.FieldByName("SchemaVersion")
+	if !field.IsValid() || field.Kind() != reflect.Int {
+		return 0
+	}
+
+	return int(field.Int())
+}
@@ -0,0 +1,108 @@
+package consumer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/chainbound/valtrack/types"
+)
+
+// MetaDataSerializer encodes the metadata of a metadata_received event for the `metadata`
+// column of the Parquet files.
+type MetaDataSerializer func(md *types.SimpleMetaData) (string, error)
+
+// metaDataColumn is the JSON shape of the `metadata` column.
+type metaDataColumn struct {
+	SeqNumber int64  `json:"seq_number"`
+	Attnets   string `json:"attnets"`
+	Syncnets  string `json:"syncnets"`
+}
+
+// SerializeMetaData is the default MetaDataSerializer. It encodes the metadata as
+// `{"seq_number":42,"attnets":"<hex>","syncnets":"<hex>"}`, with the bitfields hex-encoded
+// like in the validator_metadata_events output, or an empty string without metadata.
+func SerializeMetaData(md *types.SimpleMetaData) (string, error) {
+	if md == nil {
+		return "", nil
+	}
+
+	b, err := json.Marshal(metaDataColumn{
+		SeqNumber: md.SeqNumber,
+		Attnets:   hex.EncodeToString(md.Attnets),
+		Syncnets:  hex.EncodeToString(md.Syncnets),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// MetadataRow is a metadata_received event as written to Parquet. It has the columns of
+// types.MetadataReceivedEvent, except that the metadata is a string encoded by a
+// MetaDataSerializer instead of the nested bitfields.
+type MetadataRow struct {
+	ENR               string   `parquet:"name=enr, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ID                string   `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Multiaddr         string   `parquet:"name=multiaddr, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Multiaddrs        []string `parquet:"name=multiaddrs, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	PrivateAddr       bool     `parquet:"name=private_addr, type=BOOLEAN"`
+	RemoteAddr        string   `parquet:"name=remote_addr, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Direction         string   `parquet:"name=direction, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Partial           string   `parquet:"name=partial, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Epoch             int      `parquet:"name=epoch, type=INT32"`
+	MetaData          string   `parquet:"name=metadata, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SubscribedSubnets []int64  `parquet:"name=subscribed_subnets, type=LIST, valuetype=INT64"`
+	ClientVersion     string   `parquet:"name=client_version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PingLatencyMs     int64    `parquet:"name=ping_latency_ms, type=INT64"`
+	PingMinLatencyMs  int64    `parquet:"name=ping_min_latency_ms, type=INT64"`
+	Protocols         []string `parquet:"name=protocols, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	CrawlerID         string   `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CrawlerLoc        string   `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CrawlerVer        string   `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp         int64    `parquet:"name=timestamp, type=INT64"`
+	ClockOffsetMs     int64    `parquet:"name=clock_offset_ms, type=INT64"`
+	ClockSynced       bool     `parquet:"name=clock_synced, type=BOOLEAN"`
+	SchemaVersion     int      `parquet:"name=schema_version, type=INT32"`
+	ObservedAt        int64    `parquet:"name=observed_at, type=INT64"`
+	IngestedAt        int64    `parquet:"name=ingested_at, type=INT64"`
+	BeaconConnected   bool     `parquet:"name=beacon_connected, type=BOOLEAN"`
+	Raw               string   `parquet:"name=raw, type=BYTE_ARRAY"`
+}
+
+// newMetadataRow converts an event to the row written to Parquet.
+func newMetadataRow(event *types.MetadataReceivedEvent, serialize MetaDataSerializer) (MetadataRow, error) {
+	md, err := serialize(event.MetaData)
+	if err != nil {
+		return MetadataRow{}, err
+	}
+
+	return MetadataRow{
+		ENR:               event.ENR,
+		ID:                event.ID,
+		Multiaddr:         event.Multiaddr,
+		Multiaddrs:        event.Multiaddrs,
+		PrivateAddr:       event.PrivateAddr,
+		RemoteAddr:        event.RemoteAddr,
+		Direction:         event.Direction,
+		Partial:           event.Partial,
+		Epoch:             event.Epoch,
+		MetaData:          md,
+		SubscribedSubnets: event.SubscribedSubnets,
+		ClientVersion:     event.ClientVersion,
+		PingLatencyMs:     event.PingLatencyMs,
+		PingMinLatencyMs:  event.PingMinLatencyMs,
+		Protocols:         event.Protocols,
+		CrawlerID:         event.CrawlerID,
+		CrawlerLoc:        event.CrawlerLoc,
+		CrawlerVer:        event.CrawlerVer,
+		Timestamp:         event.Timestamp,
+		ClockOffsetMs:     event.ClockOffsetMs,
+		ClockSynced:       event.ClockSynced,
+		SchemaVersion:     event.SchemaVersion,
+		ObservedAt:        event.ObservedAt,
+		IngestedAt:        event.IngestedAt,
+		BeaconConnected:   event.BeaconConnected,
+		Raw:               event.Raw,
+	}, nil
+}
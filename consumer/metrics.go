@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+const metricsNamespace = "valtrack_consumer"
+
+// decodeStatsWindow is the window the decode failure rate is computed and logged over.
+const decodeStatsWindow = time.Minute
+
+var (
+	decodeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "decode_failures_total",
+		Help:      "Number of messages that couldn't be decoded, by subject",
+	}, []string{"subject"})
+
+	decodeFailureRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "decode_failure_ratio",
+		Help:      "Fraction of messages that couldn't be decoded over the last minute, by subject",
+	}, []string{"subject"})
+
+	resumeGap = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "resume_gap_messages",
+		Help:      "Number of messages that were removed from the stream before the consumer could resume",
+	})
+
+	consumerConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "consumer_config_conflicts_total",
+		Help:      "Number of conflicting fields found in the existing durable consumer's configuration on startup, by field",
+	}, []string{"field"})
+
+	messagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_total",
+		Help:      "Number of messages processed, by subject and result (stored, failed, unknown or redelivered)",
+	}, []string{"subject", "result"})
+
+	writersEvicted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "parquet_writers_evicted_total",
+		Help:      "Number of Parquet files closed because too many were open, by output",
+	}, []string{"output"})
+
+	parquetRowsWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "parquet_rows_written_total",
+		Help:      "Number of rows written to Parquet files, by output",
+	}, []string{"output"})
+
+	parquetBytesFlushed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "parquet_bytes_flushed_total",
+		Help:      "Size of the Parquet files closed (when idle, evicted, rotated or on shutdown), by output",
+	}, []string{"output"})
+
+	lastHeartbeat = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sentry_last_heartbeat_timestamp_seconds",
+		Help:      "Unix time of the last heartbeat received from each sentry, by crawler ID",
+	}, []string{"crawler"})
+
+	influxPoints = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "influx_points_total",
+		Help:      "Number of points sent to the InfluxDB sink, by result (written, failed or dropped)",
+	}, []string{"result"})
+
+	fetchPauses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_pauses_total",
+		Help:      "Number of times fetching was paused because the validator event queues reached the high watermark",
+	})
+
+	fetchPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_paused",
+		Help:      "1 while fetching is paused by backpressure, 0 otherwise",
+	})
+
+	fetchPauseDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_pause_duration_seconds",
+		Help:      "How long fetching was paused for until the validator event queues drained to the low watermark",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+)
+
+// decodeStats counts decoded and failed messages per subject within the current window.
+type decodeStats struct {
+	sync.Mutex
+
+	total    map[string]uint64
+	failures map[string]uint64
+}
+
+func newDecodeStats() *decodeStats {
+	return &decodeStats{
+		total:    make(map[string]uint64),
+		failures: make(map[string]uint64),
+	}
+}
+
+func (s *decodeStats) record(subject string, failed bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.total[subject]++
+	if failed {
+		s.failures[subject]++
+		decodeFailures.WithLabelValues(subject).Inc()
+	}
+}
+
+// flush updates the failure rate gauges with the current window, logs a summary line
+// per subject that had failures, and starts a new window.
+func (s *decodeStats) flush(log zerolog.Logger) {
+	s.Lock()
+	defer s.Unlock()
+
+	for subject, total := range s.total {
+		failures := s.failures[subject]
+
+		// Keep known subjects around, so they report 0 when there were no messages
+		s.total[subject], s.failures[subject] = 0, 0
+
+		if total == 0 {
+			decodeFailureRate.WithLabelValues(subject).Set(0)
+			continue
+		}
+
+		rate := float64(failures) / float64(total)
+
+		decodeFailureRate.WithLabelValues(subject).Set(rate)
+
+		if failures > 0 {
+			log.Warn().
+				Str("subject", subject).
+				Uint64("failures", failures).
+				Uint64("total", total).
+				Msgf("%s: %.1f%% decode failures over last %s", types.EventType(subject), rate*100, decodeStatsWindow)
+		}
+	}
+}
+
+// runReporter flushes the decode stats every window.
+func (s *decodeStats) runReporter(log zerolog.Logger) {
+	ticker := time.NewTicker(decodeStatsWindow)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.flush(log)
+	}
+}
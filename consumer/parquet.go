@@ -0,0 +1,769 @@
+package consumer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/rs/zerolog"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// PartitionBy controls how output files are partitioned on disk.
+type PartitionBy string
+
+const (
+	// PartitionNone writes everything to a single `<name>_<prefix>.parquet` file.
+	PartitionNone PartitionBy = "none"
+	// PartitionDay writes to `<name>/date=YYYY-MM-DD/part-*.parquet`.
+	PartitionDay PartitionBy = "day"
+	// PartitionHour writes to `<name>/date=YYYY-MM-DD/hour=HH/part-*.parquet`.
+	PartitionHour PartitionBy = "hour"
+)
+
+// ParsePartitionBy validates a partitioning scheme.
+func ParsePartitionBy(s string) (PartitionBy, error) {
+	switch p := PartitionBy(s); p {
+	case PartitionNone, PartitionDay, PartitionHour:
+		return p, nil
+	case "":
+		return PartitionNone, nil
+	default:
+		return "", fmt.Errorf("invalid partitioning scheme %q (expected none, day or hour)", s)
+	}
+}
+
+// partitionKey returns the Hive-style partition directory for the given timestamp.
+func (p PartitionBy) partitionKey(ts time.Time) string {
+	ts = ts.UTC()
+
+	switch p {
+	case PartitionDay:
+		return fmt.Sprintf("date=%s", ts.Format("2006-01-02"))
+	case PartitionHour:
+		return filepath.Join(fmt.Sprintf("date=%s", ts.Format("2006-01-02")), fmt.Sprintf("hour=%02d", ts.Hour()))
+	default:
+		return ""
+	}
+}
+
+// ShardBy controls whether output files are split per sentry on disk.
+type ShardBy string
+
+const (
+	// ShardNone writes the events of all sentries to the same files.
+	ShardNone ShardBy = "none"
+	// ShardCrawlerID writes to `<name>/crawler_id=<id>/[<partition>/]part-*.parquet`.
+	ShardCrawlerID ShardBy = "crawler_id"
+)
+
+// ParseShardBy validates a sharding scheme.
+func ParseShardBy(s string) (ShardBy, error) {
+	switch sh := ShardBy(s); sh {
+	case ShardNone, ShardCrawlerID:
+		return sh, nil
+	case "":
+		return ShardNone, nil
+	default:
+		return "", fmt.Errorf("invalid sharding scheme %q (expected none or crawler_id)", s)
+	}
+}
+
+// shardKey returns the Hive-style shard directory of a row, or "" for rows that aren't
+// from a single sentry (e.g. rollups).
+func (s ShardBy) shardKey(row interface{}) string {
+	if s != ShardCrawlerID {
+		return ""
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(row))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	field := v.FieldByName("CrawlerID")
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return ""
+	}
+
+	id := field.String()
+	if id == "" {
+		id = "unknown"
+	}
+
+	// Crawler IDs are machine IDs, but keep them from escaping the output directory
+	return "crawler_id=" + strings.NewReplacer("/", "_", string(filepath.Separator), "_", "..", "_").Replace(id)
+}
+
+// writerIdleTimeout is how long a partition writer can go without writes before it is closed.
+const writerIdleTimeout = 10 * time.Minute
+
+// Default Parquet writer settings, used when the WriterConfig leaves them unset.
+const (
+	// DefaultRowGroupSize is the size in bytes of a row group, which is buffered in memory
+	// before it is written.
+	DefaultRowGroupSize int64 = 128 * 1024 * 1024
+	// DefaultPageSize is the size in bytes of a column page within a row group.
+	DefaultPageSize int64 = 8 * 1024
+	// DefaultWriterParallelism is the number of goroutines a writer uses to marshal rows.
+	DefaultWriterParallelism int64 = 4
+	// DefaultMaxOpenWriters is the number of files each writer keeps open at most.
+	DefaultMaxOpenWriters = 64
+)
+
+// WriterConfig holds the output options shared by all Parquet writers.
+type WriterConfig struct {
+	// Dir is the directory all output files are written to.
+	Dir string
+	// Prefix is included in every file name, so multiple consumers can share a directory.
+	Prefix string
+	// PartitionBy controls how output files are partitioned.
+	PartitionBy PartitionBy
+	// RowGroupSize is the Parquet row group size in bytes (0 for DefaultRowGroupSize).
+	RowGroupSize int64
+	// PageSize is the Parquet page size in bytes (0 for DefaultPageSize).
+	PageSize int64
+	// Parallelism is the number of goroutines each writer uses to marshal rows
+	// (0 for DefaultWriterParallelism).
+	Parallelism int64
+	// ShardBy controls whether output files are split per sentry.
+	ShardBy ShardBy
+	// MaxOpenWriters is the number of files (partitions and shards) each writer keeps open,
+	// the least recently written one is closed to open another (0 for DefaultMaxOpenWriters).
+	MaxOpenWriters int
+	// Manifest lists every completed file when set.
+	Manifest *Manifest
+}
+
+// Validate checks that the Parquet writer settings are positive, or unset.
+func (c *WriterConfig) Validate() error {
+	if c.RowGroupSize < 0 {
+		return fmt.Errorf("invalid row group size %d: must be positive", c.RowGroupSize)
+	}
+
+	if c.PageSize < 0 {
+		return fmt.Errorf("invalid page size %d: must be positive", c.PageSize)
+	}
+
+	if c.Parallelism < 0 {
+		return fmt.Errorf("invalid writer parallelism %d: must be positive", c.Parallelism)
+	}
+
+	if c.MaxOpenWriters < 0 {
+		return fmt.Errorf("invalid max open writers %d: must be positive", c.MaxOpenWriters)
+	}
+
+	if c.RowGroupSize > 0 && c.PageSize > c.RowGroupSize {
+		return fmt.Errorf("page size %d is larger than the row group size %d", c.PageSize, c.RowGroupSize)
+	}
+
+	return nil
+}
+
+// PrepareOutputDir creates the output directory if needed and verifies it is writable.
+func PrepareOutputDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory %s: %w", dir, err)
+	}
+
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", dir, err)
+	}
+
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// rowWriter is the subset of *writer.ParquetWriter used by PartitionedWriter.
+type rowWriter interface {
+	Write(row interface{}) error
+	// Flush writes the rows written since the last row group to the file, as a new row
+	// group when `flag` is set.
+	Flush(flag bool) error
+	WriteStop() error
+	// WriteFooter finalizes the file with the row groups written to it, leaving out the rows
+	// written since (which WriteStop would flush first).
+	WriteFooter() error
+	// Check returns an error if the row can't be marshaled.
+	Check(row interface{}) error
+}
+
+// parquetRowWriter implements rowWriter for a *writer.ParquetWriter.
+type parquetRowWriter struct {
+	*writer.ParquetWriter
+}
+
+func (pw *parquetRowWriter) WriteFooter() error {
+	// Like WriteStop, but without flushing. The row groups are only added to the footer once
+	// written, its row count also includes the rows marshaled since though.
+	pw.RenameSchema()
+
+	footer := *pw.Footer
+	footer.NumRows = 0
+	for _, rg := range footer.RowGroups {
+		footer.NumRows += rg.NumRows
+	}
+
+	ts := thrift.NewTSerializer()
+	ts.Protocol = thrift.NewTCompactProtocolFactory().GetProtocol(ts.Transport)
+
+	buf, err := ts.Write(context.Background(), &footer)
+	if err != nil {
+		return err
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(buf)))
+	buf = append(buf, "PAR1"...)
+
+	_, err = pw.PFile.Write(buf)
+	return err
+}
+
+func (pw *parquetRowWriter) Check(row interface{}) (err error) {
+	// Marshaling panics on some invalid rows, parquet-go recovers those too
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to marshal row: %v", r)
+		}
+	}()
+
+	_, err = pw.MarshalFunc([]interface{}{reflect.Indirect(reflect.ValueOf(row)).Interface()}, pw.SchemaHandler)
+	return err
+}
+
+func newParquetWriter(file source.ParquetFile, schema interface{}, cfg *WriterConfig) (*parquetRowWriter, error) {
+	np := cfg.Parallelism
+	if np == 0 {
+		np = DefaultWriterParallelism
+	}
+
+	pw, err := writer.NewParquetWriter(file, schema, np)
+	if err != nil {
+		return nil, err
+	}
+
+	pw.RowGroupSize = rowGroupSize(cfg)
+
+	pw.PageSize = DefaultPageSize
+	if cfg.PageSize > 0 {
+		pw.PageSize = cfg.PageSize
+	}
+
+	return &parquetRowWriter{pw}, nil
+}
+
+func rowGroupSize(cfg *WriterConfig) int64 {
+	if cfg.RowGroupSize > 0 {
+		return cfg.RowGroupSize
+	}
+
+	return DefaultRowGroupSize
+}
+
+// partFile is a local Parquet file that keeps track of its size, so a row group that failed
+// to be written can be cut off again.
+type partFile struct {
+	*local.LocalFile
+	size int64
+}
+
+// createPartFile creates a new file, failing if it exists.
+func createPartFile(path string) (*partFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &partFile{LocalFile: &local.LocalFile{FilePath: path, File: f}}, nil
+}
+
+func (f *partFile) Write(b []byte) (int, error) {
+	n, err := f.LocalFile.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+// truncate cuts the file back to `size` bytes, and continues writing from there.
+func (f *partFile) truncate(size int64) error {
+	if err := f.File.Truncate(size); err != nil {
+		return err
+	}
+
+	if _, err := f.File.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+
+	f.size = size
+	return nil
+}
+
+type partitionWriter struct {
+	path      string
+	file      *partFile
+	pw        rowWriter
+	lastWrite time.Time
+	// pending are the rows of the next row group, which are only handed to the Parquet
+	// writer once they add up to groupSize bytes. Their messages are acknowledged already,
+	// so they're moved to a new file if writing the row group fails.
+	pending     []pendingRow
+	pendingSize int64
+	groupSize   int64
+	// written is the size of the file up to the end of the last row group written
+	written int64
+	// minTs and maxTs are the range of the timestamps written, in Unix milliseconds, and
+	// schemaVersion the highest schema version, for the manifest
+	minTs, maxTs  int64
+	schemaVersion int
+}
+
+// PartitionedWriter writes rows of a single schema to Parquet files, keeping one open
+// writer per active partition (and shard). Writers that haven't been written to for a
+// while, or for the longest when too many are open, are closed, and late-arriving rows
+// for a closed partition open a new part file in it.
+type PartitionedWriter struct {
+	sync.Mutex
+
+	name    string
+	schema  interface{}
+	cfg     *WriterConfig
+	writers map[string]*partitionWriter
+	// buffered holds the pending rows of failed files whose replacement couldn't be opened
+	// yet, by partition. They're written once it is.
+	buffered map[string][]pendingRow
+
+	newWriter func(file source.ParquetFile, schema interface{}) (rowWriter, error)
+
+	log zerolog.Logger
+}
+
+// NewPartitionedWriter creates a writer for rows of type `schema`. Files are written under
+// `<dir>/<name>/` (or to `<dir>/<name>_<prefix>.parquet` when not partitioning).
+func NewPartitionedWriter(name string, schema interface{}, cfg *WriterConfig, log zerolog.Logger) *PartitionedWriter {
+	return &PartitionedWriter{
+		name:     name,
+		schema:   schema,
+		cfg:      cfg,
+		writers:  make(map[string]*partitionWriter),
+		buffered: make(map[string][]pendingRow),
+		newWriter: func(file source.ParquetFile, schema interface{}) (rowWriter, error) {
+			pw, err := newParquetWriter(file, schema, cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			// Row groups are only written when flushed, once PartitionedWriter has buffered one
+			pw.RowGroupSize = math.MaxInt64
+			return pw, nil
+		},
+		log: log,
+	}
+}
+
+// Write writes a row into the partition that corresponds to the given timestamp, in the
+// shard of the row's sentry when sharding.
+func (w *PartitionedWriter) Write(ts time.Time, row interface{}) error {
+	w.Lock()
+	defer w.Unlock()
+
+	key := filepath.Join(w.cfg.ShardBy.shardKey(row), w.cfg.PartitionBy.partitionKey(ts))
+
+	pw, ok := w.writers[key]
+	if !ok {
+		w.evictOldest()
+
+		var err error
+		if pw, err = w.openPartition(key); err != nil {
+			return fmt.Errorf("%w: %w", errWriteFailed, err)
+		}
+	}
+
+	// A row that can't be marshaled would fail its whole row group, and retrying it won't help
+	if err := pw.pw.Check(row); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", pw.path, err)
+	}
+
+	if err := pw.write(pendingRow{ts: ts, row: row}); err != nil {
+		if err = w.rotate(key, pw, err); err != nil {
+			return err
+		}
+	}
+
+	parquetRowsWritten.WithLabelValues(w.name).Inc()
+
+	return nil
+}
+
+// errWriteFailed wraps the errors of rows that weren't written but can be when retried,
+// e.g. because the file failed and its replacement couldn't be opened.
+var errWriteFailed = errors.New("parquet write failed")
+
+// pendingRow is a row that isn't in a written row group yet, with the timestamp of its
+// partition.
+type pendingRow struct {
+	ts  time.Time
+	row interface{}
+}
+
+// write adds a row to the pending row group, and writes the row group to the file once
+// it's complete.
+func (pw *partitionWriter) write(r pendingRow) error {
+	pw.lastWrite = time.Now()
+	pw.pending = append(pw.pending, r)
+	pw.pendingSize += common.SizeOf(reflect.ValueOf(r.row))
+
+	if pw.pendingSize < pw.groupSize {
+		return nil
+	}
+
+	return pw.flush()
+}
+
+// flush writes the pending rows to the file as a row group.
+func (pw *partitionWriter) flush() error {
+	if len(pw.pending) == 0 {
+		return nil
+	}
+
+	for _, r := range pw.pending {
+		if err := pw.pw.Write(r.row); err != nil {
+			return err
+		}
+	}
+
+	if err := pw.pw.Flush(true); err != nil {
+		return err
+	}
+
+	for _, r := range pw.pending {
+		if ms := r.ts.UnixMilli(); pw.minTs == 0 || ms < pw.minTs {
+			pw.minTs = ms
+		}
+		pw.maxTs = max(pw.maxTs, r.ts.UnixMilli())
+		pw.schemaVersion = max(pw.schemaVersion, schemaVersion(r.row))
+	}
+
+	pw.pending, pw.pendingSize = nil, 0
+	pw.written = pw.file.size
+
+	return nil
+}
+
+// seal finalizes a file whose last row group failed to be written. The Parquet writer still
+// holds the rows of that row group, so the file is cut back to the row groups written
+// before, and finalized with only those.
+func (pw *partitionWriter) seal() error {
+	if err := pw.file.truncate(pw.written); err != nil {
+		return err
+	}
+
+	return pw.pw.WriteFooter()
+}
+
+// rotate replaces a file that failed to write a row group, e.g. because the disk is full.
+// The file keeps the row groups written before, and the rows of the failed one are moved to
+// a new file.
+//
+// It returns nil if the rows were moved. If the new file can't be opened either, the error
+// wraps errWriteFailed and the rows are written once the partition is reopened, except the
+// last one, which is written again when its message is redelivered.
+func (w *PartitionedWriter) rotate(key string, pw *partitionWriter, cause error) error {
+	w.fail(key, pw, cause)
+
+	next, err := w.openPartition(key)
+	if err != nil {
+		w.log.Error().Err(err).Str("partition", key).Msg("Failed to open new parquet file, retrying on next write")
+
+		// The last row is still the one of this write
+		rows := w.buffered[key]
+		w.buffered[key] = rows[:len(rows)-1]
+
+		return fmt.Errorf("%w: %s: %w", errWriteFailed, pw.path, cause)
+	}
+
+	w.log.Warn().Str("old_path", pw.path).Str("new_path", next.path).Int("pending_rows", len(next.pending)).Msg("Rotated parquet file after write error")
+
+	return nil
+}
+
+// openPartition opens a new file for the partition, and writes the rows buffered for it
+// after a previous file failed. The rows that aren't written stay buffered if that fails too.
+func (w *PartitionedWriter) openPartition(key string) (*partitionWriter, error) {
+	pw, err := w.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	w.writers[key] = pw
+
+	rows := w.buffered[key]
+	delete(w.buffered, key)
+
+	for i, row := range rows {
+		if err := pw.write(row); err != nil {
+			w.fail(key, pw, err)
+			w.buffered[key] = append(w.buffered[key], rows[i+1:]...)
+
+			return nil, fmt.Errorf("failed to write %d buffered rows to %s: %w", len(rows), pw.path, err)
+		}
+	}
+
+	return pw, nil
+}
+
+// evictOldest closes the least recently written writer if the limit of open writers is
+// reached. The single unpartitioned file is never closed, as reopening it would start a new one.
+func (w *PartitionedWriter) evictOldest() {
+	limit := w.cfg.MaxOpenWriters
+	if limit == 0 {
+		limit = DefaultMaxOpenWriters
+	}
+
+	if len(w.writers) < limit {
+		return
+	}
+
+	var (
+		oldestKey string
+		oldest    *partitionWriter
+	)
+	for key, pw := range w.writers {
+		if key != "" && (oldest == nil || pw.lastWrite.Before(oldest.lastWrite)) {
+			oldestKey, oldest = key, pw
+		}
+	}
+
+	if oldest != nil {
+		writersEvicted.WithLabelValues(w.name).Inc()
+		w.closeWriter(oldestKey, oldest)
+	}
+}
+
+func (w *PartitionedWriter) open(key string) (*partitionWriter, error) {
+	var path string
+	if key == "" {
+		var err error
+		if path, err = w.nextFile(); err != nil {
+			return nil, err
+		}
+	} else {
+		path = filepath.Join(w.cfg.Dir, w.name, key, fmt.Sprintf("part-%s-%d.parquet", w.cfg.Prefix, time.Now().UnixNano()))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	file, err := createPartFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet file %s: %w", path, err)
+	}
+
+	pw, err := w.newWriter(file, w.schema)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to create parquet writer for %s: %w", path, err)
+	}
+
+	w.log.Info().Str("path", path).Msg("Opened parquet file")
+
+	return &partitionWriter{path: path, file: file, pw: pw, groupSize: rowGroupSize(w.cfg), written: file.size}, nil
+}
+
+// nextFile returns the path of the next unpartitioned file, `<name>_<prefix>.parquet`. If
+// that exists already, e.g. from a previous run or rotated after a write error, the files
+// are numbered `<name>_<prefix>.<n>.parquet` after the highest one in the directory, so none
+// are overwritten.
+func (w *PartitionedWriter) nextFile() (string, error) {
+	base := fmt.Sprintf("%s_%s", w.name, w.cfg.Prefix)
+
+	entries, err := os.ReadDir(w.cfg.Dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to list output directory %s: %w", w.cfg.Dir, err)
+	}
+
+	next := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == base+".parquet" {
+			next = max(next, 1)
+			continue
+		}
+
+		n, ok := strings.CutPrefix(name, base+".")
+		if !ok {
+			continue
+		}
+
+		if i, err := strconv.Atoi(strings.TrimSuffix(n, ".parquet")); err == nil && i >= next {
+			next = i + 1
+		}
+	}
+
+	if next == 0 {
+		return filepath.Join(w.cfg.Dir, base+".parquet"), nil
+	}
+
+	return filepath.Join(w.cfg.Dir, fmt.Sprintf("%s.%d.parquet", base, next)), nil
+}
+
+// closeWriter writes the pending rows and closes the file. If writing them fails, they're
+// kept for the next file of the partition.
+func (w *PartitionedWriter) closeWriter(key string, pw *partitionWriter) {
+	if err := pw.flush(); err != nil {
+		w.fail(key, pw, err)
+		return
+	}
+
+	if err := pw.pw.WriteStop(); err != nil {
+		w.log.Error().Err(err).Str("path", pw.path).Msg("Failed to stop parquet writer")
+	}
+
+	w.closeFile(key, pw)
+}
+
+// fail closes a file that failed to write its pending rows, with the row groups written
+// before. The pending rows are buffered for the next file of the partition.
+func (w *PartitionedWriter) fail(key string, pw *partitionWriter, cause error) {
+	w.log.Error().Err(cause).Str("path", pw.path).Int("pending_rows", len(pw.pending)).Msg("Failed to write parquet row group")
+
+	if err := pw.seal(); err != nil {
+		w.log.Error().Err(err).Str("path", pw.path).Msg("Failed to finalize parquet file")
+	}
+
+	w.buffered[key] = pw.pending
+	w.closeFile(key, pw)
+}
+
+func (w *PartitionedWriter) closeFile(key string, pw *partitionWriter) {
+	if err := pw.file.Close(); err != nil {
+		w.log.Error().Err(err).Str("path", pw.path).Msg("Failed to close parquet file")
+	}
+
+	delete(w.writers, key)
+
+	// The file is complete once closed, so its size is what was flushed
+	var size int64
+	if info, err := os.Stat(pw.path); err == nil {
+		size = info.Size()
+		parquetBytesFlushed.WithLabelValues(w.name).Add(float64(size))
+	}
+
+	w.log.Info().Str("path", pw.path).Int64("bytes", size).Msg("Closed parquet file")
+
+	if w.cfg.Manifest != nil {
+		w.addToManifest(pw, size)
+	}
+}
+
+// addToManifest lists a closed file in the manifest. Files without a readable footer
+// aren't complete, so they're left out.
+func (w *PartitionedWriter) addToManifest(pw *partitionWriter, size int64) {
+	schema, err := ReadParquetSchema(pw.path)
+	if err != nil {
+		w.log.Error().Err(err).Str("path", pw.path).Msg("Failed to read closed parquet file, not listing it in the manifest")
+		return
+	}
+
+	path, err := filepath.Rel(w.cfg.Dir, pw.path)
+	if err != nil {
+		path = pw.path
+	}
+
+	err = w.cfg.Manifest.add(ManifestFile{
+		Output:        w.name,
+		Path:          filepath.ToSlash(path),
+		MinTimestamp:  pw.minTs,
+		MaxTimestamp:  pw.maxTs,
+		Rows:          schema.NumRows,
+		Bytes:         size,
+		SchemaVersion: pw.schemaVersion,
+		ClosedAt:      time.Now().UnixMilli(),
+	})
+	if err != nil {
+		w.log.Error().Err(err).Str("path", pw.path).Msg("Failed to update the manifest")
+	}
+}
+
+// CloseIdle closes all partition writers that haven't been written to within `idle`.
+// When neither partitioning nor sharding, the single output file is kept open.
+func (w *PartitionedWriter) CloseIdle(idle time.Duration) {
+	w.Lock()
+	defer w.Unlock()
+
+	for key, pw := range w.writers {
+		if key != "" && time.Since(pw.lastWrite) > idle {
+			w.closeWriter(key, pw)
+		}
+	}
+}
+
+// Close flushes and closes all open partition writers, then makes a last attempt to write
+// the rows buffered for partitions whose file failed.
+func (w *PartitionedWriter) Close() {
+	w.Lock()
+	defer w.Unlock()
+
+	for key, pw := range w.writers {
+		w.closeWriter(key, pw)
+	}
+
+	for key := range w.buffered {
+		if pw, err := w.openPartition(key); err == nil {
+			w.closeWriter(key, pw)
+		}
+
+		if rows := w.buffered[key]; len(rows) > 0 {
+			w.log.Error().Str("partition", key).Int("rows", len(rows)).Msg("Failed to write buffered rows, they are lost")
+		}
+	}
+}
+
+// startIdleCloser periodically closes idle partition writers, until the returned function
+// is called. It waits for the closer to stop, so the writers can then be closed for the last
+// time.
+func startIdleCloser(writers ...*PartitionedWriter) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, w := range writers {
+					w.CloseIdle(writerIdleTimeout)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
@@ -0,0 +1,489 @@
+package consumer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// failingWriter fails to write the row groups after the first `ok` ones (never if
+// negative), and can't marshal `invalid` rows.
+type failingWriter struct {
+	*parquetRowWriter
+	ok      int
+	invalid string
+	file    *failingFile
+}
+
+func (f *failingWriter) Flush(flag bool) error {
+	if flag && f.ok >= 0 {
+		if f.ok == 0 {
+			f.file.fail = true
+		} else {
+			f.ok--
+		}
+	}
+
+	return f.parquetRowWriter.Flush(flag)
+}
+
+func (f *failingWriter) Check(row interface{}) error {
+	if event, ok := row.(types.PeerDiscoveredEvent); ok && f.invalid != "" && event.ID == f.invalid {
+		return errors.New("injected invalid row")
+	}
+
+	return f.parquetRowWriter.Check(row)
+}
+
+// failingFile fails the next write once `fail` is set, after writing half of it.
+type failingFile struct {
+	source.ParquetFile
+	fail bool
+}
+
+func (f *failingFile) Write(b []byte) (int, error) {
+	if !f.fail {
+		return f.ParquetFile.Write(b)
+	}
+
+	f.fail = false
+	n, _ := f.ParquetFile.Write(b[:len(b)/2])
+	return n, errors.New("injected write failure")
+}
+
+// newFailingWriter creates an unpartitioned writer in `dir` with row groups of `groupRows`
+// rows, whose files are written with the writers returned by `open`, for the n-th file
+// (starting at 1).
+func newFailingWriter(t *testing.T, dir string, groupRows int64, open func(n int) (*failingWriter, error)) (*PartitionedWriter, *int) {
+	event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()}
+
+	cfg := &WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionNone, RowGroupSize: groupRows * common.SizeOf(reflect.ValueOf(event))}
+	w := NewPartitionedWriter("discovery_events", new(types.PeerDiscoveredEvent), cfg, zerolog.Nop())
+
+	opened := 0
+	newWriter := w.newWriter
+	w.newWriter = func(file source.ParquetFile, schema interface{}) (rowWriter, error) {
+		opened++
+		fw, err := open(opened)
+		if err != nil {
+			return nil, err
+		}
+
+		pw, err := newWriter(file, schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fw.parquetRowWriter = pw.(*parquetRowWriter)
+		fw.file = &failingFile{ParquetFile: fw.PFile}
+		fw.PFile = fw.file
+		return fw, nil
+	}
+
+	return w, &opened
+}
+
+func checkRows(t *testing.T, dir string, want map[string]int64) {
+	t.Helper()
+
+	for path, rows := range want {
+		if got := countRows(t, filepath.Join(dir, path)); got != rows {
+			t.Errorf("%s: expected %d rows, got %d", path, rows, got)
+		}
+	}
+}
+
+func TestPartitionedWriterRecoversFromWriteError(t *testing.T) {
+	dir := t.TempDir()
+
+	// Only the first writer fails, on its first row group
+	w, opened := newFailingWriter(t, dir, 2, func(n int) (*failingWriter, error) {
+		if n == 1 {
+			return &failingWriter{ok: 0}, nil
+		}
+		return &failingWriter{ok: -1}, nil
+	})
+
+	event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()}
+
+	rowsBefore := testutil.ToFloat64(parquetRowsWritten.WithLabelValues("discovery_events"))
+	bytesBefore := testutil.ToFloat64(parquetBytesFlushed.WithLabelValues("discovery_events"))
+
+	// The failed row group is moved to a fresh file
+	for i := 0; i < 5; i++ {
+		if err := w.Write(time.Now(), event); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+
+	w.Close()
+
+	if *opened != 2 {
+		t.Fatalf("expected 2 opened files, got %d", *opened)
+	}
+
+	if got := testutil.ToFloat64(parquetRowsWritten.WithLabelValues("discovery_events")) - rowsBefore; got != 5 {
+		t.Errorf("expected 5 rows written, got %v", got)
+	}
+	if got := testutil.ToFloat64(parquetBytesFlushed.WithLabelValues("discovery_events")) - bytesBefore; got <= 0 {
+		t.Errorf("expected flushed bytes, got %v", got)
+	}
+
+	checkRows(t, dir, map[string]int64{
+		"discovery_events_test.parquet":   0,
+		"discovery_events_test.1.parquet": 5,
+	})
+}
+
+func TestPartitionedWriterKeepsWrittenRowGroups(t *testing.T) {
+	dir := t.TempDir()
+
+	// The first two row groups are in the file when writing the third one fails halfway
+	w, _ := newFailingWriter(t, dir, 1, func(n int) (*failingWriter, error) {
+		if n == 1 {
+			return &failingWriter{ok: 2}, nil
+		}
+		return &failingWriter{ok: -1}, nil
+	})
+
+	event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()}
+	for i := 0; i < 4; i++ {
+		if err := w.Write(time.Now(), event); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+
+	w.Close()
+
+	checkRows(t, dir, map[string]int64{
+		"discovery_events_test.parquet":   2,
+		"discovery_events_test.1.parquet": 2,
+	})
+}
+
+// The rows pending when a file is closed are written to a new file if their row group fails.
+func TestPartitionedWriterWritesPendingRowsOnClose(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _ := newFailingWriter(t, dir, 10, func(n int) (*failingWriter, error) {
+		if n == 1 {
+			return &failingWriter{ok: 0}, nil
+		}
+		return &failingWriter{ok: -1}, nil
+	})
+
+	event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()}
+	for i := 0; i < 3; i++ {
+		if err := w.Write(time.Now(), event); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+
+	w.Close()
+
+	checkRows(t, dir, map[string]int64{
+		"discovery_events_test.parquet":   0,
+		"discovery_events_test.1.parquet": 3,
+	})
+}
+
+func TestPartitionedWriterRejectsInvalidRow(t *testing.T) {
+	dir := t.TempDir()
+
+	w, opened := newFailingWriter(t, dir, 1, func(int) (*failingWriter, error) {
+		return &failingWriter{ok: -1, invalid: "invalid"}, nil
+	})
+
+	event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()}
+	invalid := types.PeerDiscoveredEvent{ID: "invalid", Timestamp: time.Now().UnixMilli()}
+
+	if err := w.Write(time.Now(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	// Retrying an invalid row doesn't help, so the error doesn't say to
+	err := w.Write(time.Now(), invalid)
+	if err == nil || errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected an invalid row error, got %v", err)
+	}
+
+	if err := w.Write(time.Now(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Close()
+
+	if *opened != 1 {
+		t.Fatalf("expected the file to be kept, got %d opened files", *opened)
+	}
+
+	checkRows(t, dir, map[string]int64{"discovery_events_test.parquet": 2})
+}
+
+func TestPartitionedWriterBuffersRowsUntilReopened(t *testing.T) {
+	dir := t.TempDir()
+
+	// The replacement of the failed file can't be opened at first
+	w, _ := newFailingWriter(t, dir, 2, func(n int) (*failingWriter, error) {
+		switch n {
+		case 1:
+			return &failingWriter{ok: 0}, nil
+		case 2:
+			return nil, errors.New("injected open failure")
+		default:
+			return &failingWriter{ok: -1}, nil
+		}
+	})
+
+	event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()}
+
+	if err := w.Write(time.Now(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed write is retried when redelivered, the row pending before it is kept
+	if err := w.Write(time.Now(), event); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected a retryable write error, got %v", err)
+	}
+
+	if err := w.Write(time.Now(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Close()
+
+	checkRows(t, dir, map[string]int64{
+		"discovery_events_test.parquet":   0,
+		"discovery_events_test.1.parquet": 2,
+	})
+}
+
+// Restarting continues with a new file, the ones of the previous run aren't overwritten.
+func TestPartitionedWriterKeepsPreviousFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionNone}
+
+	for run := 1; run <= 3; run++ {
+		w := NewPartitionedWriter("discovery_events", new(types.PeerDiscoveredEvent), cfg, zerolog.Nop())
+
+		for i := 0; i < run; i++ {
+			event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: time.Now().UnixMilli()}
+			if err := w.Write(time.Now(), event); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		w.Close()
+	}
+
+	checkRows(t, dir, map[string]int64{
+		"discovery_events_test.parquet":   1,
+		"discovery_events_test.1.parquet": 2,
+		"discovery_events_test.2.parquet": 3,
+	})
+}
+
+func TestPartitionedWriterShardsByCrawler(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionNone, ShardBy: ShardCrawlerID, MaxOpenWriters: 2}
+
+	w := NewPartitionedWriter("discovery_events", new(types.PeerDiscoveredEvent), cfg, zerolog.Nop())
+
+	// The third crawler closes the least recently written file, of crawler a
+	for _, crawler := range []string{"a", "b", "b", "c"} {
+		event := types.PeerDiscoveredEvent{ID: "peer", CrawlerID: crawler, Timestamp: time.Now().UnixMilli()}
+		if err := w.Write(time.Now(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(w.writers) != 2 {
+		t.Fatalf("expected 2 open writers, got %d", len(w.writers))
+	}
+	if _, ok := w.writers["crawler_id=a"]; ok {
+		t.Fatal("expected the writer of crawler a to be closed")
+	}
+
+	w.Close()
+
+	for crawler, rows := range map[string]int64{"a": 1, "b": 2, "c": 1} {
+		files, err := filepath.Glob(filepath.Join(dir, "discovery_events", "crawler_id="+crawler, "part-test-*.parquet"))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("crawler %s: expected 1 file, got %v (%v)", crawler, files, err)
+		}
+
+		if got := countRows(t, files[0]); got != rows {
+			t.Errorf("crawler %s: expected %d rows, got %d", crawler, rows, got)
+		}
+	}
+}
+
+func countRows(t *testing.T, path string) int64 {
+	t.Helper()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("missing output file: %v", err)
+	}
+
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Read with the schema of the file, so it works for every output
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	defer pr.ReadStop()
+
+	return pr.GetNumRows()
+}
+
+func TestCompactDeduplicates(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(path string, ids ...string) {
+		file, err := local.NewLocalFileWriter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pw, err := newParquetWriter(file, new(types.PeerDiscoveredEvent), &WriterConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range ids {
+			if err := pw.Write(types.PeerDiscoveredEvent{ID: id, Timestamp: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := pw.WriteStop(); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+
+	write(filepath.Join(dir, "discovery_events_a.parquet"), "peer1", "peer2")
+	write(filepath.Join(dir, "discovery_events_b.parquet"), "peer2", "peer3", "peer3")
+
+	files, err := CompactFiles(dir, "discovery_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+
+	out := filepath.Join(dir, "compacted.parquet")
+	stats, err := Compact("discovery_events", files, out, DefaultCompactKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := CompactStats{Files: 2, RowsIn: 5, RowsOut: 3, Duplicates: 2}
+	if *stats != want {
+		t.Fatalf("expected %+v, got %+v", want, *stats)
+	}
+
+	if got := countRows(t, out); got != 3 {
+		t.Fatalf("expected 3 rows in %s, got %d", out, got)
+	}
+}
+
+func TestPartitionedWriterManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	manifest, err := OpenManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionDay, Manifest: manifest}
+	w := NewPartitionedWriter("discovery_events", new(types.PeerDiscoveredEvent), cfg, zerolog.Nop())
+
+	day := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, ts := range []time.Time{day, day.Add(time.Hour), day.Add(24 * time.Hour)} {
+		event := types.PeerDiscoveredEvent{ID: "peer", Timestamp: ts.UnixMilli(), SchemaVersion: i + 1}
+		if err := w.Write(ts, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(manifest.Files()) != 0 {
+		t.Fatal("listed files that are still open")
+	}
+
+	w.Close()
+
+	// Reopening keeps the files listed by the previous run
+	reopened, err := OpenManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := reopened.Files()
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files in the manifest, got %d", len(files))
+	}
+
+	for _, f := range files {
+		if filepath.IsAbs(f.Path) {
+			t.Errorf("expected a path relative to the output directory, got %s", f.Path)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, f.Path)); err != nil {
+			t.Errorf("listed file %s doesn't exist: %v", f.Path, err)
+		}
+
+		switch f.MinTimestamp {
+		case day.UnixMilli():
+			if f.Rows != 2 || f.MaxTimestamp != day.Add(time.Hour).UnixMilli() || f.SchemaVersion != 2 {
+				t.Errorf("unexpected first day entry: %+v", f)
+			}
+		case day.Add(24 * time.Hour).UnixMilli():
+			if f.Rows != 1 || f.SchemaVersion != 3 {
+				t.Errorf("unexpected second day entry: %+v", f)
+			}
+		default:
+			t.Errorf("unexpected entry: %+v", f)
+		}
+	}
+}
+
+// The idle closer has stopped once stop returns, which can be called again on shutdown.
+func TestIdleCloserStops(t *testing.T) {
+	cfg := &WriterConfig{Dir: t.TempDir(), Prefix: "test", PartitionBy: PartitionDay}
+	w := NewPartitionedWriter("discovery_events", new(types.PeerDiscoveredEvent), cfg, zerolog.Nop())
+
+	stop := startIdleCloser(w)
+
+	done := make(chan struct{})
+	go func() {
+		stop()
+		stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle closer didn't stop")
+	}
+
+	w.Close()
+}
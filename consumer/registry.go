@@ -0,0 +1,226 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/rs/zerolog"
+)
+
+// validatorOutput is written from the metadata events, it has no subject of its own.
+const validatorOutput = "validator_metadata_events"
+
+// eventType maps the subject of an event type to its Parquet output and to how it's
+// decoded and stored. Adding an event type to the consumer is a registration in eventTypes.
+type eventType struct {
+	subject string
+	// output is the name of the Parquet output the events are written to, with rows of
+	// type row. Empty for events that aren't stored.
+	output string
+	row    any
+	// process decodes the payload and stores the event with the writer of the output, see
+	// processEvent.
+	process func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error
+}
+
+// payload is an event to decode, as received on its subject.
+type payload struct {
+	subject string
+	info    messageInfo
+	data    []byte
+}
+
+var eventTypes = []eventType{
+	{
+		subject: types.SubjectPeerDiscovered,
+		output:  "discovery_events",
+		row:     new(types.PeerDiscoveredEvent),
+		process: func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error {
+			var event types.PeerDiscoveredEvent
+			if err := c.decode(p, &event, "PeerDiscoveredEvent"); err != nil {
+				return err
+			}
+			event.IngestedAt = p.info.ingestedAt
+			event.Raw = c.raw(p)
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			return c.storeDiscoveryEvent(ctx, event, w)
+		},
+	},
+	{
+		subject: types.SubjectMetadataReceived,
+		output:  "metadata_events",
+		row:     new(MetadataRow),
+		process: func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error {
+			var event types.MetadataReceivedEvent
+			if err := c.decode(p, &event, "MetadataReceivedEvent"); err != nil {
+				return err
+			}
+			if p.info.format == types.WireFormatCompact {
+				event.CrawlerID = p.info.crawlerID
+				event.CrawlerLoc = p.info.crawlerLoc
+				event.CrawlerVer = p.info.crawlerVer
+			}
+			event.IngestedAt = p.info.ingestedAt
+			event.Raw = c.raw(p)
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			if err := c.handleMetadataEvent(ctx, event); err != nil {
+				return err
+			}
+			// The validator event may already be stored, only have it redelivered if the
+			// metadata event couldn't be written
+			return c.storeMetadataEvent(context.WithoutCancel(ctx), event, w)
+		},
+	},
+	{
+		subject: types.SubjectAttnetsChanged,
+		output:  "attnets_changed_events",
+		row:     new(types.AttnetsChangedEvent),
+		process: func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error {
+			var event types.AttnetsChangedEvent
+			if err := c.decode(p, &event, "AttnetsChangedEvent"); err != nil {
+				return err
+			}
+			event.Raw = c.raw(p)
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			return c.storeAttnetsChangedEvent(ctx, event, w)
+		},
+	},
+	{
+		subject: types.SubjectHeartbeat,
+		output:  "heartbeat_events",
+		row:     new(types.HeartbeatEvent),
+		process: func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error {
+			var event types.HeartbeatEvent
+			if err := c.decode(p, &event, "HeartbeatEvent"); err != nil {
+				return err
+			}
+			event.Raw = c.raw(p)
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			return c.storeHeartbeatEvent(ctx, event, w)
+		},
+	},
+	{
+		subject: types.SubjectHandshakeFailed,
+		output:  "handshake_failed_events",
+		row:     new(types.HandshakeFailedEvent),
+		process: func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error {
+			var event types.HandshakeFailedEvent
+			if err := c.decode(p, &event, "HandshakeFailedEvent"); err != nil {
+				return err
+			}
+			event.Raw = c.raw(p)
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			return c.storeHandshakeFailedEvent(ctx, event, w)
+		},
+	},
+	{
+		subject: types.SubjectSuspiciousPeer,
+		output:  "suspicious_peer_events",
+		row:     new(types.SuspiciousPeerEvent),
+		process: func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error {
+			var event types.SuspiciousPeerEvent
+			if err := c.decode(p, &event, "SuspiciousPeerEvent"); err != nil {
+				return err
+			}
+			event.Raw = c.raw(p)
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			return c.storeSuspiciousPeerEvent(ctx, event, w)
+		},
+	},
+	{
+		subject: types.SubjectPeerChurn,
+		output:  "peer_churn_events",
+		row:     new(types.PeerChurnEvent),
+		process: func(ctx context.Context, c *Consumer, p payload, w *PartitionedWriter) error {
+			var event types.PeerChurnEvent
+			if err := c.decode(p, &event, "PeerChurnEvent"); err != nil {
+				return err
+			}
+			event.Raw = c.raw(p)
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			return c.storePeerChurnEvent(ctx, event, w)
+		},
+	},
+	{
+		// Snapshots aren't stored, they are small enough to read from the logs
+		subject: types.SubjectClientDiversity,
+		process: func(ctx context.Context, c *Consumer, p payload, _ *PartitionedWriter) error {
+			var event types.ClientDiversitySnapshotEvent
+			if err := c.decode(p, &event, "ClientDiversitySnapshotEvent"); err != nil {
+				return err
+			}
+
+			c.checkSchemaVersion(event.SchemaVersion)
+			c.log.Info().Str("crawler", event.CrawlerID).Int("sample_size", event.SampleSize).Any("clients", event.Clients).Msg("Client diversity snapshot")
+			return nil
+		},
+	},
+}
+
+// eventTypesBySubject indexes eventTypes for processEvent.
+var eventTypesBySubject = func() map[string]*eventType {
+	bySubject := make(map[string]*eventType, len(eventTypes))
+	for i := range eventTypes {
+		bySubject[eventTypes[i].subject] = &eventTypes[i]
+	}
+	return bySubject
+}()
+
+// outputSchemas returns the row types of the registered outputs, and of the outputs that
+// aren't written for a subject of their own.
+func outputSchemas() map[string]any {
+	schemas := map[string]any{
+		validatorOutput: new(types.ValidatorEvent),
+	}
+	for _, t := range eventTypes {
+		if t.output != "" {
+			schemas[t.output] = t.row
+		}
+	}
+	return schemas
+}
+
+// newWriters creates a writer for every output in OutputSchemas.
+func newWriters(cfg *WriterConfig, log zerolog.Logger) map[string]*PartitionedWriter {
+	writers := make(map[string]*PartitionedWriter, len(OutputSchemas))
+	for name, row := range OutputSchemas {
+		writers[name] = NewPartitionedWriter(name, row, cfg, log)
+	}
+	return writers
+}
+
+// writerList returns the writers of newWriters, e.g. for startIdleCloser.
+func writerList(writers map[string]*PartitionedWriter) []*PartitionedWriter {
+	list := make([]*PartitionedWriter, 0, len(writers))
+	for _, w := range writers {
+		list = append(list, w)
+	}
+	return list
+}
+
+// decode unmarshals the payload into event, and records the outcome in the decode stats.
+func (c *Consumer) decode(p payload, event any, name string) error {
+	if err := types.Unmarshal(p.info.format, p.data, event); err != nil {
+		c.decodeStats.record(p.subject, true)
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	c.decodeStats.record(p.subject, false)
+
+	return nil
+}
+
+// raw returns the payload to store with the event, only with --store-raw.
+func (c *Consumer) raw(p payload) string {
+	if !c.storeRaw {
+		return ""
+	}
+	return string(p.data)
+}
@@ -0,0 +1,130 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+)
+
+// The results of a message, the result label of messages_total.
+const (
+	resultStored      = "stored"
+	resultFailed      = "failed"
+	resultUnknown     = "unknown"
+	resultRedelivered = "redelivered"
+)
+
+// runStats counts the messages of a run by result and subject, along with the
+// messages_total metric, for the shutdown report.
+type runStats struct {
+	startedAt time.Time
+
+	mu     sync.Mutex
+	counts map[string]map[string]uint64
+	// sinks are the results of closing the sinks, set on shutdown
+	sinks map[string]string
+}
+
+func newRunStats() *runStats {
+	return &runStats{startedAt: time.Now(), counts: make(map[string]map[string]uint64)}
+}
+
+func (s *runStats) record(subject, result string) {
+	messagesTotal.WithLabelValues(subject, result).Inc()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts[result] == nil {
+		s.counts[result] = make(map[string]uint64)
+	}
+	s.counts[result][types.EventType(subject)]++
+}
+
+func (s *runStats) setSinks(results map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sinks = results
+}
+
+func (s *runStats) total(result string) uint64 {
+	var total uint64
+	for _, count := range s.counts[result] {
+		total += count
+	}
+	return total
+}
+
+// ShutdownReport summarizes a consumer run. It's logged on a clean exit, and written to
+// --report-file.
+type ShutdownReport struct {
+	StartedAt       time.Time `json:"started_at"`
+	StoppedAt       time.Time `json:"stopped_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	// Stored are the events written, by event type
+	Stored      map[string]uint64 `json:"stored"`
+	Failed      uint64            `json:"failed"`
+	Unknown     uint64            `json:"unknown"`
+	Redelivered uint64            `json:"redelivered"`
+	// ResumeSeq is the stream sequence the next run resumes from, and Pending the number of
+	// messages left until the end of the stream. Both are 0 when converting a file.
+	ResumeSeq uint64 `json:"resume_seq"`
+	Pending   uint64 `json:"pending"`
+	// Sinks is the result of closing each sink by name, closed or timed_out. A sink that
+	// timed out may have lost the data it hadn't written yet.
+	Sinks map[string]string `json:"sinks,omitempty"`
+}
+
+// report returns the shutdown report of the run. With a durable consumer, its resume
+// sequence is looked up on the server.
+func (s *runStats) report(consumer jetstream.Consumer, log zerolog.Logger) *ShutdownReport {
+	s.mu.Lock()
+	stored := make(map[string]uint64, len(s.counts[resultStored]))
+	for eventType, count := range s.counts[resultStored] {
+		stored[eventType] = count
+	}
+
+	r := &ShutdownReport{
+		StartedAt:   s.startedAt,
+		StoppedAt:   time.Now(),
+		Stored:      stored,
+		Failed:      s.total(resultFailed),
+		Unknown:     s.total(resultUnknown),
+		Redelivered: s.total(resultRedelivered),
+		Sinks:       s.sinks,
+	}
+	s.mu.Unlock()
+
+	r.DurationSeconds = r.StoppedAt.Sub(r.StartedAt).Seconds()
+
+	if consumer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if info, err := consumer.Info(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to look up the resume sequence for the shutdown report")
+		} else {
+			r.ResumeSeq = info.AckFloor.Stream + 1
+			r.Pending = info.NumPending
+		}
+	}
+
+	log.Info().
+		Time("started_at", r.StartedAt).
+		Float64("duration_seconds", r.DurationSeconds).
+		Any("stored", r.Stored).
+		Uint64("failed", r.Failed).
+		Uint64("unknown", r.Unknown).
+		Uint64("redelivered", r.Redelivered).
+		Uint64("resume_seq", r.ResumeSeq).
+		Uint64("pending", r.Pending).
+		Any("sinks", r.Sinks).
+		Msg("Shutdown report")
+
+	return r
+}
@@ -0,0 +1,247 @@
+package consumer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chainbound/valtrack/pkg/ethereum"
+	"github.com/chainbound/valtrack/types"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/rs/zerolog"
+)
+
+// The aggregations of the rollups.
+const (
+	// RollupPeers counts the distinct peers
+	RollupPeers = "peers"
+	// RollupClients counts the distinct peers per client
+	RollupClients = "clients"
+	// RollupCountries counts the distinct peers per country
+	RollupCountries = "countries"
+)
+
+// AllRollupAggregations are the aggregations rollups can compute.
+var AllRollupAggregations = []string{RollupPeers, RollupClients, RollupCountries}
+
+// RollupConfig configures the rollups of the metadata events.
+type RollupConfig struct {
+	// Window is the length of a rollup, aligned to wall-clock time. 0 disables rollups.
+	Window time.Duration
+	// Aggregations are the aggregations to compute, all of them if empty.
+	Aggregations []string
+	// Only skips the raw metadata events, so only their rollups are written.
+	Only bool
+}
+
+// Validate checks the rollup window and aggregations.
+func (c *RollupConfig) Validate() error {
+	if c.Window < 0 {
+		return fmt.Errorf("invalid rollup window %s: must be positive", c.Window)
+	}
+
+	if c.Only && c.Window == 0 {
+		return fmt.Errorf("rollup-only needs a rollup window")
+	}
+
+	for _, agg := range c.Aggregations {
+		if !slices.Contains(AllRollupAggregations, agg) {
+			return fmt.Errorf("unknown rollup aggregation %q (must be one of %v)", agg, AllRollupAggregations)
+		}
+	}
+
+	return nil
+}
+
+// RollupRow is a row of the rollups output: the number of distinct peers of an aggregation
+// in a window.
+type RollupRow struct {
+	WindowStart int64  `parquet:"name=window_start, type=INT64"`
+	WindowEnd   int64  `parquet:"name=window_end, type=INT64"`
+	Aggregation string `parquet:"name=aggregation, type=BYTE_ARRAY, convertedtype=UTF8"`
+	// Key is the client or country, empty for the peers aggregation
+	Key   string `parquet:"name=key, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Peers int64  `parquet:"name=peers, type=INT64"`
+}
+
+// rollupWindow holds the peers seen in a window, by client and country.
+type rollupWindow struct {
+	start     time.Time
+	peers     map[string]struct{}
+	clients   map[string]int64
+	countries map[string]int64
+}
+
+// rollups aggregates the metadata events in windows, and writes every window once it's
+// over. Peers are only counted once per window, so redelivered events don't change them.
+type rollups struct {
+	mu      sync.Mutex
+	cfg     *RollupConfig
+	enabled map[string]bool
+	windows map[int64]*rollupWindow
+	writer  *PartitionedWriter
+	// country returns the country of an IP address, or "" if unknown
+	country func(ip string) string
+	log     zerolog.Logger
+}
+
+func newRollups(cfg *RollupConfig, writer *PartitionedWriter, country func(string) string, log zerolog.Logger) *rollups {
+	aggregations := cfg.Aggregations
+	if len(aggregations) == 0 {
+		aggregations = AllRollupAggregations
+	}
+
+	enabled := make(map[string]bool, len(aggregations))
+	for _, agg := range aggregations {
+		enabled[agg] = true
+	}
+
+	return &rollups{
+		cfg:     cfg,
+		enabled: enabled,
+		windows: make(map[int64]*rollupWindow),
+		writer:  writer,
+		country: country,
+		log:     log,
+	}
+}
+
+// add counts the peer of a metadata event in the window of its timestamp.
+func (r *rollups) add(event *types.MetadataReceivedEvent) {
+	start := time.UnixMilli(event.Timestamp).Truncate(r.cfg.Window)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.windows[start.UnixMilli()]
+	if !ok {
+		w = &rollupWindow{
+			start:     start,
+			peers:     make(map[string]struct{}),
+			clients:   make(map[string]int64),
+			countries: make(map[string]int64),
+		}
+		r.windows[start.UnixMilli()] = w
+	}
+
+	if _, ok := w.peers[event.ID]; ok {
+		return
+	}
+	w.peers[event.ID] = struct{}{}
+
+	if r.enabled[RollupClients] {
+		w.clients[ethereum.ClientName(event.ClientVersion)]++
+	}
+
+	if r.enabled[RollupCountries] {
+		country := "unknown"
+		if r.country != nil {
+			if c := r.country(multiaddrIP(event.Multiaddr)); c != "" {
+				country = c
+			}
+		}
+		w.countries[country]++
+	}
+}
+
+// flush writes the windows that ended before `now`, or all of them if `all` is set.
+func (r *rollups) flush(now time.Time, all bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, w := range r.windows {
+		end := w.start.Add(r.cfg.Window)
+		if !all && end.After(now) {
+			continue
+		}
+
+		rows := r.rows(w, end)
+		for _, row := range rows {
+			if err := r.writer.Write(w.start, row); err != nil {
+				r.log.Error().Err(err).Time("window", w.start).Msg("Failed to write rollup to Parquet file")
+				break
+			}
+		}
+
+		r.log.Info().Time("window", w.start).Int("peers", len(w.peers)).Int("rows", len(rows)).Msg("Wrote rollup")
+		delete(r.windows, key)
+	}
+}
+
+// rows returns the rows of the enabled aggregations of a window.
+func (r *rollups) rows(w *rollupWindow, end time.Time) []RollupRow {
+	row := func(agg, key string, peers int64) RollupRow {
+		return RollupRow{
+			WindowStart: w.start.UnixMilli(),
+			WindowEnd:   end.UnixMilli(),
+			Aggregation: agg,
+			Key:         key,
+			Peers:       peers,
+		}
+	}
+
+	var rows []RollupRow
+	if r.enabled[RollupPeers] {
+		rows = append(rows, row(RollupPeers, "", int64(len(w.peers))))
+	}
+
+	for client, count := range w.clients {
+		rows = append(rows, row(RollupClients, client, count))
+	}
+
+	for country, count := range w.countries {
+		rows = append(rows, row(RollupCountries, country, count))
+	}
+
+	return rows
+}
+
+// run flushes the windows that ended at every window boundary, until the context is
+// cancelled.
+func (r *rollups) run(ctx context.Context) {
+	for {
+		now := time.Now()
+		next := now.Truncate(r.cfg.Window).Add(r.cfg.Window)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+			r.flush(time.Now(), false)
+		}
+	}
+}
+
+// multiaddrIP returns the IP address of a multiaddr, or "" if it has none.
+func multiaddrIP(addr string) string {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return ""
+	}
+
+	if ip, err := maddr.ValueForProtocol(ma.P_IP4); err == nil {
+		return ip
+	}
+
+	ip, _ := maddr.ValueForProtocol(ma.P_IP6)
+	return ip
+}
+
+// countryFromDB looks up the country of an IP address in the IP metadata table.
+func countryFromDB(db *sql.DB) func(ip string) string {
+	return func(ip string) string {
+		if ip == "" {
+			return ""
+		}
+
+		var country sql.NullString
+		if err := db.QueryRow("SELECT country FROM ip_metadata WHERE ip = ?", ip).Scan(&country); err != nil {
+			return ""
+		}
+
+		return country.String
+	}
+}
@@ -0,0 +1,89 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/rs/zerolog"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestRollups(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &WriterConfig{Dir: dir, Prefix: "test", PartitionBy: PartitionNone}
+	w := NewPartitionedWriter("rollups", new(RollupRow), cfg, zerolog.Nop())
+
+	country := func(ip string) string {
+		if ip == "1.2.3.4" {
+			return "DE"
+		}
+		return ""
+	}
+
+	r := newRollups(&RollupConfig{Window: time.Hour}, w, country, zerolog.Nop())
+
+	hour := time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)
+	for _, e := range []types.MetadataReceivedEvent{
+		{ID: "a", ClientVersion: "Lighthouse/v5.1.3", Multiaddr: "/ip4/1.2.3.4/tcp/9000", Timestamp: hour.Add(time.Minute).UnixMilli()},
+		// Seen again in the same window, only counted once
+		{ID: "a", ClientVersion: "Lighthouse/v5.1.3", Multiaddr: "/ip4/1.2.3.4/tcp/9000", Timestamp: hour.Add(30 * time.Minute).UnixMilli()},
+		{ID: "b", ClientVersion: "teku/v24.4.0", Multiaddr: "/ip4/5.6.7.8/tcp/9000", Timestamp: hour.Add(59 * time.Minute).UnixMilli()},
+		// Next window
+		{ID: "a", ClientVersion: "Lighthouse/v5.1.3", Multiaddr: "/ip4/1.2.3.4/tcp/9000", Timestamp: hour.Add(61 * time.Minute).UnixMilli()},
+	} {
+		r.add(&e)
+	}
+
+	if len(r.windows) != 2 {
+		t.Fatalf("expected 2 windows, got %d", len(r.windows))
+	}
+
+	first := r.windows[hour.UnixMilli()]
+	if len(first.peers) != 2 || first.clients["lighthouse"] != 1 || first.clients["teku"] != 1 {
+		t.Fatalf("unexpected first window: %+v", first)
+	}
+	if first.countries["DE"] != 1 || first.countries["unknown"] != 1 {
+		t.Fatalf("unexpected countries: %v", first.countries)
+	}
+
+	// Only the first window is over
+	r.flush(hour.Add(90*time.Minute), false)
+	if len(r.windows) != 1 {
+		t.Fatalf("expected 1 window left, got %d", len(r.windows))
+	}
+
+	r.flush(hour.Add(90*time.Minute), true)
+	w.Close()
+
+	// peers, 2 clients and 2 countries in the first window, and 1 of each in the second
+	if got := countRows(t, filepath.Join(dir, "rollups_test.parquet")); got != 8 {
+		t.Fatalf("expected 8 rollup rows, got %d", got)
+	}
+}
+
+// A metadata event whose write failed is redelivered, so it's only added to the rollups
+// once it's written.
+func TestRollupsSkipFailedWrites(t *testing.T) {
+	cfg := &WriterConfig{Dir: t.TempDir(), Prefix: "test", PartitionBy: PartitionNone}
+	w := NewPartitionedWriter("metadata_events", new(MetadataRow), cfg, zerolog.Nop())
+	w.newWriter = func(source.ParquetFile, interface{}) (rowWriter, error) {
+		return nil, errors.New("injected open failure")
+	}
+
+	c := &Consumer{
+		log:     zerolog.Nop(),
+		rollups: newRollups(&RollupConfig{Window: time.Hour}, nil, func(string) string { return "" }, zerolog.Nop()),
+	}
+
+	event := types.MetadataReceivedEvent{ID: "a", MetaData: &types.SimpleMetaData{}, Timestamp: time.Now().UnixMilli()}
+	if err := c.storeMetadataEvent(context.Background(), event, w); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected a write failure, got %v", err)
+	}
+	if len(c.rollups.windows) != 0 {
+		t.Fatalf("expected the event not to be added to the rollups, got %d windows", len(c.rollups.windows))
+	}
+}
@@ -0,0 +1,83 @@
+package consumer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// ParquetColumn describes a column (or group of columns) in a Parquet file schema.
+type ParquetColumn struct {
+	// Path is the dotted path of the column, e.g. `multiaddrs.list.element`.
+	Path          string          `json:"path"`
+	Depth         int             `json:"depth"`
+	Type          string          `json:"type,omitempty"`
+	ConvertedType string          `json:"converted_type,omitempty"`
+	Repetition    string          `json:"repetition,omitempty"`
+	Children      []ParquetColumn `json:"children,omitempty"`
+}
+
+// ParquetSchema is the schema of a Parquet file, read from its footer.
+type ParquetSchema struct {
+	NumRows int64           `json:"num_rows"`
+	Columns []ParquetColumn `json:"columns"`
+}
+
+// ReadParquetSchema reads the schema from the footer of a Parquet file, without reading
+// any rows.
+func ReadParquetSchema(path string) (*ParquetSchema, error) {
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	pr := &reader.ParquetReader{PFile: file}
+	if err := pr.ReadFooter(); err != nil {
+		return nil, fmt.Errorf("failed to read parquet footer of %s: %w", path, err)
+	}
+
+	elements := pr.Footer.GetSchema()
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("%s has an empty schema", path)
+	}
+
+	// The first element is the root, its children are the top-level columns
+	columns, _ := parquetColumns(elements, 1, int(elements[0].GetNumChildren()), nil, 0)
+
+	return &ParquetSchema{NumRows: pr.Footer.GetNumRows(), Columns: columns}, nil
+}
+
+// parquetColumns converts `count` schema elements starting at `idx` (and their children,
+// which follow them depth-first) into columns. It returns the index after the last one.
+func parquetColumns(elements []*parquet.SchemaElement, idx, count int, parent []string, depth int) ([]ParquetColumn, int) {
+	columns := make([]ParquetColumn, 0, count)
+
+	for i := 0; i < count && idx < len(elements); i++ {
+		el := elements[idx]
+		path := append(append([]string{}, parent...), el.GetName())
+		idx++
+
+		col := ParquetColumn{Path: strings.Join(path, "."), Depth: depth}
+		if el.IsSetType() {
+			col.Type = el.GetType().String()
+		}
+		if el.IsSetConvertedType() {
+			col.ConvertedType = el.GetConvertedType().String()
+		}
+		if el.IsSetRepetitionType() {
+			col.Repetition = el.GetRepetitionType().String()
+		}
+
+		if n := int(el.GetNumChildren()); n > 0 {
+			col.Children, idx = parquetColumns(elements, idx, n, path, depth+1)
+		}
+
+		columns = append(columns, col)
+	}
+
+	return columns, idx
+}
@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// The results of closing a sink on shutdown, in the shutdown report.
+const (
+	sinkClosed   = "closed"
+	sinkTimedOut = "timed_out"
+)
+
+// sinks are the outputs flushed and closed on shutdown: the Parquet writers by output name,
+// the rollups and the InfluxDB sink.
+type sinks struct {
+	names   []string
+	closers []func()
+	// results is set once the sinks are closed
+	results map[string]string
+}
+
+// add registers a sink. close flushes it and must return once its data is written.
+func (s *sinks) add(name string, close func()) {
+	s.names = append(s.names, name)
+	s.closers = append(s.closers, close)
+}
+
+// close closes the sinks concurrently, waiting at most `timeout` for each, so a stuck sink
+// doesn't keep the others from writing their data before the process exits. A sink that
+// timed out keeps closing in the background. 0 waits for every sink. It returns the result
+// of each sink by name, and only closes the sinks on the first call.
+func (s *sinks) close(timeout time.Duration, log zerolog.Logger) map[string]string {
+	if s.results != nil {
+		return s.results
+	}
+
+	type result struct {
+		name   string
+		status string
+		took   time.Duration
+	}
+
+	results := make(chan result, len(s.names))
+	for i, name := range s.names {
+		go func(name string, close func()) {
+			start := time.Now()
+
+			done := make(chan struct{}, 1)
+			go func() {
+				close()
+				done <- struct{}{}
+			}()
+
+			var expired <-chan time.Time
+			if timeout > 0 {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				expired = timer.C
+			}
+
+			select {
+			case <-done:
+				results <- result{name, sinkClosed, time.Since(start)}
+			case <-expired:
+				results <- result{name, sinkTimedOut, timeout}
+			}
+		}(name, s.closers[i])
+	}
+
+	s.results = make(map[string]string, len(s.names))
+	for range s.names {
+		r := <-results
+		s.results[r.name] = r.status
+
+		if r.status == sinkTimedOut {
+			log.Warn().Str("sink", r.name).Dur("timeout", timeout).Msg("Timed out closing sink, its last data may be lost")
+		} else {
+			log.Info().Str("sink", r.name).Dur("took", r.took).Msg("Closed sink")
+		}
+	}
+
+	return s.results
+}
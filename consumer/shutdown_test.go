@@ -0,0 +1,36 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSinksClose(t *testing.T) {
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	var s sinks
+	closed := false
+	s.add("metadata_events", func() { closed = true })
+	s.add("influx", func() { <-stuck })
+
+	start := time.Now()
+	results := s.close(50*time.Millisecond, zerolog.Nop())
+	if took := time.Since(start); took > time.Second {
+		t.Fatalf("the stuck sink held the shutdown for %s", took)
+	}
+
+	if !closed || results["metadata_events"] != sinkClosed {
+		t.Errorf("expected metadata_events to be closed, got %q", results["metadata_events"])
+	}
+	if results["influx"] != sinkTimedOut {
+		t.Errorf("expected influx to time out, got %q", results["influx"])
+	}
+
+	// Only the first call closes the sinks
+	if again := s.close(0, zerolog.Nop()); again["influx"] != sinkTimedOut {
+		t.Errorf("expected the results of the first call, got %v", again)
+	}
+}
@@ -0,0 +1,51 @@
+package discovery
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/chainbound/valtrack/log"
+	gcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// identityKey returns the private key of the node. Without a path, a new key is generated
+// on every start. Otherwise the key is loaded from the file, which is created with a new
+// key (readable only by the owner) on the first run.
+func identityKey(path string) (*ecdsa.PrivateKey, error) {
+	if path == "" {
+		return ecdsa.GenerateKey(gcrypto.S256(), rand.Reader)
+	}
+
+	logger := log.NewLogger("identity")
+
+	key, err := gcrypto.LoadECDSA(path)
+	if err == nil {
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o077 != 0 {
+			logger.Warn().Str("path", path).Str("mode", info.Mode().Perm().String()).Msg("Identity key file is readable by other users")
+		}
+
+		logger.Info().Str("path", path).Msg("Loaded identity key")
+		return key, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load identity key from %s: %w", path, err)
+	}
+
+	key, err = ecdsa.GenerateKey(gcrypto.S256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Written with 0600 permissions
+	if err := gcrypto.SaveECDSA(path, key); err != nil {
+		return nil, fmt.Errorf("failed to save identity key to %s: %w", path, err)
+	}
+
+	logger.Info().Str("path", path).Msg("Generated new identity key")
+	return key, nil
+}
@@ -0,0 +1,35 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestIdentityKeyIsPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.key")
+
+	generated, err := identityKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected 0600 permissions, got %v", perm)
+	}
+
+	loaded, err := identityKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gcrypto.PubkeyToAddress(generated.PublicKey) != gcrypto.PubkeyToAddress(loaded.PublicKey) {
+		t.Fatal("loaded a different key than the generated one")
+	}
+}
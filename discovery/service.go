@@ -2,16 +2,18 @@ package discovery
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/rand"
 	"fmt"
+	"net/http"
 
 	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/log"
 
 	"github.com/chainbound/valtrack/pkg/ethereum"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	gcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/prysmaticlabs/prysm/v5/config/params"
 )
 
@@ -19,23 +21,25 @@ type Discovery struct {
 	node *ethereum.Node
 }
 
-func NewDiscovery(natsURL string) (*Discovery, error) {
-	var privBytes []byte
-
-	key, err := ecdsa.GenerateKey(gcrypto.S256(), rand.Reader)
+// NewDiscovery creates the sentry node. Peers are found with `discoverer`, or if nil, with
+// the discv5 walk (or from the configured peers file).
+func NewDiscovery(nodeConfig *config.NodeConfig, discoverer ethereum.Discoverer) (*Discovery, error) {
+	key, err := identityKey(nodeConfig.IdentityKeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate key: %w", err)
+		return nil, fmt.Errorf("failed to set up identity key: %w", err)
 	}
 
-	privBytes = gcrypto.FromECDSA(key)
-	privateKey := (*crypto.Secp256k1PrivateKey)(secp256k1.PrivKeyFromBytes(privBytes))
+	privateKey := (*crypto.Secp256k1PrivateKey)(secp256k1.PrivKeyFromBytes(gcrypto.FromECDSA(key)))
+
+	if id, err := peer.IDFromPrivateKey(privateKey); err == nil {
+		logger := log.NewLogger("identity")
+		logger.Info().Str("peer_id", id.String()).Bool("persistent", nodeConfig.IdentityKeyPath != "").Msg("Node identity")
+	}
 
-	nodeConfig := &config.DefaultNodeConfig
 	nodeConfig.PrivateKey = privateKey
 	nodeConfig.BeaconConfig = params.MainnetConfig()
-	nodeConfig.NatsURL = natsURL
 
-	n, err := ethereum.NewNode(nodeConfig)
+	n, err := ethereum.NewNode(nodeConfig, discoverer)
 
 	return &Discovery{
 		node: n,
@@ -45,3 +49,34 @@ func NewDiscovery(natsURL string) (*Discovery, error) {
 func (d *Discovery) Start(ctx context.Context) error {
 	return d.node.Start(ctx)
 }
+
+// StatsHandler serves a JSON summary of the current crawl.
+func (d *Discovery) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	d.node.StatsHandler(w, r)
+}
+
+// Stats returns a summary of the current crawl.
+func (d *Discovery) Stats() ethereum.CrawlStats {
+	return d.node.Stats()
+}
+
+// SelfHandler serves the peer ID, ENR and addresses of the sentry as JSON.
+func (d *Discovery) SelfHandler(w http.ResponseWriter, r *http.Request) {
+	d.node.SelfHandler(w, r)
+}
+
+// DiscTableHandler serves a snapshot of the discv5 routing table as JSON.
+func (d *Discovery) DiscTableHandler(w http.ResponseWriter, r *http.Request) {
+	d.node.DiscTableHandler(w, r)
+}
+
+// Nodes returns a channel with every node found by the discv5 walk, in discovery order.
+func (d *Discovery) Nodes() <-chan *enode.Node {
+	return d.node.DiscoveredNodes()
+}
+
+// Probe handshakes a single peer and returns the outcome of every step. The node can't
+// be started afterwards.
+func (d *Discovery) Probe(ctx context.Context, sp *ethereum.StaticPeer) *ethereum.ProbeResult {
+	return d.node.Probe(ctx, sp)
+}
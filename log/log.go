@@ -2,6 +2,8 @@ package log
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -19,3 +21,58 @@ func NewLogger(module string) zerolog.Logger {
 
 	return log.Output(output)
 }
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// NewFileLogger returns a logger that writes newline-delimited JSON to the file at `path`,
+// together with the closer for the underlying file. If `path` is empty, file logging is
+// disabled and a no-op logger is returned.
+func NewFileLogger(path string) (zerolog.Logger, io.Closer, error) {
+	if path == "" {
+		return zerolog.Nop(), nopCloser{}, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return zerolog.Nop(), nil, err
+	}
+
+	return zerolog.New(file).With().Timestamp().Logger(), file, nil
+}
+
+// NewWriterLogger returns a logger that writes newline-delimited JSON to w, like the file
+// logger. The returned closer is a no-op: w is closed by its owner.
+func NewWriterLogger(w io.Writer) (zerolog.Logger, io.Closer) {
+	return zerolog.New(w).With().Timestamp().Logger(), nopCloser{}
+}
+
+// LevelHandler serves the global log level. GET returns the current level, PUT sets
+// it from the request body (e.g. "debug").
+func LevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		text := strings.TrimSpace(string(body))
+		level, err := zerolog.ParseLevel(text)
+		if err != nil || text == "" {
+			http.Error(w, fmt.Sprintf("unknown log level: %q", text), http.StatusBadRequest)
+			return
+		}
+
+		zerolog.SetGlobalLevel(level)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Fprintln(w, zerolog.GlobalLevel().String())
+}
@@ -0,0 +1,174 @@
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// socketWriteTimeout is how long a line can take to be written to the client before it's
+// considered gone.
+const socketWriteTimeout = time.Second
+
+// SocketWriter serves newline-delimited JSON on a Unix domain socket, to a sidecar reading
+// it. One client is served at a time: a new connection replaces the previous one. Writes
+// never block: lines are queued up to the buffer size while no client is connected or the
+// client falls behind, and dropped after that.
+type SocketWriter struct {
+	ln     net.Listener
+	lines  chan []byte
+	conns  chan net.Conn
+	onDrop func()
+	// closing stops waiting for a client on Close, done is closed when run returned
+	closing chan struct{}
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewSocketWriter listens on the Unix socket at `path`, replacing a stale socket file left
+// by a previous run. `onDrop` is called for every dropped line, and can be nil.
+func NewSocketWriter(path string, bufferSize int, onDrop func()) (*SocketWriter, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if onDrop == nil {
+		onDrop = func() {}
+	}
+
+	w := &SocketWriter{
+		ln:      ln,
+		lines:   make(chan []byte, bufferSize),
+		conns:   make(chan net.Conn),
+		onDrop:  onDrop,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go w.accept()
+	go w.run()
+
+	return w, nil
+}
+
+// Write queues a line, or drops it if the buffer is full or the writer is closed.
+func (w *SocketWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		w.onDrop()
+		return len(p), nil
+	}
+
+	// The caller may reuse p
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	select {
+	case w.lines <- line:
+	default:
+		w.onDrop()
+	}
+
+	return len(p), nil
+}
+
+// Close stops accepting clients, writes the queued lines to the current client, if any,
+// and removes the socket.
+func (w *SocketWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.lines)
+	close(w.closing)
+	w.mu.Unlock()
+
+	err := w.ln.Close()
+	<-w.done
+
+	return err
+}
+
+func (w *SocketWriter) accept() {
+	for {
+		conn, err := w.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		select {
+		case w.conns <- conn:
+		case <-w.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// run writes the queued lines to the current client. While none is connected, lines stay
+// queued. A line that failed to be written is retried on the next client.
+func (w *SocketWriter) run() {
+	defer close(w.done)
+
+	var (
+		conn    net.Conn
+		pending []byte
+	)
+
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		if conn == nil {
+			select {
+			case conn = <-w.conns:
+			case <-w.closing:
+				return
+			}
+			continue
+		}
+
+		if pending == nil {
+			select {
+			case c := <-w.conns:
+				conn.Close()
+				conn = c
+				continue
+			case line, ok := <-w.lines:
+				if !ok {
+					return
+				}
+				pending = line
+			}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		if _, err := conn.Write(pending); err != nil {
+			conn.Close()
+			conn = nil
+			continue
+		}
+		pending = nil
+	}
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readSocketLine(t *testing.T, r *bufio.Reader, conn net.Conn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func TestSocketWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+
+	dropped := 0
+	w, err := NewSocketWriter(path, 2, func() { dropped++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Lines are queued until a client connects, then dropped when the buffer is full
+	for _, line := range []string{"1\n", "2\n", "3\n"} {
+		w.Write([]byte(line))
+	}
+	if dropped != 1 {
+		t.Fatalf("expected 1 dropped line, got %d", dropped)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"1\n", "2\n"} {
+		if got := readSocketLine(t, r, conn); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+
+	// A reconnecting client replaces the previous one
+	conn.Close()
+	conn, err = net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Give the writer time to pick up the new client
+	time.Sleep(100 * time.Millisecond)
+	w.Write([]byte("4\n"))
+	if got := readSocketLine(t, bufio.NewReader(conn), conn); got != "4\n" {
+		t.Fatalf("expected %q, got %q", "4\n", got)
+	}
+}
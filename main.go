@@ -1,21 +1,33 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/chainbound/valtrack/cmd"
+	"github.com/chainbound/valtrack/version"
 )
 
 func main() {
+	cli.VersionPrinter = func(c *cli.Context) {
+		fmt.Println(version.Info())
+	}
+
 	app := &cli.App{
-		Name:  "valtrack",
-		Usage: "Ethereum consensus validator tracking tool",
+		Name:    "valtrack",
+		Usage:   "Ethereum consensus validator tracking tool",
+		Version: version.Short(),
 		Commands: []*cli.Command{
 			cmd.SentryCommand,
 			cmd.ConsumerCommand,
+			cmd.QueryCommand,
+			cmd.ProbeCommand,
+			cmd.CompactCommand,
+			cmd.BenchCommand,
+			cmd.VersionCommand,
 		},
 	}
 
@@ -0,0 +1,177 @@
+package ethereum
+
+import (
+	"net"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// normalizeAddr strips the peer ID from a multiaddr, so an address received with and
+// without it compares equal.
+func normalizeAddr(addr ma.Multiaddr) ma.Multiaddr {
+	if transport, _ := peer.SplitAddr(addr); transport != nil {
+		return transport
+	}
+
+	return addr
+}
+
+func isRelayAddr(addr ma.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(ma.P_CIRCUIT)
+	return err == nil
+}
+
+// enrIPPort returns the IP and TCP port advertised in an ENR. The IPv4 address is
+// preferred, an IPv6-only ENR has its `tcp6` port, or the `tcp` port if it has none. It
+// returns a nil IP if the ENR advertises neither.
+func enrIPPort(node *enode.Node) (net.IP, int) {
+	var (
+		ip4  enr.IPv4
+		ip6  enr.IPv6
+		tcp  enr.TCP
+		tcp6 enr.TCP6
+	)
+
+	node.Load(&tcp)
+
+	if node.Load(&ip4) == nil && tcp != 0 {
+		return net.IP(ip4), int(tcp)
+	}
+
+	if node.Load(&ip6) == nil {
+		if node.Load(&tcp6) == nil && tcp6 != 0 {
+			return net.IP(ip6), int(tcp6)
+		}
+		if tcp != 0 {
+			return net.IP(ip6), int(tcp)
+		}
+	}
+
+	return nil, 0
+}
+
+// ipVersion returns the version of an IP address, 4 or 6, or 0 if it isn't one.
+func ipVersion(ip string) int {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return 0
+	case parsed.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
+}
+
+// enrAddr returns the TCP address advertised in an ENR, or nil if it has none.
+func enrAddr(node enode.Node) ma.Multiaddr {
+	if node.ID() == (enode.ID{}) {
+		return nil
+	}
+
+	ip, port := enrIPPort(&node)
+	if ip == nil {
+		return nil
+	}
+
+	addr, err := MaddrFrom(ip.String(), uint(port))
+	if err != nil {
+		return nil
+	}
+
+	return addr
+}
+
+// peerAddrs returns all known addresses of a peer, normalized and without duplicates,
+// starting with the address of the connection.
+func peerAddrs(remote ma.Multiaddr, addrs []ma.Multiaddr) []ma.Multiaddr {
+	all := make([]ma.Multiaddr, 0, len(addrs)+1)
+	seen := make(map[string]struct{}, len(addrs)+1)
+
+	for _, addr := range append([]ma.Multiaddr{remote}, addrs...) {
+		if addr == nil {
+			continue
+		}
+
+		addr = normalizeAddr(addr)
+		if _, ok := seen[string(addr.Bytes())]; ok {
+			continue
+		}
+
+		seen[string(addr.Bytes())] = struct{}{}
+		all = append(all, addr)
+	}
+
+	return all
+}
+
+// selectAddr picks the address to report for a peer out of its known addresses (see
+// peerAddrs): the first public, non-relay address, then the ENR address, then the first
+// address that isn't a loopback or relay address. It returns false if the selected
+// address isn't public.
+func selectAddr(addrs []ma.Multiaddr, enr ma.Multiaddr) (ma.Multiaddr, bool) {
+	for _, addr := range addrs {
+		if manet.IsPublicAddr(addr) && !isRelayAddr(addr) {
+			return addr, true
+		}
+	}
+
+	if enr != nil {
+		return enr, manet.IsPublicAddr(enr)
+	}
+
+	for _, addr := range addrs {
+		if !manet.IsIPLoopback(addr) && !isRelayAddr(addr) {
+			return addr, false
+		}
+	}
+
+	if len(addrs) > 0 {
+		return addrs[0], false
+	}
+
+	return nil, false
+}
+
+// selectDialAddr picks the address to dial a peer on out of its known addresses: the first
+// public, non-relay address, then the first private, non-relay address that isn't a
+// loopback, then the first address. It returns false if it had to fall back to an address
+// that isn't public.
+func selectDialAddr(addrs []ma.Multiaddr) (ma.Multiaddr, bool) {
+	if len(addrs) == 0 {
+		return nil, false
+	}
+
+	for _, addr := range addrs {
+		if manet.IsPublicAddr(addr) && !isRelayAddr(addr) {
+			return normalizeAddr(addr), true
+		}
+	}
+
+	for _, addr := range addrs {
+		if !manet.IsIPLoopback(addr) && !isRelayAddr(addr) {
+			return normalizeAddr(addr), false
+		}
+	}
+
+	return normalizeAddr(addrs[0]), false
+}
+
+// dialAddrInfo returns the address info to redial a peer with, built from the address
+// selected by selectDialAddr. Fallbacks are logged, at most once per minute.
+func (n *Node) dialAddrInfo(pid peer.ID, addrs []ma.Multiaddr) peer.AddrInfo {
+	addr, ok := selectDialAddr(addrs)
+	if addr == nil {
+		return peer.AddrInfo{ID: pid}
+	}
+
+	if !ok {
+		n.dialAddrLog.Warn().Str("peer", pid.String()).Str("addr", addr.String()).Int("addrs", len(addrs)).Msg("No public address for peer, falling back to a private or relay address")
+	}
+
+	return peer.AddrInfo{ID: pid, Addrs: []ma.Multiaddr{addr}}
+}
@@ -0,0 +1,245 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestSelectDialAddr(t *testing.T) {
+	const (
+		public  = "/ip4/1.2.3.4/tcp/9000"
+		private = "/ip4/192.168.1.10/tcp/9000"
+		local   = "/ip4/127.0.0.1/tcp/9000"
+		relay   = "/ip4/5.6.7.8/tcp/4001/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC/p2p-circuit"
+	)
+
+	tests := []struct {
+		name   string
+		addrs  []string
+		want   string
+		public bool
+	}{
+		{name: "no addresses"},
+		{name: "public only", addrs: []string{public}, want: public, public: true},
+		{name: "public after private", addrs: []string{local, private, public}, want: public, public: true},
+		{name: "public after relay", addrs: []string{relay, public}, want: public, public: true},
+		{name: "private over loopback", addrs: []string{local, private}, want: private},
+		{name: "private over relay", addrs: []string{relay, private}, want: private},
+		{name: "loopback only", addrs: []string{local}, want: local},
+		{name: "relay only", addrs: []string{relay}, want: "/ip4/5.6.7.8/tcp/4001/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC/p2p-circuit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs := make([]ma.Multiaddr, 0, len(tt.addrs))
+			for _, s := range tt.addrs {
+				addrs = append(addrs, ma.StringCast(s))
+			}
+
+			got, public := selectDialAddr(addrs)
+			if tt.want == "" {
+				if got != nil {
+					t.Fatalf("expected no address, got %s", got)
+				}
+				return
+			}
+
+			if got == nil || got.String() != tt.want {
+				t.Fatalf("expected %s, got %v", tt.want, got)
+			}
+
+			if public != tt.public {
+				t.Fatalf("expected public=%v, got %v", tt.public, public)
+			}
+		})
+	}
+}
+
+func TestDialAddrs(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/127.0.0.1/tcp/9000"),
+		ma.StringCast("/ip4/192.168.1.10/tcp/9000"),
+		ma.StringCast("/ip4/1.2.3.4/tcp/9000"),
+		ma.StringCast("/ip4/1.2.3.4/tcp/9000"),
+		ma.StringCast("/ip4/5.6.7.8/tcp/9000"),
+	}
+
+	got := dialAddrs(addrs, 3)
+	want := []string{"/ip4/1.2.3.4/tcp/9000", "/ip4/5.6.7.8/tcp/9000", "/ip4/192.168.1.10/tcp/9000"}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	if all := dialAddrs(addrs, 0); len(all) != 4 {
+		t.Fatalf("expected 4 addresses without a limit, got %v", all)
+	}
+}
+
+func TestConnectAddrsRetriesFailedHandshake(t *testing.T) {
+	remote, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	addrs := remote.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 listen addresses, got %v", addrs)
+	}
+
+	// The handshake fails on the first connection, and succeeds on the second one
+	attempts := newDialAttempts()
+	dialed := make(chan ma.Multiaddr, 2)
+	h.Network().Notify(&network.NotifyBundle{ConnectedF: func(_ network.Network, c network.Conn) {
+		dialed <- c.RemoteMultiaddr()
+		if len(h.Peerstore().Addrs(remote.ID())) != 1 {
+			t.Errorf("expected only the dialed address in the peerstore, got %v", h.Peerstore().Addrs(remote.ID()))
+		}
+
+		go func() {
+			if !attempts.handshakeStarted(remote.ID()) {
+				return
+			}
+			_ = c.Close()
+			attempts.finish(remote.ID(), ErrStatusFailed)
+		}()
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := connectAddrs(ctx, h, peer.AddrInfo{ID: remote.ID(), Addrs: addrs}, 2, attempts); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range addrs {
+		if got := <-dialed; !got.Equal(want) {
+			t.Fatalf("expected attempt %d on %s, got %s", i, want, got)
+		}
+	}
+	if h.Network().Connectedness(remote.ID()) != network.Connected {
+		t.Fatal("expected to stay connected after the second handshake")
+	}
+}
+
+func TestDialAttemptsWait(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	pid, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := newDialAttempts()
+	if attempts.handshakeStarted(pid) {
+		t.Fatal("expected no attempt before start")
+	}
+
+	// A connection that closed before a handshake started fails the attempt
+	attempts.start(pid)
+	if err := attempts.wait(context.Background(), h, pid); !errors.Is(err, errNoHandshake) {
+		t.Fatalf("expected errNoHandshake, got %v", err)
+	}
+
+	// Once the handshake started, its outcome is waited for
+	if !attempts.handshakeStarted(pid) {
+		t.Fatal("expected the attempt to be started")
+	}
+	go func() {
+		time.Sleep(3 * statusPollInterval)
+		attempts.finish(pid, ErrPingFailed)
+	}()
+	if err := attempts.wait(context.Background(), h, pid); !errors.Is(err, ErrPingFailed) {
+		t.Fatalf("expected the handshake error, got %v", err)
+	}
+
+	attempts.stop(pid)
+	if attempts.handshakeStarted(pid) {
+		t.Fatal("expected no attempt after stop")
+	}
+}
+
+func TestEnrAddr(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		entries []enr.Entry
+		want    string
+	}{
+		{name: "ipv4", entries: []enr.Entry{enr.IPv4(net.ParseIP("1.2.3.4")), enr.TCP(9000)}, want: "/ip4/1.2.3.4/tcp/9000"},
+		{name: "ipv4 over ipv6", entries: []enr.Entry{enr.IPv4(net.ParseIP("1.2.3.4")), enr.TCP(9000), enr.IPv6(net.ParseIP("2001:db8::1")), enr.TCP6(9001)}, want: "/ip4/1.2.3.4/tcp/9000"},
+		{name: "ipv6 with tcp6", entries: []enr.Entry{enr.IPv6(net.ParseIP("2001:db8::1")), enr.TCP6(9001)}, want: "/ip6/2001:db8::1/tcp/9001"},
+		{name: "ipv6 with tcp", entries: []enr.Entry{enr.IPv6(net.ParseIP("2001:db8::1")), enr.TCP(9000)}, want: "/ip6/2001:db8::1/tcp/9000"},
+		{name: "ipv4 without tcp", entries: []enr.Entry{enr.IPv4(net.ParseIP("1.2.3.4")), enr.IPv6(net.ParseIP("2001:db8::1")), enr.TCP6(9001)}, want: "/ip6/2001:db8::1/tcp/9001"},
+		{name: "no tcp port", entries: []enr.Entry{enr.IPv6(net.ParseIP("2001:db8::1"))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r enr.Record
+			for _, e := range tt.entries {
+				r.Set(e)
+			}
+			if err := enode.SignV4(&r, key); err != nil {
+				t.Fatal(err)
+			}
+
+			node, err := enode.New(enode.ValidSchemes, &r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := enrAddr(*node)
+			if tt.want == "" {
+				if got != nil {
+					t.Fatalf("expected no address, got %s", got)
+				}
+				return
+			}
+
+			if got == nil || got.String() != tt.want {
+				t.Fatalf("expected %s, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIPVersion(t *testing.T) {
+	for ip, want := range map[string]int{"1.2.3.4": 4, "2001:db8::1": 6, "::ffff:1.2.3.4": 4, "<nil>": 0, "": 0} {
+		if got := ipVersion(ip); got != want {
+			t.Errorf("ipVersion(%q): expected %d, got %d", ip, want, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package ethereum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prysmaticlabs/go-bitfield"
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+// diffAttnets returns the subnet indices that are set in `next` but not in `prev`, and
+// the ones that are set in `prev` but not in `next`.
+func diffAttnets(prev, next bitfield.Bitvector64) (added, removed []int64) {
+	for i := uint64(0); i < next.Len(); i++ {
+		was, is := prev.BitAt(i), next.BitAt(i)
+
+		if is && !was {
+			added = append(added, int64(i))
+		} else if was && !is {
+			removed = append(removed, int64(i))
+		}
+	}
+
+	return added, removed
+}
+
+// attnetsChangedEvent returns the event for a peer whose attnets changed between two
+// handshakes, or nil if there was no earlier handshake or the attnets are the same.
+func (n *Node) attnetsChangedEvent(pid peer.ID, prev, next *eth.MetaDataV1) *types.AttnetsChangedEvent {
+	if prev == nil || next == nil || bytes.Equal(prev.Attnets, next.Attnets) {
+		return nil
+	}
+
+	added, removed := diffAttnets(prev.Attnets, next.Attnets)
+
+	event := &types.AttnetsChangedEvent{
+		ID:             pid.String(),
+		OldSeqNumber:   int64(prev.SeqNumber),
+		NewSeqNumber:   int64(next.SeqNumber),
+		OldAttnets:     hex.EncodeToString(prev.Attnets),
+		NewAttnets:     hex.EncodeToString(next.Attnets),
+		AddedSubnets:   added,
+		RemovedSubnets: removed,
+		Timestamp:      time.Now().UnixMilli(),
+	}
+
+	if info := n.peerstore.Get(pid); info != nil {
+		event.ENR = info.enode.String()
+		if info.remoteAddr != nil {
+			event.Multiaddr = info.remoteAddr.String()
+		}
+	}
+
+	return event
+}
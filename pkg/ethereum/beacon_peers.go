@@ -0,0 +1,101 @@
+package ethereum
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// beaconPeers is the set of peers the beacon node at BeaconAPI is connected to, as of its
+// last successful poll.
+type beaconPeers struct {
+	mu  sync.RWMutex
+	ids map[string]struct{}
+}
+
+func newBeaconPeers() *beaconPeers {
+	return &beaconPeers{ids: make(map[string]struct{})}
+}
+
+// Contains reports whether the beacon node was connected to the peer on the last poll.
+func (b *beaconPeers) Contains(id string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.ids[id]
+	return ok
+}
+
+func (b *beaconPeers) set(ids map[string]struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ids = ids
+}
+
+// runBeaconPeersPoller polls the peers of the beacon node every BeaconPeersInterval, until
+// the context is cancelled.
+func (n *Node) runBeaconPeersPoller(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.BeaconPeersInterval)
+	defer ticker.Stop()
+
+	for {
+		n.pollBeaconPeers(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollBeaconPeers replaces the beacon node peers with the ones it's connected to now. When
+// the beacon API is unavailable, the peers of the last successful poll are kept.
+func (n *Node) pollBeaconPeers(ctx context.Context) {
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	ids, err := fetchBeaconPeers(reqCtx, n.cfg.BeaconAPI)
+	if err != nil {
+		if ctx.Err() == nil {
+			n.dialAddrLog.Warn().Err(err).Str("beacon_api", n.cfg.BeaconAPI).Msg("Failed to fetch the peers of the beacon node")
+		}
+		return
+	}
+
+	n.beaconPeers.set(ids)
+
+	// The beacon node peers the sentry found too, a measure of the discovery coverage
+	known := 0
+	for id := range ids {
+		if pid, err := peer.Decode(id); err == nil && n.peerstore.Get(pid) != nil {
+			known++
+		}
+	}
+
+	beaconPeersGauge.Set(float64(len(ids)))
+	beaconPeersKnown.Set(float64(known))
+	n.log.Debug().Int("peers", len(ids)).Int("known", known).Msg("Polled the peers of the beacon node")
+}
+
+// fetchBeaconPeers returns the IDs of the peers the beacon node at baseURL is connected to.
+func fetchBeaconPeers(ctx context.Context, baseURL string) (map[string]struct{}, error) {
+	var peers struct {
+		Data []struct {
+			PeerID string `json:"peer_id"`
+		} `json:"data"`
+	}
+	if err := getBeaconAPI(ctx, baseURL, "/eth/v1/node/peers?state=connected", &peers); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]struct{}, len(peers.Data))
+	for _, p := range peers.Data {
+		ids[p.PeerID] = struct{}{}
+	}
+
+	return ids, nil
+}
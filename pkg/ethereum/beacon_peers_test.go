@@ -0,0 +1,36 @@
+package ethereum
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchBeaconPeers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eth/v1/node/peers" || r.URL.Query().Get("state") != "connected" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`{"data":[{"peer_id":"16Uiu2HAmA","state":"connected"},{"peer_id":"16Uiu2HAmB","state":"connected"}],"meta":{"count":2}}`))
+	}))
+	defer srv.Close()
+
+	ids, err := fetchBeaconPeers(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers := newBeaconPeers()
+	peers.set(ids)
+	if !peers.Contains("16Uiu2HAmA") || !peers.Contains("16Uiu2HAmB") || peers.Contains("16Uiu2HAmC") {
+		t.Errorf("unexpected beacon node peers %v", ids)
+	}
+
+	srv.Close()
+	if _, err := fetchBeaconPeers(context.Background(), srv.URL); err == nil {
+		t.Fatal("expected an error with the beacon API down")
+	}
+}
@@ -0,0 +1,83 @@
+package ethereum
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// peerFilter is a bloom filter of the peers we handshaked with during this run. It uses a
+// fixed amount of memory regardless of the number of peers, at the cost of false positives
+// (peers it wrongly reports as handshaked, which then aren't dialed).
+type peerFilter struct {
+	mu sync.RWMutex
+
+	bits []uint64
+	// m is the number of bits and k the number of hash functions
+	m, k uint64
+	// seeds of the two hashes that the k hashes are derived from
+	seed1, seed2 maphash.Seed
+}
+
+// newPeerFilter returns a filter sized for `expected` peers with the given false positive
+// rate at that size.
+func newPeerFilter(expected int, fpRate float64) *peerFilter {
+	n := float64(max(expected, 1))
+
+	m := math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/n*math.Ln2))
+
+	words := (uint64(m) + 63) / 64
+
+	return &peerFilter{
+		bits:  make([]uint64, words),
+		m:     words * 64,
+		k:     uint64(k),
+		seed1: maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+	}
+}
+
+// indexes returns the bit indexes of a peer, using double hashing.
+func (f *peerFilter) indexes(id peer.ID) []uint64 {
+	h1 := maphash.String(f.seed1, string(id))
+	h2 := maphash.String(f.seed2, string(id)) | 1
+
+	idx := make([]uint64, f.k)
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) % f.m
+	}
+
+	return idx
+}
+
+// Add records a peer as handshaked.
+func (f *peerFilter) Add(id peer.ID) {
+	idx := f.indexes(id)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, i := range idx {
+		f.bits[i/64] |= 1 << (i % 64)
+	}
+}
+
+// Contains reports whether the peer was (probably) handshaked. It never returns false for
+// a peer that was added.
+func (f *peerFilter) Contains(id peer.ID) bool {
+	idx := f.indexes(id)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, i := range idx {
+		if f.bits[i/64]&(1<<(i%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
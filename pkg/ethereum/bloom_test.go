@@ -0,0 +1,40 @@
+package ethereum
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerFilter(t *testing.T) {
+	const (
+		expected = 10_000
+		fpRate   = 0.01
+	)
+
+	f := newPeerFilter(expected, fpRate)
+
+	for i := 0; i < expected; i++ {
+		f.Add(peer.ID(fmt.Sprintf("added-%d", i)))
+	}
+
+	// No false negatives
+	for i := 0; i < expected; i++ {
+		if id := peer.ID(fmt.Sprintf("added-%d", i)); !f.Contains(id) {
+			t.Fatalf("expected added peer %s to be contained", id)
+		}
+	}
+
+	// False positives stay around the configured rate at the expected size
+	var falsePositives int
+	for i := 0; i < expected; i++ {
+		if f.Contains(peer.ID(fmt.Sprintf("other-%d", i))) {
+			falsePositives++
+		}
+	}
+
+	if rate := float64(falsePositives) / expected; rate > 2*fpRate {
+		t.Errorf("false positive rate %.4f is more than twice the configured %.2f", rate, fpRate)
+	}
+}
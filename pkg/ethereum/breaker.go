@@ -0,0 +1,118 @@
+package ethereum
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrCircuitOpen is returned for the events that aren't published because the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("nats circuit breaker open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops publishing to NATS after `threshold` consecutive failures, so
+// publishes fail right away instead of waiting for their timeout while NATS is down. Once
+// `cooldown` passed, a single publish is let through to test the recovery: the breaker
+// closes if it succeeds, and opens again otherwise. A threshold of 0 disables it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+
+	now func() time.Time
+	log zerolog.Logger
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, log zerolog.Logger) *circuitBreaker {
+	if threshold > 0 {
+		// The node and discovery have a breaker each, so the gauge counts them by state
+		natsBreakers.WithLabelValues(breakerClosed.String()).Inc()
+	}
+
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now, log: log}
+}
+
+// allow reports whether an event can be published. In the half-open state, only the
+// publish testing the recovery is allowed until its result is recorded.
+func (c *circuitBreaker) allow() bool {
+	if c.threshold == 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case breakerOpen:
+		if c.now().Sub(c.openedAt) < c.cooldown {
+			return false
+		}
+
+		c.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the result of an allowed publish.
+func (c *circuitBreaker) record(err error) {
+	if c.threshold == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		c.failures = 0
+		if c.state != breakerClosed {
+			c.setState(breakerClosed)
+			c.log.Info().Msg("NATS publish succeeded, closing the circuit breaker")
+		}
+		return
+	}
+
+	c.failures++
+	if c.state == breakerHalfOpen || c.failures >= c.threshold {
+		if c.state == breakerClosed {
+			c.log.Warn().Err(err).Int("failures", c.failures).Dur("cooldown", c.cooldown).Msg("Too many NATS publish failures, opening the circuit breaker")
+		}
+
+		c.openedAt = c.now()
+		c.setState(breakerOpen)
+	}
+}
+
+// setState moves the breaker to `state`. The caller holds the lock.
+func (c *circuitBreaker) setState(state breakerState) {
+	natsBreakers.WithLabelValues(c.state.String()).Dec()
+	natsBreakers.WithLabelValues(state.String()).Inc()
+	c.state = state
+}
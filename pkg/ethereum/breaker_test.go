@@ -0,0 +1,56 @@
+package ethereum
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newCircuitBreaker(3, time.Minute, zerolog.Nop())
+	c.now = func() time.Time { return now }
+
+	failure := errors.New("nats: timeout")
+
+	// A success resets the consecutive failures
+	c.record(failure)
+	c.record(failure)
+	c.record(nil)
+	c.record(failure)
+	c.record(failure)
+	if !c.allow() {
+		t.Fatal("opened before the threshold")
+	}
+
+	c.record(failure)
+	if c.allow() {
+		t.Fatal("didn't open at the threshold")
+	}
+
+	// After the cooldown, a single publish tests the recovery
+	now = now.Add(time.Minute)
+	if !c.allow() {
+		t.Fatal("didn't half-open after the cooldown")
+	}
+	if c.allow() {
+		t.Fatal("allowed a second publish while half-open")
+	}
+
+	c.record(failure)
+	if c.allow() {
+		t.Fatal("didn't open again after the failed test publish")
+	}
+
+	now = now.Add(time.Minute)
+	if !c.allow() {
+		t.Fatal("didn't half-open after the cooldown")
+	}
+
+	c.record(nil)
+	if c.state != breakerClosed || !c.allow() {
+		t.Fatal("didn't close after the successful test publish")
+	}
+}
@@ -0,0 +1,127 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// clockSyncInterval is how often the local clock is compared with the NTP server.
+	clockSyncInterval = 10 * time.Minute
+	// ntpTimeout is the timeout of a single NTP query.
+	ntpTimeout = 5 * time.Second
+	// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and the Unix epoch.
+	ntpEpochOffset = 2208988800
+)
+
+// The measured offset of the local clock, i.e. what to add to a local timestamp to get the
+// NTP server's time. Events record it next to their (local) timestamp, so the consumer can
+// correct for clock skew between sentries. It's only valid while clockSynced is set.
+var (
+	clockOffset atomic.Int64
+	clockSynced atomic.Bool
+)
+
+// getClockOffset returns the last measured clock offset in milliseconds, and whether the
+// last sync succeeded. Without a successful sync the offset is 0.
+func getClockOffset() (int64, bool) {
+	if !clockSynced.Load() {
+		return 0, false
+	}
+
+	return time.Duration(clockOffset.Load()).Milliseconds(), true
+}
+
+// runClockSync measures the clock offset against the NTP server every clockSyncInterval,
+// until the context is cancelled. If a sync fails, events fall back to uncorrected time
+// (an unsynced offset of 0) until the next one succeeds.
+func runClockSync(ctx context.Context, server string, log zerolog.Logger) {
+	ticker := time.NewTicker(clockSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		offset, err := queryNTPOffset(server)
+		if err != nil {
+			clockSynced.Store(false)
+			clockOffsetGauge.Set(0)
+			log.Warn().Err(err).Str("server", server).Msg("Clock sync failed, events use uncorrected time")
+		} else {
+			clockOffset.Store(int64(offset))
+			clockSynced.Store(true)
+			clockOffsetGauge.Set(offset.Seconds())
+			log.Debug().Str("server", server).Dur("offset", offset).Msg("Synced clock")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queryNTPOffset sends a single SNTP (RFC 4330) request to the server and returns the
+// offset of the local clock.
+func queryNTPOffset(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to dial NTP server: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(ntpTimeout)); err != nil {
+		return 0, err
+	}
+
+	// LI = 0, version = 4, mode = 3 (client)
+	req := make([]byte, 48)
+	req[0] = 0x23
+
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, fmt.Errorf("failed to send NTP request: %w", err)
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read NTP response: %w", err)
+	}
+	received := time.Now()
+
+	if n < 48 {
+		return 0, fmt.Errorf("short NTP response (%d bytes)", n)
+	}
+
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+
+	// Stratum 0 is a "kiss-o'-death" response, e.g. when we're rate limited
+	if stratum := resp[1]; stratum == 0 || stratum > 15 {
+		return 0, fmt.Errorf("invalid NTP stratum %d", stratum)
+	}
+
+	serverReceived := ntpTime(resp[32:40])
+	serverSent := ntpTime(resp[40:48])
+
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime converts a 64-bit NTP timestamp (seconds and fraction since 1900).
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:8]))
+
+	return time.Unix(secs, (frac*int64(time.Second))>>32)
+}
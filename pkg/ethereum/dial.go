@@ -0,0 +1,188 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// dialAddrs returns up to `limit` addresses to dial a peer on, normalized and without
+// duplicates, in the order of selectDialAddr: public, non-relay addresses first, then
+// private ones that aren't loopbacks, then the rest. A limit of 0 returns all of them.
+func dialAddrs(addrs []ma.Multiaddr, limit int) []ma.Multiaddr {
+	var public, private, rest []ma.Multiaddr
+
+	for _, addr := range peerAddrs(nil, addrs) {
+		switch {
+		case manet.IsPublicAddr(addr) && !isRelayAddr(addr):
+			public = append(public, addr)
+		case !manet.IsIPLoopback(addr) && !isRelayAddr(addr):
+			private = append(private, addr)
+		default:
+			rest = append(rest, addr)
+		}
+	}
+
+	ordered := append(append(public, private...), rest...)
+	if limit > 0 && len(ordered) > limit {
+		ordered = ordered[:limit]
+	}
+
+	return ordered
+}
+
+// connectAddrs connects to a peer on up to `perPeer` of its addresses (see dialAddrs), one
+// at a time until a handshake succeeds, and returns the error of the last dial if none
+// connected. All attempts share the deadline of ctx, each gets an equal share of the time
+// that's left. Before each dial, the addresses libp2p knows of for the peer are cleared,
+// or it would dial all of them again. The outcome of the handshake on the last address
+// isn't waited for, the handshake backs the peer off itself if it fails.
+func connectAddrs(ctx context.Context, h host.Host, info peer.AddrInfo, perPeer int, attempts *dialAttempts) error {
+	addrs := dialAddrs(info.Addrs, perPeer)
+	if len(addrs) == 0 || h.Network().Connectedness(info.ID) == network.Connected {
+		// Dial the addresses libp2p already knows of
+		return h.Connect(ctx, info)
+	}
+
+	var err error
+	for i, addr := range addrs {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(addrs)-i))
+		}
+
+		last := i == len(addrs)-1
+		if !last {
+			attempts.start(info.ID)
+		}
+
+		h.Peerstore().ClearAddrs(info.ID)
+		err = h.Connect(attemptCtx, peer.AddrInfo{ID: info.ID, Addrs: []ma.Multiaddr{addr}})
+		if err == nil && !last {
+			err = attempts.wait(attemptCtx, h, info.ID)
+		}
+		attempts.stop(info.ID)
+		cancel()
+
+		if err == nil {
+			if i > 0 {
+				dialAddrFallbacks.Inc()
+			}
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return err
+}
+
+// errNoHandshake is the outcome of a dial whose connection closed without an outbound
+// handshake, e.g. because it was over the peer limit.
+var errNoHandshake = errors.New("connection closed before the handshake")
+
+// dialAttempts hands the outcome of the outbound handshake on a dialed address back to
+// connectAddrs, so it can dial the peer's next address if the handshake failed.
+type dialAttempts struct {
+	mu       sync.Mutex
+	attempts map[peer.ID]*dialAttempt
+}
+
+type dialAttempt struct {
+	// started is set once the outbound handshake started on the connection
+	started bool
+	outcome chan error
+}
+
+func newDialAttempts() *dialAttempts {
+	return &dialAttempts{attempts: make(map[peer.ID]*dialAttempt)}
+}
+
+// start registers an attempt on one of the peer's addresses that isn't its last.
+func (d *dialAttempts) start(pid peer.ID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.attempts[pid] = &dialAttempt{outcome: make(chan error, 1)}
+}
+
+// stop removes the attempt on the peer, if any.
+func (d *dialAttempts) stop(pid peer.ID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.attempts, pid)
+}
+
+// handshakeStarted marks the attempt on the peer as handshaking, and reports whether
+// there is one, in which case a failed handshake is retried on the peer's next address.
+func (d *dialAttempts) handshakeStarted(pid peer.ID) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	a, ok := d.attempts[pid]
+	if ok {
+		a.started = true
+	}
+
+	return ok
+}
+
+// finish sends the outcome of the handshake to the attempt on the peer, if any. It's
+// called once the connection of a failed handshake is closed, so the next address can be
+// dialed right away.
+func (d *dialAttempts) finish(pid peer.ID, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if a, ok := d.attempts[pid]; ok {
+		select {
+		case a.outcome <- err:
+		default:
+		}
+	}
+}
+
+// wait returns the outcome of the handshake on the connection to the peer. If the
+// connection closes before a handshake started, it returns errNoHandshake, and if ctx
+// expires while the peer is still connected, nil.
+func (d *dialAttempts) wait(ctx context.Context, h host.Host, pid peer.ID) error {
+	d.mu.Lock()
+	a, ok := d.attempts[pid]
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-a.outcome:
+			return err
+		case <-ctx.Done():
+			if h.Network().Connectedness(pid) == network.Connected {
+				return nil
+			}
+			return ctx.Err()
+		case <-ticker.C:
+			d.mu.Lock()
+			started := a.started
+			d.mu.Unlock()
+
+			if !started && h.Network().Connectedness(pid) != network.Connected {
+				return errNoHandshake
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ethereum
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DialPrioritizer scores a discovered peer. Peers with a higher score are dialed first,
+// peers with the same score are dialed in discovery order.
+type DialPrioritizer func(info *HostInfo) int
+
+// DialStrategies are the available dial prioritization strategies, by name.
+var DialStrategies = map[string]DialPrioritizer{
+	// fifo dials peers in the order they were discovered.
+	"fifo": func(*HostInfo) int { return 0 },
+	// attnets dials peers that advertise more attestation subnets in their ENR first.
+	"attnets": attnetsPriority,
+}
+
+// NewDialPrioritizer returns the dial prioritization strategy with the given name.
+func NewDialPrioritizer(name string) (DialPrioritizer, error) {
+	p, ok := DialStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown dial strategy: %s", name)
+	}
+
+	return p, nil
+}
+
+func attnetsPriority(info *HostInfo) int {
+	info.RLock()
+	defer info.RUnlock()
+
+	if n, ok := info.Attr[EnrAttnetsNumAttribute].(int); ok {
+		return n
+	}
+
+	return -1
+}
+
+type dialItem struct {
+	info     peer.AddrInfo
+	priority int
+	seq      uint64
+}
+
+type dialHeap []dialItem
+
+func (h dialHeap) Len() int { return len(h) }
+func (h dialHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h dialHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *dialHeap) Push(x interface{}) { *h = append(*h, x.(dialItem)) }
+func (h *dialHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// dialQueue is a bounded priority queue of peers waiting to be dialed.
+type dialQueue struct {
+	mu      sync.Mutex
+	items   dialHeap
+	seq     uint64
+	maxSize int
+	notify  chan struct{}
+}
+
+func newDialQueue(maxSize int) *dialQueue {
+	return &dialQueue{
+		maxSize: maxSize,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// Push adds a peer to the queue. It returns false if the queue is full.
+func (q *dialQueue) Push(info peer.AddrInfo, priority int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.maxSize {
+		return false
+	}
+
+	q.seq++
+	heap.Push(&q.items, dialItem{info: info, priority: priority, seq: q.seq})
+	dialQueueLength.Set(float64(len(q.items)))
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Pop blocks until a peer is available or the context is cancelled, and returns the
+// highest priority peer.
+func (q *dialQueue) Pop(ctx context.Context) (peer.AddrInfo, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := heap.Pop(&q.items).(dialItem)
+			dialQueueLength.Set(float64(len(q.items)))
+			q.mu.Unlock()
+
+			return item.info, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return peer.AddrInfo{}, false
+		case <-q.notify:
+		}
+	}
+}
+
+func (q *dialQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
@@ -0,0 +1,153 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// discTableBuckets is the number of buckets of the discv5 routing table.
+	discTableBuckets = 17
+	// discTableMinDistance is the log distance of the closest bucket, which also holds
+	// the closer nodes.
+	discTableMinDistance = 256 - discTableBuckets
+)
+
+// DiscTableSnapshot is the content of the sentry's discv5 routing table at a point in time.
+type DiscTableSnapshot struct {
+	Timestamp int64  `json:"timestamp"`
+	NodeID    string `json:"node_id"`
+	Size      int    `json:"size"`
+	// Buckets holds the occupancy of every bucket, including the empty ones
+	Buckets []DiscTableBucket `json:"buckets"`
+	Nodes   []DiscTableNode   `json:"nodes"`
+}
+
+// DiscTableBucket is the occupancy of a bucket of the routing table. The closest bucket
+// holds the nodes up to its distance, the others the nodes at their distance.
+type DiscTableBucket struct {
+	Index    int `json:"index"`
+	Distance int `json:"distance"`
+	Size     int `json:"size"`
+}
+
+// DiscTableNode is a node in the routing table.
+type DiscTableNode struct {
+	ENR      string `json:"enr"`
+	NodeID   string `json:"node_id"`
+	PeerID   string `json:"peer_id,omitempty"`
+	Bucket   int    `json:"bucket"`
+	Distance int    `json:"distance"`
+}
+
+// discTableBucket returns the bucket a node at the log distance `dist` is in.
+func discTableBucket(dist int) int {
+	if dist <= discTableMinDistance+1 {
+		return 0
+	}
+
+	return dist - discTableMinDistance - 1
+}
+
+// newDiscTableSnapshot sorts the nodes of the table of `self` into its buckets.
+func newDiscTableSnapshot(self enode.ID, nodes []*enode.Node, now time.Time) DiscTableSnapshot {
+	snapshot := DiscTableSnapshot{
+		Timestamp: now.UnixMilli(),
+		NodeID:    self.String(),
+		Size:      len(nodes),
+		Buckets:   make([]DiscTableBucket, discTableBuckets),
+		Nodes:     make([]DiscTableNode, 0, len(nodes)),
+	}
+
+	for i := range snapshot.Buckets {
+		snapshot.Buckets[i] = DiscTableBucket{Index: i, Distance: discTableMinDistance + 1 + i}
+	}
+
+	for _, node := range nodes {
+		dist := enode.LogDist(self, node.ID())
+		bucket := discTableBucket(dist)
+		snapshot.Buckets[bucket].Size++
+
+		entry := DiscTableNode{
+			ENR:      node.String(),
+			NodeID:   node.ID().String(),
+			Bucket:   bucket,
+			Distance: dist,
+		}
+		if pubkey, err := ConvertECDSAPubkeyToSecp2561k(node.Pubkey()); err == nil {
+			if pid, err := peer.IDFromPublicKey(pubkey); err == nil {
+				entry.PeerID = pid.String()
+			}
+		}
+
+		snapshot.Nodes = append(snapshot.Nodes, entry)
+	}
+
+	return snapshot
+}
+
+// DiscTable returns a snapshot of the discv5 routing table, or false without the discv5 walk.
+func (n *Node) DiscTable() (DiscTableSnapshot, bool) {
+	if n.disc == nil {
+		return DiscTableSnapshot{}, false
+	}
+
+	listener := n.disc.Dv5Listener
+	return newDiscTableSnapshot(listener.Self().ID(), listener.AllNodes(), time.Now()), true
+}
+
+// DiscTableHandler serves a snapshot of the discv5 routing table as JSON.
+func (n *Node) DiscTableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshot, ok := n.DiscTable()
+	if !ok {
+		http.Error(w, "discv5 is not running", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+	}
+}
+
+// runDiscTableSnapshots appends a snapshot of the routing table to DiscTablePath every
+// DiscTableInterval, as a line of JSON, until the context is cancelled.
+func (n *Node) runDiscTableSnapshots(ctx context.Context) {
+	file, err := os.Create(n.cfg.DiscTablePath)
+	if err != nil {
+		n.log.Error().Err(err).Str("path", n.cfg.DiscTablePath).Msg("Failed to create the routing table snapshot file")
+		return
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+
+	ticker := time.NewTicker(n.cfg.DiscTableInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snapshot, _ := n.DiscTable()
+			if err := enc.Encode(snapshot); err != nil {
+				n.log.Error().Err(err).Msg("Failed to write routing table snapshot")
+				continue
+			}
+
+			n.log.Debug().Int("size", snapshot.Size).Msg("Wrote routing table snapshot")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ethereum
+
+import (
+	"testing"
+	"time"
+
+	gcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+func TestDiscTableBucket(t *testing.T) {
+	for dist, want := range map[int]int{0: 0, 239: 0, 240: 0, 241: 1, 255: 15, 256: 16} {
+		if got := discTableBucket(dist); got != want {
+			t.Errorf("distance %d: expected bucket %d, got %d", dist, want, got)
+		}
+	}
+}
+
+func TestNewDiscTableSnapshot(t *testing.T) {
+	key, err := gcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r enr.Record
+	if err := enode.SignV4(&r, key); err != nil {
+		t.Fatal(err)
+	}
+	node, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var self enode.ID
+	snapshot := newDiscTableSnapshot(self, []*enode.Node{node}, time.Now())
+
+	if snapshot.Size != 1 || len(snapshot.Buckets) != discTableBuckets || len(snapshot.Nodes) != 1 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	entry := snapshot.Nodes[0]
+	if entry.Distance != enode.LogDist(self, node.ID()) || snapshot.Buckets[entry.Bucket].Size != 1 {
+		t.Fatalf("node not in its bucket: %+v", snapshot)
+	}
+	if entry.PeerID == "" {
+		t.Fatal("expected a peer ID")
+	}
+}
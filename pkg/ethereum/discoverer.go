@@ -0,0 +1,33 @@
+package ethereum
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Discoverer finds the peers the node dials. The node handshakes with every peer it
+// receives on Peers, so any libp2p network with the same req/resp protocols can be
+// crawled by plugging in its discovery mechanism. DiscoveryV5 is the default.
+type Discoverer interface {
+	// Peers returns the channel found peers are sent on. It is closed when discovery stops.
+	Peers() <-chan peer.AddrInfo
+	// Start runs discovery until the context is cancelled or Stop is called.
+	Start(ctx context.Context) error
+	// Stop stops a running discovery.
+	Stop()
+}
+
+// ENRResolver is implemented by discoverers that know the ENRs of the peers they find,
+// so they can be included in the metadata events.
+type ENRResolver interface {
+	ENR(id peer.ID) (enode.Node, bool)
+}
+
+var (
+	_ Discoverer  = (*DiscoveryV5)(nil)
+	_ ENRResolver = (*DiscoveryV5)(nil)
+	_ Discoverer  = (*StaticDiscoverer)(nil)
+	_ ENRResolver = (*StaticDiscoverer)(nil)
+)
@@ -0,0 +1,67 @@
+package ethereum
+
+import (
+	"context"
+	"time"
+)
+
+// maxWatchdogInterval is how often the watchdog checks the walk at most.
+const maxWatchdogInterval = time.Minute
+
+// watchdog restarts the discv5 walk whenever it found no new peer within the watchdog
+// window, e.g. because the routing table went stale or the network interface flapped.
+func (d *DiscoveryV5) watchdog(ctx context.Context) {
+	ticker := time.NewTicker(min(d.watchdogWindow, maxWatchdogInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		idle := time.Since(time.Unix(0, d.lastNewPeer.Load()))
+		if idle < d.watchdogWindow {
+			continue
+		}
+
+		d.log.Warn().Dur("idle", idle).Dur("window", d.watchdogWindow).Msg("No new peers discovered, restarting discv5 walk")
+		d.restartWalk(ctx)
+	}
+}
+
+// restartWalk pings the bootnodes, which re-establishes their sessions after a network
+// interruption, and replaces the walk's iterator with a new one, starting fresh lookups.
+func (d *DiscoveryV5) restartWalk(ctx context.Context) {
+	var alive int
+	for _, node := range d.bootnodes {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := d.Dv5Listener.Ping(node); err != nil {
+			d.log.Debug().Err(err).Str("bootnode", node.ID().TerminalString()).Msg("Bootnode didn't answer ping")
+			continue
+		}
+		alive++
+	}
+
+	d.log.Info().Int("alive", alive).Int("bootnodes", len(d.bootnodes)).Msg("Pinged bootnodes")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Closing the old iterator ends the current walk, which then picks up the new one
+	old := d.iter
+	d.iter = d.Dv5Listener.RandomNodes()
+	old.Close()
+
+	// Give the new walk a full window
+	d.lastNewPeer.Store(time.Now().UnixNano())
+	discoveryRestarts.Inc()
+}
@@ -5,9 +5,13 @@ import (
 	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/chainbound/valtrack/config"
 	"github.com/chainbound/valtrack/log"
@@ -40,25 +44,64 @@ type HostInfo struct {
 type NodeInfo struct {
 	Node enode.Node
 	Flag bool
+	// Reported is when the last peer_discovered event for this node was sent
+	Reported time.Time
 }
 
 type DiscoveryV5 struct {
 	Dv5Listener   *discover.UDPv5
-	FilterDigest  string
+	FilterDigests []string
 	log           zerolog.Logger
 	seenNodes     map[peer.ID]NodeInfo
-	fileLogger    *os.File
+	fileLogger    zerolog.Logger
+	fileLogCloser io.Closer
 	out           chan peer.AddrInfo
+	queue         *dialQueue
+	prioritizer   DialPrioritizer
+	nodes         chan *enode.Node
+	discovered    atomic.Uint64
+	dedupWindow   time.Duration
+	natsCfg       config.NatsConfig
+	cancel        context.CancelFunc
+	mu            sync.Mutex
+	// iter is the iterator of the current walk, replaced when the watchdog restarts it
+	iter           enode.Iterator
+	bootnodes      []*enode.Node
+	watchdogWindow time.Duration
+	// lastNewPeer is the Unix time in nanoseconds the walk last found a new peer
+	lastNewPeer   atomic.Int64
 	js            jetstream.JetStream
+	publishBuf    *publishBuffer
 	discEventChan chan *types.PeerDiscoveredEvent
+	redaction     config.RedactionConfig
+	// beaconPeers is set by the node with BeaconAPI and BeaconPeersInterval
+	beaconPeers *beaconPeers
 }
 
 func NewDiscoveryV5(pk *ecdsa.PrivateKey, discConfig *config.DiscConfig) (*DiscoveryV5, error) {
-	js, err := createNatsStream(discConfig.NatsURL)
+	js, publishBuf, err := createNatsStream(discConfig.NatsURL, &discConfig.Nats)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create NATS JetStream")
 	}
 
+	var (
+		fileLogger    zerolog.Logger
+		fileLogCloser io.Closer
+	)
+	if discConfig.EventWriter != nil {
+		fileLogger, fileLogCloser = log.NewWriterLogger(discConfig.EventWriter)
+	} else {
+		fileLogger, fileLogCloser, err = log.NewFileLogger(discConfig.LogPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to create log file")
+		}
+	}
+
+	prioritizer, err := NewDialPrioritizer(discConfig.DialStrategy)
+	if err != nil {
+		return nil, err
+	}
+
 	// New geth logger at debug level
 	gethlog := glog.New()
 	log := log.NewLogger("discv5")
@@ -79,7 +122,15 @@ func NewDiscoveryV5(pk *ecdsa.PrivateKey, discConfig *config.DiscConfig) (*Disco
 	tcpEntry := enr.TCP(discConfig.TCP)
 	ethNode.Set(tcpEntry)
 
-	ethNode.Set(attnetsEntry())
+	if discConfig.Attnets != nil {
+		ethNode.Set(enr.WithEntry("attnets", discConfig.Attnets))
+	} else {
+		ethNode.Set(attnetsEntry())
+	}
+
+	if discConfig.Syncnets != nil {
+		ethNode.Set(enr.WithEntry("syncnets", discConfig.Syncnets))
+	}
 
 	eth2, err := discConfig.Eth2EnrEntry()
 	if err != nil {
@@ -124,76 +175,225 @@ func NewDiscoveryV5(pk *ecdsa.PrivateKey, discConfig *config.DiscConfig) (*Disco
 	}
 	log.Info().Str("udp_addr", udpAddr.String()).Msg("Listening on UDP")
 
-	file, err := os.Create(discConfig.LogPath)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create log file")
-	}
-
 	return &DiscoveryV5{
 		Dv5Listener:   listener,
-		FilterDigest:  "0x" + hex.EncodeToString(discConfig.ForkDigest[:]),
+		FilterDigests: forkDigestStrings(append([][4]byte{discConfig.ForkDigest}, discConfig.AcceptedForkDigests...)),
 		log:           log,
 		seenNodes:     make(map[peer.ID]NodeInfo),
-		fileLogger:    file,
-		out:           make(chan peer.AddrInfo, 1024),
+		fileLogger:    fileLogger,
+		fileLogCloser: fileLogCloser,
+		out:           make(chan peer.AddrInfo),
+		queue:         newDialQueue(1024),
+		prioritizer:   prioritizer,
+		nodes:         make(chan *enode.Node, 1024),
+		dedupWindow:   discConfig.DiscoveryDedupWindow,
+		bootnodes:     discConfig.Bootnodes,
+		natsCfg:       discConfig.Nats,
 		js:            js,
+		publishBuf:    publishBuf,
 		discEventChan: make(chan *types.PeerDiscoveredEvent, 1024),
+		redaction:     discConfig.Redaction,
+
+		watchdogWindow: discConfig.WatchdogWindow,
 	}, nil
 }
 
+func (d *DiscoveryV5) Peers() <-chan peer.AddrInfo {
+	return d.out
+}
+
+// Start runs the discv5 walk until the context is cancelled or Stop is called.
+func (d *DiscoveryV5) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d.mu.Lock()
+	d.cancel = cancel
+	d.mu.Unlock()
+
+	return d.Serve(ctx)
+}
+
+func (d *DiscoveryV5) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// ENR returns the last ENR seen for a peer.
+func (d *DiscoveryV5) ENR(id peer.ID) (enode.Node, bool) {
+	info, ok := d.seenNodes[id]
+	return info.Node, ok
+}
+
 func (d *DiscoveryV5) Serve(ctx context.Context) error {
 	d.log.Info().Msg("Starting discv5 listener")
 
 	// Start iterating over randomly discovered nodes
-	iter := d.Dv5Listener.RandomNodes()
+	d.mu.Lock()
+	d.iter = d.Dv5Listener.RandomNodes()
+	d.mu.Unlock()
 
 	if d.js != nil {
-		d.startDiscoveryPublisher()
+		startPublisher(d.discEventChan, types.SubjectPeerDiscovered, d.publishBuf, d.log)
 	}
 
-	defer iter.Close()
-	defer close(d.out)
-
+	// Feed the peer dialers from the dial queue, highest priority first
 	go func() {
-		defer d.fileLogger.Close()
+		defer close(d.out)
+
+		for {
+			info, ok := d.queue.Pop(ctx)
+			if !ok {
+				return
+			}
 
-		for iter.Next() {
 			select {
+			case d.out <- info:
 			case <-ctx.Done():
-				d.log.Info().Msg("Stopping discv5 listener")
 				return
+			}
+		}
+	}()
+
+	d.lastNewPeer.Store(time.Now().UnixNano())
+	if d.watchdogWindow > 0 {
+		go d.watchdog(ctx)
+	}
+
+	walkDone := make(chan struct{})
+	go func() {
+		defer close(walkDone)
+		defer d.fileLogCloser.Close()
+
+		// Walk until the context is cancelled, with a new iterator whenever the watchdog
+		// restarts the walk
+		for {
+			d.mu.Lock()
+			iter := d.iter
+			d.mu.Unlock()
+
+			d.walk(ctx, iter)
+
+			d.mu.Lock()
+			restarted := d.iter != iter
+			d.mu.Unlock()
+
+			if ctx.Err() != nil || !restarted {
+				return
+			}
+		}
+	}()
+
+	<-ctx.Done()
+
+	// Unblock the walk and wait for it to close the event log
+	d.mu.Lock()
+	d.iter.Close()
+	d.mu.Unlock()
+	<-walkDone
+
+	if d.publishBuf != nil {
+		d.publishBuf.close()
+	}
+
+	return ctx.Err()
+}
+
+// walk handles the nodes of a discv5 walk until the iterator is closed or the context is
+// cancelled.
+func (d *DiscoveryV5) walk(ctx context.Context, iter enode.Iterator) {
+	for iter.Next() {
+		select {
+		case <-ctx.Done():
+			d.log.Info().Msg("Stopping discv5 listener")
+			return
+		default:
+			if !iter.Next() {
+				return
+			}
+			node := iter.Node()
+
+			// Other nodes can return our own ENR, which is at distance 0 and not a peer
+			if node.ID() == d.Dv5Listener.Self().ID() {
+				continue
+			}
+
+			select {
+			case d.nodes <- node:
 			default:
-				if !iter.Next() {
-					return
+			}
+
+			hInfo, err := d.handleENR(node)
+			if err != nil {
+				d.log.Error().Err(err).Msg("Error handling new ENR")
+				continue
+			}
+
+			if hInfo == nil {
+				continue
+			}
+
+			prev := d.seenNodes[hInfo.ID]
+			if !prev.Flag {
+				info := peer.AddrInfo{
+					ID:    hInfo.ID,
+					Addrs: hInfo.MAddrs,
 				}
-				node := iter.Node()
-				hInfo, err := d.handleENR(node)
-				if err != nil {
-					d.log.Error().Err(err).Msg("Error handling new ENR")
-					continue
+
+				if !d.queue.Push(info, d.prioritizer(hInfo)) {
+					d.log.Debug().Msg("Dial queue is full")
 				}
 
-				if hInfo != nil && !d.seenNodes[hInfo.ID].Flag {
-					select {
-					case d.out <- peer.AddrInfo{
-						ID:    hInfo.ID,
-						Addrs: hInfo.MAddrs,
-					}:
-					default:
-						d.log.Debug().Msg("Disc out channel is full")
-					}
+				d.discovered.Add(1)
+				d.lastNewPeer.Store(time.Now().UnixNano())
+				lastDiscovery.SetToCurrentTime()
+			}
 
-					d.seenNodes[hInfo.ID] = NodeInfo{Node: *node, Flag: true}
+			seen := NodeInfo{Node: *node, Flag: true, Reported: prev.Reported}
 
-					// Send peer event
-					d.sendPeerEvent(ctx, node, hInfo)
+			// The ENR sequence number of a peer we already know of from a previous ENR
+			var prevSeq uint64
+			if prev.Flag {
+				prevSeq = prev.Node.Seq()
+				if node.Seq() > prevSeq {
+					enrUpdates.Inc()
 				}
 			}
+
+			if suppressRediscovery(prev, node.Seq(), d.dedupWindow, time.Now()) {
+				discoveryEventsSuppressed.Inc()
+				d.seenNodes[hInfo.ID] = seen
+				continue
+			}
+
+			seen.Reported = time.Now()
+			d.seenNodes[hInfo.ID] = seen
+
+			// Send peer event
+			d.sendPeerEvent(ctx, node, hInfo, prevSeq)
 		}
-	}()
+	}
+}
 
-	<-ctx.Done()
-	return ctx.Err()
+// suppressRediscovery returns true if a peer that was already reported shouldn't be reported
+// again: only when its ENR sequence number increased, or, with a window, once the window
+// passed since it was last reported.
+func suppressRediscovery(prev NodeInfo, seq uint64, window time.Duration, now time.Time) bool {
+	if prev.Reported.IsZero() || seq > prev.Node.Seq() {
+		return false
+	}
+
+	return window == 0 || now.Sub(prev.Reported) < window
+}
+
+// Nodes returns a channel with every node found by the discv5 walk, in discovery order.
+// Nodes are dropped if the channel isn't drained.
+func (d *DiscoveryV5) Nodes() <-chan *enode.Node {
+	return d.nodes
 }
 
 // handleENR parses and identifies all the advertised fields of a newly discovered peer
@@ -204,7 +404,7 @@ func (d *DiscoveryV5) handleENR(node *enode.Node) (*HostInfo, error) {
 		return nil, errors.Wrap(err, "unable to parse new discovered ENR")
 	}
 
-	if enr.Eth2Data.ForkDigest.String() != d.FilterDigest {
+	if !slices.Contains(d.FilterDigests, enr.Eth2Data.ForkDigest.String()) {
 		d.log.Debug().Str("fork_digest", enr.Eth2Data.ForkDigest.String()).Msg("Fork digest does not match")
 		return nil, nil
 	}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/chainbound/valtrack/config"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
 )
 
 func TestSingleDiscoveryV5(t *testing.T) {
@@ -25,3 +27,45 @@ func TestSingleDiscoveryV5(t *testing.T) {
 	<-timeout
 	t.FailNow()
 }
+
+func TestSuppressRediscovery(t *testing.T) {
+	node := func(seq uint64) enode.Node {
+		key, _ := crypto.GenerateKey()
+
+		var r enr.Record
+		r.SetSeq(seq)
+		if err := enode.SignV4(&r, key); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return *n
+	}
+
+	now := time.Now()
+	prev := NodeInfo{Node: node(1), Flag: true, Reported: now.Add(-time.Hour)}
+
+	if suppressRediscovery(NodeInfo{Node: node(1), Flag: true}, 1, 0, now) {
+		t.Error("expected a peer that wasn't reported yet to be reported")
+	}
+
+	if !suppressRediscovery(prev, 1, 0, now) {
+		t.Error("expected a reported peer to be suppressed without a window")
+	}
+
+	if suppressRediscovery(prev, 2, 0, now) {
+		t.Error("expected a peer with a newer ENR to be reported again")
+	}
+
+	if !suppressRediscovery(prev, 1, 2*time.Hour, now) {
+		t.Error("expected a peer reported within the window to be suppressed")
+	}
+
+	if suppressRediscovery(prev, 1, 10*time.Minute, now) {
+		t.Error("expected a peer reported before the window to be reported again")
+	}
+}
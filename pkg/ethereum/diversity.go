@@ -0,0 +1,175 @@
+package ethereum
+
+import (
+	"cmp"
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/chainbound/valtrack/version"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// knownClients maps a substring of the agent version to the client it identifies. Lodestar
+// peers often only identify as js-libp2p, and Caplin as erigon.
+var knownClients = []struct{ substr, client string }{
+	{"lighthouse", "lighthouse"},
+	{"prysm", "prysm"},
+	{"teku", "teku"},
+	{"nimbus", "nimbus"},
+	{"lodestar", "lodestar"},
+	{"js-libp2p", "lodestar"},
+	{"grandine", "grandine"},
+	{"caplin", "caplin"},
+	{"erigon", "caplin"},
+}
+
+// ClientName normalizes an agent version (e.g. "Lighthouse/v5.1.3-3058b96/x86_64-linux")
+// to the name of the client.
+func ClientName(agentVersion string) string {
+	v := strings.ToLower(agentVersion)
+	if v == "" || v == "unknown" {
+		return "unknown"
+	}
+
+	for _, c := range knownClients {
+		if strings.Contains(v, c.substr) {
+			return c.client
+		}
+	}
+
+	return "other"
+}
+
+// releasePattern matches the release in a part of an agent version, e.g. "v5.1.3" in
+// "v5.1.3-3058b96".
+var releasePattern = regexp.MustCompile(`^v?\d+\.\d+(\.\d+)?`)
+
+// ClientRelease returns the client name of an agent version, and its release without the
+// commit and platform (e.g. "lighthouse" and "v5.1.3"). The release is "unknown" when the
+// agent version has none, or when the client is only recognized by its libp2p
+// implementation, whose version isn't the client's.
+func ClientRelease(agentVersion string) (string, string) {
+	client := ClientName(agentVersion)
+
+	v := strings.ToLower(agentVersion)
+	for _, c := range knownClients {
+		if !strings.Contains(v, c.substr) {
+			continue
+		}
+		if c.substr != c.client {
+			return client, "unknown"
+		}
+		break
+	}
+
+	if client == "unknown" || client == "other" {
+		return client, "unknown"
+	}
+
+	for _, part := range strings.Split(v, "/") {
+		if release := releasePattern.FindString(part); release != "" {
+			return client, "v" + strings.TrimPrefix(release, "v")
+		}
+	}
+
+	return client, "unknown"
+}
+
+// ClientCounts returns the number of peers per client, for the peers we handshaked with.
+func (p *Peerstore) ClientCounts() map[string]int {
+	counts := make(map[string]int)
+
+	p.RLock()
+	defer p.RUnlock()
+
+	p.peers.Range(func(_ peer.ID, info *PeerInfo) {
+		// The metadata is moved to lastMetadata when the handshake completes
+		if info.metadata == nil && info.lastMetadata == nil {
+			return
+		}
+
+		counts[ClientName(info.clientVersion)]++
+	})
+
+	return counts
+}
+
+// diversitySnapshot returns the snapshot of the given client counts, with the most common
+// client first.
+func diversitySnapshot(counts map[string]int) *types.ClientDiversitySnapshotEvent {
+	event := &types.ClientDiversitySnapshotEvent{
+		Clients: make([]types.ClientShare, 0, len(counts)),
+	}
+
+	for _, count := range counts {
+		event.SampleSize += count
+	}
+
+	for client, count := range counts {
+		event.Clients = append(event.Clients, types.ClientShare{
+			Client:  client,
+			Count:   count,
+			Percent: float64(count) / float64(event.SampleSize) * 100,
+		})
+	}
+
+	slices.SortFunc(event.Clients, func(a, b types.ClientShare) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return cmp.Compare(a.Client, b.Client)
+	})
+
+	return event
+}
+
+// runDiversitySampler takes a client diversity snapshot of the handshaked peers every
+// DiversityInterval, until the context is cancelled.
+func (n *Node) runDiversitySampler(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.DiversityInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		counts := n.peerstore.ClientCounts()
+
+		clientDiversity.Reset()
+		for client, count := range counts {
+			clientDiversity.WithLabelValues(client).Set(float64(count))
+		}
+
+		if len(counts) == 0 {
+			n.log.Info().Msg("No handshaked peers yet, skipping client diversity snapshot")
+			continue
+		}
+
+		n.sendClientDiversityEvent(diversitySnapshot(counts))
+	}
+}
+
+func (n *Node) sendClientDiversityEvent(event *types.ClientDiversitySnapshotEvent) {
+	event.CrawlerID = getCrawlerMachineID()
+	event.CrawlerLoc = getCrawlerLocation()
+	event.CrawlerVer = version.Short()
+	event.Timestamp = time.Now().UnixMilli()
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+	event.SchemaVersion = EventSchemaVersion
+
+	n.log.Info().Int("sample_size", event.SampleSize).Any("clients", event.Clients).Msg("Client diversity snapshot")
+
+	if n.js == nil {
+		n.fileLogger.Log().Str("type", types.EventClientDiversity).Any("event", event).Send()
+		return
+	}
+
+	n.publishNow(types.SubjectClientDiversity, event)
+}
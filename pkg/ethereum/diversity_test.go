@@ -0,0 +1,63 @@
+package ethereum
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chainbound/valtrack/types"
+)
+
+func TestClientName(t *testing.T) {
+	tests := map[string]string{
+		"Lighthouse/v5.1.3-3058b96/x86_64-linux": "lighthouse",
+		"Prysm/v5.0.3/abc":                       "prysm",
+		"teku/teku/v24.4.0/linux-x86_64":         "teku",
+		"nimbus":                                 "nimbus",
+		"js-libp2p/1.2.3 UserAgent=v20.11.1":     "lodestar",
+		"erigon/caplin":                          "caplin",
+		"unknown":                                "unknown",
+		"":                                       "unknown",
+		"rust-libp2p/0.53.0":                     "other",
+	}
+
+	for agent, want := range tests {
+		if got := ClientName(agent); got != want {
+			t.Errorf("ClientName(%q) = %q, want %q", agent, got, want)
+		}
+	}
+}
+
+func TestClientRelease(t *testing.T) {
+	tests := map[string][2]string{
+		"Lighthouse/v5.1.3-3058b96/x86_64-linux": {"lighthouse", "v5.1.3"},
+		"teku/teku/v24.4.0/linux-x86_64":         {"teku", "v24.4.0"},
+		"Grandine/0.4.0-c2ccbc5/x86_64-linux":    {"grandine", "v0.4.0"},
+		"nimbus":                                 {"nimbus", "unknown"},
+		"js-libp2p/1.2.3 UserAgent=v20.11.1":     {"lodestar", "unknown"},
+		"rust-libp2p/0.53.0":                     {"other", "unknown"},
+		"unknown":                                {"unknown", "unknown"},
+	}
+
+	for agent, want := range tests {
+		if client, release := ClientRelease(agent); client != want[0] || release != want[1] {
+			t.Errorf("ClientRelease(%q) = %q, %q, want %q, %q", agent, client, release, want[0], want[1])
+		}
+	}
+}
+
+func TestDiversitySnapshot(t *testing.T) {
+	event := diversitySnapshot(map[string]int{"teku": 1, "prysm": 1, "lighthouse": 2})
+
+	want := []types.ClientShare{
+		{Client: "lighthouse", Count: 2, Percent: 50},
+		{Client: "prysm", Count: 1, Percent: 25},
+		{Client: "teku", Count: 1, Percent: 25},
+	}
+
+	if event.SampleSize != 4 {
+		t.Fatalf("expected sample size 4, got %d", event.SampleSize)
+	}
+	if !reflect.DeepEqual(event.Clients, want) {
+		t.Fatalf("expected %+v, got %+v", want, event.Clients)
+	}
+}
@@ -66,9 +66,8 @@ func ParseEnr(node *enode.Node) (*EnrNode, error) {
 
 	// compose the rest of the info
 	enrNode.Seq = node.Seq()
-	enrNode.IP = node.IP()
+	enrNode.IP, enrNode.TCP = enrIPPort(node)
 	enrNode.UDP = node.UDP()
-	enrNode.TCP = node.TCP()
 	enrNode.Pubkey = node.Pubkey()
 
 	// Retrieve the Fork Digest and the attestnets
@@ -0,0 +1,80 @@
+package ethereum
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	p2ptypes "github.com/prysmaticlabs/prysm/v5/beacon-chain/p2p/types"
+)
+
+// Handshake failures. The errors returned by the handshake wrap one of these, so they
+// can be matched with errors.Is.
+var (
+	ErrStatusFailed       = errors.New("status request failed")
+	ErrPingFailed         = errors.New("ping failed")
+	ErrMetadataFailed     = errors.New("metadata request failed")
+	ErrForkDigestMismatch = errors.New("fork digest mismatch")
+	ErrPeerDisconnected   = errors.New("peer disconnected")
+)
+
+// Disconnect causes that aren't handshake failures, to derive the goodbye code from.
+var (
+	// ErrTooManyPeers is the cause when a peer is rejected or evicted by the peer limit.
+	ErrTooManyPeers = errors.New("too many peers")
+	// ErrShuttingDown is the cause when the sentry disconnects its peers on shutdown.
+	ErrShuttingDown = errors.New("shutting down")
+)
+
+// handshakeFailureReason returns the metric label for a handshake error.
+func handshakeFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrForkDigestMismatch):
+		return "fork_digest"
+	case errors.Is(err, ErrPeerDisconnected):
+		return "disconnected"
+	case errors.Is(err, ErrStatusFailed):
+		return "status"
+	case errors.Is(err, ErrPingFailed):
+		return "ping"
+	case errors.Is(err, ErrMetadataFailed):
+		return "metadata"
+	default:
+		return "other"
+	}
+}
+
+// goodbyeCode returns the reason code to send a peer we disconnect because of `cause`.
+// Every goodbye goes through it, so the code always matches the cause:
+//   - a fork digest mismatch is an irrelevant network
+//   - a status request that failed leaves the network unverified
+//   - the peer limit, and the end of a successful handshake we don't keep, are too many
+//     peers, which clients don't penalize us for
+//   - our own shutdown is a client shutdown
+//   - timeouts, stream errors and anything else are a fault/error
+func goodbyeCode(cause error) uint64 {
+	switch {
+	case cause == nil, errors.Is(cause, ErrTooManyPeers):
+		return uint64(p2ptypes.GoodbyeCodeTooManyPeers)
+	case errors.Is(cause, ErrShuttingDown):
+		return uint64(p2ptypes.GoodbyeCodeClientShutdown)
+	case errors.Is(cause, ErrForkDigestMismatch):
+		return uint64(p2ptypes.GoodbyeCodeWrongNetwork)
+	case errors.Is(cause, ErrStatusFailed):
+		return uint64(p2ptypes.GoodbyeCodeUnableToVerifyNetwork)
+	default:
+		return uint64(p2ptypes.GoodbyeCodeGenericError)
+	}
+}
+
+// goodbyePeerGone reports whether a goodbye failed because the peer had already closed
+// the connection, which is expected, as opposed to a failure on our side (e.g. stream
+// limits) that is worth alerting on.
+func goodbyePeerGone(err error) bool {
+	return errors.Is(err, network.ErrReset) ||
+		errors.Is(err, network.ErrNoConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,34 @@
+package ethereum
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	p2ptypes "github.com/prysmaticlabs/prysm/v5/beacon-chain/p2p/types"
+)
+
+func TestGoodbyeCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		cause error
+		want  p2ptypes.RPCGoodbyeCode
+	}{
+		{"handshake succeeded", nil, p2ptypes.GoodbyeCodeTooManyPeers},
+		{"peer limit", ErrTooManyPeers, p2ptypes.GoodbyeCodeTooManyPeers},
+		{"shutdown", ErrShuttingDown, p2ptypes.GoodbyeCodeClientShutdown},
+		{"fork digest", fmt.Errorf("%w: got 0x01020304", ErrForkDigestMismatch), p2ptypes.GoodbyeCodeWrongNetwork},
+		{"status failed", fmt.Errorf("%w: %w", ErrStatusFailed, network.ErrReset), p2ptypes.GoodbyeCodeUnableToVerifyNetwork},
+		{"timeout", fmt.Errorf("%w: %w", ErrPingFailed, context.DeadlineExceeded), p2ptypes.GoodbyeCodeGenericError},
+		{"stream error", fmt.Errorf("%w: %w", ErrMetadataFailed, network.ErrReset), p2ptypes.GoodbyeCodeGenericError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := goodbyeCode(tt.cause); got != uint64(tt.want) {
+				t.Errorf("goodbyeCode(%v) = %d, want %d", tt.cause, got, tt.want)
+			}
+		})
+	}
+}
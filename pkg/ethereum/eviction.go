@@ -0,0 +1,75 @@
+package ethereum
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EvictionCandidate is a connected peer that could be evicted to make room for a new connection.
+type EvictionCandidate struct {
+	ID peer.ID
+	// Opened is when the connection to the peer was opened.
+	Opened time.Time
+	// LastSeen is the last time we received new data (status, metadata, subscriptions) from the peer.
+	LastSeen time.Time
+	// Handshaking is true if we're still in the middle of a handshake with the peer.
+	Handshaking bool
+}
+
+// EvictionPolicy decides what happens when a new connection comes in while the node
+// is at its peer limit.
+type EvictionPolicy interface {
+	// SelectVictim returns the peer to disconnect to make room for the new connection.
+	// If it returns false, the new connection is rejected instead.
+	SelectVictim(candidates []EvictionCandidate) (peer.ID, bool)
+}
+
+// EvictionPolicies are the available eviction policies, by name.
+var EvictionPolicies = map[string]EvictionPolicy{
+	"oldest": EvictOldest{},
+	"reject": RejectNew{},
+}
+
+// NewEvictionPolicy returns the eviction policy with the given name.
+func NewEvictionPolicy(name string) (EvictionPolicy, error) {
+	policy, ok := EvictionPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown eviction policy: %s", name)
+	}
+
+	return policy, nil
+}
+
+// EvictOldest evicts the peer we haven't received new data from for the longest time,
+// skipping peers we're still handshaking with. If every peer is handshaking, the new
+// connection is rejected.
+type EvictOldest struct{}
+
+func (EvictOldest) SelectVictim(candidates []EvictionCandidate) (peer.ID, bool) {
+	var (
+		victim EvictionCandidate
+		found  bool
+	)
+
+	for _, c := range candidates {
+		if c.Handshaking {
+			continue
+		}
+
+		if !found || c.LastSeen.Before(victim.LastSeen) {
+			victim = c
+			found = true
+		}
+	}
+
+	return victim.ID, found
+}
+
+// RejectNew always rejects new connections while at the peer limit.
+type RejectNew struct{}
+
+func (RejectNew) SelectVictim([]EvictionCandidate) (peer.ID, bool) {
+	return "", false
+}
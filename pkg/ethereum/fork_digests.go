@@ -0,0 +1,91 @@
+package ethereum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/prysmaticlabs/prysm/v5/beacon-chain/core/signing"
+	"github.com/prysmaticlabs/prysm/v5/config/params"
+	"github.com/prysmaticlabs/prysm/v5/time/slots"
+)
+
+// nextForkDigest returns the fork digest of the next fork in the fork schedule of beaconCfg
+// at `now`, computed with genesisValidatorsRoot, or false if there is none.
+func nextForkDigest(beaconCfg *params.BeaconChainConfig, genesisValidatorsRoot [32]byte, genesis time.Time, now time.Time) ([4]byte, bool, error) {
+	epoch := slots.ToEpoch(currentSlot(genesis, beaconCfg.SecondsPerSlot, now))
+
+	var (
+		nextVersion [4]byte
+		nextEpoch   = beaconCfg.FarFutureEpoch
+	)
+	for version, forkEpoch := range beaconCfg.ForkVersionSchedule {
+		if forkEpoch > epoch && forkEpoch < nextEpoch {
+			nextVersion, nextEpoch = version, forkEpoch
+		}
+	}
+
+	if nextEpoch == beaconCfg.FarFutureEpoch {
+		return [4]byte{}, false, nil
+	}
+
+	digest, err := signing.ComputeForkDigest(nextVersion[:], genesisValidatorsRoot[:])
+	if err != nil {
+		return [4]byte{}, false, fmt.Errorf("compute next fork digest: %w", err)
+	}
+
+	return digest, true, nil
+}
+
+// acceptedForkDigests returns the fork digests peers can be on: ForkDigest first, then
+// AcceptedForkDigests and the next fork's with AcceptNextForkDigest, without duplicates.
+func acceptedForkDigests(cfg *config.NodeConfig, now time.Time) ([][4]byte, error) {
+	digests := [][4]byte{cfg.ForkDigest}
+
+	add := func(digest [4]byte) {
+		if !slices.Contains(digests, digest) {
+			digests = append(digests, digest)
+		}
+	}
+
+	for _, digest := range cfg.AcceptedForkDigests {
+		add(digest)
+	}
+
+	if cfg.AcceptNextForkDigest {
+		next, ok, err := nextForkDigest(cfg.BeaconConfig, cfg.GenesisValidatorsRoot, time.Unix(cfg.GenesisTime, 0), now)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			add(next)
+		}
+	}
+
+	return digests, nil
+}
+
+// matchForkDigest returns the accepted digest equal to `digest`, or false if there is none.
+func matchForkDigest(accepted [][4]byte, digest []byte) ([4]byte, bool) {
+	for _, d := range accepted {
+		if bytes.Equal(d[:], digest) {
+			return d, true
+		}
+	}
+
+	return [4]byte{}, false
+}
+
+// forkDigestStrings returns the digests 0x-prefixed, as they're printed in ENRs.
+func forkDigestStrings(digests [][4]byte) []string {
+	strs := make([]string, len(digests))
+	for i, d := range digests {
+		strs[i] = "0x" + hex.EncodeToString(d[:])
+	}
+
+	return strs
+}
@@ -0,0 +1,58 @@
+package ethereum
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/prysmaticlabs/prysm/v5/config/params"
+)
+
+func TestAcceptedForkDigests(t *testing.T) {
+	cfg := config.DefaultNodeConfig
+	cfg.AcceptNextForkDigest = false
+	cfg.AcceptedForkDigests = [][4]byte{{0x01, 0x02, 0x03, 0x04}, cfg.ForkDigest}
+
+	digests, err := acceptedForkDigests(&cfg, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(digests) != 2 || digests[0] != cfg.ForkDigest {
+		t.Fatalf("expected the fork digest first and no duplicates, got %v", forkDigestStrings(digests))
+	}
+
+	if digest, ok := matchForkDigest(digests, []byte{0x01, 0x02, 0x03, 0x04}); !ok || digest != digests[1] {
+		t.Errorf("expected a match on the accepted fork digest, got %#x %v", digest, ok)
+	}
+
+	if _, ok := matchForkDigest(digests, []byte{0xff, 0xff, 0xff, 0xff}); ok {
+		t.Error("expected no match on another fork digest")
+	}
+
+	if _, err := config.ParseForkDigest("0x6a95a1"); err == nil {
+		t.Error("expected an error for a 3 byte fork digest")
+	}
+}
+
+func TestNextForkDigest(t *testing.T) {
+	cfg := config.DefaultNodeConfig
+	beaconCfg := params.MainnetConfig()
+	genesis := time.Unix(cfg.GenesisTime, 0)
+
+	// At genesis, the next fork is Altair
+	digest, ok, err := nextForkDigest(beaconCfg, cfg.GenesisValidatorsRoot, genesis, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || digest != [4]byte{0xaf, 0xca, 0xab, 0xa0} {
+		t.Errorf("expected the Altair fork digest 0xafcaaba0, got %#x %v", digest, ok)
+	}
+
+	// After Deneb, no fork is scheduled in this config
+	deneb := genesis.Add(time.Duration(uint64(beaconCfg.DenebForkEpoch)*uint64(beaconCfg.SlotsPerEpoch)*beaconCfg.SecondsPerSlot) * time.Second)
+	if _, ok, err := nextForkDigest(beaconCfg, cfg.GenesisValidatorsRoot, genesis, deneb); err != nil || ok {
+		t.Errorf("expected no next fork after Deneb, got %v %v", ok, err)
+	}
+}
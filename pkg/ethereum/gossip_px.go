@@ -0,0 +1,169 @@
+package ethereum
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/chainbound/valtrack/version"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// pxCollector collects the peers of the peer exchange (PX) records in the PRUNE messages
+// received over gossipsub, as peer_discovered events. It's a pubsub.RawTracer that ignores
+// all other events.
+type pxCollector struct {
+	window time.Duration
+	report func(*types.PeerDiscoveredEvent)
+
+	mu sync.Mutex
+	// seen is the time every peer was last reported at
+	seen *lruCache[peer.ID, time.Time]
+}
+
+var _ pubsub.RawTracer = (*pxCollector)(nil)
+
+func newPXCollector(size int, window time.Duration, report func(*types.PeerDiscoveredEvent)) *pxCollector {
+	return &pxCollector{
+		window: window,
+		report: report,
+		seen:   newLRUCache[peer.ID, time.Time](size, nil, nil),
+	}
+}
+
+func (c *pxCollector) RecvRPC(rpc *pubsub.RPC) {
+	for _, prune := range rpc.GetControl().GetPrune() {
+		for _, info := range prune.GetPeers() {
+			if event := c.collect(info, time.Now()); event != nil {
+				c.report(event)
+			}
+		}
+	}
+}
+
+// collect returns the event of a PX record, or nil if the record is invalid or its peer
+// was already reported: within the window, or at all with a 0 window. Records without a signed peer record only
+// carry the peer ID.
+func (c *pxCollector) collect(info *pb.PeerInfo, now time.Time) *types.PeerDiscoveredEvent {
+	pid, err := peer.IDFromBytes(info.GetPeerID())
+	if err != nil {
+		gossipPXPeers.WithLabelValues("invalid").Inc()
+		return nil
+	}
+
+	event := &types.PeerDiscoveredEvent{
+		ID:        pid.String(),
+		Source:    types.SourceGossipPX,
+		Timestamp: now.UnixMilli(),
+	}
+
+	if spr := info.GetSignedPeerRecord(); len(spr) > 0 {
+		addrs, err := pxRecordAddrs(pid, spr)
+		if err != nil {
+			gossipPXPeers.WithLabelValues("invalid").Inc()
+			return nil
+		}
+
+		if addr, _ := selectAddr(addrs, nil); addr != nil {
+			event.IP, event.Port = addrIPPort(addr)
+			event.IPVersion = ipVersion(event.IP)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.seen.Peek(pid); ok && (c.window == 0 || now.Sub(last) < c.window) {
+		gossipPXPeers.WithLabelValues("duplicate").Inc()
+		return nil
+	}
+	c.seen.Add(pid, now)
+
+	gossipPXPeers.WithLabelValues("reported").Inc()
+	return event
+}
+
+// pxRecordAddrs returns the addresses of the signed peer record of a PX record, which
+// must be signed by the peer itself.
+func pxRecordAddrs(pid peer.ID, spr []byte) ([]ma.Multiaddr, error) {
+	_, rec, err := record.ConsumeEnvelope(spr, peer.PeerRecordEnvelopeDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	peerRec, ok := rec.(*peer.PeerRecord)
+	if !ok {
+		return nil, fmt.Errorf("unexpected record type %T", rec)
+	}
+
+	if peerRec.PeerID != pid {
+		return nil, fmt.Errorf("record of peer %s for peer %s", peerRec.PeerID, pid)
+	}
+
+	return peerRec.Addrs, nil
+}
+
+// addrIPPort returns the IP and TCP port of an address, empty if it has none.
+func addrIPPort(addr ma.Multiaddr) (string, int) {
+	ip, err := addr.ValueForProtocol(ma.P_IP4)
+	if err != nil {
+		if ip, err = addr.ValueForProtocol(ma.P_IP6); err != nil {
+			return "", 0
+		}
+	}
+
+	port, _ := addr.ValueForProtocol(ma.P_TCP)
+	portNum, _ := strconv.Atoi(port)
+
+	return ip, portNum
+}
+
+func (c *pxCollector) AddPeer(p peer.ID, proto protocol.ID)        {}
+func (c *pxCollector) RemovePeer(p peer.ID)                        {}
+func (c *pxCollector) Join(topic string)                           {}
+func (c *pxCollector) Leave(topic string)                          {}
+func (c *pxCollector) Graft(p peer.ID, topic string)               {}
+func (c *pxCollector) Prune(p peer.ID, topic string)               {}
+func (c *pxCollector) ValidateMessage(msg *pubsub.Message)         {}
+func (c *pxCollector) DeliverMessage(msg *pubsub.Message)          {}
+func (c *pxCollector) RejectMessage(msg *pubsub.Message, _ string) {}
+func (c *pxCollector) DuplicateMessage(msg *pubsub.Message)        {}
+func (c *pxCollector) ThrottlePeer(p peer.ID)                      {}
+func (c *pxCollector) SendRPC(rpc *pubsub.RPC, p peer.ID)          {}
+func (c *pxCollector) DropRPC(rpc *pubsub.RPC, p peer.ID)          {}
+func (c *pxCollector) UndeliverableMessage(msg *pubsub.Message)    {}
+
+// sendPXPeerEvent doesn't block, it's called from the gossipsub event loop.
+func (n *Node) sendPXPeerEvent(event *types.PeerDiscoveredEvent) {
+	event.CrawlerID = getCrawlerMachineID()
+	event.CrawlerLoc = getCrawlerLocation()
+	event.CrawlerVer = version.Short()
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+	event.SchemaVersion = EventSchemaVersion
+	event.ObservedAt = time.Now().UnixMilli()
+	if n.beaconPeers != nil {
+		event.BeaconConnected = n.beaconPeers.Contains(event.ID)
+	}
+	redactPeerDiscovered(&n.cfg.Redaction, event)
+
+	n.log.Debug().Any("event", event).Msg("Discovered peer from gossipsub PX")
+
+	if n.js == nil {
+		n.fileLogger.Log().Str("type", types.EventPeerDiscovered).Any("event", event).Send()
+		return
+	}
+
+	select {
+	case n.pxPeerChan <- event:
+		n.log.Trace().Str("peer", event.ID).Msg("Sent peer_discovered event to channel")
+	default:
+		n.dialAddrLog.Warn().Msg("Channel full, dropped gossipsub PX peer_discovered event")
+	}
+}
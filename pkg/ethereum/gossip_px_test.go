@@ -0,0 +1,75 @@
+package ethereum
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func signedPXRecord(t *testing.T, addrs ...ma.Multiaddr) (peer.ID, []byte) {
+	t.Helper()
+
+	priv, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: pid, Addrs: addrs}), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spr, err := envelope.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pid, spr
+}
+
+func TestPXCollector(t *testing.T) {
+	now := time.Now()
+	collector := newPXCollector(100, time.Hour, nil)
+
+	pid, spr := signedPXRecord(t, ma.StringCast("/ip4/10.0.0.1/tcp/9000"), ma.StringCast("/ip4/8.8.8.8/tcp/9001"))
+	event := collector.collect(&pb.PeerInfo{PeerID: []byte(pid), SignedPeerRecord: spr}, now)
+	if event == nil {
+		t.Fatal("expected an event")
+	}
+	if event.ID != pid.String() || event.Source != types.SourceGossipPX || event.IP != "8.8.8.8" || event.Port != 9001 || event.IPVersion != 4 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// Reported once per window
+	if event := collector.collect(&pb.PeerInfo{PeerID: []byte(pid)}, now.Add(time.Minute)); event != nil {
+		t.Fatalf("expected no event within the window, got %+v", event)
+	}
+	if event := collector.collect(&pb.PeerInfo{PeerID: []byte(pid)}, now.Add(2*time.Hour)); event == nil {
+		t.Fatal("expected an event after the window")
+	}
+
+	// Without a window, a peer is only reported once
+	collector = newPXCollector(100, 0, nil)
+	if event := collector.collect(&pb.PeerInfo{PeerID: []byte(pid)}, now); event == nil {
+		t.Fatal("expected an event")
+	}
+	if event := collector.collect(&pb.PeerInfo{PeerID: []byte(pid)}, now.Add(24*time.Hour)); event != nil {
+		t.Fatalf("expected no event for a peer that was already reported, got %+v", event)
+	}
+
+	// A record signed by another peer is rejected
+	other, _ := signedPXRecord(t)
+	if event := collector.collect(&pb.PeerInfo{PeerID: []byte(other), SignedPeerRecord: spr}, now); event != nil {
+		t.Fatalf("expected no event for a record of another peer, got %+v", event)
+	}
+}
@@ -0,0 +1,40 @@
+package ethereum
+
+import (
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// handshakeFailedEvent returns the event for a failed handshake with a peer. backoff is the
+// backoff counter of the peer after the failure, 0 for inbound peers and for failures
+// retried on another address.
+func (n *Node) handshakeFailedEvent(pid peer.ID, err error, backoff uint32) *types.HandshakeFailedEvent {
+	event := &types.HandshakeFailedEvent{
+		ID:             pid.String(),
+		Reason:         handshakeFailureReason(err),
+		Error:          err.Error(),
+		BackoffCounter: int64(backoff),
+		Timestamp:      time.Now().UnixMilli(),
+	}
+
+	if info := n.peerstore.Get(pid); info != nil {
+		event.ENR = info.enode.String()
+		if info.remoteAddr != nil {
+			event.Multiaddr = info.remoteAddr.String()
+		}
+		if info.status != nil {
+			event.ForkDigest = hex.EncodeToString(info.status.ForkDigest)
+		}
+	}
+
+	return event
+}
+
+// recordHandshakeFailed reports whether a failed handshake is published as an event.
+func (n *Node) recordHandshakeFailed(err error) bool {
+	return n.cfg.RecordHandshakeFailures || (n.cfg.RecordForkMismatches && errors.Is(err, ErrForkDigestMismatch))
+}
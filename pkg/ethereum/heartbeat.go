@@ -0,0 +1,48 @@
+package ethereum
+
+import (
+	"context"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/chainbound/valtrack/version"
+)
+
+// runHeartbeat sends a heartbeat event every HeartbeatInterval, until the context is
+// cancelled.
+func (n *Node) runHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.sendHeartbeatEvent()
+		}
+	}
+}
+
+func (n *Node) sendHeartbeatEvent() {
+	event := &types.HeartbeatEvent{
+		CrawlerID:      getCrawlerMachineID(),
+		CrawlerLoc:     getCrawlerLocation(),
+		CrawlerVer:     version.Short(),
+		UptimeSeconds:  int64(time.Since(n.stats.startedAt).Seconds()),
+		ConnectedPeers: len(n.host.Network().Peers()),
+		IntervalMs:     n.cfg.HeartbeatInterval.Milliseconds(),
+		Timestamp:      time.Now().UnixMilli(),
+		SchemaVersion:  EventSchemaVersion,
+	}
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+
+	n.log.Debug().Any("event", event).Msg("Heartbeat")
+
+	if n.js == nil {
+		n.fileLogger.Log().Str("type", types.EventHeartbeat).Any("event", event).Send()
+		return
+	}
+
+	n.publishNow(types.SubjectHeartbeat, event)
+}
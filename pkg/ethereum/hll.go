@@ -0,0 +1,106 @@
+package ethereum
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Bounds of the HyperLogLog precision: 16 registers to 256 KiB.
+const (
+	minHLLPrecision = 4
+	maxHLLPrecision = 18
+)
+
+// peerHLL is a HyperLogLog estimate of the number of distinct peers added. It uses 2^p
+// registers of one byte regardless of the number of peers, with a standard error of
+// 1.04/sqrt(2^p). The sum the estimate is computed from is kept up to date on every add, so
+// reading it doesn't walk the registers.
+type peerHLL struct {
+	mu sync.Mutex
+
+	p         uint8
+	registers []uint8
+	// sum is the sum of 2^-register over all registers, and zeros the number of registers
+	// still at 0
+	sum   float64
+	zeros int
+
+	seed maphash.Seed
+}
+
+func newPeerHLL(precision int) (*peerHLL, error) {
+	if precision < minHLLPrecision || precision > maxHLLPrecision {
+		return nil, fmt.Errorf("HyperLogLog precision must be between %d and %d, got %d", minHLLPrecision, maxHLLPrecision, precision)
+	}
+
+	m := 1 << precision
+
+	return &peerHLL{
+		p:         uint8(precision),
+		registers: make([]uint8, m),
+		sum:       float64(m),
+		zeros:     m,
+		seed:      maphash.MakeSeed(),
+	}, nil
+}
+
+// Add records a peer. It reports whether the estimate changed.
+func (h *peerHLL) Add(id peer.ID) bool {
+	hash := maphash.String(h.seed, string(id))
+
+	// The first p bits select the register, the rank is the position of the first set bit
+	// in the rest
+	idx := hash >> (64 - h.p)
+	rank := uint8(bits.LeadingZeros64(hash<<h.p|1<<(h.p-1)) + 1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	old := h.registers[idx]
+	if rank <= old {
+		return false
+	}
+
+	h.registers[idx] = rank
+	h.sum += math.Ldexp(1, -int(rank)) - math.Ldexp(1, -int(old))
+	if old == 0 {
+		h.zeros--
+	}
+
+	return true
+}
+
+// Estimate returns the estimated number of distinct peers added.
+func (h *peerHLL) Estimate() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	m := float64(len(h.registers))
+
+	var alpha float64
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+
+	estimate := alpha * m * m / h.sum
+
+	// Small cardinalities are estimated from the empty registers (linear counting). The
+	// 64-bit hash doesn't need the large range correction.
+	if estimate <= 2.5*m && h.zeros > 0 {
+		estimate = m * math.Log(m/float64(h.zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
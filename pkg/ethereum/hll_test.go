@@ -0,0 +1,37 @@
+package ethereum
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerHLL(t *testing.T) {
+	if _, err := newPeerHLL(maxHLLPrecision + 1); err == nil {
+		t.Fatal("expected an error for a precision out of bounds")
+	}
+
+	const precision = 14
+	stdErr := 1.04 / math.Sqrt(1<<precision)
+
+	for _, distinct := range []int{100, 10_000, 500_000} {
+		h, err := newPeerHLL(precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every peer is added twice, duplicates don't count
+		for round := 0; round < 2; round++ {
+			for i := 0; i < distinct; i++ {
+				h.Add(peer.ID(fmt.Sprintf("peer-%d", i)))
+			}
+		}
+
+		got := float64(h.Estimate())
+		if relErr := math.Abs(got-float64(distinct)) / float64(distinct); relErr > 4*stdErr {
+			t.Errorf("estimate of %d distinct peers is %.0f, error %.4f above 4 standard errors (%.4f)", distinct, got, relErr, 4*stdErr)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package ethereum
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// inFlight is the set of peers a handshake is running for. Connected fires for every
+// connection, and discovery can surface a peer several times in quick succession, so
+// without it a peer can be handshaked by concurrent goroutines racing on the caches.
+// Entries are removed when the handshake returns, which DialTimeout bounds.
+type inFlight struct {
+	mu    sync.Mutex
+	peers map[peer.ID]struct{}
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{peers: make(map[peer.ID]struct{})}
+}
+
+// start adds the peer to the set, or returns false if a handshake is already running for it.
+func (f *inFlight) start(pid peer.ID) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.peers[pid]; ok {
+		return false
+	}
+
+	f.peers[pid] = struct{}{}
+	handshakesInFlight.Set(float64(len(f.peers)))
+
+	return true
+}
+
+// done removes the peer from the set once its handshake returned.
+func (f *inFlight) done(pid peer.ID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.peers, pid)
+	handshakesInFlight.Set(float64(len(f.peers)))
+}
@@ -0,0 +1,45 @@
+package ethereum
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestInFlight(t *testing.T) {
+	f := newInFlight()
+	pid := peer.ID("peer")
+
+	// Concurrent connections of the same peer start a single handshake
+	var (
+		wg      sync.WaitGroup
+		started atomic.Int32
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if f.start(pid) {
+				started.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if started.Load() != 1 {
+		t.Fatalf("expected 1 handshake started, got %d", started.Load())
+	}
+
+	// Other peers aren't affected
+	if !f.start(peer.ID("other")) {
+		t.Fatal("expected a handshake for another peer to start")
+	}
+
+	// Once done, the peer can be handshaked again
+	f.done(pid)
+	if !f.start(pid) {
+		t.Fatal("expected a handshake to start after the previous one is done")
+	}
+}
@@ -0,0 +1,104 @@
+package ethereum
+
+import "container/list"
+
+// lruCache is a map bounded to `size` entries, evicting the least recently used entry
+// when full. It is not safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	size  int
+	ll    *list.List
+	items map[K]*list.Element
+
+	// canEvict can protect entries from eviction (e.g. ones in use). If no entry can be
+	// evicted, the cache temporarily grows beyond its size.
+	canEvict func(K, V) bool
+	// onEvict is called for every evicted entry, but not for removed ones.
+	onEvict func(K, V)
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache creates a new cache. A size of 0 or less means unbounded.
+func newLRUCache[K comparable, V any](size int, canEvict func(K, V) bool, onEvict func(K, V)) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		size:     size,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element),
+		canEvict: canEvict,
+		onEvict:  onEvict,
+	}
+}
+
+// Add inserts or replaces an entry and marks it as most recently used.
+func (c *lruCache[K, V]) Add(key K, value V) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry[K, V]).value = value
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry[K, V]{key: key, value: value})
+
+	if c.size > 0 && c.ll.Len() > c.size {
+		c.evict()
+	}
+}
+
+// Touch marks an entry as most recently used.
+func (c *lruCache[K, V]) Touch(key K) {
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+	}
+}
+
+// Peek returns an entry without updating its recency.
+func (c *lruCache[K, V]) Peek(key K) (V, bool) {
+	if el, ok := c.items[key]; ok {
+		return el.Value.(*lruEntry[K, V]).value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Remove removes an entry without calling onEvict.
+func (c *lruCache[K, V]) Remove(key K) {
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *lruCache[K, V]) Len() int {
+	return c.ll.Len()
+}
+
+// Range calls fn for every entry, from most to least recently used.
+func (c *lruCache[K, V]) Range(fn func(K, V)) {
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*lruEntry[K, V])
+		fn(entry.key, entry.value)
+	}
+}
+
+// evict removes the least recently used entry that can be evicted.
+func (c *lruCache[K, V]) evict() {
+	for el := c.ll.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*lruEntry[K, V])
+		if c.canEvict != nil && !c.canEvict(entry.key, entry.value) {
+			continue
+		}
+
+		c.ll.Remove(el)
+		delete(c.items, entry.key)
+
+		if c.onEvict != nil {
+			c.onEvict(entry.key, entry.value)
+		}
+
+		return
+	}
+}
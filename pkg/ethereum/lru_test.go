@@ -0,0 +1,71 @@
+package ethereum
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLRUCache(t *testing.T) {
+	var evicted []int
+	c := newLRUCache(3, nil, func(k int, _ string) { evicted = append(evicted, k) })
+
+	c.Add(1, "a")
+	c.Add(2, "b")
+	c.Add(3, "c")
+
+	// Touching 1 makes 2 the least recently used entry
+	c.Touch(1)
+	c.Add(4, "d")
+
+	if _, ok := c.Peek(2); ok || !slices.Equal(evicted, []int{2}) {
+		t.Fatalf("expected 2 to be evicted, evicted %v", evicted)
+	}
+
+	// Replacing an entry updates its value and recency without evicting
+	c.Add(3, "c2")
+	if v, ok := c.Peek(3); !ok || v != "c2" || c.Len() != 3 {
+		t.Fatalf("expected 3 to be replaced, got %q %v with %d entries", v, ok, c.Len())
+	}
+
+	var keys []int
+	c.Range(func(k int, _ string) { keys = append(keys, k) })
+	if !slices.Equal(keys, []int{3, 4, 1}) {
+		t.Fatalf("expected entries from most to least recently used, got %v", keys)
+	}
+
+	// Removed entries aren't reported as evicted
+	c.Remove(4)
+	if _, ok := c.Peek(4); ok || len(evicted) != 1 {
+		t.Fatalf("expected 4 to be removed without eviction, evicted %v", evicted)
+	}
+}
+
+func TestLRUCacheCanEvict(t *testing.T) {
+	// Odd keys are in use and can't be evicted
+	c := newLRUCache(2, func(k int, _ struct{}) bool { return k%2 == 0 }, nil)
+
+	c.Add(1, struct{}{})
+	c.Add(2, struct{}{})
+	c.Add(3, struct{}{})
+
+	if _, ok := c.Peek(2); ok {
+		t.Fatal("expected the evictable entry 2 to be evicted instead of 1")
+	}
+
+	// With no evictable entry left, the cache grows beyond its size
+	c.Add(5, struct{}{})
+	if c.Len() != 3 {
+		t.Fatalf("expected the cache to grow to 3 entries, got %d", c.Len())
+	}
+}
+
+func TestLRUCacheUnbounded(t *testing.T) {
+	c := newLRUCache[int, int](0, nil, nil)
+	for i := 0; i < 1000; i++ {
+		c.Add(i, i)
+	}
+
+	if c.Len() != 1000 {
+		t.Fatalf("expected an unbounded cache to keep every entry, got %d", c.Len())
+	}
+}
@@ -0,0 +1,220 @@
+package ethereum
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "valtrack_sentry"
+
+var (
+	connectedPeers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "connected_peers",
+		Help:      "Number of peers the node is currently connected to",
+	})
+
+	maxPeers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "max_peers",
+		Help:      "Configured maximum number of connected peers (0 means unlimited)",
+	})
+
+	peerEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "peer_evictions_total",
+		Help:      "Number of peers disconnected because the node was at its peer limit",
+	}, []string{"action"})
+
+	handshakeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "handshake_failures_total",
+		Help:      "Number of failed peer handshakes, by reason",
+	}, []string{"reason"})
+
+	clientHandshakes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "client_handshakes_total",
+		Help:      "Number of peer handshakes by client, release (unknown before identify completed) and result (success or failure)",
+	}, []string{"client", "release", "result"})
+
+	dialAddrFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dial_addr_fallbacks_total",
+		Help:      "Number of peers handshaked with on another address after the first one failed",
+	})
+
+	metadataRequestsThrottled = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "metadata_requests_throttled_total",
+		Help:      "Number of handshakes that reused the metadata received within the metadata cooldown",
+	})
+
+	natsDisconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "nats_disconnects_total",
+		Help:      "Number of times a NATS connection was lost",
+	})
+
+	eventsBuffered = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "nats_buffered_events",
+		Help:      "Number of events kept while disconnected from NATS, to publish once reconnected",
+	})
+
+	eventsDroppedDisconnected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "nats_dropped_disconnected_total",
+		Help:      "Number of events dropped while disconnected from NATS because the publish buffer was full, by subject",
+	}, []string{"subject"})
+
+	natsBreakers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "nats_breakers",
+		Help:      "Number of NATS publish circuit breakers by state (closed, open or half_open)",
+	}, []string{"state"})
+
+	eventsDroppedBreakerOpen = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "nats_dropped_breaker_open_total",
+		Help:      "Number of events dropped while connected to NATS because the circuit breaker was open, by subject",
+	}, []string{"subject"})
+
+	attnetPeerCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "attnet_peer_count",
+		Help:      "Number of peers in the peerstore whose last metadata has the attestation subnet set, by subnet",
+	}, []string{"subnet"})
+
+	clientDiversity = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "client_diversity_peers",
+		Help:      "Number of handshaked peers per consensus client, at the last client diversity snapshot",
+	}, []string{"client"})
+
+	handshakeRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "handshake_retries_total",
+		Help:      "Number of handshake requests retried after a stream reset, by request",
+	}, []string{"request"})
+
+	clockOffsetGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "clock_offset_seconds",
+		Help:      "Measured offset of the local clock from the NTP server (0 if the last sync failed)",
+	})
+
+	goodbyesFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "goodbyes_failed_total",
+		Help:      "Number of goodbye messages that couldn't be sent to a peer that was still connected",
+	})
+
+	peerstoreEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "peerstore_evictions_total",
+		Help:      "Number of peers evicted from the peerstore because a cache was full, by cache (metadata or backoff)",
+	}, []string{"cache"})
+
+	discoveryEventsSuppressed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "discovery_events_suppressed_total",
+		Help:      "Number of rediscovered peers not reported because they were reported within the dedup window",
+	})
+
+	lastDiscovery = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_discovery_timestamp_seconds",
+		Help:      "Unix time the discv5 walk last found a new peer",
+	})
+
+	discoveryRestarts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "discovery_restarts_total",
+		Help:      "Number of times the watchdog restarted the discv5 walk because it found no new peer within the window",
+	})
+
+	enrUpdates = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "enr_updates_total",
+		Help:      "Number of rediscovered peers that published an ENR with a higher sequence number",
+	})
+
+	backoffSkippedDials = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "backoff_skipped_dials_total",
+		Help:      "Number of dials skipped because the peer's last handshake failed within the backoff period",
+	})
+
+	peerFilterSkippedDials = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "peer_filter_skipped_dials_total",
+		Help:      "Number of dials skipped because the handshaked peers filter reported the peer as handshaked",
+	})
+
+	beaconPeersGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "beacon_peers",
+		Help:      "Number of peers the beacon node was connected to on the last poll of its peers",
+	})
+
+	beaconPeersKnown = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "beacon_peers_known",
+		Help:      "Number of peers of the beacon node that are in the sentry's peerstore, as of the last poll",
+	})
+
+	uniquePeersEstimate = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "unique_peers_estimate",
+		Help:      "HyperLogLog estimate of the number of distinct peers that connected during this run",
+	})
+
+	redials = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redials_total",
+		Help:      "Number of redials of handshaked peers that disconnected from us",
+	})
+
+	dialQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dial_queue_length",
+		Help:      "Number of discovered peers waiting to be dialed",
+	})
+
+	suspiciousPeerIPs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "suspicious_peer_ips_total",
+		Help:      "Number of suspicious_peer events, IPs that served more peer IDs than --suspicious-peer-threshold",
+	})
+
+	gossipPXPeers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "gossip_px_peers_total",
+		Help:      "Number of peers learned from gossipsub peer exchange, by result (reported, duplicate, invalid)",
+	}, []string{"result"})
+
+	eventSocketDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "event_socket_dropped_total",
+		Help:      "Number of events dropped because the --event-socket buffer was full",
+	})
+
+	handshakesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "handshakes_in_flight",
+		Help:      "Number of peers a handshake is running for",
+	})
+
+	duplicateHandshakes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "duplicate_handshakes_skipped_total",
+		Help:      "Number of connections not handshaked because a handshake was already running for the peer, by direction",
+	}, []string{"direction"})
+
+	peerForkDigests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "peer_fork_digests_total",
+		Help:      "Number of peer statuses on an accepted fork digest, by the fork digest the peer advertised",
+	}, []string{"fork_digest"})
+)
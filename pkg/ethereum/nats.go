@@ -2,61 +2,267 @@ package ethereum
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"os"
+	"slices"
 	"time"
 
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/log"
 	"github.com/chainbound/valtrack/types"
+	"github.com/chainbound/valtrack/version"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
-func createNatsStream(url string) (js jetstream.JetStream, err error) {
+// createNatsStream connects to NATS and creates the EVENTS stream. The returned buffer
+// keeps the events that fail to publish while the connection is down.
+func createNatsStream(url string, natsCfg *config.NatsConfig) (js jetstream.JetStream, buf *publishBuffer, err error) {
 	// If empty URL and empty env variable, return nil and run without NATS
+	url = natsURL(url)
 	if url == "" {
-		if os.Getenv("NATS_URL") == "" {
-			return nil, nil
-		}
-		url = os.Getenv("NATS_URL")
+		return nil, nil, nil
+	}
+	opts, err := natsCfg.Options()
+	if err != nil {
+		return nil, nil, err
 	}
+
+	buf = newPublishBuffer(natsCfg, log.NewLogger("nats"))
+	opts = append(opts, buf.options()...)
+
 	// Initialize NATS JetStream
-	nc, err := nats.Connect(url)
+	nc, err := nats.Connect(url, opts...)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to connect to NATS")
+		return nil, nil, errors.Wrap(err, "Failed to connect to NATS")
 	}
 
 	js, err = jetstream.New(nc)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create JetStream context")
+		return nil, nil, errors.Wrap(err, "Failed to create JetStream context")
+	}
+
+	buf.nc = nc
+	buf.js = js
+
+	retention, err := natsCfg.Stream.RetentionPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subjects := natsCfg.Stream.Subjects
+	if len(subjects) == 0 {
+		subjects = config.DefaultStreamSubjects
 	}
 
 	cfgjs := jetstream.StreamConfig{
 		Name:      "EVENTS",
-		Retention: jetstream.InterestPolicy,
-		Subjects:  []string{"events.metadata_received", "events.peer_discovered"},
+		Retention: retention,
+		Subjects:  subjects,
+		MaxAge:    natsCfg.Stream.MaxAge,
+		MaxBytes:  natsCfg.Stream.MaxBytes,
+		Replicas:  natsCfg.Stream.Replicas,
+		// Publishes with a message ID that was already seen within this window are dropped
+		Duplicates: natsCfg.DedupWindow,
+	}
+
+	if err := ensureStream(context.Background(), js, cfgjs); err != nil {
+		return nil, nil, err
+	}
+
+	return js, buf, nil
+}
+
+// natsURL returns the NATS URL to connect to, `url` or else the NATS_URL environment
+// variable. It's empty without NATS.
+func natsURL(url string) string {
+	if url == "" {
+		return os.Getenv("NATS_URL")
+	}
+	return url
+}
+
+// ensureStream creates the stream if it doesn't exist yet. If it exists with a different
+// configuration (e.g. because it was provisioned by hand), the differences are logged and
+// the stream is updated. If the update is refused, e.g. because the retention policy of a
+// stream can't be changed, we keep publishing to the existing stream.
+func ensureStream(ctx context.Context, js jetstream.JetStream, cfg jetstream.StreamConfig) error {
+	log := log.NewLogger("nats")
+
+	stream, err := js.Stream(ctx, cfg.Name)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		if _, err := js.CreateStream(ctx, cfg); err != nil {
+			return errors.Wrap(err, "Failed to create JetStream stream")
+		}
+
+		log.Info().Str("stream", cfg.Name).Strs("subjects", cfg.Subjects).Msg("Created JetStream stream")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to look up JetStream stream")
+	}
+
+	fields := streamConfigConflicts(stream.CachedInfo().Config, cfg)
+	if len(fields) == 0 {
+		return nil
 	}
 
-	ctxJs := context.Background()
+	log.Warn().Str("stream", cfg.Name).Strs("fields", fields).Msg("JetStream stream exists with a different configuration, updating it")
 
-	_, err = js.CreateOrUpdateStream(ctxJs, cfgjs)
+	if _, err := js.UpdateStream(ctx, cfg); err != nil {
+		log.Warn().Err(err).Str("stream", cfg.Name).Msg("Failed to update JetStream stream, keeping its existing configuration")
+	}
+
+	return nil
+}
+
+// streamConfigConflicts returns the names of the fields of the desired stream config that
+// differ from the existing one. Fields the server fills with a default are only compared
+// when we set them.
+func streamConfigConflicts(existing, desired jetstream.StreamConfig) []string {
+	var fields []string
+
+	if !slices.Equal(sortedSubjects(existing.Subjects), sortedSubjects(desired.Subjects)) {
+		fields = append(fields, "subjects")
+	}
+	if existing.Retention != desired.Retention {
+		fields = append(fields, "retention")
+	}
+	if existing.MaxAge != desired.MaxAge {
+		fields = append(fields, "max_age")
+	}
+	// The server stores unlimited as -1
+	if max(existing.MaxBytes, 0) != max(desired.MaxBytes, 0) {
+		fields = append(fields, "max_bytes")
+	}
+	if desired.Replicas != 0 && existing.Replicas != desired.Replicas {
+		fields = append(fields, "replicas")
+	}
+	if desired.Duplicates != 0 && existing.Duplicates != desired.Duplicates {
+		fields = append(fields, "duplicates")
+	}
+
+	return fields
+}
+
+func sortedSubjects(subjects []string) []string {
+	sorted := slices.Clone(subjects)
+	slices.Sort(sorted)
+	return sorted
+}
+
+// PublishEvent publishes an event encoded in the configured wire format, with its
+// deduplication ID. The format that was used is sent in the WireFormatHeader, and for the
+// compact format the crawler fields in the crawler headers. With Gzip, the payload is
+// compressed and the ContentEncodingHeader set. The bench command publishes its synthetic
+// events with it too, so they're encoded exactly like the sentry's.
+func PublishEvent(ctx context.Context, js jetstream.JetStream, subject string, cfg *config.NatsConfig, event interface{ MsgID() string }) (*jetstream.PubAck, error) {
+	data, format, err := types.Marshal(cfg.WireFormat, event)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create JetStream stream")
+		return nil, errors.Wrap(err, "failed to marshal event")
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(types.WireFormatHeader, string(format))
+
+	if cfg.Gzip {
+		if data, err = types.Gzip(data); err != nil {
+			return nil, errors.Wrap(err, "failed to compress event")
+		}
+		msg.Header.Set(types.ContentEncodingHeader, types.ContentEncodingGzip)
+	}
+
+	msg.Data = data
+
+	if format == types.WireFormatCompact {
+		msg.Header.Set(types.CrawlerIDHeader, getCrawlerMachineID())
+		msg.Header.Set(types.CrawlerLocationHeader, getCrawlerLocation())
+		msg.Header.Set(types.CrawlerVersionHeader, version.Short())
+	}
+
+	return js.PublishMsg(ctx, msg, jetstream.WithMsgID(event.MsgID()))
+}
+
+// publishNow publishes an event from the calling goroutine. It's meant for rare events
+// (heartbeats, snapshots), which are published right away instead of through a channel.
+func (n *Node) publishNow(subject string, event interface{ MsgID() string }) {
+	publishCtx, publishCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer publishCancel()
+
+	ack, err := n.publishBuf.publish(publishCtx, subject, event)
+	if err != nil {
+		n.log.Error().Err(err).Msgf("Failed to publish %s event", types.EventType(subject))
+		return
+	}
+
+	n.log.Trace().Msgf("Published %s event with seq: %v", types.EventType(subject), ack.Sequence)
+}
+
+// startPublisher starts runPublisher for ch. It's stopped by the buffer's close.
+func startPublisher[T interface{ MsgID() string }](ch <-chan T, subject string, buf *publishBuffer, log zerolog.Logger) {
+	buf.publishers.Add(1)
+	go func() {
+		defer buf.publishers.Done()
+		runPublisher(ch, subject, buf, log)
+	}()
+}
+
+// runPublisher publishes the events sent to ch until the buffer is closed and ch is empty.
+// The events that fail while NATS is disconnected are buffered, the others are dropped.
+func runPublisher[T interface{ MsgID() string }](ch <-chan T, subject string, buf *publishBuffer, log zerolog.Logger) {
+	name := types.EventType(subject)
+
+	for {
+		var event T
+		select {
+		case event = <-ch:
+		case <-buf.stop:
+			// Publish the events left in the channel
+			select {
+			case event = <-ch:
+			default:
+				return
+			}
+		}
+
+		publishCtx, publishCancel := context.WithTimeout(context.Background(), 3*time.Second)
+		ack, err := buf.publish(publishCtx, subject, event)
+		publishCancel()
+
+		if err != nil {
+			if buf.add(subject, event) {
+				log.Debug().Err(err).Msgf("Buffered %s event while disconnected from NATS", name)
+			} else if !errors.Is(err, ErrCircuitOpen) {
+				log.Error().Err(err).Msgf("Failed to publish %s event", name)
+			}
+			continue
+		}
+
+		if ack.Duplicate {
+			log.Debug().Str("id", event.MsgID()).Msgf("Dropped duplicate %s event", name)
+		} else {
+			log.Trace().Msgf("Published %s event with seq: %v", name, ack.Sequence)
+		}
 	}
-	return js, nil
 }
 
 func (n *Node) sendMetadataEvent(ctx context.Context, event *types.MetadataReceivedEvent) {
 	event.CrawlerID = getCrawlerMachineID()
 	event.CrawlerLoc = getCrawlerLocation()
+	event.CrawlerVer = version.Short()
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+	event.SchemaVersion = EventSchemaVersion
+	event.ObservedAt = time.Now().UnixMilli()
+	if n.beaconPeers != nil {
+		event.BeaconConnected = n.beaconPeers.Contains(event.ID)
+	}
 
-	json, _ := json.Marshal(event)
-	n.log.Info().Msgf("Succesful handshake: %s", string(json))
+	n.log.Info().Any("event", event).Msg("Succesful handshake")
 
 	if n.js == nil {
-		fmt.Fprintln(n.fileLogger, string(json))
+		n.fileLogger.Log().Str("type", types.EventMetadataReceived).Any("event", event).Send()
 		return
 	}
 
@@ -68,46 +274,82 @@ func (n *Node) sendMetadataEvent(ctx context.Context, event *types.MetadataRecei
 	}
 }
 
-func (n *Node) startMetadataPublisher() {
-	go func() {
-		for metadataEvent := range n.metadataEventChan {
-			publishCtx, publishCancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-			eventData, err := json.Marshal(metadataEvent)
-			if err != nil {
-				n.log.Error().Err(err).Msg("Failed to marshal metadata_received event")
-				publishCancel()
-				continue
-			}
+func (n *Node) sendAttnetsChangedEvent(ctx context.Context, event *types.AttnetsChangedEvent) {
+	event.CrawlerID = getCrawlerMachineID()
+	event.CrawlerLoc = getCrawlerLocation()
+	event.CrawlerVer = version.Short()
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+	event.SchemaVersion = EventSchemaVersion
 
-			ack, err := n.js.Publish(publishCtx, "events.metadata_received", eventData)
-			if err != nil {
-				n.log.Error().Err(err).Msg("Failed to publish metadata_received event")
-				publishCancel()
-				continue
-			}
-			n.log.Debug().Msgf("Published metadata_received event with seq: %v", ack.Sequence)
-			publishCancel()
-		}
-	}()
+	n.log.Info().Any("event", event).Msg("Peer changed attnets")
+
+	if n.js == nil {
+		n.fileLogger.Log().Str("type", types.EventAttnetsChanged).Any("event", event).Send()
+		return
+	}
+
+	select {
+	case n.attnetsEventChan <- event:
+		n.log.Trace().Str("peer", event.ID).Msg("Sent attnets_changed event to channel")
+	case <-ctx.Done():
+		n.log.Warn().Msg("Context cancelled before sending attnets_changed event to channel")
+	}
 }
 
-func (d *DiscoveryV5) sendPeerEvent(ctx context.Context, node *enode.Node, hInfo *HostInfo) {
+// sendHandshakeFailedEvent doesn't block: the handshake context has often expired by the
+// time a handshake fails, and failures can come in bursts. Events are dropped instead when
+// the publisher falls behind.
+func (n *Node) sendHandshakeFailedEvent(event *types.HandshakeFailedEvent) {
+	event.CrawlerID = getCrawlerMachineID()
+	event.CrawlerLoc = getCrawlerLocation()
+	event.CrawlerVer = version.Short()
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+	event.SchemaVersion = EventSchemaVersion
+
+	if n.js == nil {
+		n.fileLogger.Log().Str("type", types.EventHandshakeFailed).Any("event", event).Send()
+		return
+	}
+
+	select {
+	case n.handshakeFailedChan <- event:
+		n.log.Trace().Str("peer", event.ID).Msg("Sent handshake_failed event to channel")
+	default:
+		n.dialAddrLog.Warn().Msg("Channel full, dropped handshake_failed event")
+	}
+}
+
+// sendPeerEvent reports a discovered peer. prevSeq is the sequence number of the ENR the
+// peer was discovered with before, or 0 on its first discovery.
+func (d *DiscoveryV5) sendPeerEvent(ctx context.Context, node *enode.Node, hInfo *HostInfo, prevSeq uint64) {
+	now := time.Now().UnixMilli()
 	peerEvent := &types.PeerDiscoveredEvent{
-		ENR:        node.String(),
-		ID:         hInfo.ID.String(),
-		IP:         hInfo.IP,
-		Port:       hInfo.Port,
-		CrawlerID:  getCrawlerMachineID(),
-		CrawlerLoc: getCrawlerLocation(),
-		Timestamp:  time.Now().UnixMilli(),
+		ENR:           node.String(),
+		ID:            hInfo.ID.String(),
+		IP:            hInfo.IP,
+		Port:          hInfo.Port,
+		IPVersion:     ipVersion(hInfo.IP),
+		Source:        types.SourceDiscv5,
+		EnrSeq:        int64(node.Seq()),
+		PrevEnrSeq:    int64(prevSeq),
+		Distance:      enode.LogDist(d.Dv5Listener.Self().ID(), node.ID()),
+		CrawlerID:     getCrawlerMachineID(),
+		CrawlerLoc:    getCrawlerLocation(),
+		CrawlerVer:    version.Short(),
+		Timestamp:     now,
+		SchemaVersion: EventSchemaVersion,
+		ObservedAt:    now,
 	}
+	peerEvent.ClockOffsetMs, peerEvent.ClockSynced = getClockOffset()
+	if d.beaconPeers != nil {
+		peerEvent.BeaconConnected = d.beaconPeers.Contains(peerEvent.ID)
+	}
+	redactPeerDiscovered(&d.redaction, peerEvent)
 
-	json, _ := json.Marshal(peerEvent)
-	d.log.Info().Msgf("Discovered peer: %s", string(json))
+	d.log.Info().Any("event", peerEvent).Msg("Discovered peer")
 
 	if d.js == nil {
-		fmt.Fprintln(d.fileLogger, string(json))
+		d.fileLogger.Log().Str("type", types.EventPeerDiscovered).Any("event", peerEvent).Send()
 		return
 	}
 
@@ -118,27 +360,3 @@ func (d *DiscoveryV5) sendPeerEvent(ctx context.Context, node *enode.Node, hInfo
 		d.log.Warn().Msg("Context cancelled before sending peer_discovered event to channel")
 	}
 }
-
-func (disc *DiscoveryV5) startDiscoveryPublisher() {
-	go func() {
-		for discoveryEvent := range disc.discEventChan {
-			publishCtx, publishCancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-			eventData, err := json.Marshal(discoveryEvent)
-			if err != nil {
-				disc.log.Error().Err(err).Msg("Failed to marshal peer_discovered event")
-				publishCancel()
-				continue
-			}
-
-			ack, err := disc.js.Publish(publishCtx, "events.peer_discovered", eventData)
-			if err != nil {
-				disc.log.Error().Err(err).Msg("Failed to publish peer_discovered event")
-				publishCancel()
-				continue
-			}
-			disc.log.Debug().Msgf("Published peer_discovered event with seq: %v", ack.Sequence)
-			publishCancel()
-		}
-	}()
-}
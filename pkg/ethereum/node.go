@@ -3,24 +3,30 @@ package ethereum
 import (
 	"context"
 	"fmt"
-	"os"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chainbound/valtrack/config"
 	"github.com/chainbound/valtrack/log"
 	"github.com/chainbound/valtrack/types"
+	"github.com/chainbound/valtrack/version"
 	gcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/libp2p/go-libp2p"
 	mplex "github.com/libp2p/go-libp2p-mplex"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	gomplex "github.com/libp2p/go-mplex"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/prysm/v5/beacon-chain/p2p/encoder"
@@ -48,45 +54,231 @@ type Node struct {
 	reqResp           *ReqResp
 	disc              *DiscoveryV5
 	js                jetstream.JetStream
+	publishBuf        *publishBuffer
 	log               zerolog.Logger
-	fileLogger        *os.File
+	dialAddrLog       zerolog.Logger
+	fileLogger        zerolog.Logger
+	fileLogCloser     io.Closer
 	metadataEventChan chan *types.MetadataReceivedEvent
-	reconnectChan     chan peer.AddrInfo
+	attnetsEventChan  chan *types.AttnetsChangedEvent
+	// handshakeFailedChan is only used with RecordHandshakeFailures or RecordForkMismatches
+	handshakeFailedChan chan *types.HandshakeFailedEvent
+	suspiciousPeerChan  chan *types.SuspiciousPeerEvent
+	peerChurnChan       chan *types.PeerChurnEvent
+	pxPeerChan          chan *types.PeerDiscoveredEvent
+	reconnectChan       chan peer.AddrInfo
+	evictionPolicy      EvictionPolicy
+	peerCache           *PeerCache
+	stats               *crawlStats
+	// discoverer finds the peers to dial. disc is only set when it's the discv5 walk.
+	discoverer Discoverer
+	// redialer is only set with RedialOnDisconnect
+	redialer *redialer
+	// handshaked is only set with ExpectedPeers
+	handshaked *peerFilter
+	// uniquePeers is only set with UniquePeersPrecision
+	uniquePeers *peerHLL
+	// beaconPeers is only set with BeaconAPI and BeaconPeersInterval
+	beaconPeers *beaconPeers
+	// ipTracker is only set with SuspiciousPeerThreshold
+	ipTracker *ipTracker
+	// pxCollector is only set with GossipPX
+	pxCollector *pxCollector
+	// handshaking holds the peers a handshake is running for
+	handshaking *inFlight
+	// dialAttempts holds the dials waiting for a handshake to try the next address
+	dialAttempts *dialAttempts
+	// forkDigests are the fork digests peers are accepted on, ForkDigest first
+	forkDigests [][4]byte
+	// stopping is set once the node is shutting down
+	stopping atomic.Bool
 }
 
-// NewNode initializes a new Node using the provided configuration and options.
-func NewNode(cfg *config.NodeConfig) (*Node, error) {
-	log := log.NewLogger("node")
+// eventSocketBufferSize is the number of events queued for the sidecar while it's
+// disconnected or falls behind.
+const eventSocketBufferSize = 10_000
 
-	file, err := os.Create(cfg.LogPath)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create log file")
+// NewNode initializes a new Node using the provided configuration and options. Peers are
+// found with `discoverer`, or if nil, from the peers file or the discv5 walk.
+func NewNode(cfg *config.NodeConfig, discoverer Discoverer) (*Node, error) {
+	if !cfg.AcceptInbound && !cfg.DialOutbound {
+		return nil, errors.New("at least one of inbound and outbound connections must be enabled")
+	}
+
+	if cfg.ExpectedPeers > 0 && (cfg.PeerFilterFPRate <= 0 || cfg.PeerFilterFPRate >= 1) {
+		return nil, errors.Errorf("peer filter false positive rate must be between 0 and 1, got %v", cfg.PeerFilterFPRate)
+	}
+
+	if cfg.DialAddrsPerPeer < 1 {
+		return nil, errors.Errorf("dial addresses per peer must be at least 1, got %d", cfg.DialAddrsPerPeer)
+	}
+
+	if cfg.SuspiciousPeerThreshold > 0 && cfg.SuspiciousPeerWindow <= 0 {
+		return nil, errors.New("suspicious peer window must be positive")
+	}
+
+	if cfg.PeerstoreGCInterval > 0 && (cfg.PeerstoreAddrTTL <= 0 || cfg.PeerstoreRecordTTL <= 0) {
+		return nil, errors.New("peerstore TTLs must be positive")
+	}
+
+	// Events are only written to the socket without NATS
+	if cfg.EventSocket != "" && natsURL(cfg.NatsURL) != "" {
+		return nil, errors.New("the event socket can't be combined with NATS")
+	}
+
+	var (
+		fileLogger    zerolog.Logger
+		fileLogCloser io.Closer
+		eventSocket   *log.SocketWriter
+		err           error
+	)
+	if cfg.EventSocket != "" {
+		eventSocket, err = log.NewSocketWriter(cfg.EventSocket, eventSocketBufferSize, eventSocketDropped.Inc)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to listen on the event socket")
+		}
+		fileLogger, _ = log.NewWriterLogger(eventSocket)
+		fileLogCloser = eventSocket
+	} else {
+		// An empty path writes nothing
+		logPath := cfg.LogPath
+		if cfg.DisableFileLog {
+			logPath = ""
+		}
+
+		fileLogger, fileLogCloser, err = log.NewFileLogger(logPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create log file")
+		}
 	}
 
+	log := log.NewLogger("node")
+
 	data, err := cfg.PrivateKey.Raw()
 	discKey, _ := gcrypto.ToECDSA(data)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate discv5 key")
 	}
 
-	peerstore := NewPeerstore(30 * time.Second)
+	evictionPolicy, err := NewEvictionPolicy(cfg.EvictionPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same subnets are advertised in the ENR and the metadata
+	attnets, err := attnetsBitfield(cfg.Attnets)
+	if err != nil {
+		return nil, err
+	}
+
+	syncnets, err := syncnetsBitfield(cfg.Syncnets)
+	if err != nil {
+		return nil, err
+	}
+
+	peerstore := NewPeerstore(30*time.Second, cfg.MetadataCacheSize, cfg.BackoffCacheSize)
+
+	var peerCache *PeerCache
+	if cfg.CachePath != "" {
+		if peerCache, err = OpenPeerCache(cfg.CachePath, cfg.CacheTTL); err != nil {
+			return nil, err
+		}
+
+		restored, err := peerstore.Restore(peerCache)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load peer cache")
+		}
+
+		log.Info().Str("path", cfg.CachePath).Int("peers", restored).Msg("Restored peers from cache")
+	}
+
+	forkDigests, err := acceptedForkDigests(cfg, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Strs("fork_digests", forkDigestStrings(forkDigests)).Msg("Accepting peers on fork digests")
+
+	if cfg.Redaction.Enabled() {
+		log.Info().Str("ip", cfg.Redaction.IP).Str("enr", cfg.Redaction.ENR).Str("port", cfg.Redaction.Port).Msg("Redacting peer_discovered events")
+	}
+
+	var (
+		disc        *DiscoveryV5
+		staticPeers []*StaticPeer
+		// bPeers is shared with the discv5 walk, to tag the peers it discovers
+		bPeers *beaconPeers
+	)
+	if cfg.BeaconAPI != "" && cfg.BeaconPeersInterval > 0 {
+		bPeers = newBeaconPeers()
+	}
+
+	switch {
+	case discoverer != nil:
+		log.Info().Msg("Using custom peer discoverer")
+
+	case cfg.PeersFile != "":
+		if staticPeers, err = LoadStaticPeers(cfg.PeersFile); err != nil {
+			return nil, err
+		}
+
+		if len(staticPeers) == 0 {
+			return nil, fmt.Errorf("no peers in peers file %s", cfg.PeersFile)
+		}
+
+		log.Info().Str("path", cfg.PeersFile).Int("peers", len(staticPeers)).Msg("Loaded static peers, discv5 walk disabled")
+
+	default:
+		// TODO: read config from node config
+		conf := config.DefaultDiscConfig
+		conf.NatsURL = cfg.NatsURL
+		conf.Nats = cfg.Nats
+		conf.LogPath = cfg.DiscLogPath
+		if cfg.DisableFileLog {
+			conf.LogPath = ""
+		}
+		if eventSocket != nil {
+			conf.EventWriter = eventSocket
+		}
+		conf.DialStrategy = cfg.DialStrategy
+		conf.DiscoveryDedupWindow = cfg.DiscoveryDedupWindow
+		conf.WatchdogWindow = cfg.DiscoveryWatchdog
+		conf.Attnets = attnets.Bytes()
+		conf.Syncnets = syncnets.Bytes()
+		conf.Redaction = cfg.Redaction
+		conf.AcceptedForkDigests = forkDigests[1:]
+		disc, err = NewDiscoveryV5(discKey, &conf)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create DiscoveryV5 service")
+		}
+		disc.beaconPeers = bPeers
 
-	// TODO: read config from node config
-	conf := config.DefaultDiscConfig
-	conf.NatsURL = cfg.NatsURL
-	disc, err := NewDiscoveryV5(discKey, &conf)
+		discoverer = disc
+	}
+
+	// Listen on the configured multiaddrs, or on the IP and port otherwise
+	listenMaddrs, err := ParseMaddrs(cfg.ListenAddrs)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create DiscoveryV5 service")
+		return nil, fmt.Errorf("invalid listen address: %w", err)
 	}
 
-	listenMaddr, err := MaddrFrom(cfg.IP, uint(cfg.Port))
+	if len(listenMaddrs) == 0 {
+		listenMaddr, err := MaddrFrom(cfg.IP, uint(cfg.Port))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create multiaddr: %w", err)
+		}
+
+		listenMaddrs = append(listenMaddrs, listenMaddr)
+	}
+
+	announceMaddrs, err := ParseMaddrs(cfg.AnnounceAddrs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create multiaddr: %w", err)
+		return nil, fmt.Errorf("invalid announce address: %w", err)
 	}
 
 	gomplex.ResetStreamTimeout = 5 * time.Second
 	opts := []libp2p.Option{
-		libp2p.ListenAddrs(listenMaddr),
+		libp2p.ListenAddrs(listenMaddrs...),
 		libp2p.Identity(cfg.PrivateKey),
 		libp2p.UserAgent("valtrack"),
 		libp2p.Transport(tcp.NewTCPTransport),
@@ -97,19 +289,46 @@ func NewNode(cfg *config.NodeConfig) (*Node, error) {
 		libp2p.DisableMetrics(),
 	}
 
+	if len(announceMaddrs) > 0 {
+		// Advertise the announce addresses instead of the addresses we listen on
+		opts = append(opts, libp2p.AddrsFactory(func([]ma.Multiaddr) []ma.Multiaddr {
+			return announceMaddrs
+		}))
+	}
+
+	rm, err := newResourceManager(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource manager: %w", err)
+	}
+	opts = append(opts, libp2p.ResourceManager(rm))
+
+	if cfg.EnableNAT {
+		// Try to open a port on the router with UPnP or NAT-PMP
+		opts = append(opts, libp2p.NATPortMap())
+	}
+
 	// Create a new libp2p Host
 	h, err := libp2p.New(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create libp2p host: %w", err)
 	}
 
-	log.Info().Any("listen_addrs", h.Network().ListenAddresses()).Msg("Created new libp2p host")
+	log.Info().Any("listen_addrs", h.Network().ListenAddresses()).Any("announce_addrs", h.Addrs()).Bool("nat", cfg.EnableNAT).Msg("Created new libp2p host")
+
+	if staticPeers != nil {
+		// Only redial static peers we aren't connected or connecting to
+		discoverer = NewStaticDiscoverer(staticPeers, func(id peer.ID) bool {
+			return h.Network().Connectedness(id) == network.Connected || peerstore.State(id) == Connecting
+		})
+	}
 
 	reqRespCfg := &ReqRespConfig{
 		ForkDigest:   cfg.ForkDigest,
 		Encoder:      encoder.SszNetworkEncoder{},
 		ReadTimeout:  cfg.BeaconConfig.TtfbTimeoutDuration(),
 		WriteTimeout: cfg.BeaconConfig.RespTimeoutDuration(),
+		Attnets:      attnets,
+		Syncnets:     syncnets,
 	}
 
 	// Initialize ReqResp
@@ -118,27 +337,99 @@ func NewNode(cfg *config.NodeConfig) (*Node, error) {
 		return nil, fmt.Errorf("failed to create reqresp: %w", err)
 	}
 
-	js, err := createNatsStream(cfg.NatsURL)
+	js, publishBuf, err := createNatsStream(cfg.NatsURL, &cfg.Nats)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create NATS JetStream")
 	}
 
 	// Log the node's peer ID and addresses
-	log.Info().Str("peer_id", h.ID().String()).Any("Maddr", h.Addrs()).Msg("Initialized new libp2p Host")
+	maxPeers.Set(float64(cfg.MaxPeers))
+
+	log.Info().Str("peer_id", h.ID().String()).Any("Maddr", h.Addrs()).Str("version", version.Short()).Msg("Initialized new libp2p Host")
+
+	var handshaked *peerFilter
+	if cfg.ExpectedPeers > 0 {
+		handshaked = newPeerFilter(cfg.ExpectedPeers, cfg.PeerFilterFPRate)
+	}
+
+	var uniquePeers *peerHLL
+	if cfg.UniquePeersPrecision > 0 {
+		if uniquePeers, err = newPeerHLL(cfg.UniquePeersPrecision); err != nil {
+			return nil, err
+		}
+	}
+
+	var redialer *redialer
+	// Redials are outbound connections
+	if cfg.RedialOnDisconnect && cfg.DialOutbound {
+		redialer = newRedialer(cfg.MetadataCacheSize, cfg.MaxRedials)
+	}
+
+	var tracker *ipTracker
+	if cfg.SuspiciousPeerThreshold > 0 {
+		tracker = newIPTracker(cfg.SuspiciousPeerThreshold, cfg.SuspiciousPeerWindow)
+	}
 
 	// Return the fully initialized Node
-	return &Node{
-		host:              h,
-		cfg:               cfg,
-		reqResp:           reqResp,
-		disc:              disc,
-		js:                js,
-		log:               log,
-		fileLogger:        file,
-		peerstore:         peerstore,
-		metadataEventChan: make(chan *types.MetadataReceivedEvent, 100),
-		reconnectChan:     make(chan peer.AddrInfo, 100),
-	}, nil
+	n := &Node{
+		host:                h,
+		cfg:                 cfg,
+		reqResp:             reqResp,
+		disc:                disc,
+		js:                  js,
+		publishBuf:          publishBuf,
+		log:                 log,
+		dialAddrLog:         log.Sample(&zerolog.BurstSampler{Burst: 1, Period: time.Minute}),
+		fileLogger:          fileLogger,
+		fileLogCloser:       fileLogCloser,
+		peerstore:           peerstore,
+		metadataEventChan:   make(chan *types.MetadataReceivedEvent, 100),
+		attnetsEventChan:    make(chan *types.AttnetsChangedEvent, 100),
+		handshakeFailedChan: make(chan *types.HandshakeFailedEvent, 100),
+		suspiciousPeerChan:  make(chan *types.SuspiciousPeerEvent, 100),
+		peerChurnChan:       make(chan *types.PeerChurnEvent, 1000),
+		pxPeerChan:          make(chan *types.PeerDiscoveredEvent, 100),
+		reconnectChan:       make(chan peer.AddrInfo, 100),
+		evictionPolicy:      evictionPolicy,
+		peerCache:           peerCache,
+		stats:               newCrawlStats(),
+		discoverer:          discoverer,
+		redialer:            redialer,
+		handshaked:          handshaked,
+		uniquePeers:         uniquePeers,
+		ipTracker:           tracker,
+		handshaking:         newInFlight(),
+		dialAttempts:        newDialAttempts(),
+		forkDigests:         forkDigests,
+		beaconPeers:         bPeers,
+	}
+
+	if cfg.GossipPX {
+		n.pxCollector = newPXCollector(cfg.MetadataCacheSize, cfg.DiscoveryDedupWindow, n.sendPXPeerEvent)
+	}
+
+	return n, nil
+}
+
+// DiscoveredNodes returns a channel with every node found by the discv5 walk. It is nil
+// when peers are found with another discoverer.
+func (n *Node) DiscoveredNodes() <-chan *enode.Node {
+	if n.disc == nil {
+		return nil
+	}
+
+	return n.disc.Nodes()
+}
+
+// lookupENR returns the ENR of a peer, if the discoverer knows it.
+func (n *Node) lookupENR(pid peer.ID) enode.Node {
+	if resolver, ok := n.discoverer.(ENRResolver); ok {
+		if node, ok := resolver.ENR(pid); ok {
+			return node
+		}
+	}
+
+	return enode.Node{}
 }
 
 func (n *Node) CanSubscribe(topic string) bool {
@@ -179,6 +470,8 @@ func (n *Node) Start(ctx context.Context) error {
 	}
 
 	n.reqResp.SetStatus(status)
+	// Start with a current head rather than the genesis
+	n.refreshStatus(ctx)
 
 	// Set stream handlers on our libp2p host
 	if err := n.reqResp.RegisterHandlers(ctx); err != nil {
@@ -187,24 +480,90 @@ func (n *Node) Start(ctx context.Context) error {
 
 	n.log.Info().Msg("Starting node services")
 
+	self := n.Self()
+	n.log.Info().
+		Str("peer_id", self.PeerID).
+		Str("enr", self.ENR).
+		Str("fork_digest", self.ForkDigest).
+		Strs("listen_addrs", self.ListenAddrs).
+		Strs("announce_addrs", self.AnnounceAddrs).
+		Msg("Local node")
+
 	// Register the node itself as the notifiee for network connection events
 	n.host.Network().Notify(n)
 
+	if n.cfg.NTPServer != "" {
+		go runClockSync(ctx, n.cfg.NTPServer, n.log)
+	}
+
+	if n.cfg.DiversityInterval > 0 {
+		go n.runDiversitySampler(ctx)
+	}
+
+	if n.cfg.HeartbeatInterval > 0 {
+		go n.runHeartbeat(ctx)
+	}
+
+	if n.disc != nil && n.cfg.DiscTablePath != "" && n.cfg.DiscTableInterval > 0 {
+		go n.runDiscTableSnapshots(ctx)
+	}
+
+	if n.cfg.StatusInterval > 0 {
+		go n.runStatusRefresher(ctx)
+	}
+
+	if n.beaconPeers != nil {
+		go n.runBeaconPeersPoller(ctx)
+	}
+
+	if n.cfg.PeerstoreGCInterval > 0 {
+		go n.runPeerstoreGC(ctx)
+	}
+
 	if n.js != nil {
-		// Start the metadata event publisher
-		n.startMetadataPublisher()
+		// Start the metadata event publishers
+		startPublisher(n.metadataEventChan, types.SubjectMetadataReceived, n.publishBuf, n.log)
+		startPublisher(n.attnetsEventChan, types.SubjectAttnetsChanged, n.publishBuf, n.log)
+
+		if n.cfg.RecordHandshakeFailures || n.cfg.RecordForkMismatches {
+			startPublisher(n.handshakeFailedChan, types.SubjectHandshakeFailed, n.publishBuf, n.log)
+		}
+
+		if n.ipTracker != nil {
+			startPublisher(n.suspiciousPeerChan, types.SubjectSuspiciousPeer, n.publishBuf, n.log)
+		}
+
+		if n.cfg.PeerChurnEvents {
+			startPublisher(n.peerChurnChan, types.SubjectPeerChurn, n.publishBuf, n.log)
+		}
+
+		if n.pxCollector != nil {
+			startPublisher(n.pxPeerChan, types.SubjectPeerDiscovered, n.publishBuf, n.log)
+		}
 	}
 	// Start the discovery service
-	go n.runDiscovery(ctx)
+	discDone := make(chan struct{})
+	go func() {
+		defer close(discDone)
+		n.runDiscovery(ctx)
+	}()
 
-	// Start the peer dialer service
-	for i := 0; i < n.cfg.ConcurrentDialers; i++ {
-		go n.runPeerDialer(ctx)
-	}
+	if n.cfg.DialOutbound {
+		// Start the peer dialer service
+		for i := 0; i < n.cfg.ConcurrentDialers; i++ {
+			go n.runPeerDialer(ctx, n.discoverer.Peers())
+		}
 
-	// Start the timer function to attempt reconnections every 30 seconds
-	go n.startReconnectionTimer()
-	n.startReconnectListener()
+		// Start the timer function to attempt reconnections every 30 seconds
+		go n.startReconnectionTimer()
+		n.startReconnectListener()
+	} else {
+		// Discovery keeps reporting peers, but we don't dial them
+		go func() {
+			for range n.discoverer.Peers() {
+			}
+		}()
+	}
 
 	psOpts := []pubsub.Option{
 		pubsub.WithMessageSignaturePolicy(pubsub.StrictNoSign),
@@ -222,6 +581,12 @@ func (n *Node) Start(ctx context.Context) error {
 		// pubsub.WithRawTracer(gossipTracer{host: s.host}),
 	}
 
+	if n.pxCollector != nil {
+		// We don't subscribe to any topic, PX records only come with the PRUNEs peers send us.
+		// The PX peers gossipsub connects to are handshaked like any other inbound peer.
+		psOpts = append(psOpts, pubsub.WithPeerExchange(true), pubsub.WithRawTracer(n.pxCollector))
+	}
+
 	gs, err := pubsub.NewGossipSub(ctx, n.host, psOpts...)
 	if err != nil {
 		return errors.Wrap(err, "failed to create GossipSub")
@@ -230,22 +595,70 @@ func (n *Node) Start(ctx context.Context) error {
 	n.gs = gs
 
 	<-ctx.Done()
+	n.stopping.Store(true)
 	n.log.Info().Msg("Shutting down node services")
 
+	n.discoverer.Stop()
+	<-discDone
+
+	// Don't redial the peers we are about to say goodbye to
+	if n.redialer != nil {
+		n.redialer.close()
+	}
+
+	if n.cfg.KeepConnected {
+		n.disconnectAll()
+	}
+
+	// Publish the events left, including the goodbyes' churn events, before closing NATS
+	if n.publishBuf != nil {
+		n.publishBuf.close()
+	}
+
+	if err := n.fileLogCloser.Close(); err != nil {
+		n.log.Error().Err(err).Msg("Failed to close log file")
+	}
+
+	if n.peerCache != nil {
+		if err := n.peerCache.Close(); err != nil {
+			n.log.Error().Err(err).Msg("Failed to close peer cache")
+		}
+	}
+
 	return nil
 }
 
+// disconnectAll says goodbye to all connected peers and closes their connections.
+func (n *Node) disconnectAll() {
+	var wg sync.WaitGroup
+
+	for _, pid := range n.host.Network().Peers() {
+		wg.Add(1)
+		go func(pid peer.ID) {
+			defer wg.Done()
+			n.goodbyeAndClose(pid, ErrShuttingDown)
+		}(pid)
+	}
+
+	wg.Wait()
+}
+
 func (n *Node) runDiscovery(ctx context.Context) {
-	if err := n.disc.Serve(ctx); err != nil && ctx.Err() == nil {
-		n.log.Error().Err(err).Msg("DiscoveryV5 service stopped unexpectedly")
+	if err := n.discoverer.Start(ctx); err != nil && ctx.Err() == nil {
+		n.log.Error().Err(err).Msg("Discovery service stopped unexpectedly")
 	}
 }
 
-func (n *Node) runPeerDialer(ctx context.Context) {
+func (n *Node) runPeerDialer(ctx context.Context, peerChan <-chan peer.AddrInfo) {
 	cs := &PeerDialer{
-		host:     n.host,
-		peerChan: n.disc.out,
-		log:      log.NewLogger("peer_dialer"),
+		host:         n.host,
+		peerstore:    n.peerstore,
+		peerChan:     peerChan,
+		handshaked:   n.handshaked,
+		dialTimeout:  n.cfg.DialTimeout,
+		addrsPerPeer: n.cfg.DialAddrsPerPeer,
+		attempts:     n.dialAttempts,
+		log:          log.NewLogger("peer_dialer"),
 	}
 	if err := cs.Serve(ctx); err != nil && ctx.Err() == nil {
 		n.log.Error().Err(err).Msg("PeerDialer service stopped unexpectedly")
@@ -272,9 +685,11 @@ func (n *Node) startReconnectListener() {
 		for info := range n.reconnectChan {
 			go func() {
 				ctx, cancel := context.WithTimeout(context.Background(), n.cfg.DialTimeout)
-				err := n.host.Connect(ctx, info)
+				err := connectAddrs(ctx, n.host, info, n.cfg.DialAddrsPerPeer, n.dialAttempts)
 				cancel()
 
+				// Only back off once all addresses failed to connect, a failed handshake on the
+				// last one backs the peer off itself
 				if err != nil {
 					counter := n.peerstore.SetBackoff(info.ID, err)
 
@@ -1,31 +1,58 @@
 package ethereum
 
 import (
-	"bytes"
 	"context"
+	"fmt"
+	"slices"
 	"time"
 
+	"github.com/chainbound/valtrack/types"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
 )
 
 var _ network.Notifiee = (*Node)(nil)
 
+const (
+	// inboundStatusTimeout is how long we wait for an inbound peer to send its status.
+	inboundStatusTimeout = 5 * time.Second
+	// statusPollInterval is how often we check for the status of an inbound peer, and
+	// whether it's still connected.
+	statusPollInterval = 100 * time.Millisecond
+)
+
 func (n *Node) Connected(net network.Network, c network.Conn) {
 	pid := c.RemotePeer()
 
+	n.observePeerAddr(pid, c.RemoteMultiaddr())
+	n.observeChurn(net, c, types.ChurnConnected)
+
+	if n.uniquePeers != nil && n.uniquePeers.Add(pid) {
+		uniquePeersEstimate.Set(float64(n.uniquePeers.Estimate()))
+	}
+
 	if n.peerstore.State(pid) != NotConnected {
 		// If we're already connecting, return
 		n.log.Debug().Str("peer", pid.String()).Msg("Already connecting to peer")
 		return
 	}
 
-	info := n.disc.seenNodes[pid]
+	if c.Stat().Direction == network.DirInbound && !n.cfg.AcceptInbound {
+		n.log.Debug().Str("peer", pid.String()).Msg("Not accepting inbound connections, disconnecting")
+		// Too many peers is the goodbye reason clients don't penalize us for
+		go n.goodbyeAndClose(pid, ErrTooManyPeers)
+		return
+	}
+
+	if !n.enforcePeerLimit(net, c) {
+		return
+	}
 
 	// Insert into the peerstore
-	n.peerstore.Insert(pid, c.RemoteMultiaddr(), info.Node)
+	n.peerstore.Insert(pid, c.RemoteMultiaddr(), n.lookupENR(pid))
 	n.peerstore.SetState(pid, Connecting)
 
 	n.log.Info().
@@ -45,7 +72,102 @@ func (n *Node) Connected(net network.Network, c network.Conn) {
 func (n *Node) Disconnected(net network.Network, c network.Conn) {
 	pid := c.RemotePeer()
 
+	connectedPeers.Set(float64(len(net.Peers())))
+	n.observeChurn(net, c, types.ChurnDisconnected)
+
 	n.log.Info().Str("peer", pid.String()).Msg("Peer disconnected")
+
+	if n.redialer != nil && net.Connectedness(pid) != network.Connected {
+		n.scheduleRedial(pid)
+	}
+}
+
+// enforcePeerLimit makes room for the new connection if the node is above its peer limit,
+// using the configured eviction policy. It returns false if the new connection was rejected.
+func (n *Node) enforcePeerLimit(net network.Network, c network.Conn) bool {
+	peers := net.Peers()
+	connectedPeers.Set(float64(len(peers)))
+
+	if n.cfg.MaxPeers <= 0 || len(peers) <= n.cfg.MaxPeers {
+		return true
+	}
+
+	pid := c.RemotePeer()
+
+	candidates := make([]EvictionCandidate, 0, len(peers))
+	for _, conn := range net.Conns() {
+		remote := conn.RemotePeer()
+		if remote == pid {
+			continue
+		}
+
+		candidates = append(candidates, EvictionCandidate{
+			ID:          remote,
+			Opened:      conn.Stat().Opened,
+			LastSeen:    n.peerstore.LastSeen(remote),
+			Handshaking: n.peerstore.State(remote) == Connecting,
+		})
+	}
+
+	victim, ok := n.evictionPolicy.SelectVictim(candidates)
+	if !ok {
+		n.log.Info().
+			Str("peer", pid.String()).
+			Str("dir", c.Stat().Direction.String()).
+			Int("peers", len(peers)).
+			Int("max_peers", n.cfg.MaxPeers).
+			Msg("At peer limit, rejecting connection")
+
+		peerEvictions.WithLabelValues("rejected").Inc()
+		go n.goodbyeAndClose(pid, ErrTooManyPeers)
+
+		return false
+	}
+
+	n.log.Info().
+		Str("peer", victim.String()).
+		Str("new_peer", pid.String()).
+		Int("peers", len(peers)).
+		Int("max_peers", n.cfg.MaxPeers).
+		Msg("At peer limit, evicting peer")
+
+	peerEvictions.WithLabelValues("evicted").Inc()
+	go n.goodbyeAndClose(victim, ErrTooManyPeers)
+
+	return true
+}
+
+// goodbyeAndClose sends a goodbye message to the peer and closes the connection. The reason
+// code is derived from `cause` (nil when the handshake succeeded), or is a client shutdown
+// once the node is stopping, since that's what interrupted the handshake.
+func (n *Node) goodbyeAndClose(pid peer.ID, cause error) {
+	if n.stopping.Load() {
+		cause = ErrShuttingDown
+	}
+	code := goodbyeCode(cause)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// Close the connection even if the goodbye fails
+	defer n.host.Network().ClosePeer(pid)
+
+	if n.redialer != nil {
+		n.redialer.expectDisconnect(pid)
+	}
+
+	err := n.reqResp.Goodbye(ctx, pid, code)
+	if err == nil {
+		return
+	}
+
+	if goodbyePeerGone(err) || n.host.Network().Connectedness(pid) != network.Connected {
+		n.log.Debug().Str("peer", pid.String()).Err(err).Msg("Peer disconnected before goodbye message was sent")
+		return
+	}
+
+	goodbyesFailed.Inc()
+	n.log.Warn().Str("peer", pid.String()).Uint64("code", code).Err(err).Msg("Failed to send goodbye message")
 }
 
 func (n *Node) Listen(net network.Network, maddr ma.Multiaddr) {}
@@ -53,44 +175,80 @@ func (n *Node) Listen(net network.Network, maddr ma.Multiaddr) {}
 func (n *Node) ListenClose(net network.Network, maddr ma.Multiaddr) {}
 
 func (n *Node) handleOutboundConnection(pid peer.ID) {
+	if !n.handshaking.start(pid) {
+		duplicateHandshakes.WithLabelValues(types.DirectionOutbound).Inc()
+		n.log.Debug().Str("peer", pid.String()).Msg("Handshake already running for peer, skipping")
+		return
+	}
+
+	var handshakeErr error
+
+	// Once the connection is closed and the handshake is done, let the dialer try the peer's
+	// next address if it failed
+	defer func() {
+		n.handshaking.done(pid)
+		if handshakeErr != nil {
+			n.dialAttempts.finish(pid, handshakeErr)
+		}
+	}()
+
+	// With more addresses to dial, a failed handshake doesn't back the peer off yet
+	retried := n.dialAttempts.handshakeStarted(pid)
+
 	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.DialTimeout)
 	defer cancel()
 
 	// Cleanup function
 	defer func() {
 		// Mark the peer as succesfully connected, which will reset the backoff
-		// and error to nil.
-		n.peerstore.Reset(pid)
+		// and error to nil. A failed handshake keeps the peer backed off.
+		if handshakeErr == nil {
+			n.peerstore.Reset(pid)
+		} else {
+			n.peerstore.EndFailedHandshake(pid)
+		}
 
 		// Don't do anything if we're already disconnected
 		if n.host.Network().Connectedness(pid) != network.Connected {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-
-		err := n.reqResp.Goodbye(ctx, pid, 3) // NOTE: Figure out the correct reason code
-		if err != nil {
-			n.log.Debug().Str("peer", pid.String()).Err(err).Msg("Failed to send goodbye message")
+		if handshakeErr == nil && n.cfg.KeepConnected {
+			return
 		}
 
-		n.host.Network().ClosePeer(pid)
+		n.goodbyeAndClose(pid, handshakeErr)
 	}()
 
 	addrs := n.host.Peerstore().Addrs(pid)
 	if len(addrs) == 0 {
 		n.log.Error().Str("peer", pid.String()).Msg("No addresses found for peer")
+		handshakeErr = errors.New("no addresses found for peer")
 		return
 	}
 
-	addrInfo := peer.AddrInfo{ID: pid, Addrs: addrs}
+	addrInfo := n.dialAddrInfo(pid, addrs)
 	if err := n.handshake(ctx, pid, addrInfo); err != nil {
-		n.log.Warn().Str("peer", pid.String()).Err(err).Msg("Handshake failed")
+		handshakeErr = err
+		n.recordHandshakeFailure(pid, err)
+
+		n.log.Warn().Str("peer", pid.String()).Str("reason", handshakeFailureReason(err)).Err(err).Msg("Handshake failed")
 
 		// If there was any issue during the handshake, we didn't get to the metadata response.
-		// This means we should try again and mark the peer as backed off
-		n.peerstore.SetBackoff(pid, err)
+		// This means we should try again and mark the peer as backed off, unless the dialer
+		// tries its next address
+		var backoff uint32
+		if !retried {
+			backoff = n.peerstore.SetBackoff(pid, err)
+		}
+
+		if n.recordHandshakeFailed(err) {
+			n.sendHandshakeFailedEvent(n.handshakeFailedEvent(pid, err, backoff))
+		}
+
+		if n.cfg.MetadataOnStatusFailure && errors.Is(err, ErrStatusFailed) {
+			n.sendStatusFailedMetadata(ctx, pid)
+		}
 
 		return
 	}
@@ -102,120 +260,284 @@ func (n *Node) handleOutboundConnection(pid peer.ID) {
 		n.peerstore.SetClientVersion(pid, "unknown")
 	}
 
+	n.recordProtocols(pid)
+	n.peerstore.SetAddrs(pid, n.host.Peerstore().Addrs(pid))
+
 	// Sleep 2 seconds to allow for all subnet subscriptions to be processed
 	time.Sleep(2 * time.Second)
 
+	// The peer can be evicted from the peerstore in the meantime
 	info := n.peerstore.Get(pid)
+	if info == nil || info.metadata == nil {
+		return
+	}
+
 	event := info.IntoMetadataEvent()
+	n.stats.recordHandshake(event.ClientVersion)
+	event.Direction = types.DirectionOutbound
 
 	n.sendMetadataEvent(ctx, event)
+
+	if n.handshaked != nil {
+		n.handshaked.Add(pid)
+	}
+
+	if n.redialer != nil {
+		n.redialer.handshakeSucceeded(addrInfo)
+	}
+}
+
+// sendStatusFailedMetadata requests the metadata of a dialed peer whose status request
+// failed, and publishes it flagged as partial. Some clients answer metadata requests
+// but not status ones.
+func (n *Node) sendStatusFailedMetadata(ctx context.Context, pid peer.ID) {
+	md, err := retryRequest(ctx, n.cfg.HandshakeRetries, n.cfg.HandshakeRetryDelay, "metadata", pid, n.reqResp.MetaData)
+	if err != nil {
+		n.log.Debug().Str("peer", pid.String()).Err(err).Msg("Failed requesting metadata after status failure")
+		return
+	}
+
+	n.peerstore.SetMetadata(pid, md)
+
+	if v, err := n.host.Peerstore().Get(pid, "AgentVersion"); err == nil {
+		n.peerstore.SetClientVersion(pid, v.(string))
+	} else {
+		n.peerstore.SetClientVersion(pid, "unknown")
+	}
+
+	n.recordProtocols(pid)
+	n.peerstore.SetAddrs(pid, n.host.Peerstore().Addrs(pid))
+
+	// The peer can be evicted from the peerstore in the meantime
+	info := n.peerstore.Get(pid)
+	if info == nil || info.metadata == nil {
+		return
+	}
+
+	event := info.IntoMetadataEvent()
+	event.Direction = types.DirectionOutbound
+	event.Partial = types.PartialStatusFailed
+
+	n.log.Info().Str("peer", pid.String()).Msg("Received metadata from peer whose status failed")
+	n.sendMetadataEvent(ctx, event)
 }
 
 func (n *Node) handleInboundConnection(pid peer.ID) {
+	if !n.handshaking.start(pid) {
+		duplicateHandshakes.WithLabelValues(types.DirectionInbound).Inc()
+		n.log.Debug().Str("peer", pid.String()).Msg("Handshake already running for peer, skipping")
+		return
+	}
+	defer n.handshaking.done(pid)
+
 	n.log.Info().Str("peer", pid.String()).Msg("Handling new inbound connection")
 
+	var handshakeErr error
+
 	// Cleanup function
 	defer func() {
 		// Mark the peer as succesfully connected, which will reset the backoff
-		// and error to nil.
-		n.peerstore.Reset(pid)
+		// and error to nil. A failed handshake keeps the peer backed off.
+		if handshakeErr == nil {
+			n.peerstore.Reset(pid)
+		} else {
+			n.peerstore.EndFailedHandshake(pid)
+		}
 
 		if n.host.Network().Connectedness(pid) != network.Connected {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-
-		err := n.reqResp.Goodbye(ctx, pid, 3) // NOTE: Figure out the correct reason code
-		if err != nil {
-			n.log.Debug().Str("peer", pid.String()).Err(err).Msg("Failed to send goodbye message")
+		if handshakeErr == nil && n.cfg.KeepConnected {
+			return
 		}
 
-		n.host.Network().ClosePeer(pid)
+		n.goodbyeAndClose(pid, handshakeErr)
 	}()
 
-	// Wait max 5 seconds for the remote status to come in
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// DialTimeout caps the whole inbound handshake, including the wait for the status
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.DialTimeout)
 	defer cancel()
 
-	if err := n.waitForStatus(ctx, pid); err != nil {
-		n.log.Warn().Str("peer", pid.String()).Msg("Timed out waiting for status")
+	statusCtx, statusCancel := context.WithTimeout(ctx, inboundStatusTimeout)
+	defer statusCancel()
+
+	if err := n.waitForStatus(statusCtx, pid); err != nil {
+		handshakeErr = err
+		n.recordHandshakeFailure(pid, err)
+
+		n.log.Warn().Str("peer", pid.String()).Err(err).Msg("Failed waiting for status")
 		return
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), n.cfg.DialTimeout)
-	defer cancel()
+	// The peer can be evicted from the peerstore in the meantime, no metadata event is sent
+	// for it then
+	if st := n.peerstore.Status(pid); st != nil {
+		if err := n.checkForkDigest(st); err != nil {
+			handshakeErr = err
+			n.recordHandshakeFailure(pid, err)
+
+			n.log.Debug().Str("peer", pid.String()).Err(err).Msg("Inbound peer is on another fork")
+
+			if n.cfg.RecordForkMismatches {
+				n.sendHandshakeFailedEvent(n.handshakeFailedEvent(pid, err, 0))
+			}
+			return
+		}
+	}
 
 	if n.host.Network().Connectedness(pid) != network.Connected {
 		n.log.Warn().Str("peer", pid.String()).Msg("Connection was closed before handshake completed")
 		return
 	}
 
-	md, err := n.reqResp.MetaData(ctx, pid)
-	if err != nil {
+	if err := n.updateMetadata(ctx, pid); err != nil {
+		handshakeErr = fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+		n.recordHandshakeFailure(pid, handshakeErr)
+
 		n.log.Warn().Str("peer", pid.String()).Err(err).Msg("Failed requesting metadata")
 		return
 	}
 
-	n.peerstore.SetMetadata(pid, md)
-
 	// Save the client version
 	if v, err := n.host.Peerstore().Get(pid, "AgentVersion"); err == nil {
 		n.peerstore.SetClientVersion(pid, v.(string))
 	}
 
+	n.recordProtocols(pid)
+	n.peerstore.SetAddrs(pid, n.host.Peerstore().Addrs(pid))
+
 	// Sleep 2 seconds to allow for all subnet subscriptions to be processed
 	time.Sleep(2 * time.Second)
 
+	// The peer can be evicted from the peerstore in the meantime
 	info := n.peerstore.Get(pid)
+	if info == nil || info.metadata == nil {
+		return
+	}
+
 	event := info.IntoMetadataEvent()
+	n.stats.recordHandshake(event.ClientVersion)
+	event.Direction = types.DirectionInbound
 
 	n.sendMetadataEvent(ctx, event)
+
+	if n.handshaked != nil {
+		n.handshaked.Add(pid)
+	}
+
+	if n.redialer != nil {
+		n.redialer.handshakeSucceeded(n.dialAddrInfo(pid, n.host.Peerstore().Addrs(pid)))
+	}
+}
+
+// recordProtocols saves the sorted list of protocols the peer supports. These are learned
+// through identify, so if that hasn't completed yet the list is empty.
+func (n *Node) recordProtocols(pid peer.ID) {
+	protocols := []string{}
+
+	protos, err := n.host.Peerstore().GetProtocols(pid)
+	if err != nil {
+		n.log.Debug().Str("peer", pid.String()).Err(err).Msg("Failed to get peer protocols")
+	}
+
+	for _, proto := range protos {
+		protocols = append(protocols, string(proto))
+	}
+
+	slices.Sort(protocols)
+
+	n.peerstore.SetProtocols(pid, protocols)
 }
 
+// waitForStatus waits for an inbound peer to send its status, which the metadata request
+// is sent right after. It returns early if the peer disconnects in the meantime.
 func (n *Node) waitForStatus(ctx context.Context, pid peer.ID) error {
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
 	for {
+		if n.peerstore.Status(pid) != nil {
+			return nil
+		}
+
+		if n.host.Network().Connectedness(pid) != network.Connected {
+			return fmt.Errorf("%w: %w while waiting for status", ErrStatusFailed, ErrPeerDisconnected)
+		}
+
 		select {
 		case <-ctx.Done():
-			return errors.New("Timeout")
-		default:
-			if n.peerstore.Status(pid) != nil {
-				return nil
-			}
-
-			time.Sleep(1 * time.Second)
+			return errors.Wrap(ErrStatusFailed, "timed out waiting for status")
+		case <-ticker.C:
 		}
 	}
 }
 
+// checkForkDigest returns ErrForkDigestMismatch if the peer's status isn't on one of the
+// accepted fork digests, and otherwise counts the digest the peer is on.
+func (n *Node) checkForkDigest(st *eth.Status) error {
+	digest, ok := matchForkDigest(n.forkDigests, st.ForkDigest)
+	if !ok {
+		return fmt.Errorf("%w: got %#x", ErrForkDigestMismatch, st.ForkDigest)
+	}
+
+	peerForkDigests.WithLabelValues(fmt.Sprintf("%#x", digest)).Inc()
+	return nil
+}
+
 func (n *Node) handshake(ctx context.Context, pid peer.ID, addrInfo peer.AddrInfo) error {
-	st, err := n.reqResp.Status(ctx, pid)
+	st, err := retryRequest(ctx, n.cfg.HandshakeRetries, n.cfg.HandshakeRetryDelay, "status", pid, n.reqResp.Status)
 	if err != nil {
-		return errors.Wrap(err, "Failed to get status from peer")
+		return fmt.Errorf("%w: %w", ErrStatusFailed, err)
 	}
 
 	// Set the status for this peer
 	n.peerstore.SetStatus(pid, st)
 
+	// Peers on another network or fork aren't relevant to us, so skip the ping and metadata
+	if err := n.checkForkDigest(st); err != nil {
+		return err
+	}
+
 	// If the status head slot is higher than the current, update it
-	if bytes.Equal(st.ForkDigest, n.cfg.ForkDigest[:]) {
-		if st.HeadSlot > n.reqResp.status.HeadSlot {
-			n.reqResp.SetStatus(st)
-		}
+	if st.HeadSlot > n.reqResp.status.HeadSlot {
+		n.reqResp.SetStatus(st)
 	}
 
-	if err := n.reqResp.Ping(ctx, pid); err != nil {
-		return errors.Wrap(err, "Failed to ping peer")
+	rtt, err := retryRequest(ctx, n.cfg.HandshakeRetries, n.cfg.HandshakeRetryDelay, "ping", pid, n.reqResp.Ping)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPingFailed, err)
 	}
 
-	md, err := n.reqResp.MetaData(ctx, pid)
+	n.peerstore.AddPingLatency(pid, rtt)
+
+	if err := n.updateMetadata(ctx, pid); err != nil {
+		return fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+	}
+
+	return nil
+}
+
+// updateMetadata requests the metadata of a peer and stores it. With MetadataCooldown, the
+// metadata of the peer's previous handshake is reused instead if it was received within
+// the cooldown, so peers that keep reconnecting aren't asked again every time.
+func (n *Node) updateMetadata(ctx context.Context, pid peer.ID) error {
+	if n.cfg.MetadataCooldown > 0 && n.peerstore.ReuseMetadata(pid, n.cfg.MetadataCooldown) != nil {
+		metadataRequestsThrottled.Inc()
+		n.log.Debug().Str("peer", pid.String()).Msg("Reusing metadata received within the cooldown")
+		return nil
+	}
+
+	md, err := retryRequest(ctx, n.cfg.HandshakeRetries, n.cfg.HandshakeRetryDelay, "metadata", pid, n.reqResp.MetaData)
 	if err != nil {
-		return errors.Wrap(err, "Failed to get metadata from peer")
+		return err
 	}
 
 	// Store the metadata for this peer
-	n.peerstore.SetMetadata(pid, md)
+	prev := n.peerstore.SetMetadata(pid, md)
+	if event := n.attnetsChangedEvent(pid, prev, md); event != nil {
+		n.sendAttnetsChangedEvent(ctx, event)
+	}
 
 	return nil
 }
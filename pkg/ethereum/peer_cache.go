@@ -0,0 +1,110 @@
+package ethereum
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/chainbound/valtrack/log"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+)
+
+var peerCacheBucket = []byte("peers")
+
+// cachedPeer is the handshake state of a peer that is persisted across restarts.
+type cachedPeer struct {
+	ENR            string    `json:"enr,omitempty"`
+	Addr           string    `json:"addr"`
+	LastSeen       time.Time `json:"last_seen"`
+	LastErr        string    `json:"last_err,omitempty"`
+	BackoffCounter uint32    `json:"backoff_counter"`
+}
+
+// PeerCache persists the peerstore in a bbolt database, keyed by peer ID, so the
+// handshake and backoff state survives restarts.
+type PeerCache struct {
+	db  *bolt.DB
+	ttl time.Duration
+	log zerolog.Logger
+}
+
+// OpenPeerCache opens (or creates) the peer cache at `path`. Peers that haven't been
+// seen within `ttl` are dropped when the cache is loaded.
+func OpenPeerCache(path string, ttl time.Duration) (*PeerCache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open peer cache")
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(peerCacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to create peer cache bucket")
+	}
+
+	return &PeerCache{
+		db:  db,
+		ttl: ttl,
+		log: log.NewLogger("peer_cache"),
+	}, nil
+}
+
+// Load returns all peers that were seen within the TTL, and removes the expired ones.
+func (c *PeerCache) Load() (map[peer.ID]*cachedPeer, error) {
+	peers := make(map[peer.ID]*cachedPeer)
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(peerCacheBucket)
+
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var cp cachedPeer
+			if err := json.Unmarshal(v, &cp); err != nil || time.Since(cp.LastSeen) > c.ttl {
+				expired = append(expired, k)
+				return nil
+			}
+
+			peers[peer.ID(k)] = &cp
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return peers, err
+}
+
+// Put writes the state of a peer to the cache. Failures are logged, as the in-memory
+// peerstore stays authoritative.
+func (c *PeerCache) Put(id peer.ID, cp *cachedPeer) {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		c.log.Error().Err(err).Str("peer", id.String()).Msg("Failed to marshal peer")
+		return
+	}
+
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(peerCacheBucket).Put([]byte(id), data)
+	})
+	if err != nil {
+		c.log.Error().Err(err).Str("peer", id.String()).Msg("Failed to write peer to cache")
+	}
+}
+
+func (c *PeerCache) Close() error {
+	return c.db.Close()
+}
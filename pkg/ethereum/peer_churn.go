@@ -0,0 +1,69 @@
+package ethereum
+
+import (
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/chainbound/valtrack/version"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// observeChurn publishes a peer_churn event when the first connection to a peer opened, or
+// its last one closed, with PeerChurnEvents. It's called from the connection notifiee for
+// every connection, so it only reads the peerstore and never blocks.
+func (n *Node) observeChurn(net network.Network, c network.Conn, transition string) {
+	if !n.cfg.PeerChurnEvents {
+		return
+	}
+
+	pid := c.RemotePeer()
+
+	var connectedMs int64
+	switch transition {
+	case types.ChurnConnected:
+		if len(net.ConnsToPeer(pid)) > 1 {
+			return
+		}
+	case types.ChurnDisconnected:
+		if net.Connectedness(pid) == network.Connected {
+			return
+		}
+		connectedMs = time.Since(c.Stat().Opened).Milliseconds()
+	}
+
+	var direction string
+	switch c.Stat().Direction {
+	case network.DirInbound:
+		direction = types.DirectionInbound
+	case network.DirOutbound:
+		direction = types.DirectionOutbound
+	}
+
+	n.sendPeerChurnEvent(&types.PeerChurnEvent{
+		ID:          pid.String(),
+		Transition:  transition,
+		Direction:   direction,
+		Handshaked:  n.peerstore.Handshaked(pid),
+		ConnectedMs: connectedMs,
+		Timestamp:   time.Now().UnixMilli(),
+	})
+}
+
+func (n *Node) sendPeerChurnEvent(event *types.PeerChurnEvent) {
+	event.CrawlerID = getCrawlerMachineID()
+	event.CrawlerLoc = getCrawlerLocation()
+	event.CrawlerVer = version.Short()
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+	event.SchemaVersion = EventSchemaVersion
+
+	if n.js == nil {
+		n.fileLogger.Log().Str("type", types.EventPeerChurn).Any("event", event).Send()
+		return
+	}
+
+	select {
+	case n.peerChurnChan <- event:
+	default:
+		n.dialAddrLog.Warn().Msg("Channel full, dropped peer_churn event")
+	}
+}
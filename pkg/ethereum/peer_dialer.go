@@ -14,9 +14,16 @@ import (
 // When PeerDialer sees a new peer, it does a few sanity checks and tries
 // to establish a connection.
 type PeerDialer struct {
-	host     host.Host
-	peerChan <-chan peer.AddrInfo
-	log      zerolog.Logger
+	host      host.Host
+	peerstore *Peerstore
+	peerChan  <-chan peer.AddrInfo
+	// handshaked holds the peers we handshaked with during this run, if set
+	handshaked *peerFilter
+	// dialTimeout is shared by the attempts on up to addrsPerPeer addresses of a peer
+	dialTimeout  time.Duration
+	addrsPerPeer int
+	attempts     *dialAttempts
+	log          zerolog.Logger
 }
 
 func (p *PeerDialer) Serve(ctx context.Context) error {
@@ -37,14 +44,41 @@ func (p *PeerDialer) Serve(ctx context.Context) error {
 				continue
 			}
 
+			// don't redial peers we recently handshaked with before a restart
+			if p.peerstore.SkipDial(addrInfo.ID) {
+				p.log.Debug().Str("peer", addrInfo.ID.String()).Msg("Skipping recently handshaked peer from cache")
+				continue
+			}
+
+			// don't redial peers we already handshaked with during this run
+			if p.handshaked != nil && p.handshaked.Contains(addrInfo.ID) {
+				peerFilterSkippedDials.Inc()
+				p.log.Debug().Str("peer", addrInfo.ID.String()).Msg("Skipping handshaked peer from filter")
+				continue
+			}
+
+			// don't redial peers whose handshake failed within the backoff period, e.g. when
+			// the discv5 walk finds them again, nor peers another dialer is dialing
+			reserved, backedOff := p.peerstore.ReserveDial(addrInfo.ID)
+			if backedOff {
+				backoffSkippedDials.Inc()
+				p.log.Debug().Str("peer", addrInfo.ID.String()).Msg("Skipping backed off peer")
+				continue
+			}
+			if !reserved {
+				p.log.Debug().Str("peer", addrInfo.ID.String()).Msg("Skipping peer that is already being dialed")
+				continue
+			}
+
 			// finally, start the connection establishment.
 			// The success case is handled in net_notifiee.go.
-			timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-			if err := p.host.Connect(timeoutCtx, addrInfo); err != nil {
+			timeoutCtx, cancel := context.WithTimeout(ctx, p.dialTimeout)
+			if err := connectAddrs(timeoutCtx, p.host, addrInfo, p.addrsPerPeer, p.attempts); err != nil {
 				p.log.Debug().Err(err).Str("peer", addrInfo.ID.String()).Msg("Failed to connect to peer")
 			}
 
 			cancel()
+			p.peerstore.ReleaseDial(addrInfo.ID)
 		}
 
 	}
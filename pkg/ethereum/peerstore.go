@@ -1,6 +1,8 @@
 package ethereum
 
 import (
+	"errors"
+	"slices"
 	"sync"
 	"time"
 
@@ -32,15 +34,47 @@ type PeerInfo struct {
 	enode      enode.Node
 	lastSeen   time.Time
 	remoteAddr multiaddr.Multiaddr
+	// addrs are all addresses known for the peer, learned through identify and discovery
+	addrs []multiaddr.Multiaddr
 
 	status            *eth.Status
 	metadata          *eth.MetaDataV1 // Only interested in metadataV1
 	subscribedSubnets []int64
 	clientVersion     string
+	protocols         []string
+	pingLatencies     []time.Duration
+	// lastMetadata is the metadata of the previous handshake, kept across Reset
+	lastMetadata *eth.MetaDataV1
+	// metadataAt is when the metadata was last received from the peer, kept across Reset
+	metadataAt time.Time
 
 	state          ConnectionState
 	lastErr        error
 	backoffCounter uint32
+	// restored is set for peers loaded from the peer cache, until they connect again
+	restored bool
+}
+
+// cacheRecord returns the state of the peer to persist in the peer cache.
+func (p *PeerInfo) cacheRecord() *cachedPeer {
+	cp := &cachedPeer{
+		LastSeen:       p.lastSeen,
+		BackoffCounter: p.backoffCounter,
+	}
+
+	if p.enode.ID() != (enode.ID{}) {
+		cp.ENR = p.enode.String()
+	}
+
+	if p.remoteAddr != nil {
+		cp.Addr = p.remoteAddr.String()
+	}
+
+	if p.lastErr != nil {
+		cp.LastErr = p.lastErr.Error()
+	}
+
+	return cp
 }
 
 func (p *PeerInfo) IntoMetadataEvent() *types.MetadataReceivedEvent {
@@ -50,66 +84,255 @@ func (p *PeerInfo) IntoMetadataEvent() *types.MetadataReceivedEvent {
 		Syncnets:  p.metadata.Syncnets,
 	}
 
+	minLatency, medianLatency := latencyStats(p.pingLatencies)
+
+	addrs := peerAddrs(p.remoteAddr, p.addrs)
+	multiaddrs := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		multiaddrs = append(multiaddrs, addr.String())
+	}
+
+	var selected string
+	addr, public := selectAddr(addrs, enrAddr(p.enode))
+	if addr != nil {
+		selected = addr.String()
+	}
+
+	var remoteAddr string
+	if p.remoteAddr != nil {
+		remoteAddr = p.remoteAddr.String()
+	}
+
+	// Peers whose status failed don't have one
+	var epoch int
+	if p.status != nil {
+		// `epoch = slot // SLOTS_PER_EPOCH`
+		epoch = int(p.status.HeadSlot) / 32
+	}
+
 	return &types.MetadataReceivedEvent{
 		ENR:           p.enode.String(),
 		ID:            p.id.String(),
-		Multiaddr:     p.remoteAddr.String(),
+		Multiaddr:     selected,
+		Multiaddrs:    multiaddrs,
+		PrivateAddr:   !public,
+		RemoteAddr:    remoteAddr,
 		ClientVersion: p.clientVersion,
 		MetaData:      simpleMetadata,
-		// `epoch = slot // SLOTS_PER_EPOCH`
-		Epoch: int(p.status.HeadSlot) / 32,
+		Epoch:         epoch,
 		// These should be set later
 		CrawlerID:         "",
 		CrawlerLoc:        "",
 		SubscribedSubnets: p.subscribedSubnets,
+		Protocols:         p.protocols,
+		PingLatencyMs:     medianLatency.Milliseconds(),
+		PingMinLatencyMs:  minLatency.Milliseconds(),
 		Timestamp:         p.lastSeen.UnixMilli(),
 	}
 }
 
+// latencyStats returns the minimum and median of the given ping latencies, or zeroes if
+// there are none.
+func latencyStats(latencies []time.Duration) (minRTT, medianRTT time.Duration) {
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	return sorted[0], sorted[len(sorted)/2]
+}
+
 type Peerstore struct {
 	sync.RWMutex
 
-	peers          map[peer.ID]*PeerInfo
+	// peers holds the status and metadata of at most `maxPeers` peers.
+	peers *lruCache[peer.ID, *PeerInfo]
+	// backoffs tracks the backed off peers. When it's full, the least recently failed
+	// peer is forgotten entirely.
+	backoffs       *lruCache[peer.ID, struct{}]
 	defaultBackoff time.Duration
+	cache          *PeerCache
+	// subnetPeers is the number of peers per attestation subnet, according to the last
+	// metadata of every peer in `peers`
+	subnetPeers [attnetSubnetCount]int
+	// dialing holds the peers a dial is reserved for, see ReserveDial
+	dialing map[peer.ID]struct{}
 }
 
-// NewPeerstore creates a new peerstore
-func NewPeerstore(defaultBackoff time.Duration) *Peerstore {
-	return &Peerstore{
-		peers:          make(map[peer.ID]*PeerInfo),
+// NewPeerstore creates a new peerstore that holds at most `maxPeers` peers, of which at
+// most `maxBackoffs` are backed off. Peers that are being handshaked are never evicted.
+// A size of 0 means unbounded. Every other peer can be evicted while it's still connected,
+// so the setters ignore peers that aren't in the peerstore.
+func NewPeerstore(defaultBackoff time.Duration, maxPeers, maxBackoffs int) *Peerstore {
+	p := &Peerstore{
 		defaultBackoff: defaultBackoff,
+		dialing:        make(map[peer.ID]struct{}),
 	}
+
+	p.peers = newLRUCache(maxPeers,
+		func(_ peer.ID, info *PeerInfo) bool { return info.state != Connecting },
+		func(id peer.ID, info *PeerInfo) {
+			p.backoffs.Remove(id)
+			p.removeFromSubnetCoverage(info)
+			peerstoreEvictions.WithLabelValues("metadata").Inc()
+		},
+	)
+
+	p.backoffs = newLRUCache(maxBackoffs,
+		func(id peer.ID, _ struct{}) bool { return p.state(id) != Connecting },
+		func(id peer.ID, _ struct{}) {
+			p.removeFromSubnetCoverage(p.peer(id))
+			p.peers.Remove(id)
+			peerstoreEvictions.WithLabelValues("backoff").Inc()
+		},
+	)
+
+	resetSubnetCoverageGauges()
+
+	return p
+}
+
+// peer returns the info of a peer, or nil if it isn't in the peerstore. It doesn't
+// update the recency of the peer.
+func (p *Peerstore) peer(id peer.ID) *PeerInfo {
+	info, _ := p.peers.Peek(id)
+	return info
+}
+
+func (p *Peerstore) state(id peer.ID) ConnectionState {
+	if info := p.peer(id); info != nil {
+		return info.state
+	}
+
+	return NotConnected
+}
+
+// Restore loads the peers from the cache into the peerstore, and writes the result of
+// every following handshake through to the cache. It returns the number of restored peers.
+func (p *Peerstore) Restore(cache *PeerCache) (int, error) {
+	cached, err := cache.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.cache = cache
+
+	for id, cp := range cached {
+		addr, err := multiaddr.NewMultiaddr(cp.Addr)
+		if err != nil {
+			continue
+		}
+
+		info := &PeerInfo{
+			id:             id,
+			remoteAddr:     addr,
+			lastSeen:       cp.LastSeen,
+			backoffCounter: cp.BackoffCounter,
+			restored:       true,
+		}
+
+		if cp.ENR != "" {
+			if node, err := enode.Parse(enode.ValidSchemes, cp.ENR); err == nil {
+				info.enode = *node
+			}
+		}
+
+		if cp.LastErr != "" {
+			info.lastErr = errors.New(cp.LastErr)
+		}
+
+		p.peers.Add(id, info)
+		if info.backoffCounter > 0 {
+			p.backoffs.Add(id, struct{}{})
+		}
+	}
+
+	return len(cached), nil
+}
+
+// persist writes the peer state through to the peer cache, if there is one.
+func (p *Peerstore) persist(id peer.ID, cp *cachedPeer) {
+	if p.cache != nil {
+		p.cache.Put(id, cp)
+	}
+}
+
+// SkipDial returns true for peers restored from the peer cache that had a successful
+// handshake within the last epoch. These don't need to be dialed again when they are
+// rediscovered after a restart, the reconnection timer picks them up once they're due.
+func (p *Peerstore) SkipDial(id peer.ID) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	info, ok := p.peers.Peek(id)
+	if !ok || !info.restored {
+		return false
+	}
+
+	return info.lastErr == nil && info.backoffCounter == 0 && time.Since(info.lastSeen) < EPOCH_DURATION
 }
 
 func (p *Peerstore) Get(id peer.ID) *PeerInfo {
 	p.RLock()
 	defer p.RUnlock()
 
-	return p.peers[id]
+	return p.peer(id)
 }
 
-// Insert inserts a peer into the peerstore in the `NotConnected` state.
+// Insert inserts a peer into the peerstore in the `NotConnected` state. The last metadata
+// of a peer that is already known is kept, so it can be compared after the next handshake,
+// and so is its backoff, which only a successful handshake resets.
 func (p *Peerstore) Insert(id peer.ID, addr multiaddr.Multiaddr, enode enode.Node) {
 	p.Lock()
 	defer p.Unlock()
 
-	p.peers[id] = &PeerInfo{
+	info := &PeerInfo{
 		enode:      enode,
 		id:         id,
 		remoteAddr: addr,
 		lastSeen:   time.Now(),
 	}
+
+	if old, ok := p.peers.Peek(id); ok {
+		info.lastMetadata = old.lastMetadata
+		if old.metadata != nil {
+			info.lastMetadata = old.metadata
+		}
+		info.backoffCounter = old.backoffCounter
+		info.lastErr = old.lastErr
+	}
+
+	p.peers.Add(id, info)
+	if info.backoffCounter == 0 {
+		p.backoffs.Remove(id)
+	}
+}
+
+// LastSeen returns the last time we received new data from the peer.
+func (p *Peerstore) LastSeen(id peer.ID) time.Time {
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.peer(id) == nil {
+		return time.Time{}
+	}
+
+	return p.peer(id).lastSeen
 }
 
 func (p *Peerstore) SetState(id peer.ID, state ConnectionState) {
 	p.Lock()
 	defer p.Unlock()
 
-	if info, ok := p.peers[id]; ok {
+	if info, ok := p.peers.Peek(id); ok {
 		info.state = state
 		info.lastSeen = time.Now()
-	} else {
-		panic("peerstore: SetState: peer not found")
+		p.peers.Touch(id)
 	}
 }
 
@@ -117,71 +340,141 @@ func (p *Peerstore) State(id peer.ID) ConnectionState {
 	p.RLock()
 	defer p.RUnlock()
 
-	if p.peers[id] == nil {
+	if p.peer(id) == nil {
 		return NotConnected
 	}
 
-	return p.peers[id].state
+	return p.peer(id).state
 }
 
 // SetBackoff marks the peer as backed off, increments the backoff counter
 // and records the last error. This should only be used on outbound connections.
+// It returns the backoff counter, or 0 if the peer isn't in the peerstore.
 func (p *Peerstore) SetBackoff(id peer.ID, err error) uint32 {
 	p.Lock()
-	defer p.Unlock()
-
-	if info, ok := p.peers[id]; ok {
-		info.lastErr = err
-		info.backoffCounter++
-		info.lastSeen = time.Now()
 
-		return info.backoffCounter
-	} else {
-		panic("peerstore: SetErr: peer not found")
+	info, ok := p.peers.Peek(id)
+	if !ok {
+		p.Unlock()
+		return 0
 	}
+
+	info.lastErr = err
+	info.backoffCounter++
+	info.lastSeen = time.Now()
+	p.backoffs.Add(id, struct{}{})
+
+	counter, cp := info.backoffCounter, info.cacheRecord()
+	p.Unlock()
+
+	p.persist(id, cp)
+
+	return counter
 }
 
 func (p *Peerstore) IsBackedOff(id peer.ID) bool {
 	p.RLock()
 	defer p.RUnlock()
 
-	if info, ok := p.peers[id]; ok {
+	return p.isBackedOff(id)
+}
+
+func (p *Peerstore) isBackedOff(id peer.ID) bool {
+	if info, ok := p.peers.Peek(id); ok {
 		return info.backoffCounter > 0 && time.Since(info.lastSeen) < p.defaultBackoff
 	}
 
 	return false
 }
 
+// ReserveDial reserves a dial of the peer, unless it's backed off or already being dialed.
+// The backoff check and the reservation happen under the lock, so concurrent dialers never
+// dial the same peer twice, nor a peer whose SetBackoff completed before. The reservation
+// must be released with ReleaseDial once the dial returned.
+func (p *Peerstore) ReserveDial(id peer.ID) (reserved bool, backedOff bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.isBackedOff(id) {
+		return false, true
+	}
+
+	if _, ok := p.dialing[id]; ok {
+		return false, false
+	}
+
+	p.dialing[id] = struct{}{}
+	return true, false
+}
+
+// ReleaseDial releases the dial reservation of the peer.
+func (p *Peerstore) ReleaseDial(id peer.ID) {
+	p.Lock()
+	defer p.Unlock()
+
+	delete(p.dialing, id)
+}
+
 // Reset MUST be called every time we've had a succesful handshake & metadata exchange with a peer.
 // It will reset the backoff counter and the last error, and remove the last status & metadata
 func (p *Peerstore) Reset(id peer.ID) {
 	p.Lock()
+
+	info, ok := p.peers.Peek(id)
+	if !ok {
+		p.Unlock()
+		return
+	}
+
+	info.backoffCounter = 0
+	info.lastSeen = time.Now()
+	info.lastErr = nil
+	p.backoffs.Remove(id)
+	p.endHandshake(id, info)
+
+	cp := info.cacheRecord()
+	p.Unlock()
+
+	p.persist(id, cp)
+}
+
+// EndFailedHandshake MUST be called instead of Reset when the handshake with a peer failed.
+// It removes the last status & metadata like Reset, but keeps the backoff counter, the last
+// error and the time of the failure, so the peer stays backed off.
+func (p *Peerstore) EndFailedHandshake(id peer.ID) {
+	p.Lock()
 	defer p.Unlock()
 
-	if info, ok := p.peers[id]; ok {
-		info.backoffCounter = 0
-		info.lastSeen = time.Now()
-		info.lastErr = nil
-		info.state = NotConnected
+	// The peer can be evicted while it's backed off
+	if info, ok := p.peers.Peek(id); ok {
+		p.endHandshake(id, info)
+	}
+}
 
-		// Remove status!
-		info.status = nil
-		info.metadata = nil
-		info.subscribedSubnets = []int64{}
-	} else {
-		panic("peerstore: ResetBackoff: peer not found")
+// endHandshake marks the peer as not connected and removes the status & metadata of the
+// handshake.
+func (p *Peerstore) endHandshake(id peer.ID, info *PeerInfo) {
+	info.state = NotConnected
+	p.peers.Touch(id)
+
+	// Remove status!
+	info.status = nil
+	if info.metadata != nil {
+		info.lastMetadata = info.metadata
 	}
+	info.metadata = nil
+	info.subscribedSubnets = []int64{}
+	info.protocols = nil
+	info.pingLatencies = nil
 }
 
 func (p *Peerstore) AddSubscribedSubnets(id peer.ID, subnet ...int64) {
 	p.Lock()
 	defer p.Unlock()
 
-	if info, ok := p.peers[id]; ok {
+	if info, ok := p.peers.Peek(id); ok {
 		info.subscribedSubnets = append(info.subscribedSubnets, subnet...)
 		info.lastSeen = time.Now()
-	} else {
-		panic("peerstore: AddSubscribedSubnet: peer not found")
 	}
 }
 
@@ -189,11 +482,9 @@ func (p *Peerstore) SetStatus(id peer.ID, status *eth.Status) {
 	p.Lock()
 	defer p.Unlock()
 
-	if info, ok := p.peers[id]; ok {
+	if info, ok := p.peers.Peek(id); ok {
 		info.status = status
 		info.lastSeen = time.Now()
-	} else {
-		panic("peerstore: SetStatus: peer not found")
 	}
 }
 
@@ -201,22 +492,79 @@ func (p *Peerstore) Status(id peer.ID) *eth.Status {
 	p.RLock()
 	defer p.RUnlock()
 
-	if p.peers[id] == nil {
+	if p.peer(id) == nil {
 		return nil
 	}
 
-	return p.peers[id].status
+	return p.peer(id).status
 }
 
-func (p *Peerstore) SetMetadata(id peer.ID, metadata *eth.MetaDataV1) {
+// SetMetadata stores the metadata of a peer, and returns the metadata of its previous
+// handshake (nil if there was none).
+func (p *Peerstore) SetMetadata(id peer.ID, metadata *eth.MetaDataV1) (previous *eth.MetaDataV1) {
 	p.Lock()
 	defer p.Unlock()
 
-	if info, ok := p.peers[id]; ok {
+	if info, ok := p.peers.Peek(id); ok {
+		previous = info.metadata
+		if previous == nil {
+			previous = info.lastMetadata
+		}
 		info.metadata = metadata
+
+		p.updateSubnetCoverage(metadataAttnets(previous), metadataAttnets(metadata))
 		info.lastSeen = time.Now()
-	} else {
-		panic("peerstore: SetMetadata: peer not found")
+		info.metadataAt = info.lastSeen
+	}
+
+	return previous
+}
+
+// ReuseMetadata sets the metadata of a peer to the one of its previous handshake, if it was
+// received within `cooldown`, and returns it. It returns nil otherwise, or if the peer
+// isn't in the peerstore. The time the metadata was received isn't updated, so it's
+// requested again once the cooldown is over.
+func (p *Peerstore) ReuseMetadata(id peer.ID, cooldown time.Duration) *eth.MetaDataV1 {
+	p.Lock()
+	defer p.Unlock()
+
+	info, ok := p.peers.Peek(id)
+	if !ok || time.Since(info.metadataAt) >= cooldown {
+		return nil
+	}
+
+	metadata := info.metadata
+	if metadata == nil {
+		metadata = info.lastMetadata
+	}
+	if metadata == nil {
+		return nil
+	}
+
+	// The subnet coverage still counts the metadata of the previous handshake
+	info.metadata = metadata
+	info.lastSeen = time.Now()
+
+	return metadata
+}
+
+// Handshaked reports whether the metadata of a peer was received, in its last handshake
+// or a previous one.
+func (p *Peerstore) Handshaked(id peer.ID) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	info, ok := p.peers.Peek(id)
+	return ok && (info.metadata != nil || info.lastMetadata != nil)
+}
+
+// AddPingLatency records the round trip time of a ping to the peer.
+func (p *Peerstore) AddPingLatency(id peer.ID, rtt time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+
+	if info, ok := p.peers.Peek(id); ok {
+		info.pingLatencies = append(info.pingLatencies, rtt)
 	}
 }
 
@@ -224,10 +572,28 @@ func (p *Peerstore) SetClientVersion(id peer.ID, version string) {
 	p.Lock()
 	defer p.Unlock()
 
-	if info, ok := p.peers[id]; ok {
+	if info, ok := p.peers.Peek(id); ok {
 		info.clientVersion = version
-	} else {
-		panic("peerstore: SetClientVersion: peer not found")
+	}
+}
+
+// SetAddrs records all known addresses of the peer.
+func (p *Peerstore) SetAddrs(id peer.ID, addrs []multiaddr.Multiaddr) {
+	p.Lock()
+	defer p.Unlock()
+
+	if info, ok := p.peers.Peek(id); ok {
+		info.addrs = addrs
+	}
+}
+
+// SetProtocols records the protocols the peer supports.
+func (p *Peerstore) SetProtocols(id peer.ID, protocols []string) {
+	p.Lock()
+	defer p.Unlock()
+
+	if info, ok := p.peers.Peek(id); ok {
+		info.protocols = protocols
 	}
 }
 
@@ -235,18 +601,18 @@ func (p *Peerstore) LastErr(id peer.ID) error {
 	p.RLock()
 	defer p.RUnlock()
 
-	if p.peers[id] == nil {
+	if p.peer(id) == nil {
 		return nil
 	}
 
-	return p.peers[id].lastErr
+	return p.peer(id).lastErr
 }
 
 func (p *Peerstore) Size() int {
 	p.RLock()
 	defer p.RUnlock()
 
-	return len(p.peers)
+	return p.peers.Len()
 }
 
 // PeersToReconnect returns the peers that we need to reconnect to. This includes
@@ -258,7 +624,7 @@ func (p *Peerstore) PeersToReconnect() []peer.AddrInfo {
 	p.RLock()
 	defer p.RUnlock()
 
-	for id, info := range p.peers {
+	p.peers.Range(func(id peer.ID, info *PeerInfo) {
 		if info.state == NotConnected {
 			// If the backoff expired, reconnect
 			if info.backoffCounter > 0 && time.Since(info.lastSeen) > p.defaultBackoff*(time.Second*time.Duration(info.backoffCounter)) {
@@ -271,7 +637,7 @@ func (p *Peerstore) PeersToReconnect() []peer.AddrInfo {
 			}
 
 		}
-	}
+	})
 
 	return peers
 }
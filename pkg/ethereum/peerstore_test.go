@@ -0,0 +1,117 @@
+package ethereum
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/libp2p/go-libp2p/core/peer"
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+// Concurrent dialers reserve a dial of the same peer only once, and never of a backed off peer.
+func TestReserveDial(t *testing.T) {
+	p := NewPeerstore(time.Minute, 0, 0)
+	id := peer.ID("a")
+
+	var reserved, backedOff atomic.Int32
+	reserveConcurrently := func() {
+		reserved.Store(0)
+		backedOff.Store(0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 64; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				ok, backoff := p.ReserveDial(id)
+				if ok {
+					reserved.Add(1)
+				}
+				if backoff {
+					backedOff.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	reserveConcurrently()
+	if reserved.Load() != 1 || backedOff.Load() != 0 {
+		t.Fatalf("expected exactly 1 reservation, got %d (%d backed off)", reserved.Load(), backedOff.Load())
+	}
+
+	// Once released, the peer can be dialed again
+	p.ReleaseDial(id)
+	if ok, _ := p.ReserveDial(id); !ok {
+		t.Fatal("expected a reservation after the release")
+	}
+	p.ReleaseDial(id)
+
+	// A peer whose handshake failed is never reserved, also after the cleanup of the
+	// handshake, which runs before the discv5 walk can find the peer again
+	p.Insert(id, nil, enode.Node{})
+	p.SetState(id, Connecting)
+	p.SetBackoff(id, errors.New("handshake failed"))
+	p.EndFailedHandshake(id)
+
+	reserveConcurrently()
+	if reserved.Load() != 0 || backedOff.Load() != 64 {
+		t.Fatalf("expected every dial of the backed off peer to be skipped, got %d reserved and %d backed off", reserved.Load(), backedOff.Load())
+	}
+
+	// The backoff is kept when the peer connects again, and grows when it fails again
+	p.Insert(id, nil, enode.Node{})
+	p.SetState(id, Connecting)
+	if counter := p.SetBackoff(id, errors.New("handshake failed")); counter != 2 {
+		t.Fatalf("expected backoff counter 2, got %d", counter)
+	}
+	p.EndFailedHandshake(id)
+	if !p.IsBackedOff(id) {
+		t.Fatal("expected the peer to stay backed off")
+	}
+
+	// A successful handshake resets the backoff
+	p.Insert(id, nil, enode.Node{})
+	p.SetState(id, Connecting)
+	p.Reset(id)
+	if ok, backoff := p.ReserveDial(id); !ok || backoff {
+		t.Fatal("expected a reservation after a successful handshake")
+	}
+}
+
+// The setters ignore peers that were evicted, which can still be connected and handshaked.
+func TestSettersOfEvictedPeer(t *testing.T) {
+	p := NewPeerstore(time.Minute, 1, 0)
+	id := peer.ID("a")
+
+	p.Insert(id, nil, enode.Node{})
+	p.Insert(peer.ID("b"), nil, enode.Node{})
+	if p.Get(id) != nil {
+		t.Fatal("expected the peer to be evicted")
+	}
+
+	p.SetState(id, Connecting)
+	if counter := p.SetBackoff(id, errors.New("reconnect failed")); counter != 0 {
+		t.Fatalf("expected backoff counter 0, got %d", counter)
+	}
+	p.Reset(id)
+	p.EndFailedHandshake(id)
+	p.AddSubscribedSubnets(id, 1)
+	p.SetStatus(id, &eth.Status{})
+	if previous := p.SetMetadata(id, attnets(1)); previous != nil {
+		t.Fatal("expected no previous metadata")
+	}
+	p.AddPingLatency(id, time.Millisecond)
+	p.SetClientVersion(id, "unknown")
+	p.SetAddrs(id, nil)
+	p.SetProtocols(id, nil)
+
+	if p.Get(id) != nil || p.Size() != 1 {
+		t.Fatal("expected the setters not to insert the evicted peer")
+	}
+}
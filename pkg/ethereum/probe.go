@@ -0,0 +1,208 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	"github.com/prysmaticlabs/go-bitfield"
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+// ProbeResult is the outcome of every step of a handshake with a single peer. A failed
+// step doesn't stop the following ones, except for the connection.
+type ProbeResult struct {
+	PeerID       string   `json:"peer_id"`
+	ENR          string   `json:"enr,omitempty"`
+	Addrs        []string `json:"addrs"`
+	RemoteAddr   string   `json:"remote_addr,omitempty"`
+	AgentVersion string   `json:"agent_version,omitempty"`
+	Protocols    []string `json:"protocols,omitempty"`
+
+	Connect  ProbeStep `json:"connect"`
+	Identify ProbeStep `json:"identify"`
+	Status   ProbeStep `json:"status"`
+	Ping     ProbeStep `json:"ping"`
+	MetaData ProbeStep `json:"metadata"`
+}
+
+// ProbeStep is the outcome of a step of a probe. Result is the decoded response, which can
+// be set along with an error (e.g. a status on another fork).
+type ProbeStep struct {
+	Skipped    bool   `json:"skipped,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Result     any    `json:"result,omitempty"`
+}
+
+// ProbeStatus is the status of a probed peer.
+type ProbeStatus struct {
+	ForkDigest     string `json:"fork_digest"`
+	FinalizedRoot  string `json:"finalized_root"`
+	FinalizedEpoch uint64 `json:"finalized_epoch"`
+	HeadRoot       string `json:"head_root"`
+	HeadSlot       uint64 `json:"head_slot"`
+}
+
+// ProbePing is the ping of a probed peer.
+type ProbePing struct {
+	RTTMs int64 `json:"rtt_ms"`
+}
+
+// ProbeMetaData is the metadata of a probed peer.
+type ProbeMetaData struct {
+	SeqNumber        uint64  `json:"seq_number"`
+	Attnets          string  `json:"attnets"`
+	Syncnets         string  `json:"syncnets"`
+	LongLivedSubnets []int64 `json:"long_lived_subnets"`
+}
+
+// probeIdentifyTimeout is how long the probe waits for identify to complete, which it
+// doesn't with some peers.
+const probeIdentifyTimeout = 5 * time.Second
+
+// Probe connects to a single peer and runs the status, ping and metadata requests, each
+// once, without publishing any event. It's meant for a node that isn't started, and
+// closes its host when done.
+func (n *Node) Probe(ctx context.Context, sp *StaticPeer) *ProbeResult {
+	defer n.host.Close()
+
+	pid := sp.AddrInfo.ID
+	result := &ProbeResult{PeerID: pid.String()}
+	for _, addr := range sp.AddrInfo.Addrs {
+		result.Addrs = append(result.Addrs, addr.String())
+	}
+	if sp.Node != nil {
+		result.ENR = sp.Node.String()
+	}
+
+	n.reqResp.SetStatus(&eth.Status{
+		ForkDigest:     n.cfg.ForkDigest[:],
+		FinalizedRoot:  make([]byte, 32),
+		FinalizedEpoch: 0,
+		HeadRoot:       make([]byte, 32),
+		HeadSlot:       0,
+	})
+	n.refreshStatus(ctx)
+
+	// Peers request our status and metadata too
+	if err := n.reqResp.RegisterHandlers(ctx); err != nil {
+		result.Connect.Error = fmt.Sprintf("register RPC handlers: %s", err)
+		result.skipAfterConnect()
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.cfg.DialTimeout)
+	defer cancel()
+
+	err := probeStep(&result.Connect, func() (any, error) {
+		return nil, n.host.Connect(ctx, peer.AddrInfo{ID: pid, Addrs: sp.AddrInfo.Addrs})
+	})
+	if err != nil {
+		result.skipAfterConnect()
+		return result
+	}
+	defer n.goodbyeAndClose(pid, ErrShuttingDown)
+
+	conns := n.host.Network().ConnsToPeer(pid)
+	if len(conns) > 0 {
+		result.RemoteAddr = conns[0].RemoteMultiaddr().String()
+	}
+
+	probeStep(&result.Identify, func() (any, error) {
+		ids, ok := n.host.(interface{ IDService() identify.IDService })
+		if !ok || len(conns) == 0 {
+			return nil, errors.New("identify unavailable")
+		}
+
+		select {
+		case <-ids.IDService().IdentifyWait(conns[0]):
+		case <-time.After(probeIdentifyTimeout):
+			return nil, errors.New("identify timed out")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		v, err := n.host.Peerstore().Get(pid, "AgentVersion")
+		if err != nil {
+			return nil, fmt.Errorf("no agent version: %w", err)
+		}
+		result.AgentVersion, _ = v.(string)
+
+		protos, _ := n.host.Peerstore().GetProtocols(pid)
+		for _, proto := range protos {
+			result.Protocols = append(result.Protocols, string(proto))
+		}
+		return nil, nil
+	})
+
+	probeStep(&result.Status, func() (any, error) {
+		st, err := n.reqResp.Status(ctx, pid)
+		if err != nil {
+			return nil, err
+		}
+
+		status := &ProbeStatus{
+			ForkDigest:     hex.EncodeToString(st.ForkDigest),
+			FinalizedRoot:  hex.EncodeToString(st.FinalizedRoot),
+			FinalizedEpoch: uint64(st.FinalizedEpoch),
+			HeadRoot:       hex.EncodeToString(st.HeadRoot),
+			HeadSlot:       uint64(st.HeadSlot),
+		}
+		return status, n.checkForkDigest(st)
+	})
+
+	probeStep(&result.Ping, func() (any, error) {
+		rtt, err := n.reqResp.Ping(ctx, pid)
+		if err != nil {
+			return nil, err
+		}
+		return &ProbePing{RTTMs: rtt.Milliseconds()}, nil
+	})
+
+	probeStep(&result.MetaData, func() (any, error) {
+		md, err := n.reqResp.MetaData(ctx, pid)
+		if err != nil {
+			return nil, err
+		}
+
+		// The subnets set in the attnets are the ones added to an empty bitfield
+		subnets, _ := diffAttnets(bitfield.NewBitvector64(), md.Attnets)
+
+		return &ProbeMetaData{
+			SeqNumber:        md.SeqNumber,
+			Attnets:          hex.EncodeToString(md.Attnets),
+			Syncnets:         hex.EncodeToString(md.Syncnets),
+			LongLivedSubnets: subnets,
+		}, nil
+	})
+
+	return result
+}
+
+// probeStep runs a step and records its duration, result and error, which it returns.
+func probeStep(step *ProbeStep, fn func() (any, error)) error {
+	start := time.Now()
+	res, err := fn()
+	step.DurationMs = time.Since(start).Milliseconds()
+
+	if res != nil {
+		step.Result = res
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+
+	return err
+}
+
+// skipAfterConnect marks the steps that need a connection as skipped.
+func (r *ProbeResult) skipAfterConnect() {
+	for _, step := range []*ProbeStep{&r.Identify, &r.Status, &r.Ping, &r.MetaData} {
+		step.Skipped = true
+	}
+}
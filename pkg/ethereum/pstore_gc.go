@@ -0,0 +1,72 @@
+package ethereum
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+// runPeerstoreGC garbage collects the libp2p peerstore every PeerstoreGCInterval, until the
+// context is cancelled. libp2p keeps the addresses of a peer for 30 minutes after it
+// disconnects, and its other records (keys, protocols, agent version) forever.
+func (n *Node) runPeerstoreGC(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.PeerstoreGCInterval)
+	defer ticker.Stop()
+
+	// disconnectedAt is when a collection first found each peer disconnected, so the TTLs
+	// are only accurate to the GC interval
+	disconnectedAt := make(map[peer.ID]time.Time)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.gcPeerstore(disconnectedAt, time.Now())
+		}
+	}
+}
+
+// gcPeerstore shortens the address TTL of newly disconnected peers to PeerstoreAddrTTL, and
+// removes the peers that have been disconnected for PeerstoreRecordTTL.
+func (n *Node) gcPeerstore(disconnectedAt map[peer.ID]time.Time, now time.Time) {
+	ps := n.host.Peerstore()
+
+	var disconnected, removed int
+	for _, pid := range ps.Peers() {
+		if pid == n.host.ID() {
+			continue
+		}
+
+		if n.host.Network().Connectedness(pid) == network.Connected {
+			delete(disconnectedAt, pid)
+			continue
+		}
+
+		since, ok := disconnectedAt[pid]
+		if !ok {
+			disconnectedAt[pid] = now
+			// Identify moves the addresses of disconnected peers to this TTL
+			ps.UpdateAddrs(pid, pstore.RecentlyConnectedAddrTTL, n.cfg.PeerstoreAddrTTL)
+			disconnected++
+			continue
+		}
+
+		if now.Sub(since) >= n.cfg.PeerstoreRecordTTL {
+			// RemovePeer keeps the addresses
+			ps.RemovePeer(pid)
+			ps.ClearAddrs(pid)
+			delete(disconnectedAt, pid)
+			removed++
+		}
+	}
+
+	n.log.Info().
+		Int("peers", len(ps.Peers())).
+		Int("disconnected", disconnected).
+		Int("removed", removed).
+		Msg("Garbage collected libp2p peerstore")
+}
@@ -0,0 +1,75 @@
+package ethereum
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/test"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/rs/zerolog"
+)
+
+func TestGCPeerstore(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	cfg := config.DefaultNodeConfig
+	cfg.PeerstoreAddrTTL = time.Millisecond
+	cfg.PeerstoreRecordTTL = time.Hour
+	n := &Node{host: h, cfg: &cfg, log: zerolog.Nop()}
+
+	pid, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := h.Peerstore()
+	ps.AddAddr(pid, ma.StringCast("/ip4/1.2.3.4/tcp/9000"), pstore.RecentlyConnectedAddrTTL)
+	if err := ps.SetProtocols(pid, "/eth2/beacon_chain/req/status/1/ssz_snappy"); err != nil {
+		t.Fatal(err)
+	}
+
+	disconnectedAt := make(map[peer.ID]time.Time)
+	now := time.Now()
+
+	// The first collection shortens the address TTL, but keeps the other records
+	n.gcPeerstore(disconnectedAt, now)
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := disconnectedAt[pid]; !ok {
+		t.Fatal("expected the peer to be recorded as disconnected")
+	}
+	if addrs := ps.Addrs(pid); len(addrs) != 0 {
+		t.Errorf("expected the addresses to expire after PeerstoreAddrTTL, got %v", addrs)
+	}
+	if protos, _ := ps.GetProtocols(pid); len(protos) != 1 {
+		t.Errorf("expected the protocols to be kept, got %v", protos)
+	}
+
+	// Within PeerstoreRecordTTL, the peer is kept
+	n.gcPeerstore(disconnectedAt, now.Add(time.Minute))
+	if protos, _ := ps.GetProtocols(pid); len(protos) != 1 {
+		t.Errorf("expected the protocols to be kept within PeerstoreRecordTTL, got %v", protos)
+	}
+
+	// After PeerstoreRecordTTL, the peer is removed
+	n.gcPeerstore(disconnectedAt, now.Add(time.Hour))
+	if protos, _ := ps.GetProtocols(pid); len(protos) != 0 {
+		t.Errorf("expected the protocols to be removed, got %v", protos)
+	}
+	if _, ok := disconnectedAt[pid]; ok {
+		t.Error("expected the removed peer to be forgotten")
+	}
+
+	// The host itself is never collected
+	if !slices.Contains(ps.Peers(), h.ID()) {
+		t.Error("expected the host to stay in its peerstore")
+	}
+}
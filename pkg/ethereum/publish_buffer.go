@@ -0,0 +1,246 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+)
+
+type bufferedEvent struct {
+	subject string
+	event   interface{ MsgID() string }
+}
+
+// publishBuffer keeps the events that failed to publish while NATS was disconnected, and
+// publishes them once the connection is back. It holds at most `size` events, the oldest
+// are dropped when it's full. Republished events keep their message ID, so the events that
+// did reach the stream before the disconnect are dropped as duplicates.
+type publishBuffer struct {
+	mu     sync.Mutex
+	events []bufferedEvent
+	size   int
+	// retry flushes the buffer again once the breaker's cooldown passed, stopped by close
+	retry *time.Timer
+
+	// nc is set once connected, the buffer is created before to register the handlers
+	nc  *nats.Conn
+	js  jetstream.JetStream
+	cfg *config.NatsConfig
+
+	// breaker fails publishes right away while NATS keeps failing
+	breaker *circuitBreaker
+
+	// publishers are the runPublisher goroutines, which return once stop is closed and
+	// their channel is empty
+	publishers sync.WaitGroup
+	stop       chan struct{}
+	closing    atomic.Bool
+
+	log zerolog.Logger
+}
+
+// drainTimeout is how long close waits for the events left to be published on shutdown.
+const drainTimeout = 10 * time.Second
+
+func newPublishBuffer(cfg *config.NatsConfig, log zerolog.Logger) *publishBuffer {
+	return &publishBuffer{
+		size:    cfg.PublishBuffer,
+		cfg:     cfg,
+		breaker: newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, log),
+		stop:    make(chan struct{}),
+		log:     log,
+	}
+}
+
+// publish publishes an event through the circuit breaker. While it's open, the event fails
+// with ErrCircuitOpen without reaching NATS: it's still buffered by add if NATS is
+// disconnected, and dropped otherwise.
+func (b *publishBuffer) publish(ctx context.Context, subject string, event interface{ MsgID() string }) (*jetstream.PubAck, error) {
+	ack, err := b.send(ctx, subject, event)
+	if errors.Is(err, ErrCircuitOpen) && b.nc != nil && b.nc.IsConnected() {
+		eventsDroppedBreakerOpen.WithLabelValues(subject).Inc()
+	}
+
+	return ack, err
+}
+
+// send publishes an event through the circuit breaker, without counting the events it
+// refuses as dropped.
+func (b *publishBuffer) send(ctx context.Context, subject string, event interface{ MsgID() string }) (*jetstream.PubAck, error) {
+	if !b.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	ack, err := PublishEvent(ctx, b.js, subject, b.cfg, event)
+	b.breaker.record(err)
+
+	return ack, err
+}
+
+// options returns the NATS connection options that log disconnects and flush the buffer
+// on reconnects.
+func (b *publishBuffer) options() []nats.Option {
+	return []nats.Option{
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			natsDisconnects.Inc()
+			b.log.Warn().Err(err).Msg("Disconnected from NATS, buffering events")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			b.log.Info().Str("url", nc.ConnectedUrlRedacted()).Msg("Reconnected to NATS")
+			go b.flush()
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			if b.closing.Load() {
+				b.log.Info().Msg("NATS connection closed")
+				return
+			}
+			b.log.Error().Msg("NATS connection closed, events are no longer published")
+		}),
+	}
+}
+
+// add buffers an event that failed to publish, if NATS is disconnected. It returns false
+// if the connection is up, so the failure wasn't caused by a disconnect.
+func (b *publishBuffer) add(subject string, event interface{ MsgID() string }) bool {
+	if b.nc != nil && b.nc.IsConnected() {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.size == 0 {
+		eventsDroppedDisconnected.WithLabelValues(subject).Inc()
+		return true
+	}
+
+	if len(b.events) >= b.size {
+		eventsDroppedDisconnected.WithLabelValues(b.events[0].subject).Inc()
+		b.events = b.events[1:]
+	} else {
+		// The node and discovery have a buffer each, so the gauge is their sum
+		eventsBuffered.Inc()
+	}
+
+	b.events = append(b.events, bufferedEvent{subject: subject, event: event})
+
+	return true
+}
+
+// flush publishes the buffered events in order, through the circuit breaker. It stops if
+// the connection drops again, or if the breaker is open, and then tries again once the
+// breaker's cooldown passed. The events that fail for another reason are dropped.
+func (b *publishBuffer) flush() {
+	b.mu.Lock()
+	events := b.events
+	b.events = nil
+	eventsBuffered.Sub(float64(len(events)))
+	b.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	b.log.Info().Int("events", len(events)).Msg("Publishing buffered events")
+
+	for i, e := range events {
+		publishCtx, publishCancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err := b.send(publishCtx, e.subject, e.event)
+		publishCancel()
+
+		if err == nil {
+			continue
+		}
+
+		if !b.nc.IsConnected() {
+			b.requeue(events[i:])
+			return
+		}
+
+		if errors.Is(err, ErrCircuitOpen) {
+			b.log.Warn().Int("events", len(events)-i).Dur("retry_in", b.cfg.BreakerCooldown).Msg("Circuit breaker open, keeping buffered events")
+			b.requeue(events[i:])
+			b.retryFlush()
+			return
+		}
+
+		b.log.Error().Err(err).Str("subject", e.subject).Msg("Failed to publish buffered event")
+	}
+}
+
+// requeue puts events that weren't flushed back in front of the events buffered in the
+// meantime, dropping the oldest if the buffer is full.
+func (b *publishBuffer) requeue(events []bufferedEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := len(b.events)
+	b.events = append(events, b.events...)
+	if drop := len(b.events) - b.size; drop > 0 {
+		for _, dropped := range b.events[:drop] {
+			eventsDroppedDisconnected.WithLabelValues(dropped.subject).Inc()
+		}
+		b.events = b.events[drop:]
+	}
+	eventsBuffered.Add(float64(len(b.events) - prev))
+}
+
+// retryFlush schedules a flush once the breaker's cooldown passed, unless the buffer is
+// closing.
+func (b *publishBuffer) retryFlush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closing.Load() {
+		return
+	}
+
+	if b.retry != nil {
+		b.retry.Stop()
+	}
+	b.retry = time.AfterFunc(b.cfg.BreakerCooldown, func() {
+		if !b.closing.Load() {
+			b.flush()
+		}
+	})
+}
+
+// close stops the publishers once they published the events left in their channels,
+// publishes the buffered events and closes the NATS connection. The events that aren't
+// published within drainTimeout are dropped. Events sent to the channels afterwards
+// aren't published.
+func (b *publishBuffer) close() {
+	b.closing.Store(true)
+	close(b.stop)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.publishers.Wait()
+		b.flush()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+		b.log.Warn().Dur("timeout", drainTimeout).Msg("Timed out publishing the events left before closing NATS")
+	}
+
+	b.mu.Lock()
+	if b.retry != nil {
+		b.retry.Stop()
+	}
+	if len(b.events) > 0 {
+		b.log.Warn().Int("events", len(b.events)).Msg("Dropped buffered events on shutdown")
+	}
+	b.mu.Unlock()
+
+	b.nc.Close()
+}
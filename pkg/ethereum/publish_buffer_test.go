@@ -0,0 +1,70 @@
+package ethereum
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/types"
+	"github.com/rs/zerolog"
+)
+
+func TestPublishBufferDropsOldest(t *testing.T) {
+	b := newPublishBuffer(&config.NatsConfig{PublishBuffer: 2}, zerolog.Nop())
+
+	// Without a connection, every event is buffered
+	for i := int64(1); i <= 3; i++ {
+		if !b.add(types.SubjectHeartbeat, &types.HeartbeatEvent{Timestamp: i}) {
+			t.Fatal("expected the event to be buffered")
+		}
+	}
+
+	if len(b.events) != 2 {
+		t.Fatalf("expected 2 buffered events, got %d", len(b.events))
+	}
+	if first := b.events[0].event.(*types.HeartbeatEvent); first.Timestamp != 2 {
+		t.Fatalf("expected the oldest event to be dropped, first is %d", first.Timestamp)
+	}
+}
+
+func TestPublishersDrainOnStop(t *testing.T) {
+	b := newPublishBuffer(&config.NatsConfig{PublishBuffer: 10, BreakerThreshold: 1, BreakerCooldown: time.Hour}, zerolog.Nop())
+
+	// With the breaker open and no connection, every publish fails and is buffered
+	b.breaker.record(errors.New("publish failed"))
+
+	ch := make(chan *types.HeartbeatEvent, 3)
+	for i := int64(1); i <= 3; i++ {
+		ch <- &types.HeartbeatEvent{Timestamp: i}
+	}
+
+	startPublisher(ch, types.SubjectHeartbeat, b, zerolog.Nop())
+	close(b.stop)
+	b.publishers.Wait()
+
+	if len(ch) != 0 {
+		t.Fatalf("expected the publisher to empty its channel before stopping, %d left", len(ch))
+	}
+	if len(b.events) != 3 {
+		t.Fatalf("expected 3 buffered events, got %d", len(b.events))
+	}
+}
+
+func TestRetryFlushStoppedByClose(t *testing.T) {
+	b := newPublishBuffer(&config.NatsConfig{PublishBuffer: 10, BreakerCooldown: time.Hour}, zerolog.Nop())
+
+	b.retryFlush()
+	if b.retry == nil {
+		t.Fatal("expected a flush to be scheduled")
+	}
+	b.retry.Stop()
+	b.retry = nil
+
+	// Once closing, the connection is about to be closed and no flush is scheduled
+	b.closing.Store(true)
+	b.retryFlush()
+	if b.retry != nil {
+		t.Fatal("expected no flush to be scheduled while closing")
+	}
+}
@@ -0,0 +1,60 @@
+package ethereum
+
+import (
+	"github.com/chainbound/valtrack/config"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/rs/zerolog"
+)
+
+// resourceLimits returns the system limits of the libp2p resource manager: the libp2p
+// defaults scaled to the machine, with the configured maximums replacing them. A maximum
+// applies to both directions, so a crawler that mostly dials isn't capped by the outbound
+// share of the limit.
+func resourceLimits(cfg *config.NodeConfig) rcmgr.ConcreteLimitConfig {
+	limits := rcmgr.DefaultLimits
+	libp2p.SetDefaultServiceLimits(&limits)
+
+	var system rcmgr.ResourceLimits
+	if cfg.ResourceMaxConns > 0 {
+		conns := rcmgr.LimitVal(cfg.ResourceMaxConns)
+		system.Conns, system.ConnsInbound, system.ConnsOutbound = conns, conns, conns
+	}
+
+	if cfg.ResourceMaxStreams > 0 {
+		streams := rcmgr.LimitVal(cfg.ResourceMaxStreams)
+		system.Streams, system.StreamsInbound, system.StreamsOutbound = streams, streams, streams
+	}
+
+	if cfg.ResourceMaxMemoryMB > 0 {
+		system.Memory = rcmgr.LimitVal64(int64(cfg.ResourceMaxMemoryMB) << 20)
+	}
+
+	return rcmgr.PartialLimitConfig{System: system}.Build(limits.AutoScale())
+}
+
+// newResourceManager creates the libp2p resource manager of the host, or one that doesn't
+// limit anything with DisableResourceManager, and logs the effective limits.
+func newResourceManager(cfg *config.NodeConfig, log zerolog.Logger) (network.ResourceManager, error) {
+	if cfg.DisableResourceManager {
+		log.Warn().Msg("libp2p resource manager disabled, connections and streams are not limited")
+		return &network.NullResourceManager{}, nil
+	}
+
+	limiter := rcmgr.NewFixedLimiter(resourceLimits(cfg))
+
+	system := limiter.GetSystemLimits()
+	log.Info().
+		Int("conns", system.GetConnTotalLimit()).
+		Int("conns_inbound", system.GetConnLimit(network.DirInbound)).
+		Int("conns_outbound", system.GetConnLimit(network.DirOutbound)).
+		Int("streams", system.GetStreamTotalLimit()).
+		Int("streams_inbound", system.GetStreamLimit(network.DirInbound)).
+		Int("streams_outbound", system.GetStreamLimit(network.DirOutbound)).
+		Int64("memory_mb", system.GetMemoryLimit()>>20).
+		Int("fd", system.GetFDLimit()).
+		Msg("libp2p resource manager limits")
+
+	return rcmgr.NewResourceManager(limiter)
+}
@@ -0,0 +1,32 @@
+package ethereum
+
+import (
+	"testing"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+)
+
+func TestResourceLimits(t *testing.T) {
+	defaults := resourceLimits(&config.NodeConfig{}).ToPartialLimitConfig().System
+
+	system := rcmgr.NewFixedLimiter(resourceLimits(&config.NodeConfig{
+		ResourceMaxConns:    5000,
+		ResourceMaxStreams:  20000,
+		ResourceMaxMemoryMB: 2048,
+	})).GetSystemLimits()
+
+	if got := system.GetConnLimit(network.DirOutbound); got != 5000 {
+		t.Errorf("expected 5000 outbound conns, got %d", got)
+	}
+	if got := system.GetStreamTotalLimit(); got != 20000 {
+		t.Errorf("expected 20000 streams, got %d", got)
+	}
+	if got := system.GetMemoryLimit(); got != 2048<<20 {
+		t.Errorf("expected 2GB of memory, got %d", got)
+	}
+	if got := system.GetFDLimit(); got != int(defaults.FD) {
+		t.Errorf("expected the default FD limit %d, got %d", defaults.FD, got)
+	}
+}
@@ -0,0 +1,56 @@
+package ethereum
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/types"
+)
+
+// redactPeerDiscovered redacts the fields of the event configured in `cfg`. IPVersion is
+// kept, so the redacted events can still be aggregated by IP version.
+func redactPeerDiscovered(cfg *config.RedactionConfig, event *types.PeerDiscoveredEvent) {
+	switch cfg.IP {
+	case config.RedactTruncate:
+		event.IP = truncateIP(event.IP)
+	case config.RedactHMAC:
+		event.IP = hmacIP(cfg.Key, event.IP)
+	}
+
+	if cfg.ENR == config.RedactDrop {
+		event.ENR = ""
+	}
+
+	if cfg.Port == config.RedactDrop {
+		event.Port = 0
+	}
+}
+
+// truncateIP zeroes the last octet of an IPv4 address, or all but the /48 prefix of an IPv6
+// address. Anything else is dropped.
+func truncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// hmacIP returns the hex-encoded HMAC-SHA256 of the IP, truncated to 16 bytes.
+func hmacIP(key []byte, ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,42 @@
+package ethereum
+
+import (
+	"testing"
+
+	"github.com/chainbound/valtrack/config"
+	"github.com/chainbound/valtrack/types"
+)
+
+func TestTruncateIP(t *testing.T) {
+	for ip, want := range map[string]string{
+		"8.8.8.8":               "8.8.8.0",
+		"2001:db8:1:2::1":       "2001:db8:1::",
+		"::ffff:192.168.10.254": "192.168.10.0",
+		"invalid":               "",
+	} {
+		if got := truncateIP(ip); got != want {
+			t.Errorf("%s: expected %q, got %q", ip, want, got)
+		}
+	}
+}
+
+func TestRedactPeerDiscovered(t *testing.T) {
+	cfg := &config.RedactionConfig{IP: config.RedactHMAC, ENR: config.RedactDrop, Key: []byte("secret")}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	event := &types.PeerDiscoveredEvent{ENR: "enr:-abc", IP: "8.8.8.8", Port: 9000, IPVersion: 4}
+	redactPeerDiscovered(cfg, event)
+
+	if event.ENR != "" || event.Port != 9000 || event.IPVersion != 4 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event.IP == "8.8.8.8" || len(event.IP) != 32 || event.IP != hmacIP([]byte("secret"), "8.8.8.8") {
+		t.Fatalf("expected a stable HMAC of the IP, got %q", event.IP)
+	}
+
+	if err := (&config.RedactionConfig{IP: config.RedactHMAC}).Validate(); err == nil {
+		t.Fatal("expected an error for the hmac mode without a key")
+	}
+}
@@ -0,0 +1,126 @@
+package ethereum
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// redialDelay is the delay before the first redial of a disconnected peer. Every following
+// attempt waits one more delay.
+const redialDelay = 30 * time.Second
+
+// redialer keeps track of the peers we handshaked with, so they can be redialed when they
+// disconnect from us. Disconnects we caused ourselves (with a goodbye) are not redialed.
+type redialer struct {
+	mu sync.Mutex
+
+	maxRetries int
+	// handshaked holds the addresses of the peers we completed a handshake with
+	handshaked *lruCache[peer.ID, peer.AddrInfo]
+	// attempts counts the redials since the last successful handshake
+	attempts map[peer.ID]int
+	// goodbyes holds the peers we are disconnecting from ourselves
+	goodbyes map[peer.ID]struct{}
+	closing  bool
+}
+
+func newRedialer(size, maxRetries int) *redialer {
+	r := &redialer{
+		maxRetries: maxRetries,
+		attempts:   make(map[peer.ID]int),
+		goodbyes:   make(map[peer.ID]struct{}),
+	}
+
+	r.handshaked = newLRUCache(size, nil, func(id peer.ID, _ peer.AddrInfo) {
+		delete(r.attempts, id)
+	})
+
+	return r
+}
+
+// handshakeSucceeded records a peer as redialable, and resets its attempts.
+func (r *redialer) handshakeSucceeded(info peer.AddrInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handshaked.Add(info.ID, info)
+	delete(r.attempts, info.ID)
+}
+
+// expectDisconnect marks the next disconnect of the peer as intentional.
+func (r *redialer) expectDisconnect(id peer.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.goodbyes[id] = struct{}{}
+}
+
+// close stops all future redials, e.g. when shutting down.
+func (r *redialer) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closing = true
+}
+
+func (r *redialer) isClosing() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.closing
+}
+
+// next returns the peer to redial after a disconnect and how long to wait before doing so,
+// or false if the peer shouldn't be redialed.
+func (r *redialer) next(id peer.ID) (peer.AddrInfo, time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.goodbyes[id]; ok {
+		delete(r.goodbyes, id)
+		return peer.AddrInfo{}, 0, false
+	}
+
+	info, ok := r.handshaked.Peek(id)
+	if !ok || r.closing {
+		return peer.AddrInfo{}, 0, false
+	}
+
+	if r.attempts[id] >= r.maxRetries {
+		r.handshaked.Remove(id)
+		delete(r.attempts, id)
+		return peer.AddrInfo{}, 0, false
+	}
+
+	r.attempts[id]++
+
+	return info, redialDelay * time.Duration(r.attempts[id]), true
+}
+
+// scheduleRedial redials a peer that disconnected from us after a successful handshake,
+// unless it's backed off (then the reconnection timer takes care of it).
+func (n *Node) scheduleRedial(pid peer.ID) {
+	info, delay, ok := n.redialer.next(pid)
+	if !ok || n.peerstore.IsBackedOff(pid) {
+		return
+	}
+
+	n.log.Debug().Str("peer", pid.String()).Dur("delay", delay).Msg("Scheduling redial of disconnected peer")
+
+	time.AfterFunc(delay, func() {
+		// The peer may have reconnected in the meantime
+		if n.redialer.isClosing() || n.peerstore.State(pid) == Connecting || n.host.Network().Connectedness(pid) == network.Connected {
+			return
+		}
+
+		select {
+		case n.reconnectChan <- info:
+			redials.Inc()
+		default:
+			n.log.Debug().Str("peer", pid.String()).Msg("Reconnect queue is full, dropping redial")
+		}
+	})
+}
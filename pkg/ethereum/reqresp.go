@@ -31,6 +31,10 @@ type ReqRespConfig struct {
 
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// Attnets and Syncnets are the subnets advertised in our metadata, all attnets if nil
+	Attnets  bitfield.Bitvector64
+	Syncnets bitfield.Bitvector4
 }
 
 // ReqResp handles request-response operations for the node.
@@ -58,13 +62,20 @@ func NewReqResp(h host.Host, peerstore *Peerstore, cfg *ReqRespConfig) (*ReqResp
 
 	md := &pb.MetaDataV1{
 		SeqNumber: 0,
-		Attnets:   bitfield.NewBitvector64(),
-		Syncnets:  bitfield.Bitvector4{byte(0x00)},
+		Attnets:   cfg.Attnets,
+		Syncnets:  cfg.Syncnets,
 	}
 
 	// fake to support all attnets
-	for i := uint64(0); i < md.Attnets.Len(); i++ {
-		md.Attnets.SetBitAt(i, true)
+	if md.Attnets == nil {
+		md.Attnets = bitfield.NewBitvector64()
+		for i := uint64(0); i < md.Attnets.Len(); i++ {
+			md.Attnets.SetBitAt(i, true)
+		}
+	}
+
+	if md.Syncnets == nil {
+		md.Syncnets = bitfield.NewBitvector4()
 	}
 
 	p := &ReqResp{
@@ -334,11 +345,12 @@ func (r *ReqResp) Status(ctx context.Context, pid peer.ID) (status *pb.Status, e
 	return resp, nil
 }
 
-// Ping sends a ping request to the given peer.
-func (r *ReqResp) Ping(ctx context.Context, pid peer.ID) error {
+// Ping sends a ping request to the given peer and returns the round trip time. The RTT
+// only covers writing the request and reading the response, not opening the stream.
+func (r *ReqResp) Ping(ctx context.Context, pid peer.ID) (time.Duration, error) {
 	stream, err := r.host.NewStream(ctx, pid, r.protocolID(p2p.RPCPingTopicV1))
 	if err != nil {
-		return fmt.Errorf("failed to open ping stream to peer %s: %w", pid, err)
+		return 0, fmt.Errorf("failed to open ping stream to peer %s: %w", pid, err)
 	}
 	defer stream.Close()
 
@@ -346,18 +358,20 @@ func (r *ReqResp) Ping(ctx context.Context, pid peer.ID) error {
 	seqNum := r.metaData.SeqNumber
 	r.metaDataMu.RUnlock()
 
+	start := time.Now()
+
 	req := primitives.SSZUint64(seqNum)
 	if err := r.writeRequest(ctx, stream, &req); err != nil {
-		return fmt.Errorf("write ping request: %w", err)
+		return 0, fmt.Errorf("write ping request: %w", err)
 	}
 
 	// read and decode status response
 	resp := new(primitives.SSZUint64)
 	if err := r.readResponse(ctx, stream, resp); err != nil {
-		return fmt.Errorf("read ping response: %w", err)
+		return 0, fmt.Errorf("read ping response: %w", err)
 	}
 
-	return nil
+	return time.Since(start), nil
 }
 
 // MetaData sends a metadata request to the given peer.
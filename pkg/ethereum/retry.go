@@ -0,0 +1,36 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// isRetriable reports whether a req/resp request failed transiently, so that retrying it
+// right away is likely to succeed. Busy peers often reset streams, while errors like a
+// closed connection or an error response fail again.
+func isRetriable(err error) bool {
+	return errors.Is(err, network.ErrReset)
+}
+
+// retryRequest sends the req/resp request `name` to the peer, and retries it up to `retries`
+// times, `delay` apart, as long as it fails with a retriable error.
+func retryRequest[T any](ctx context.Context, retries int, delay time.Duration, name string, pid peer.ID, req func(context.Context, peer.ID) (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := req(ctx, pid)
+		if err == nil || attempt >= retries || !isRetriable(err) {
+			return res, err
+		}
+
+		handshakeRetries.WithLabelValues(name).Inc()
+
+		select {
+		case <-ctx.Done():
+			return res, err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pb "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+// fakeReqResp fails the first `failures` status requests with `err`.
+type fakeReqResp struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *fakeReqResp) Status(ctx context.Context, pid peer.ID) (*pb.Status, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+
+	return &pb.Status{HeadSlot: 1}, nil
+}
+
+func TestRetryRequest(t *testing.T) {
+	reset := fmt.Errorf("read status response: %w", network.ErrReset)
+	fatal := errors.New("received error response (code 1)")
+
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "success", wantCalls: 1},
+		{name: "reset once", failures: 1, err: reset, wantCalls: 2},
+		{name: "reset twice", failures: 2, err: reset, wantCalls: 2, wantErr: true},
+		{name: "fatal error", failures: 1, err: fatal, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := &fakeReqResp{failures: tt.failures, err: tt.err}
+
+			st, err := retryRequest(context.Background(), 1, 0, "status", peer.ID("peer"), rr.Status)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && st.HeadSlot != 1 {
+				t.Fatalf("unexpected status %v", st)
+			}
+			if rr.calls != tt.wantCalls {
+				t.Fatalf("expected %d calls, got %d", tt.wantCalls, rr.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package ethereum
+
+// EventSchemaVersion is the version of the PeerDiscoveredEvent and MetadataReceivedEvent
+// wire format, set on every published event. Bump it whenever one of the event structs
+// in the types package changes, and add the change below.
+//
+//	0: unversioned events, produced before the schema_version field existed
+//	1: crawler_version on both events, ping_latency_ms and ping_min_latency_ms on metadata_received
+//	2: protocols on metadata_received
+//	3: attnets_changed events
+//	4: multiaddrs and private_addr on metadata_received, whose multiaddr is now the most public address
+//	5: clock_offset_ms and clock_synced on all events
+//	6: enr_seq and prev_enr_seq on peer_discovered
+//	7: client_diversity events
+//	8: heartbeat events
+//	9: remote_addr and direction on metadata_received
+//	10: handshake_failed events
+//	11: fork_digest on handshake_failed
+//	12: distance on peer_discovered
+//	13: ip_version on peer_discovered, which now carries the IPv6 address of IPv6-only peers
+//	14: suspicious_peer events
+//	15: partial on metadata_received
+//	16: source on peer_discovered
+//	17: observed_at on peer_discovered and metadata_received
+//	18: beacon_connected on metadata_received
+//	19: peer_churn events
+//	20: beacon_connected on peer_discovered
+const EventSchemaVersion = 20
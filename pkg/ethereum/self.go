@@ -0,0 +1,72 @@
+package ethereum
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+// SelfInfo is how other nodes can reach the sentry.
+type SelfInfo struct {
+	PeerID string `json:"peer_id"`
+	// ENR is only set when running the discv5 walk
+	ENR    string `json:"enr,omitempty"`
+	NodeID string `json:"node_id,omitempty"`
+	EnrSeq uint64 `json:"enr_seq,omitempty"`
+	// ForkDigest is the fork digest advertised in the ENR, or the configured one without it
+	ForkDigest    string   `json:"fork_digest"`
+	ListenAddrs   []string `json:"listen_addrs"`
+	AnnounceAddrs []string `json:"announce_addrs"`
+	// Attnets and Syncnets are the hex-encoded subnets advertised in the ENR and metadata
+	Attnets  string `json:"attnets"`
+	Syncnets string `json:"syncnets"`
+}
+
+// Self returns the local node's peer ID, ENR and addresses.
+func (n *Node) Self() SelfInfo {
+	info := SelfInfo{
+		PeerID:        n.host.ID().String(),
+		ForkDigest:    "0x" + hex.EncodeToString(n.cfg.ForkDigest[:]),
+		ListenAddrs:   []string{},
+		AnnounceAddrs: []string{},
+	}
+
+	n.reqResp.metaDataMu.RLock()
+	info.Attnets = hex.EncodeToString(n.reqResp.metaData.Attnets)
+	info.Syncnets = hex.EncodeToString(n.reqResp.metaData.Syncnets)
+	n.reqResp.metaDataMu.RUnlock()
+
+	for _, addr := range n.host.Network().ListenAddresses() {
+		info.ListenAddrs = append(info.ListenAddrs, addr.String())
+	}
+
+	for _, addr := range n.host.Addrs() {
+		info.AnnounceAddrs = append(info.AnnounceAddrs, addr.String())
+	}
+
+	if n.disc != nil {
+		self := n.disc.Dv5Listener.Self()
+		info.ENR = self.String()
+		info.NodeID = self.ID().String()
+		info.EnrSeq = self.Seq()
+
+		if enr, err := ParseEnr(self); err == nil {
+			info.ForkDigest = enr.Eth2Data.ForkDigest.String()
+		}
+	}
+
+	return info
+}
+
+// SelfHandler serves the local node's peer ID, ENR and addresses as JSON.
+func (n *Node) SelfHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(n.Self()); err != nil {
+		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,198 @@
+package ethereum
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chainbound/valtrack/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/rs/zerolog"
+)
+
+// staticPeerRedialInterval is how often static peers that aren't connected are redialed.
+const staticPeerRedialInterval = 30 * time.Second
+
+// StaticPeer is a peer from the peers file. Node is only set for peers given as an ENR.
+type StaticPeer struct {
+	AddrInfo peer.AddrInfo
+	Node     *enode.Node
+}
+
+// ParseStaticPeer parses an ENR (`enr:...`) or a multiaddr that includes the peer ID
+// (`/ip4/1.2.3.4/tcp/9000/p2p/16Uiu2...`).
+func ParseStaticPeer(s string) (*StaticPeer, error) {
+	if strings.HasPrefix(s, "enr:") {
+		node, err := enode.Parse(enode.ValidSchemes, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENR: %w", err)
+		}
+
+		enr, err := ParseEnr(node)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := enr.GetPeerID()
+		if err != nil {
+			return nil, err
+		}
+
+		if enr.TCP == 0 {
+			return nil, fmt.Errorf("ENR has no TCP port")
+		}
+
+		maddr, err := MaddrFrom(enr.IP.String(), uint(enr.TCP))
+		if err != nil {
+			return nil, fmt.Errorf("ENR has no usable IP address: %w", err)
+		}
+
+		return &StaticPeer{AddrInfo: peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{maddr}}, Node: node}, nil
+	}
+
+	info, err := peer.AddrInfoFromString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multiaddr: %w", err)
+	}
+
+	return &StaticPeer{AddrInfo: *info}, nil
+}
+
+// LoadStaticPeers reads a peers file with one ENR or multiaddr per line. Empty lines
+// and lines starting with `#` are ignored, as are duplicates of an earlier peer.
+func LoadStaticPeers(path string) ([]*StaticPeer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open peers file: %w", err)
+	}
+	defer f.Close()
+
+	logger := log.NewLogger("static_peers")
+
+	var (
+		peers   []*StaticPeer
+		seen    = make(map[peer.ID]struct{})
+		scanner = bufio.NewScanner(f)
+		lineNum = 0
+	)
+
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sp, err := ParseStaticPeer(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+
+		if _, ok := seen[sp.AddrInfo.ID]; ok {
+			logger.Warn().Str("peer", sp.AddrInfo.ID.String()).Int("line", lineNum).Msg("Skipping duplicate peer in peers file")
+			continue
+		}
+
+		seen[sp.AddrInfo.ID] = struct{}{}
+		peers = append(peers, sp)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read peers file: %w", err)
+	}
+
+	return peers, nil
+}
+
+// StaticDiscoverer is a Discoverer that yields a fixed set of peers instead of walking
+// the DHT, and keeps redialing the ones that aren't connected.
+type StaticDiscoverer struct {
+	peers []*StaticPeer
+	out   chan peer.AddrInfo
+	// skip reports whether a peer is connected (or being connected to) and shouldn't be
+	// dialed again. If nil, every peer is redialed on every interval.
+	skip func(peer.ID) bool
+
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	log    zerolog.Logger
+}
+
+// NewStaticDiscoverer creates a discoverer for the given peers.
+func NewStaticDiscoverer(peers []*StaticPeer, skip func(peer.ID) bool) *StaticDiscoverer {
+	return &StaticDiscoverer{
+		peers: peers,
+		out:   make(chan peer.AddrInfo),
+		skip:  skip,
+		log:   log.NewLogger("static_peers"),
+	}
+}
+
+func (s *StaticDiscoverer) Peers() <-chan peer.AddrInfo {
+	return s.out
+}
+
+// ENR returns the ENR of a peer that was given as an ENR.
+func (s *StaticDiscoverer) ENR(id peer.ID) (enode.Node, bool) {
+	for _, sp := range s.peers {
+		if sp.AddrInfo.ID == id && sp.Node != nil {
+			return *sp.Node, true
+		}
+	}
+
+	return enode.Node{}, false
+}
+
+// Start sends all peers, and then every staticPeerRedialInterval the ones that aren't
+// connected, until stopped.
+func (s *StaticDiscoverer) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	defer close(s.out)
+
+	s.log.Info().Int("peers", len(s.peers)).Msg("Dialing static peers")
+
+	ticker := time.NewTicker(staticPeerRedialInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, sp := range s.peers {
+			if s.skip != nil && s.skip(sp.AddrInfo.ID) {
+				continue
+			}
+
+			select {
+			case s.out <- sp.AddrInfo:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *StaticDiscoverer) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
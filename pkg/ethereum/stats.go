@@ -0,0 +1,159 @@
+package ethereum
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// CrawlStats is a summary of the current crawl, served on /stats.
+type CrawlStats struct {
+	StartedAt          time.Time         `json:"started_at"`
+	UptimeSeconds      int64             `json:"uptime_seconds"`
+	PeersDiscovered    uint64            `json:"peers_discovered"`
+	PeersConnected     int               `json:"peers_connected"`
+	HandshakeSuccesses uint64            `json:"handshake_successes"`
+	HandshakeFailures  uint64            `json:"handshake_failures"`
+	ClientVersions     map[string]uint64 `json:"client_versions"`
+	// UniquePeersEstimate is the estimated number of distinct peers that connected, only
+	// with --unique-peers-precision
+	UniquePeersEstimate uint64 `json:"unique_peers_estimate,omitempty"`
+	// ClientHandshakes are the handshake outcomes per client release (e.g. "lighthouse/v5.1.3")
+	ClientHandshakes map[string]ClientHandshakeStats `json:"client_handshakes"`
+}
+
+// ClientHandshakeStats counts the handshakes with the peers of a client release.
+type ClientHandshakeStats struct {
+	Successes   uint64  `json:"successes"`
+	Failures    uint64  `json:"failures"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// crawlStats keeps running totals for the stats endpoint, so serving it doesn't need to
+// walk the peerstore.
+type crawlStats struct {
+	startedAt time.Time
+
+	handshakeSuccesses atomic.Uint64
+	handshakeFailures  atomic.Uint64
+
+	mu sync.Mutex
+	// clientVersions counts the successful handshakes per client version
+	clientVersions map[string]uint64
+	// clientHandshakes counts the handshakes per client release
+	clientHandshakes map[string]*ClientHandshakeStats
+}
+
+func newCrawlStats() *crawlStats {
+	return &crawlStats{
+		startedAt:        time.Now(),
+		clientVersions:   make(map[string]uint64),
+		clientHandshakes: make(map[string]*ClientHandshakeStats),
+	}
+}
+
+func (s *crawlStats) recordHandshake(clientVersion string) {
+	s.handshakeSuccesses.Add(1)
+
+	s.mu.Lock()
+	s.clientVersions[clientVersion]++
+	s.mu.Unlock()
+
+	s.recordClientHandshake(clientVersion, true)
+}
+
+// recordClientHandshake counts a handshake outcome per client release of the agent version.
+func (s *crawlStats) recordClientHandshake(agentVersion string, success bool) {
+	client, release := ClientRelease(agentVersion)
+
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	clientHandshakes.WithLabelValues(client, release, result).Inc()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := client + "/" + release
+	counts, ok := s.clientHandshakes[key]
+	if !ok {
+		counts = &ClientHandshakeStats{}
+		s.clientHandshakes[key] = counts
+	}
+
+	if success {
+		counts.Successes++
+	} else {
+		counts.Failures++
+	}
+}
+
+// recordHandshakeFailure counts a failed handshake in the stats and the failure metrics.
+// The peer's agent version is unknown if identify didn't complete before the failure.
+func (n *Node) recordHandshakeFailure(pid peer.ID, err error) {
+	n.stats.handshakeFailures.Add(1)
+	handshakeFailures.WithLabelValues(handshakeFailureReason(err)).Inc()
+
+	agentVersion := "unknown"
+	if v, err := n.host.Peerstore().Get(pid, "AgentVersion"); err == nil {
+		agentVersion, _ = v.(string)
+	}
+	n.stats.recordClientHandshake(agentVersion, false)
+}
+
+// Stats returns a summary of the current crawl.
+func (n *Node) Stats() CrawlStats {
+	n.stats.mu.Lock()
+	versions := make(map[string]uint64, len(n.stats.clientVersions))
+	for v, count := range n.stats.clientVersions {
+		versions[v] = count
+	}
+	clients := make(map[string]ClientHandshakeStats, len(n.stats.clientHandshakes))
+	for key, counts := range n.stats.clientHandshakes {
+		c := *counts
+		c.SuccessRate = float64(c.Successes) / float64(c.Successes+c.Failures)
+		clients[key] = c
+	}
+	n.stats.mu.Unlock()
+
+	// Only the discv5 walk counts discovered peers
+	var discovered uint64
+	if n.disc != nil {
+		discovered = n.disc.discovered.Load()
+	}
+
+	var uniquePeers uint64
+	if n.uniquePeers != nil {
+		uniquePeers = n.uniquePeers.Estimate()
+	}
+
+	return CrawlStats{
+		StartedAt:           n.stats.startedAt,
+		UptimeSeconds:       int64(time.Since(n.stats.startedAt).Seconds()),
+		PeersDiscovered:     discovered,
+		PeersConnected:      len(n.host.Network().Peers()),
+		HandshakeSuccesses:  n.stats.handshakeSuccesses.Load(),
+		HandshakeFailures:   n.stats.handshakeFailures.Load(),
+		ClientVersions:      versions,
+		UniquePeersEstimate: uniquePeers,
+		ClientHandshakes:    clients,
+	}
+}
+
+// StatsHandler serves the crawl summary as JSON.
+func (n *Node) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(n.Stats()); err != nil {
+		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+	}
+}
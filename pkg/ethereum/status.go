@@ -0,0 +1,150 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/prysmaticlabs/prysm/v5/consensus-types/primitives"
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+// staleStatusSlots is how far behind the clock the head slot of our status can be before
+// it's bumped to the computed slot, when the beacon API is unavailable. Heads learned from
+// peers are usually a few slots behind, and have real roots, so they're kept.
+const staleStatusSlots = 32
+
+// runStatusRefresher refreshes the status every StatusInterval, until the context is
+// cancelled.
+func (n *Node) runStatusRefresher(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.StatusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.refreshStatus(ctx)
+		}
+	}
+}
+
+// refreshStatus updates the head and finalized checkpoint of our status from the beacon
+// API. Without it, or when it fails, the head slot is computed from the clock if ours fell
+// behind, so peers don't reject our status as obviously stale.
+func (n *Node) refreshStatus(ctx context.Context) {
+	status := n.reqResp.cpyStatus()
+	if status == nil {
+		return
+	}
+
+	if n.cfg.BeaconAPI != "" {
+		reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		err := fetchBeaconStatus(reqCtx, n.cfg.BeaconAPI, status)
+		if err == nil {
+			n.reqResp.SetStatus(status)
+			return
+		}
+
+		n.dialAddrLog.Warn().Err(err).Str("beacon_api", n.cfg.BeaconAPI).Msg("Failed to fetch the status from the beacon API, computing the head slot")
+	}
+
+	slot := currentSlot(time.Unix(n.cfg.GenesisTime, 0), n.cfg.BeaconConfig.SecondsPerSlot, time.Now())
+	if status.HeadSlot+staleStatusSlots < slot {
+		status.HeadSlot = slot
+		n.reqResp.SetStatus(status)
+	}
+}
+
+// currentSlot returns the slot at `now`, 0 before genesis.
+func currentSlot(genesis time.Time, secondsPerSlot uint64, now time.Time) primitives.Slot {
+	if secondsPerSlot == 0 || now.Before(genesis) {
+		return 0
+	}
+
+	return primitives.Slot(uint64(now.Sub(genesis).Seconds()) / secondsPerSlot)
+}
+
+// fetchBeaconStatus sets the head and the finalized checkpoint of status to the ones of the
+// beacon node at baseURL.
+func fetchBeaconStatus(ctx context.Context, baseURL string, status *eth.Status) error {
+	var head struct {
+		Data struct {
+			Root   string `json:"root"`
+			Header struct {
+				Message struct {
+					Slot string `json:"slot"`
+				} `json:"message"`
+			} `json:"header"`
+		} `json:"data"`
+	}
+	if err := getBeaconAPI(ctx, baseURL, "/eth/v1/beacon/headers/head", &head); err != nil {
+		return err
+	}
+
+	var finality struct {
+		Data struct {
+			Finalized struct {
+				Epoch string `json:"epoch"`
+				Root  string `json:"root"`
+			} `json:"finalized"`
+		} `json:"data"`
+	}
+	if err := getBeaconAPI(ctx, baseURL, "/eth/v1/beacon/states/head/finality_checkpoints", &finality); err != nil {
+		return err
+	}
+
+	headSlot, err := strconv.ParseUint(head.Data.Header.Message.Slot, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid head slot: %w", err)
+	}
+	headRoot, err := hexutil.Decode(head.Data.Root)
+	if err != nil {
+		return fmt.Errorf("invalid head root: %w", err)
+	}
+
+	finalizedEpoch, err := strconv.ParseUint(finality.Data.Finalized.Epoch, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid finalized epoch: %w", err)
+	}
+	finalizedRoot, err := hexutil.Decode(finality.Data.Finalized.Root)
+	if err != nil {
+		return fmt.Errorf("invalid finalized root: %w", err)
+	}
+
+	status.HeadSlot = primitives.Slot(headSlot)
+	status.HeadRoot = headRoot
+	status.FinalizedEpoch = primitives.Epoch(finalizedEpoch)
+	status.FinalizedRoot = finalizedRoot
+
+	return nil
+}
+
+// getBeaconAPI decodes the JSON response of a beacon API endpoint into v.
+func getBeaconAPI(ctx context.Context, baseURL, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
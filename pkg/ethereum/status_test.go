@@ -0,0 +1,53 @@
+package ethereum
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+func TestCurrentSlot(t *testing.T) {
+	genesis := time.Unix(1606824023, 0)
+
+	if got := currentSlot(genesis, 12, genesis.Add(-time.Hour)); got != 0 {
+		t.Errorf("expected slot 0 before genesis, got %d", got)
+	}
+	if got := currentSlot(genesis, 12, genesis.Add(121*time.Second)); got != 10 {
+		t.Errorf("expected slot 10, got %d", got)
+	}
+}
+
+func TestFetchBeaconStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/eth/v1/beacon/headers/head":
+			w.Write([]byte(`{"data":{"root":"0x0102","canonical":true,"header":{"message":{"slot":"9000000"}}}}`))
+		case "/eth/v1/beacon/states/head/finality_checkpoints":
+			w.Write([]byte(`{"data":{"finalized":{"epoch":"281248","root":"0x0304"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	status := &eth.Status{ForkDigest: []byte{0x6a, 0x95, 0xa1, 0xa9}}
+	if err := fetchBeaconStatus(context.Background(), srv.URL+"/", status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.HeadSlot != 9000000 || status.FinalizedEpoch != 281248 {
+		t.Errorf("unexpected head slot %d or finalized epoch %d", status.HeadSlot, status.FinalizedEpoch)
+	}
+	if string(status.HeadRoot) != "\x01\x02" || string(status.FinalizedRoot) != "\x03\x04" {
+		t.Errorf("unexpected roots %x and %x", status.HeadRoot, status.FinalizedRoot)
+	}
+
+	srv.Close()
+	if err := fetchBeaconStatus(context.Background(), srv.URL, status); err == nil {
+		t.Error("expected an error with the beacon API down")
+	}
+}
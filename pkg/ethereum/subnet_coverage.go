@@ -0,0 +1,71 @@
+package ethereum
+
+import (
+	"strconv"
+
+	"github.com/prysmaticlabs/go-bitfield"
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+// attnetSubnetCount is the number of attestation subnets.
+const attnetSubnetCount = 64
+
+// updateSubnetCoverage moves a peer from the subnets in `prev` to the ones in `next`, and
+// updates the gauges of the subnets that changed. nil attnets stand for a peer that isn't
+// counted. The lock must be held.
+func (p *Peerstore) updateSubnetCoverage(prev, next bitfield.Bitvector64) {
+	for i := uint64(0); i < attnetSubnetCount; i++ {
+		was, is := prev.BitAt(i), next.BitAt(i)
+		if was == is {
+			continue
+		}
+
+		if is {
+			p.subnetPeers[i]++
+		} else {
+			p.subnetPeers[i]--
+		}
+
+		attnetPeerCount.WithLabelValues(strconv.FormatUint(i, 10)).Set(float64(p.subnetPeers[i]))
+	}
+}
+
+// removeFromSubnetCoverage stops counting a peer that left the peerstore. The lock must be
+// held.
+func (p *Peerstore) removeFromSubnetCoverage(info *PeerInfo) {
+	if info == nil {
+		return
+	}
+
+	md := info.metadata
+	if md == nil {
+		md = info.lastMetadata
+	}
+
+	p.updateSubnetCoverage(metadataAttnets(md), nil)
+}
+
+// SubnetCoverage returns the number of peers in the peerstore whose last metadata has each
+// attestation subnet set.
+func (p *Peerstore) SubnetCoverage() [attnetSubnetCount]int {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.subnetPeers
+}
+
+// resetSubnetCoverageGauges exports all subnets, so the ones without any peer show up at 0.
+func resetSubnetCoverageGauges() {
+	for i := 0; i < attnetSubnetCount; i++ {
+		attnetPeerCount.WithLabelValues(strconv.Itoa(i)).Set(0)
+	}
+}
+
+// metadataAttnets returns the attnets of the metadata, or nil without metadata.
+func metadataAttnets(md *eth.MetaDataV1) bitfield.Bitvector64 {
+	if md == nil {
+		return nil
+	}
+
+	return md.Attnets
+}
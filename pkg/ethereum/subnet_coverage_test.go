@@ -0,0 +1,75 @@
+package ethereum
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prysmaticlabs/go-bitfield"
+	eth "github.com/prysmaticlabs/prysm/v5/proto/prysm/v1alpha1"
+)
+
+func attnets(subnets ...uint64) *eth.MetaDataV1 {
+	b := bitfield.NewBitvector64()
+	for _, s := range subnets {
+		b.SetBitAt(s, true)
+	}
+
+	return &eth.MetaDataV1{Attnets: b}
+}
+
+func TestSubnetCoverage(t *testing.T) {
+	p := NewPeerstore(time.Minute, 2, 0)
+
+	p.Insert(peer.ID("a"), nil, enode.Node{})
+	p.SetMetadata(peer.ID("a"), attnets(1, 2))
+	p.Insert(peer.ID("b"), nil, enode.Node{})
+	p.SetMetadata(peer.ID("b"), attnets(2, 3))
+
+	check := func(want map[int]int) {
+		t.Helper()
+
+		coverage := p.SubnetCoverage()
+		for subnet, count := range coverage {
+			if count != want[subnet] {
+				t.Errorf("subnet %d: expected %d peers, got %d", subnet, want[subnet], count)
+			}
+		}
+	}
+
+	check(map[int]int{1: 1, 2: 2, 3: 1})
+
+	// The metadata is kept across handshakes, and replaced by the next one
+	p.Reset(peer.ID("a"))
+	check(map[int]int{1: 1, 2: 2, 3: 1})
+	p.SetMetadata(peer.ID("a"), attnets(4))
+	check(map[int]int{2: 1, 3: 1, 4: 1})
+
+	// Evicts b, the least recently used peer
+	p.Insert(peer.ID("c"), nil, enode.Node{})
+	check(map[int]int{4: 1})
+}
+
+func TestReuseMetadata(t *testing.T) {
+	p := NewPeerstore(time.Minute, 2, 0)
+	p.Insert(peer.ID("a"), nil, enode.Node{})
+
+	if md := p.ReuseMetadata(peer.ID("a"), time.Hour); md != nil {
+		t.Fatal("reused metadata that was never received")
+	}
+
+	p.SetMetadata(peer.ID("a"), attnets(1))
+	p.Reset(peer.ID("a"))
+
+	if md := p.ReuseMetadata(peer.ID("a"), time.Hour); md == nil || !md.Attnets.BitAt(1) {
+		t.Fatal("didn't reuse the metadata received within the cooldown")
+	}
+	if coverage := p.SubnetCoverage(); coverage[1] != 1 {
+		t.Errorf("subnet 1: expected 1 peer, got %d", coverage[1])
+	}
+
+	if md := p.ReuseMetadata(peer.ID("a"), 0); md != nil {
+		t.Fatal("reused metadata received before the cooldown")
+	}
+}
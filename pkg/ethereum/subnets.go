@@ -0,0 +1,68 @@
+package ethereum
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+// syncnetSubnetCount is the number of sync committee subnets.
+const syncnetSubnetCount = 4
+
+// parseSubnets returns the subnets of a spec, which is "all", "none" or a comma-separated
+// list of subnet indices below `count`.
+func parseSubnets(spec string, count uint64) ([]uint64, error) {
+	switch spec {
+	case "all":
+		subnets := make([]uint64, count)
+		for i := range subnets {
+			subnets[i] = uint64(i)
+		}
+		return subnets, nil
+	case "", "none":
+		return nil, nil
+	}
+
+	var subnets []uint64
+	for _, s := range strings.Split(spec, ",") {
+		idx, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil || idx >= count {
+			return nil, fmt.Errorf("invalid subnet %q: must be 'all', 'none' or indices below %d", s, count)
+		}
+		subnets = append(subnets, idx)
+	}
+
+	return subnets, nil
+}
+
+// attnetsBitfield returns the attnets the sentry advertises for an --attnets spec.
+func attnetsBitfield(spec string) (bitfield.Bitvector64, error) {
+	subnets, err := parseSubnets(spec, attnetSubnetCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attnets: %w", err)
+	}
+
+	bits := bitfield.NewBitvector64()
+	for _, idx := range subnets {
+		bits.SetBitAt(idx, true)
+	}
+
+	return bits, nil
+}
+
+// syncnetsBitfield returns the syncnets the sentry advertises for a --syncnets spec.
+func syncnetsBitfield(spec string) (bitfield.Bitvector4, error) {
+	subnets, err := parseSubnets(spec, syncnetSubnetCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syncnets: %w", err)
+	}
+
+	bits := bitfield.NewBitvector4()
+	for _, idx := range subnets {
+		bits.SetBitAt(idx, true)
+	}
+
+	return bits, nil
+}
@@ -0,0 +1,52 @@
+package ethereum
+
+import (
+	"testing"
+)
+
+func TestParseSubnets(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    int
+		wantErr bool
+	}{
+		{spec: "all", want: 64},
+		{spec: "none", want: 0},
+		{spec: "", want: 0},
+		{spec: "0, 5,63", want: 3},
+		{spec: "64", wantErr: true},
+		{spec: "one", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		subnets, err := parseSubnets(tt.spec, attnetSubnetCount)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%q: expected error %v, got %v", tt.spec, tt.wantErr, err)
+		}
+		if len(subnets) != tt.want {
+			t.Fatalf("%q: expected %d subnets, got %v", tt.spec, tt.want, subnets)
+		}
+	}
+}
+
+func TestSubnetBitfields(t *testing.T) {
+	attnets, err := attnetsBitfield("1,63")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attnets.Count() != 2 || !attnets.BitAt(1) || !attnets.BitAt(63) || len(attnets.Bytes()) != 8 {
+		t.Fatalf("unexpected attnets %#x", attnets.Bytes())
+	}
+
+	syncnets, err := syncnetsBitfield("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if syncnets.Count() != 4 || len(syncnets.Bytes()) != 1 {
+		t.Fatalf("unexpected syncnets %#x", syncnets.Bytes())
+	}
+
+	if _, err := syncnetsBitfield("4"); err == nil {
+		t.Fatal("expected an error for syncnet 4")
+	}
+}
@@ -0,0 +1,165 @@
+package ethereum
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chainbound/valtrack/types"
+	"github.com/chainbound/valtrack/version"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// ipTracker tracks the peer IDs each public IP presented within a window, to catch nodes
+// rotating their identity. Many IDs behind one IP are common with NAT or shared hosting,
+// but those nodes each listen on their own port: an IP is only reported when one of its
+// ports served more than one peer ID.
+type ipTracker struct {
+	threshold int
+	window    time.Duration
+
+	mu        sync.Mutex
+	ips       map[string]*ipPeers
+	lastPrune time.Time
+}
+
+type ipPeers struct {
+	peers    map[peer.ID]ipSighting
+	reported time.Time
+}
+
+type ipSighting struct {
+	port int64
+	seen time.Time
+}
+
+func newIPTracker(threshold int, window time.Duration) *ipTracker {
+	return &ipTracker{threshold: threshold, window: window, ips: make(map[string]*ipPeers)}
+}
+
+// observe records that a peer was seen on addr, and returns the event to publish if its IP
+// crossed the threshold. An IP is reported at most once per window.
+func (t *ipTracker) observe(pid peer.ID, addr ma.Multiaddr, now time.Time) *types.SuspiciousPeerEvent {
+	if addr == nil || !manet.IsPublicAddr(addr) {
+		return nil
+	}
+
+	ip, err := addr.ValueForProtocol(ma.P_IP4)
+	if err != nil {
+		if ip, err = addr.ValueForProtocol(ma.P_IP6); err != nil {
+			return nil
+		}
+	}
+
+	var port int64
+	if value, err := addr.ValueForProtocol(ma.P_TCP); err == nil {
+		port, _ = strconv.ParseInt(value, 10, 64)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(now)
+
+	entry, ok := t.ips[ip]
+	if !ok {
+		entry = &ipPeers{peers: make(map[peer.ID]ipSighting)}
+		t.ips[ip] = entry
+	}
+	entry.expire(now.Add(-t.window))
+	entry.peers[pid] = ipSighting{port: port, seen: now}
+
+	if len(entry.peers) < t.threshold || now.Sub(entry.reported) < t.window {
+		return nil
+	}
+
+	ports := make(map[int64]struct{}, len(entry.peers))
+	peerIDs := make([]string, 0, len(entry.peers))
+	for id, sighting := range entry.peers {
+		ports[sighting.port] = struct{}{}
+		peerIDs = append(peerIDs, id.String())
+	}
+
+	// Every peer ID on its own port, likely distinct nodes sharing a host
+	if len(ports) == len(entry.peers) {
+		return nil
+	}
+
+	entry.reported = now
+
+	event := &types.SuspiciousPeerEvent{
+		IP:        ip,
+		PeerIDs:   peerIDs,
+		WindowMs:  t.window.Milliseconds(),
+		Timestamp: now.UnixMilli(),
+	}
+	for port := range ports {
+		event.Ports = append(event.Ports, port)
+	}
+	sort.Strings(event.PeerIDs)
+	sort.Slice(event.Ports, func(i, j int) bool { return event.Ports[i] < event.Ports[j] })
+
+	return event
+}
+
+// prune drops the IPs without sightings in the window, at most once per window.
+func (t *ipTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.window {
+		return
+	}
+	t.lastPrune = now
+
+	cutoff := now.Add(-t.window)
+	for ip, entry := range t.ips {
+		entry.expire(cutoff)
+		if len(entry.peers) == 0 && entry.reported.Before(cutoff) {
+			delete(t.ips, ip)
+		}
+	}
+}
+
+// expire drops the sightings from before cutoff.
+func (p *ipPeers) expire(cutoff time.Time) {
+	for id, sighting := range p.peers {
+		if sighting.seen.Before(cutoff) {
+			delete(p.peers, id)
+		}
+	}
+}
+
+// observePeerAddr reports the IP of a peer as suspicious if it crossed the threshold.
+func (n *Node) observePeerAddr(pid peer.ID, addr ma.Multiaddr) {
+	if n.ipTracker == nil {
+		return
+	}
+
+	if event := n.ipTracker.observe(pid, addr, time.Now()); event != nil {
+		suspiciousPeerIPs.Inc()
+		n.log.Warn().Str("ip", event.IP).Strs("peer_ids", event.PeerIDs).Msg("IP served many peer IDs")
+		n.sendSuspiciousPeerEvent(event)
+	}
+}
+
+// sendSuspiciousPeerEvent doesn't block, it's called from the connection notifiee.
+func (n *Node) sendSuspiciousPeerEvent(event *types.SuspiciousPeerEvent) {
+	event.CrawlerID = getCrawlerMachineID()
+	event.CrawlerLoc = getCrawlerLocation()
+	event.CrawlerVer = version.Short()
+	event.ClockOffsetMs, event.ClockSynced = getClockOffset()
+	event.SchemaVersion = EventSchemaVersion
+
+	if n.js == nil {
+		n.fileLogger.Log().Str("type", types.EventSuspiciousPeer).Any("event", event).Send()
+		return
+	}
+
+	select {
+	case n.suspiciousPeerChan <- event:
+		n.log.Trace().Str("ip", event.IP).Msg("Sent suspicious_peer event to channel")
+	default:
+		n.dialAddrLog.Warn().Msg("Channel full, dropped suspicious_peer event")
+	}
+}
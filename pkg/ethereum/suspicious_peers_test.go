@@ -0,0 +1,64 @@
+package ethereum
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestIPTracker(t *testing.T) {
+	now := time.Now()
+	addr := ma.StringCast("/ip4/8.8.8.8/tcp/9000")
+
+	tracker := newIPTracker(3, time.Hour)
+	for i, id := range []peer.ID{"a", "b"} {
+		if event := tracker.observe(id, addr, now.Add(time.Duration(i)*time.Minute)); event != nil {
+			t.Fatalf("expected no event below the threshold, got %+v", event)
+		}
+	}
+
+	event := tracker.observe("c", addr, now.Add(2*time.Minute))
+	if event == nil {
+		t.Fatal("expected an event at the threshold")
+	}
+	if event.IP != "8.8.8.8" || len(event.PeerIDs) != 3 || len(event.Ports) != 1 || event.Ports[0] != 9000 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// Reported once per window
+	if event := tracker.observe("d", addr, now.Add(3*time.Minute)); event != nil {
+		t.Fatalf("expected no event within the window, got %+v", event)
+	}
+
+	// The sightings expired, the peer IDs are counted again
+	if event := tracker.observe("e", addr, now.Add(2*time.Hour)); event != nil {
+		t.Fatalf("expected no event after the sightings expired, got %+v", event)
+	}
+}
+
+func TestIPTrackerSharedHost(t *testing.T) {
+	now := time.Now()
+	tracker := newIPTracker(3, time.Hour)
+
+	// Distinct nodes behind one IP, each on its own port
+	for i, s := range []string{"/ip4/8.8.8.8/tcp/9000", "/ip4/8.8.8.8/tcp/9001", "/ip4/8.8.8.8/tcp/9002"} {
+		if event := tracker.observe(peer.ID(s), ma.StringCast(s), now.Add(time.Duration(i)*time.Second)); event != nil {
+			t.Fatalf("expected no event for distinct ports, got %+v", event)
+		}
+	}
+
+	// A port serving a second peer ID is reported
+	if event := tracker.observe("other", ma.StringCast("/ip4/8.8.8.8/tcp/9000"), now.Add(time.Minute)); event == nil {
+		t.Fatal("expected an event once a port served two peer IDs")
+	}
+}
+
+func TestIPTrackerPrivateAddr(t *testing.T) {
+	tracker := newIPTracker(1, time.Hour)
+
+	if event := tracker.observe("a", ma.StringCast("/ip4/192.168.1.1/tcp/9000"), time.Now()); event != nil {
+		t.Fatalf("expected private addresses to be skipped, got %+v", event)
+	}
+}
@@ -22,6 +22,21 @@ func getCrawlerMachineID() string {
 	return "FLY_MACHINE_ID"
 }
 
+// ParseMaddrs parses a list of multiaddr strings, failing on the first invalid one.
+func ParseMaddrs(addrs []string) ([]ma.Multiaddr, error) {
+	maddrs := make([]ma.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %q: %w", addr, err)
+		}
+
+		maddrs = append(maddrs, maddr)
+	}
+
+	return maddrs, nil
+}
+
 // MaddrFrom takes in an ip address string and port to produce a go multiaddr format.
 func MaddrFrom(ip string, port uint) (ma.Multiaddr, error) {
 	parsed := net.ParseIP(ip)
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+// The NATS headers the crawler fields of compact events are sent in.
+const (
+	CrawlerIDHeader       = "Valtrack-Crawler-Id"
+	CrawlerLocationHeader = "Valtrack-Crawler-Location"
+	CrawlerVersionHeader  = "Valtrack-Crawler-Version"
+)
+
+// compactMetadataEvent is the compact encoding of a MetadataReceivedEvent: short keys,
+// empty fields left out, and without the crawler fields.
+type compactMetadataEvent struct {
+	ENR               string   `json:"e,omitempty"`
+	ID                string   `json:"i"`
+	Multiaddr         string   `json:"m,omitempty"`
+	Multiaddrs        []string `json:"ms,omitempty"`
+	PrivateAddr       bool     `json:"pa,omitempty"`
+	RemoteAddr        string   `json:"ra,omitempty"`
+	Direction         string   `json:"d,omitempty"`
+	Partial           string   `json:"p,omitempty"`
+	Epoch             int      `json:"ep,omitempty"`
+	SeqNumber         *int64   `json:"sq,omitempty"`
+	Attnets           []byte   `json:"an,omitempty"`
+	Syncnets          []byte   `json:"sn,omitempty"`
+	SubscribedSubnets []int64  `json:"ss,omitempty"`
+	ClientVersion     string   `json:"cv,omitempty"`
+	PingLatencyMs     int64    `json:"pl,omitempty"`
+	PingMinLatencyMs  int64    `json:"pm,omitempty"`
+	Protocols         []string `json:"pr,omitempty"`
+	Timestamp         int64    `json:"t"`
+	ClockOffsetMs     int64    `json:"co,omitempty"`
+	ClockSynced       bool     `json:"cs,omitempty"`
+	SchemaVersion     int      `json:"v"`
+	ObservedAt        int64    `json:"oa,omitempty"`
+	BeaconConnected   bool     `json:"bc,omitempty"`
+}
+
+// MarshalCompact encodes the event in the compact wire format. The crawler fields are
+// left out, the publisher sends them in the crawler headers.
+func (e *MetadataReceivedEvent) MarshalCompact() ([]byte, error) {
+	c := compactMetadataEvent{
+		ENR:               e.ENR,
+		ID:                e.ID,
+		Multiaddr:         e.Multiaddr,
+		Multiaddrs:        e.Multiaddrs,
+		PrivateAddr:       e.PrivateAddr,
+		RemoteAddr:        e.RemoteAddr,
+		Direction:         e.Direction,
+		Partial:           e.Partial,
+		Epoch:             e.Epoch,
+		SubscribedSubnets: e.SubscribedSubnets,
+		ClientVersion:     e.ClientVersion,
+		PingLatencyMs:     e.PingLatencyMs,
+		PingMinLatencyMs:  e.PingMinLatencyMs,
+		Protocols:         e.Protocols,
+		Timestamp:         e.Timestamp,
+		ClockOffsetMs:     e.ClockOffsetMs,
+		ClockSynced:       e.ClockSynced,
+		SchemaVersion:     e.SchemaVersion,
+		ObservedAt:        e.ObservedAt,
+		BeaconConnected:   e.BeaconConnected,
+	}
+
+	// A nil SeqNumber distinguishes missing metadata from sequence number 0
+	if e.MetaData != nil {
+		c.SeqNumber = &e.MetaData.SeqNumber
+		c.Attnets = e.MetaData.Attnets
+		c.Syncnets = e.MetaData.Syncnets
+	}
+
+	return json.Marshal(c)
+}
+
+// UnmarshalCompact decodes an event in the compact wire format. The crawler fields have
+// to be set from the crawler headers.
+func (e *MetadataReceivedEvent) UnmarshalCompact(data []byte) error {
+	var c compactMetadataEvent
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+
+	*e = MetadataReceivedEvent{
+		ENR:               c.ENR,
+		ID:                c.ID,
+		Multiaddr:         c.Multiaddr,
+		Multiaddrs:        c.Multiaddrs,
+		PrivateAddr:       c.PrivateAddr,
+		RemoteAddr:        c.RemoteAddr,
+		Direction:         c.Direction,
+		Partial:           c.Partial,
+		Epoch:             c.Epoch,
+		SubscribedSubnets: c.SubscribedSubnets,
+		ClientVersion:     c.ClientVersion,
+		PingLatencyMs:     c.PingLatencyMs,
+		PingMinLatencyMs:  c.PingMinLatencyMs,
+		Protocols:         c.Protocols,
+		Timestamp:         c.Timestamp,
+		ClockOffsetMs:     c.ClockOffsetMs,
+		ClockSynced:       c.ClockSynced,
+		SchemaVersion:     c.SchemaVersion,
+		ObservedAt:        c.ObservedAt,
+		BeaconConnected:   c.BeaconConnected,
+	}
+
+	if c.SeqNumber != nil {
+		e.MetaData = &SimpleMetaData{
+			SeqNumber: *c.SeqNumber,
+			Attnets:   bitfield.Bitvector64(c.Attnets),
+			Syncnets:  bitfield.Bitvector4(c.Syncnets),
+		}
+	}
+
+	return nil
+}
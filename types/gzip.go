@@ -0,0 +1,53 @@
+package types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// ContentEncodingHeader is the NATS header set to ContentEncodingGzip on messages with a
+// gzipped payload. Messages without it aren't compressed.
+const ContentEncodingHeader = "Content-Encoding"
+
+const ContentEncodingGzip = "gzip"
+
+// maxGunzipSize is the largest decompressed payload accepted, far above any event.
+const maxGunzipSize = 16 * 1024 * 1024
+
+// Gzip compresses an event payload.
+func Gzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Gunzip decompresses an event payload compressed with Gzip.
+func Gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(zr, maxGunzipSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) > maxGunzipSize {
+		return nil, fmt.Errorf("decompressed payload larger than %d bytes", maxGunzipSize)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	event := &PeerDiscoveredEvent{
+		ENR:           "enr:-Ly4QOS00hvPDddEcCpwA1cMykWNdJUK50AjbRgbLZ9FLPyBa78i0NwsQZLSV67elpJU71L1Pt9yqVmE1C6XeSI-LV8Bh2F0dG5ldHOIAAAAAAAAAACEZXRoMpDuKNezAAAAckYFAAAAAAAAgmlkgnY0gmlwhEDhTgGJc2VjcDI1NmsxoQIgMUMFvJGlr8dI1TEQy-K78u2TJE2rWvah9nGqLQCEGohzeW5jbmV0cwCDdGNwgiMog3VkcIIjKA",
+		ID:            "16Uiu2HAm7Uf3hDqVxKxwkJxyqUaHxyd1GHHbD9LHJUYHs4pDb4Eb",
+		IP:            "64.225.78.1",
+		Port:          9000,
+		EnrSeq:        3,
+		CrawlerID:     "crawler",
+		CrawlerLoc:    "DE",
+		CrawlerVer:    "v0.1.0",
+		Timestamp:     1717200000000,
+		SchemaVersion: 8,
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := Gzip(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ratio := float64(len(compressed)) / float64(len(data))
+	t.Logf("peer_discovered: %d bytes, gzipped %d bytes (ratio %.2f)", len(data), len(compressed), ratio)
+
+	if ratio >= 1 {
+		t.Fatalf("expected gzip to shrink the event, ratio %.2f", ratio)
+	}
+
+	got, err := Gunzip(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("expected %s, got %s", data, got)
+	}
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// msgID hashes the given parts into a deterministic NATS message ID.
+func msgID(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(h[:])
+}
+
+// MsgID returns the deduplication ID of the event. It only changes when the peer
+// publishes a new ENR (which bumps its sequence number), so republishing the same
+// discovery from the same crawler is dropped by the stream.
+func (e *PeerDiscoveredEvent) MsgID() string {
+	return msgID(EventPeerDiscovered, e.CrawlerID, e.ID, e.ENR)
+}
+
+// MsgID returns the deduplication ID of the event, derived from the peer ID, the
+// sequence number of its metadata, the direction and whether the event is partial, so
+// the partial event of a failed status doesn't collide with the full one of a handshake.
+func (e *MetadataReceivedEvent) MsgID() string {
+	var seq int64
+	if e.MetaData != nil {
+		seq = e.MetaData.SeqNumber
+	}
+
+	return msgID(EventMetadataReceived, e.CrawlerID, e.ID, strconv.FormatInt(seq, 10), e.Direction, e.Partial)
+}
+
+// MsgID returns the deduplication ID of the event, derived from its timestamp.
+func (e *HeartbeatEvent) MsgID() string {
+	return msgID(EventHeartbeat, e.CrawlerID, strconv.FormatInt(e.Timestamp, 10))
+}
+
+// MsgID returns the deduplication ID of the event, derived from its timestamp.
+func (e *ClientDiversitySnapshotEvent) MsgID() string {
+	return msgID(EventClientDiversity, e.CrawlerID, strconv.FormatInt(e.Timestamp, 10))
+}
+
+// MsgID returns the deduplication ID of the event, derived from the peer ID and the
+// old and new metadata sequence numbers.
+func (e *AttnetsChangedEvent) MsgID() string {
+	return msgID(EventAttnetsChanged, e.CrawlerID, e.ID, strconv.FormatInt(e.OldSeqNumber, 10), strconv.FormatInt(e.NewSeqNumber, 10))
+}
+
+// MsgID returns the deduplication ID of the event, derived from the peer ID, the address
+// and its timestamp. The backoff counter isn't unique: it's 0 for inbound peers, and
+// for failures retried on another address.
+func (e *HandshakeFailedEvent) MsgID() string {
+	return msgID(EventHandshakeFailed, e.CrawlerID, e.ID, e.Multiaddr, strconv.FormatInt(e.Timestamp, 10))
+}
+
+// MsgID returns the deduplication ID of the event, derived from the IP address and its
+// timestamp.
+func (e *SuspiciousPeerEvent) MsgID() string {
+	return msgID(EventSuspiciousPeer, e.CrawlerID, e.IP, strconv.FormatInt(e.Timestamp, 10))
+}
+
+// MsgID returns the deduplication ID of the event, derived from the peer ID, the
+// transition and its timestamp.
+func (e *PeerChurnEvent) MsgID() string {
+	return msgID(EventPeerChurn, e.CrawlerID, e.ID, e.Transition, strconv.FormatInt(e.Timestamp, 10))
+}
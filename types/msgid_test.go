@@ -0,0 +1,32 @@
+package types
+
+import "testing"
+
+func TestMsgIDsOfSeparateEvents(t *testing.T) {
+	full := &MetadataReceivedEvent{ID: "peer", Direction: DirectionOutbound, MetaData: &SimpleMetaData{SeqNumber: 3}}
+	partial := &MetadataReceivedEvent{ID: "peer", Direction: DirectionOutbound, Partial: PartialStatusFailed, MetaData: &SimpleMetaData{SeqNumber: 3}}
+	inbound := &MetadataReceivedEvent{ID: "peer", Direction: DirectionInbound, MetaData: &SimpleMetaData{SeqNumber: 3}}
+
+	if full.MsgID() == partial.MsgID() {
+		t.Error("expected the partial metadata event not to collide with the full one")
+	}
+	if full.MsgID() == inbound.MsgID() {
+		t.Error("expected the inbound metadata event not to collide with the outbound one")
+	}
+
+	first := &HandshakeFailedEvent{ID: "peer", Multiaddr: "/ip4/1.2.3.4/tcp/9000", Timestamp: 1000}
+	second := &HandshakeFailedEvent{ID: "peer", Multiaddr: "/ip4/1.2.3.4/tcp/9000", Timestamp: 2000}
+	other := &HandshakeFailedEvent{ID: "peer", Multiaddr: "/ip4/5.6.7.8/tcp/9000", Timestamp: 1000}
+
+	if first.MsgID() == second.MsgID() {
+		t.Error("expected separate handshake failures with the same backoff counter not to collide")
+	}
+	if first.MsgID() == other.MsgID() {
+		t.Error("expected handshake failures on separate addresses not to collide")
+	}
+
+	// A republished event keeps its ID
+	if again := *first; again.MsgID() != first.MsgID() {
+		t.Error("expected the same event to keep its ID")
+	}
+}
@@ -0,0 +1,305 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/prysmaticlabs/go-bitfield"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MarshalProto encodes the event as the PeerDiscoveredEvent message in events.proto.
+func (e *PeerDiscoveredEvent) MarshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, e.ENR)
+	b = appendString(b, 2, e.ID)
+	b = appendString(b, 3, e.IP)
+	b = appendInt(b, 4, int64(e.Port))
+	b = appendString(b, 5, e.CrawlerID)
+	b = appendString(b, 6, e.CrawlerLoc)
+	b = appendString(b, 7, e.CrawlerVer)
+	b = appendInt(b, 8, e.Timestamp)
+	b = appendInt(b, 9, int64(e.SchemaVersion))
+	b = appendInt(b, 10, e.ClockOffsetMs)
+	b = appendBool(b, 11, e.ClockSynced)
+	b = appendInt(b, 12, e.EnrSeq)
+	b = appendInt(b, 13, e.PrevEnrSeq)
+	b = appendInt(b, 14, int64(e.Distance))
+	b = appendInt(b, 15, int64(e.IPVersion))
+	b = appendString(b, 16, e.Source)
+	b = appendInt(b, 17, e.ObservedAt)
+	b = appendBool(b, 18, e.BeaconConnected)
+	return b
+}
+
+// UnmarshalProto decodes the PeerDiscoveredEvent message in events.proto into the event.
+func (e *PeerDiscoveredEvent) UnmarshalProto(data []byte) error {
+	return rangeFields(data, func(num protowire.Number, typ protowire.Type, v uint64, bs []byte) error {
+		switch num {
+		case 1:
+			e.ENR = string(bs)
+		case 2:
+			e.ID = string(bs)
+		case 3:
+			e.IP = string(bs)
+		case 4:
+			e.Port = int(int32(v))
+		case 5:
+			e.CrawlerID = string(bs)
+		case 6:
+			e.CrawlerLoc = string(bs)
+		case 7:
+			e.CrawlerVer = string(bs)
+		case 8:
+			e.Timestamp = int64(v)
+		case 9:
+			e.SchemaVersion = int(int32(v))
+		case 10:
+			e.ClockOffsetMs = int64(v)
+		case 11:
+			e.ClockSynced = v != 0
+		case 12:
+			e.EnrSeq = int64(v)
+		case 13:
+			e.PrevEnrSeq = int64(v)
+		case 14:
+			e.Distance = int(v)
+		case 15:
+			e.IPVersion = int(int32(v))
+		case 16:
+			e.Source = string(bs)
+		case 17:
+			e.ObservedAt = int64(v)
+		case 18:
+			e.BeaconConnected = v != 0
+		}
+		return nil
+	})
+}
+
+// MarshalProto encodes the event as the MetadataReceivedEvent message in events.proto.
+func (e *MetadataReceivedEvent) MarshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, e.ENR)
+	b = appendString(b, 2, e.ID)
+	b = appendString(b, 3, e.Multiaddr)
+	for _, addr := range e.Multiaddrs {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, addr)
+	}
+	b = appendBool(b, 5, e.PrivateAddr)
+	b = appendInt(b, 6, int64(e.Epoch))
+	if e.MetaData != nil {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, e.MetaData.marshalProto())
+	}
+	b = appendPacked(b, 8, e.SubscribedSubnets)
+	b = appendString(b, 9, e.ClientVersion)
+	b = appendInt(b, 10, e.PingLatencyMs)
+	b = appendInt(b, 11, e.PingMinLatencyMs)
+	for _, proto := range e.Protocols {
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendString(b, proto)
+	}
+	b = appendString(b, 13, e.CrawlerID)
+	b = appendString(b, 14, e.CrawlerLoc)
+	b = appendString(b, 15, e.CrawlerVer)
+	b = appendInt(b, 16, e.Timestamp)
+	b = appendInt(b, 17, int64(e.SchemaVersion))
+	b = appendInt(b, 18, e.ClockOffsetMs)
+	b = appendBool(b, 19, e.ClockSynced)
+	b = appendString(b, 20, e.RemoteAddr)
+	b = appendString(b, 21, e.Direction)
+	b = appendString(b, 22, e.Partial)
+	b = appendInt(b, 23, e.ObservedAt)
+	b = appendBool(b, 24, e.BeaconConnected)
+	return b
+}
+
+// UnmarshalProto decodes the MetadataReceivedEvent message in events.proto into the event.
+func (e *MetadataReceivedEvent) UnmarshalProto(data []byte) error {
+	return rangeFields(data, func(num protowire.Number, typ protowire.Type, v uint64, bs []byte) (err error) {
+		switch num {
+		case 1:
+			e.ENR = string(bs)
+		case 2:
+			e.ID = string(bs)
+		case 3:
+			e.Multiaddr = string(bs)
+		case 4:
+			e.Multiaddrs = append(e.Multiaddrs, string(bs))
+		case 5:
+			e.PrivateAddr = v != 0
+		case 6:
+			e.Epoch = int(int32(v))
+		case 7:
+			e.MetaData = new(SimpleMetaData)
+			err = e.MetaData.unmarshalProto(bs)
+		case 8:
+			e.SubscribedSubnets, err = consumePacked(e.SubscribedSubnets, typ, v, bs)
+		case 9:
+			e.ClientVersion = string(bs)
+		case 10:
+			e.PingLatencyMs = int64(v)
+		case 11:
+			e.PingMinLatencyMs = int64(v)
+		case 12:
+			e.Protocols = append(e.Protocols, string(bs))
+		case 13:
+			e.CrawlerID = string(bs)
+		case 14:
+			e.CrawlerLoc = string(bs)
+		case 15:
+			e.CrawlerVer = string(bs)
+		case 16:
+			e.Timestamp = int64(v)
+		case 17:
+			e.SchemaVersion = int(int32(v))
+		case 18:
+			e.ClockOffsetMs = int64(v)
+		case 19:
+			e.ClockSynced = v != 0
+		case 20:
+			e.RemoteAddr = string(bs)
+		case 21:
+			e.Direction = string(bs)
+		case 22:
+			e.Partial = string(bs)
+		case 23:
+			e.ObservedAt = int64(v)
+		case 24:
+			e.BeaconConnected = v != 0
+		}
+		return err
+	})
+}
+
+func (m *SimpleMetaData) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, m.SeqNumber)
+	if len(m.Attnets) > 0 {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Attnets)
+	}
+	if len(m.Syncnets) > 0 {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Syncnets)
+	}
+	return b
+}
+
+func (m *SimpleMetaData) unmarshalProto(data []byte) error {
+	return rangeFields(data, func(num protowire.Number, _ protowire.Type, v uint64, bs []byte) error {
+		switch num {
+		case 1:
+			m.SeqNumber = int64(v)
+		case 2:
+			m.Attnets = append(bitfield.Bitvector64{}, bs...)
+		case 3:
+			m.Syncnets = append(bitfield.Bitvector4{}, bs...)
+		}
+		return nil
+	})
+}
+
+// appendString appends a string field, unless it's empty (the proto3 default).
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendBool appends a bool field, unless it's false (the proto3 default).
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+
+	return appendInt(b, num, 1)
+}
+
+// appendInt appends an int32 or int64 field, unless it's 0 (the proto3 default).
+// Negative values are sign-extended to 64 bits, like protobuf does for int32.
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendPacked appends a packed repeated int64 field, unless it's empty.
+func appendPacked(b []byte, num protowire.Number, vs []int64) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+
+	var packed []byte
+	for _, v := range vs {
+		packed = protowire.AppendVarint(packed, uint64(v))
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+// consumePacked appends the values of a repeated int64 field to dst. Decoders must accept
+// both the packed and the unpacked encoding.
+func consumePacked(dst []int64, typ protowire.Type, v uint64, bs []byte) ([]int64, error) {
+	if typ == protowire.VarintType {
+		return append(dst, int64(v)), nil
+	}
+
+	for len(bs) > 0 {
+		x, n := protowire.ConsumeVarint(bs)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		dst = append(dst, int64(x))
+		bs = bs[n:]
+	}
+
+	return dst, nil
+}
+
+// rangeFields calls fn with the value of every varint (v) and length-delimited (bs) field
+// in a message. Fields with other wire types aren't used by our messages and are skipped.
+func rangeFields(data []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, bs []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("invalid field tag: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		var (
+			v  uint64
+			bs []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			bs, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid field %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+
+		if err := fn(num, typ, v, bs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	discovered := &PeerDiscoveredEvent{
+		ENR:             "enr:-abc",
+		ID:              "16Uiu2HAm",
+		IP:              "1.2.3.4",
+		Port:            9000,
+		IPVersion:       4,
+		Source:          SourceDiscv5,
+		EnrSeq:          7,
+		PrevEnrSeq:      5,
+		Distance:        254,
+		CrawlerID:       "crawler",
+		CrawlerLoc:      "DE",
+		CrawlerVer:      "v0.1.0",
+		Timestamp:       1717200000000,
+		ClockOffsetMs:   -12,
+		ClockSynced:     true,
+		SchemaVersion:   5,
+		ObservedAt:      1717200000100,
+		BeaconConnected: true,
+	}
+
+	var gotDiscovered PeerDiscoveredEvent
+	if err := gotDiscovered.UnmarshalProto(discovered.MarshalProto()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*discovered, gotDiscovered) {
+		t.Fatalf("expected %+v, got %+v", *discovered, gotDiscovered)
+	}
+
+	metadata := &MetadataReceivedEvent{
+		ENR:         "enr:-abc",
+		ID:          "16Uiu2HAm",
+		Multiaddr:   "/ip4/1.2.3.4/tcp/9000",
+		Multiaddrs:  []string{"/ip4/1.2.3.4/tcp/9000", "/ip4/10.0.0.1/tcp/9000"},
+		RemoteAddr:  "/ip4/1.2.3.4/tcp/9000",
+		Direction:   DirectionInbound,
+		Partial:     PartialStatusFailed,
+		PrivateAddr: true,
+		Epoch:       -1,
+		MetaData: &SimpleMetaData{
+			SeqNumber: 42,
+			Attnets:   bitfield.Bitvector64{0x03, 0, 0, 0, 0, 0, 0, 0x80},
+			Syncnets:  bitfield.Bitvector4{0x01},
+		},
+		SubscribedSubnets: []int64{0, 1, 63},
+		ClientVersion:     "Lighthouse/v5.1.3",
+		PingLatencyMs:     12,
+		PingMinLatencyMs:  10,
+		Protocols:         []string{"/eth2/beacon_chain/req/status/1/ssz_snappy"},
+		CrawlerID:         "crawler",
+		Timestamp:         1717200000000,
+		ClockOffsetMs:     250,
+		ClockSynced:       true,
+		SchemaVersion:     5,
+		ObservedAt:        1717200000100,
+		BeaconConnected:   true,
+	}
+
+	var gotMetadata MetadataReceivedEvent
+	if err := gotMetadata.UnmarshalProto(metadata.MarshalProto()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*metadata, gotMetadata) {
+		t.Fatalf("expected %+v, got %+v", *metadata, gotMetadata)
+	}
+}
+
+func TestMarshalFallsBackToJSON(t *testing.T) {
+	_, format, err := Marshal(WireFormatProtobuf, &AttnetsChangedEvent{ID: "16Uiu2HAm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != WireFormatJSON {
+		t.Fatalf("expected %s, got %s", WireFormatJSON, format)
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	metadata := &MetadataReceivedEvent{
+		ID:        "16Uiu2HAm",
+		Multiaddr: "/ip4/1.2.3.4/tcp/9000",
+		Partial:   PartialStatusFailed,
+		MetaData: &SimpleMetaData{
+			Attnets:  bitfield.Bitvector64{0x03, 0, 0, 0, 0, 0, 0, 0x80},
+			Syncnets: bitfield.Bitvector4{0x01},
+		},
+		SubscribedSubnets: []int64{0, 1, 63},
+		CrawlerID:         "crawler",
+		CrawlerLoc:        "DE",
+		Timestamp:         1717200000000,
+		SchemaVersion:     5,
+		ObservedAt:        1717200000100,
+	}
+
+	data, format, err := Marshal(WireFormatCompact, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != WireFormatCompact {
+		t.Fatalf("expected %s, got %s", WireFormatCompact, format)
+	}
+
+	var got MetadataReceivedEvent
+	if err := Unmarshal(format, data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The crawler fields are sent in headers
+	got.CrawlerID, got.CrawlerLoc = metadata.CrawlerID, metadata.CrawlerLoc
+	if !reflect.DeepEqual(*metadata, got) {
+		t.Fatalf("expected %+v, got %+v", *metadata, got)
+	}
+}
@@ -0,0 +1,46 @@
+package types
+
+import "strings"
+
+// SubjectPrefix is the prefix of the NATS subjects all events are published on.
+const SubjectPrefix = "events."
+
+// The event types. The subject of an event is its type with the SubjectPrefix, and the
+// sentry's file log records the type of every event.
+const (
+	EventPeerDiscovered   = "peer_discovered"
+	EventMetadataReceived = "metadata_received"
+	EventAttnetsChanged   = "attnets_changed"
+	EventClientDiversity  = "client_diversity"
+	EventHeartbeat        = "heartbeat"
+	EventHandshakeFailed  = "handshake_failed"
+	EventSuspiciousPeer   = "suspicious_peer"
+	EventPeerChurn        = "peer_churn"
+)
+
+// The subjects of the event types.
+const (
+	SubjectPeerDiscovered   = SubjectPrefix + EventPeerDiscovered
+	SubjectMetadataReceived = SubjectPrefix + EventMetadataReceived
+	SubjectAttnetsChanged   = SubjectPrefix + EventAttnetsChanged
+	SubjectClientDiversity  = SubjectPrefix + EventClientDiversity
+	SubjectHeartbeat        = SubjectPrefix + EventHeartbeat
+	SubjectHandshakeFailed  = SubjectPrefix + EventHandshakeFailed
+	SubjectSuspiciousPeer   = SubjectPrefix + EventSuspiciousPeer
+	SubjectPeerChurn        = SubjectPrefix + EventPeerChurn
+)
+
+// Subject returns the subject events of the given type are published on.
+func Subject(eventType string) string {
+	return SubjectPrefix + eventType
+}
+
+// EventType returns the type of the events published on a subject.
+func EventType(subject string) string {
+	return strings.TrimPrefix(subject, SubjectPrefix)
+}
+
+// AllSubjects returns the subjects of all event types.
+func AllSubjects() []string {
+	return []string{SubjectMetadataReceived, SubjectPeerDiscovered, SubjectAttnetsChanged, SubjectClientDiversity, SubjectHeartbeat, SubjectHandshakeFailed, SubjectSuspiciousPeer, SubjectPeerChurn}
+}
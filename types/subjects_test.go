@@ -0,0 +1,29 @@
+package types
+
+import "testing"
+
+func TestSubjects(t *testing.T) {
+	subjects := map[string]string{
+		EventPeerDiscovered:   SubjectPeerDiscovered,
+		EventMetadataReceived: SubjectMetadataReceived,
+		EventAttnetsChanged:   SubjectAttnetsChanged,
+		EventClientDiversity:  SubjectClientDiversity,
+		EventHeartbeat:        SubjectHeartbeat,
+		EventHandshakeFailed:  SubjectHandshakeFailed,
+		EventSuspiciousPeer:   SubjectSuspiciousPeer,
+		EventPeerChurn:        SubjectPeerChurn,
+	}
+
+	if len(AllSubjects()) != len(subjects) {
+		t.Fatalf("expected %d subjects, got %v", len(subjects), AllSubjects())
+	}
+
+	for eventType, subject := range subjects {
+		if got := Subject(eventType); got != subject {
+			t.Errorf("Subject(%q) = %q, want %q", eventType, got, subject)
+		}
+		if got := EventType(subject); got != eventType {
+			t.Errorf("EventType(%q) = %q, want %q", subject, got, eventType)
+		}
+	}
+}
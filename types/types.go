@@ -27,22 +27,226 @@ type PeerDiscoveredEvent struct {
 	ID         string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8" json:"id" ch:"id"`
 	IP         string `parquet:"name=ip, type=BYTE_ARRAY, convertedtype=UTF8" json:"ip" ch:"ip"`
 	Port       int    `parquet:"name=port, type=INT32" json:"port" ch:"port"`
-	CrawlerID  string `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
-	CrawlerLoc string `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
-	Timestamp  int64  `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	IPVersion  int    `parquet:"name=ip_version, type=INT32" json:"ip_version" ch:"ip_version"`
+	Source     string `parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8" json:"source" ch:"source"`
+	EnrSeq     int64  `parquet:"name=enr_seq, type=INT64" json:"enr_seq" ch:"enr_seq"`
+	PrevEnrSeq int64  `parquet:"name=prev_enr_seq, type=INT64" json:"prev_enr_seq" ch:"prev_enr_seq"`
+	// Distance is the log2 distance between the peer's node ID and the sentry's (1-256)
+	Distance      int    `parquet:"name=distance, type=INT32" json:"distance" ch:"distance"`
+	CrawlerID     string `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
+	CrawlerLoc    string `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
+	CrawlerVer    string `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_version" ch:"crawler_version"`
+	Timestamp     int64  `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	ClockOffsetMs int64  `parquet:"name=clock_offset_ms, type=INT64" json:"clock_offset_ms" ch:"clock_offset_ms"`
+	ClockSynced   bool   `parquet:"name=clock_synced, type=BOOLEAN" json:"clock_synced" ch:"clock_synced"`
+	SchemaVersion int    `parquet:"name=schema_version, type=INT32" json:"schema_version" ch:"schema_version"`
+	// ObservedAt is when the sentry emitted the event, IngestedAt when the consumer received
+	// it, both in Unix milliseconds. IngestedAt is only set by the consumer.
+	ObservedAt int64 `parquet:"name=observed_at, type=INT64" json:"observed_at" ch:"observed_at"`
+	IngestedAt int64 `parquet:"name=ingested_at, type=INT64" json:"-" ch:"-"`
+	// BeaconConnected is set when the beacon node the sentry polls was connected to the peer
+	// when it was discovered. Always false without --beacon-api.
+	BeaconConnected bool `parquet:"name=beacon_connected, type=BOOLEAN" json:"beacon_connected" ch:"beacon_connected"`
+	// Raw is the payload (JSON or protobuf) the event was decoded from. Only set by the consumer with --store-raw.
+	Raw string `parquet:"name=raw, type=BYTE_ARRAY" json:"-" ch:"-"`
 }
 
+// The discovery sources of a PeerDiscoveredEvent. Events from before the source was
+// published have none, and were all found by discv5.
+const (
+	SourceDiscv5   = "discv5"
+	SourceGossipPX = "gossip-px"
+)
+
+// The directions of the connection a MetadataReceivedEvent was received on: outbound if we
+// dialed the peer, inbound if it dialed us. Its RemoteAddr is the address of that connection.
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// PartialStatusFailed is the Partial field of the metadata events of peers that answered the
+// metadata request but not the status one, so the event lacks the epoch and ping latencies.
+// Partial is empty for complete handshakes.
+const PartialStatusFailed = "status_failed"
+
 type MetadataReceivedEvent struct {
 	ENR               string          `parquet:"name=enr, type=BYTE_ARRAY, convertedtype=UTF8" json:"enr" ch:"enr"`
 	ID                string          `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8" json:"id" ch:"id"`
 	Multiaddr         string          `parquet:"name=multiaddr, type=BYTE_ARRAY, convertedtype=UTF8" json:"multiaddr" ch:"multiaddr"`
+	Multiaddrs        []string        `parquet:"name=multiaddrs, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" json:"multiaddrs" ch:"multiaddrs"`
+	PrivateAddr       bool            `parquet:"name=private_addr, type=BOOLEAN" json:"private_addr" ch:"private_addr"`
+	RemoteAddr        string          `parquet:"name=remote_addr, type=BYTE_ARRAY, convertedtype=UTF8" json:"remote_addr" ch:"remote_addr"`
+	Direction         string          `parquet:"name=direction, type=BYTE_ARRAY, convertedtype=UTF8" json:"direction" ch:"direction"`
+	Partial           string          `parquet:"name=partial, type=BYTE_ARRAY, convertedtype=UTF8" json:"partial" ch:"partial"`
 	Epoch             int             `parquet:"name=epoch, type=INT32" json:"epoch" ch:"epoch"`
 	MetaData          *SimpleMetaData `parquet:"name=metadata, type=BYTE_ARRAY, convertedtype=UTF8" json:"metadata" ch:"metadata"`
 	SubscribedSubnets []int64         `parquet:"name=subscribed_subnets, type=LIST, valuetype=INT64" json:"subscribed_subnets" ch:"subscribed_subnets"`
 	ClientVersion     string          `parquet:"name=client_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"client_version" ch:"client_version"`
+	PingLatencyMs     int64           `parquet:"name=ping_latency_ms, type=INT64" json:"ping_latency_ms" ch:"ping_latency_ms"`
+	PingMinLatencyMs  int64           `parquet:"name=ping_min_latency_ms, type=INT64" json:"ping_min_latency_ms" ch:"ping_min_latency_ms"`
+	Protocols         []string        `parquet:"name=protocols, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" json:"protocols" ch:"protocols"`
 	CrawlerID         string          `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
 	CrawlerLoc        string          `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
+	CrawlerVer        string          `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_version" ch:"crawler_version"`
 	Timestamp         int64           `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	ClockOffsetMs     int64           `parquet:"name=clock_offset_ms, type=INT64" json:"clock_offset_ms" ch:"clock_offset_ms"`
+	ClockSynced       bool            `parquet:"name=clock_synced, type=BOOLEAN" json:"clock_synced" ch:"clock_synced"`
+	SchemaVersion     int             `parquet:"name=schema_version, type=INT32" json:"schema_version" ch:"schema_version"`
+	// ObservedAt is when the sentry emitted the event, IngestedAt when the consumer received
+	// it, both in Unix milliseconds. Timestamp is when the peer was last seen. IngestedAt is
+	// only set by the consumer.
+	ObservedAt int64 `parquet:"name=observed_at, type=INT64" json:"observed_at" ch:"observed_at"`
+	IngestedAt int64 `parquet:"name=ingested_at, type=INT64" json:"-" ch:"-"`
+	// BeaconConnected is set when the beacon node the sentry polls was connected to the peer
+	// too. Always false without --beacon-api.
+	BeaconConnected bool `parquet:"name=beacon_connected, type=BOOLEAN" json:"beacon_connected" ch:"beacon_connected"`
+	// Raw is the payload (JSON or protobuf) the event was decoded from. Only set by the consumer with --store-raw.
+	Raw string `parquet:"name=raw, type=BYTE_ARRAY" json:"-" ch:"-"`
+}
+
+// AttnetsChangedEvent is emitted when a peer we handshaked with before advertises different
+// attestation subnets in its metadata.
+type AttnetsChangedEvent struct {
+	ENR            string  `parquet:"name=enr, type=BYTE_ARRAY, convertedtype=UTF8" json:"enr" ch:"enr"`
+	ID             string  `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8" json:"id" ch:"id"`
+	Multiaddr      string  `parquet:"name=multiaddr, type=BYTE_ARRAY, convertedtype=UTF8" json:"multiaddr" ch:"multiaddr"`
+	OldSeqNumber   int64   `parquet:"name=old_seq_number, type=INT64" json:"old_seq_number" ch:"old_seq_number"`
+	NewSeqNumber   int64   `parquet:"name=new_seq_number, type=INT64" json:"new_seq_number" ch:"new_seq_number"`
+	OldAttnets     string  `parquet:"name=old_attnets, type=BYTE_ARRAY, convertedtype=UTF8" json:"old_attnets" ch:"old_attnets"`
+	NewAttnets     string  `parquet:"name=new_attnets, type=BYTE_ARRAY, convertedtype=UTF8" json:"new_attnets" ch:"new_attnets"`
+	AddedSubnets   []int64 `parquet:"name=added_subnets, type=LIST, valuetype=INT64" json:"added_subnets" ch:"added_subnets"`
+	RemovedSubnets []int64 `parquet:"name=removed_subnets, type=LIST, valuetype=INT64" json:"removed_subnets" ch:"removed_subnets"`
+	CrawlerID      string  `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
+	CrawlerLoc     string  `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
+	CrawlerVer     string  `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_version" ch:"crawler_version"`
+	Timestamp      int64   `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	ClockOffsetMs  int64   `parquet:"name=clock_offset_ms, type=INT64" json:"clock_offset_ms" ch:"clock_offset_ms"`
+	ClockSynced    bool    `parquet:"name=clock_synced, type=BOOLEAN" json:"clock_synced" ch:"clock_synced"`
+	SchemaVersion  int     `parquet:"name=schema_version, type=INT32" json:"schema_version" ch:"schema_version"`
+	// Raw is the payload (JSON or protobuf) the event was decoded from. Only set by the consumer with --store-raw.
+	Raw string `parquet:"name=raw, type=BYTE_ARRAY" json:"-" ch:"-"`
+}
+
+// HandshakeFailedEvent is published when the handshake with a peer the crawler dialed
+// fails, with --record-handshake-failures. With --record-fork-mismatches, it is also
+// published for every peer (dialed or inbound) on another fork.
+type HandshakeFailedEvent struct {
+	ENR       string `parquet:"name=enr, type=BYTE_ARRAY, convertedtype=UTF8" json:"enr" ch:"enr"`
+	ID        string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8" json:"id" ch:"id"`
+	Multiaddr string `parquet:"name=multiaddr, type=BYTE_ARRAY, convertedtype=UTF8" json:"multiaddr" ch:"multiaddr"`
+	// Reason is the category of the failure, the same as the reason label of the
+	// handshake_failures_total metric
+	Reason string `parquet:"name=reason, type=BYTE_ARRAY, convertedtype=UTF8" json:"reason" ch:"reason"`
+	Error  string `parquet:"name=error, type=BYTE_ARRAY, convertedtype=UTF8" json:"error" ch:"error"`
+	// BackoffCounter is the number of consecutive failed handshakes with the peer, this one
+	// included. It's 0 for inbound peers, and when the next address of the peer is dialed.
+	BackoffCounter int64 `parquet:"name=backoff_counter, type=INT64" json:"backoff_counter" ch:"backoff_counter"`
+	// ForkDigest is the hex-encoded fork digest of the peer's status, empty if the handshake
+	// failed before the status
+	ForkDigest    string `parquet:"name=fork_digest, type=BYTE_ARRAY, convertedtype=UTF8" json:"fork_digest" ch:"fork_digest"`
+	CrawlerID     string `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
+	CrawlerLoc    string `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
+	CrawlerVer    string `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_version" ch:"crawler_version"`
+	Timestamp     int64  `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	ClockOffsetMs int64  `parquet:"name=clock_offset_ms, type=INT64" json:"clock_offset_ms" ch:"clock_offset_ms"`
+	ClockSynced   bool   `parquet:"name=clock_synced, type=BOOLEAN" json:"clock_synced" ch:"clock_synced"`
+	SchemaVersion int    `parquet:"name=schema_version, type=INT32" json:"schema_version" ch:"schema_version"`
+	// Raw is the payload (JSON or protobuf) the event was decoded from. Only set by the consumer with --store-raw.
+	Raw string `parquet:"name=raw, type=BYTE_ARRAY" json:"-" ch:"-"`
+}
+
+// SuspiciousPeerEvent is published when a public IP address served more distinct peer IDs
+// than the threshold within the window, with at least two of them on the same port, which
+// hints at a node rotating its identity (possible Sybil behavior).
+type SuspiciousPeerEvent struct {
+	IP string `parquet:"name=ip, type=BYTE_ARRAY, convertedtype=UTF8" json:"ip" ch:"ip"`
+	// PeerIDs are the distinct peer IDs seen on the IP within the window
+	PeerIDs []string `parquet:"name=peer_ids, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" json:"peer_ids" ch:"peer_ids"`
+	// Ports are the distinct TCP ports the peer IDs were seen on
+	Ports         []int64 `parquet:"name=ports, type=LIST, valuetype=INT64" json:"ports" ch:"ports"`
+	WindowMs      int64   `parquet:"name=window_ms, type=INT64" json:"window_ms" ch:"window_ms"`
+	CrawlerID     string  `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
+	CrawlerLoc    string  `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
+	CrawlerVer    string  `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_version" ch:"crawler_version"`
+	Timestamp     int64   `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	ClockOffsetMs int64   `parquet:"name=clock_offset_ms, type=INT64" json:"clock_offset_ms" ch:"clock_offset_ms"`
+	ClockSynced   bool    `parquet:"name=clock_synced, type=BOOLEAN" json:"clock_synced" ch:"clock_synced"`
+	SchemaVersion int     `parquet:"name=schema_version, type=INT32" json:"schema_version" ch:"schema_version"`
+	// Raw is the payload (JSON or protobuf) the event was decoded from. Only set by the consumer with --store-raw.
+	Raw string `parquet:"name=raw, type=BYTE_ARRAY" json:"-" ch:"-"`
+}
+
+// The transitions of a PeerChurnEvent.
+const (
+	ChurnConnected    = "connected"
+	ChurnDisconnected = "disconnected"
+)
+
+// PeerChurnEvent is published with --peer-churn-events when the sentry opens its first
+// connection to a peer, or closes its last one, whether or not they handshake. It's
+// finer-grained than the metadata events, to study how often peers reconnect.
+type PeerChurnEvent struct {
+	ID string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8" json:"id" ch:"id"`
+	// Transition is ChurnConnected or ChurnDisconnected
+	Transition string `parquet:"name=transition, type=BYTE_ARRAY, convertedtype=UTF8" json:"transition" ch:"transition"`
+	// Direction is the direction of the connection, DirectionInbound or DirectionOutbound
+	Direction string `parquet:"name=direction, type=BYTE_ARRAY, convertedtype=UTF8" json:"direction" ch:"direction"`
+	// Handshaked is set when the sentry completed a handshake with the peer before, on this
+	// connection included for disconnections
+	Handshaked bool `parquet:"name=handshaked, type=BOOLEAN" json:"handshaked" ch:"handshaked"`
+	// ConnectedMs is how long the connection lasted, only set on disconnections
+	ConnectedMs   int64  `parquet:"name=connected_ms, type=INT64" json:"connected_ms" ch:"connected_ms"`
+	CrawlerID     string `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
+	CrawlerLoc    string `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
+	CrawlerVer    string `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_version" ch:"crawler_version"`
+	Timestamp     int64  `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	ClockOffsetMs int64  `parquet:"name=clock_offset_ms, type=INT64" json:"clock_offset_ms" ch:"clock_offset_ms"`
+	ClockSynced   bool   `parquet:"name=clock_synced, type=BOOLEAN" json:"clock_synced" ch:"clock_synced"`
+	SchemaVersion int    `parquet:"name=schema_version, type=INT32" json:"schema_version" ch:"schema_version"`
+	// Raw is the payload (JSON or protobuf) the event was decoded from. Only set by the consumer with --store-raw.
+	Raw string `parquet:"name=raw, type=BYTE_ARRAY" json:"-" ch:"-"`
+}
+
+// HeartbeatEvent is published by every sentry at a fixed interval, so a sentry that is down
+// can be detected by the absence of its heartbeats.
+type HeartbeatEvent struct {
+	CrawlerID      string `parquet:"name=crawler_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_id" ch:"crawler_id"`
+	CrawlerLoc     string `parquet:"name=crawler_location, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_location" ch:"crawler_location"`
+	CrawlerVer     string `parquet:"name=crawler_version, type=BYTE_ARRAY, convertedtype=UTF8" json:"crawler_version" ch:"crawler_version"`
+	UptimeSeconds  int64  `parquet:"name=uptime_seconds, type=INT64" json:"uptime_seconds" ch:"uptime_seconds"`
+	ConnectedPeers int    `parquet:"name=connected_peers, type=INT32" json:"connected_peers" ch:"connected_peers"`
+	// IntervalMs is the interval of the heartbeats, the next one is due after it
+	IntervalMs    int64 `parquet:"name=interval_ms, type=INT64" json:"interval_ms" ch:"interval_ms"`
+	Timestamp     int64 `parquet:"name=timestamp, type=INT64" json:"timestamp" ch:"timestamp"`
+	ClockOffsetMs int64 `parquet:"name=clock_offset_ms, type=INT64" json:"clock_offset_ms" ch:"clock_offset_ms"`
+	ClockSynced   bool  `parquet:"name=clock_synced, type=BOOLEAN" json:"clock_synced" ch:"clock_synced"`
+	SchemaVersion int   `parquet:"name=schema_version, type=INT32" json:"schema_version" ch:"schema_version"`
+	// Raw is the payload (JSON or protobuf) the event was decoded from. Only set by the consumer with --store-raw.
+	Raw string `parquet:"name=raw, type=BYTE_ARRAY" json:"-" ch:"-"`
+}
+
+// ClientDiversitySnapshotEvent is a periodic snapshot of the consensus clients run by the
+// peers the crawler handshaked with.
+type ClientDiversitySnapshotEvent struct {
+	// SampleSize is the number of handshaked peers the snapshot was taken over
+	SampleSize    int           `json:"sample_size"`
+	Clients       []ClientShare `json:"clients"`
+	CrawlerID     string        `json:"crawler_id"`
+	CrawlerLoc    string        `json:"crawler_location"`
+	CrawlerVer    string        `json:"crawler_version"`
+	Timestamp     int64         `json:"timestamp"`
+	ClockOffsetMs int64         `json:"clock_offset_ms"`
+	ClockSynced   bool          `json:"clock_synced"`
+	SchemaVersion int           `json:"schema_version"`
+}
+
+// ClientShare is the number and percentage of peers in a ClientDiversitySnapshotEvent
+// that run a client.
+type ClientShare struct {
+	Client  string  `json:"client"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
 }
 
 type SimpleMetaData struct {
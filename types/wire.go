@@ -0,0 +1,84 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// WireFormat is the encoding of the events published on NATS.
+type WireFormat string
+
+const (
+	WireFormatJSON     WireFormat = "json"
+	WireFormatProtobuf WireFormat = "protobuf"
+	// WireFormatCompact is JSON with short keys and without the crawler fields, which are
+	// sent in the crawler headers instead. Only metadata_received events have it.
+	WireFormatCompact WireFormat = "compact"
+)
+
+// WireFormatHeader is the NATS header the wire format of an event is published in.
+// Messages without it are JSON.
+const WireFormatHeader = "Valtrack-Wire-Format"
+
+// ParseWireFormat returns the wire format with the given name.
+func ParseWireFormat(name string) (WireFormat, error) {
+	switch f := WireFormat(name); f {
+	case WireFormatJSON, WireFormatProtobuf, WireFormatCompact:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown wire format: %s", name)
+	}
+}
+
+// protoEvent is implemented by the events that have a protobuf encoding (see events.proto).
+type protoEvent interface {
+	MarshalProto() []byte
+	UnmarshalProto(data []byte) error
+}
+
+// compactEvent is implemented by the events that have a compact encoding.
+type compactEvent interface {
+	MarshalCompact() ([]byte, error)
+	UnmarshalCompact(data []byte) error
+}
+
+// Marshal encodes an event in the given wire format. Events without an encoding in that
+// format are encoded as JSON, so it returns the format that was actually used.
+func Marshal(format WireFormat, event any) ([]byte, WireFormat, error) {
+	switch format {
+	case WireFormatProtobuf:
+		if pe, ok := event.(protoEvent); ok {
+			return pe.MarshalProto(), WireFormatProtobuf, nil
+		}
+	case WireFormatCompact:
+		if ce, ok := event.(compactEvent); ok {
+			data, err := ce.MarshalCompact()
+			return data, WireFormatCompact, err
+		}
+	}
+
+	data, err := json.Marshal(event)
+	return data, WireFormatJSON, err
+}
+
+// Unmarshal decodes an event encoded in the given wire format into `event`.
+func Unmarshal(format WireFormat, data []byte, event any) error {
+	switch format {
+	case WireFormatJSON:
+		return json.Unmarshal(data, event)
+	case WireFormatProtobuf:
+		pe, ok := event.(protoEvent)
+		if !ok {
+			return fmt.Errorf("%T has no protobuf encoding", event)
+		}
+		return pe.UnmarshalProto(data)
+	case WireFormatCompact:
+		ce, ok := event.(compactEvent)
+		if !ok {
+			return fmt.Errorf("%T has no compact encoding", event)
+		}
+		return ce.UnmarshalCompact(data)
+	default:
+		return fmt.Errorf("unknown wire format: %s", format)
+	}
+}
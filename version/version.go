@@ -0,0 +1,86 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// These are set at build time through ldflags, e.g.
+// -ldflags "-X github.com/chainbound/valtrack/version.Commit=$(git rev-parse HEAD)"
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo describes the binary that is currently running.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Info returns the build info of the running binary. Values injected through
+// ldflags take precedence, anything missing is filled in from the module build info.
+func Info() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+
+	return info
+}
+
+// Short returns a compact version string, e.g. "v0.1.0-3f2a1b9c". It's computed once, as
+// it's set on every published event.
+func Short() string {
+	return short()
+}
+
+var short = sync.OnceValue(func() string {
+	info := Info()
+	commit := info.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+
+	return fmt.Sprintf("%s-%s", info.Version, commit)
+})
+
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("version: %s\ncommit: %s\nbuild date: %s\ngo version: %s", b.Version, b.Commit, b.BuildDate, b.GoVersion)
+}